@@ -0,0 +1,718 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/api/sheets/v4"
+)
+
+const (
+	// names at least this similar are treated as the same name
+	adoptMinNameSimilarity = 0.8
+	// a name contained in another counts as a match when it has at least this many characters
+	adoptMinContainedNameLength = 4
+	// the header row of an adopted sheet is looked for in its first rows
+	adoptHeaderSearchRows = 5
+)
+
+var spreadsheetURLRegexp = regexp.MustCompile(`/spreadsheets/d/([a-zA-Z0-9_-]+)`)
+var spreadsheetIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// parseSpreadsheetID gets the spreadsheet ID from a spreadsheet ID or URL
+func parseSpreadsheetID(s string) (FileID, error) {
+	s = strings.TrimSpace(s)
+	if m := spreadsheetURLRegexp.FindStringSubmatch(s); m != nil {
+		return FileID(m[1]), nil
+	}
+	if !spreadsheetIDRegexp.MatchString(s) {
+		return "", fmt.Errorf("%q is not a spreadsheet ID or URL", s)
+	}
+	return FileID(s), nil
+}
+
+// normalizeName lower cases the name and drops everything but letters and digits, so
+// that "Sri Lakshmi" and "sri-lakshmi" are the same name
+func normalizeName(s string) string {
+	b := strings.Builder{}
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// levenshtein counts the single character edits it takes to turn a into b
+func levenshtein(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := 0; j <= len(rb); j++ {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// nameSimilarity scores how alike two names are from 0 to 1. a name contained in the
+// other, like "Lakshmi" in "Sri Lakshmi", scores the similarity threshold.
+func nameSimilarity(a, b string) float64 {
+	na := normalizeName(a)
+	nb := normalizeName(b)
+	if na == "" || nb == "" {
+		return 0
+	}
+	if na == nb {
+		return 1
+	}
+	longest := len([]rune(na))
+	if n := len([]rune(nb)); n > longest {
+		longest = n
+	}
+	score := 1 - float64(levenshtein(na, nb))/float64(longest)
+	shortest := na
+	if len(nb) < len(na) {
+		shortest = nb
+	}
+	if score < adoptMinNameSimilarity &&
+		len([]rune(shortest)) >= adoptMinContainedNameLength &&
+		(strings.Contains(na, nb) || strings.Contains(nb, na)) {
+		score = adoptMinNameSimilarity
+	}
+	return score
+}
+
+// matchColumns maps the columns of a header row to the names they are most similar to.
+// when several columns are closest to the same name, only the most similar one gets it.
+func matchColumns(headers []string, names []string) map[int]int {
+	type candidate struct {
+		column int
+		name   int
+		score  float64
+	}
+	candidates := []candidate{}
+	for i := 0; i < len(headers); i++ {
+		best := candidate{column: i, name: -1}
+		for j := 0; j < len(names); j++ {
+			score := nameSimilarity(headers[i], names[j])
+			if score >= adoptMinNameSimilarity && score > best.score {
+				best.name = j
+				best.score = score
+			}
+		}
+		if best.name >= 0 {
+			candidates = append(candidates, best)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	matches := map[int]int{}
+	taken := map[int]bool{}
+	for i := 0; i < len(candidates); i++ {
+		if taken[candidates[i].name] {
+			continue
+		}
+		matches[candidates[i].column] = candidates[i].name
+		taken[candidates[i].name] = true
+	}
+	return matches
+}
+
+// isTickedCell reports whether the cell is a ticked checkbox, or text that stands for one
+func isTickedCell(cell *sheets.CellData) bool {
+	if cell == nil {
+		return false
+	}
+	if cell.EffectiveValue != nil && cell.EffectiveValue.BoolValue != nil {
+		return *cell.EffectiveValue.BoolValue
+	}
+	switch strings.ToLower(strings.TrimSpace(cell.FormattedValue)) {
+	case "true", "yes", "y", "x", "✓", "✔", "☑":
+		return true
+	}
+	return false
+}
+
+func cellText(row *sheets.RowData, column int) string {
+	if row == nil || column >= len(row.Values) || row.Values[column] == nil {
+		return ""
+	}
+	return strings.TrimSpace(row.Values[column].FormattedValue)
+}
+
+type adoptBoss struct {
+	id          BossID
+	name        BossName
+	expansionID ExpansionID
+	// the mounts the boss drops, the checkboxes of kept spreadsheets are mount checkboxes
+	mountIDs []CollectibleID
+}
+
+func getAdoptBosses(ctx context.Context) ([]*adoptBoss, error) {
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select
+			b.boss_id,
+			b.boss_name,
+			m.expansion_id,
+			c.collectible_id
+		from bot.boss_metadata b
+		inner join bot.boss_expansion_map m
+		on b.boss_id = m.boss_id
+		left join (
+			bot.boss_collectible_map bc
+			inner join bot.collectible_metadata c
+			on c.collectible_id = bc.collectible_id and c.collectible_type = $1
+		)
+		on b.boss_id = bc.boss_id
+		order by m.expansion_id, m.boss_expansion_index
+		`,
+		string(CollectibleTypeMount),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get boss metadata error: [%w]", err)
+	}
+	defer rows.Close()
+	bosses := []*adoptBoss{}
+	bossByID := map[string]*adoptBoss{}
+	for rows.Next() {
+		var bossID string
+		var bossName string
+		var expansionID string
+		var mountID *string
+		err = rows.Scan(&bossID, &bossName, &expansionID, &mountID)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		boss, ok := bossByID[bossID]
+		if !ok {
+			boss = &adoptBoss{
+				id:          BossID(bossID),
+				name:        BossName(bossName),
+				expansionID: ExpansionID(expansionID),
+				mountIDs:    []CollectibleID{},
+			}
+			bossByID[bossID] = boss
+			bosses = append(bosses, boss)
+		}
+		if mountID != nil {
+			boss.mountIDs = append(boss.mountIDs, CollectibleID(*mountID))
+		}
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return bosses, nil
+}
+
+// AdoptedSheet is how a sheet of an adopted spreadsheet was read
+type AdoptedSheet struct {
+	Title            string
+	Expansion        ExpansionName
+	Columns          map[string]BossName
+	UnmatchedHeaders []string
+	Members          int
+	UnmatchedRows    []string
+
+	sheetID     SheetID
+	expansionID ExpansionID
+	headerRow   int
+	// column index to boss
+	bosses map[int]*adoptBoss
+}
+
+// AdoptReport sums up what was taken over from an adopted spreadsheet
+type AdoptReport struct {
+	FileID        FileID
+	Sheets        []*AdoptedSheet
+	IgnoredSheets []string
+	Imported      int
+}
+
+// localize names the expansions and bosses of the report in the language, where they
+// have a translation
+func (r *AdoptReport) localize(t Translations, lang Language) {
+	for i := 0; i < len(r.Sheets); i++ {
+		sheet := r.Sheets[i]
+		sheet.Expansion = ExpansionName(t.name(string(sheet.expansionID), lang, string(sheet.Expansion)))
+		bossIDs := map[BossName]BossID{}
+		for _, boss := range sheet.bosses {
+			bossIDs[boss.name] = boss.id
+		}
+		for header, name := range sheet.Columns {
+			sheet.Columns[header] = BossName(t.name(string(bossIDs[name]), lang, string(name)))
+		}
+	}
+}
+
+func (r *AdoptReport) Render() string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "adopted spreadsheet %s, %d mount checkboxes imported\n", r.FileID, r.Imported)
+	for i := 0; i < len(r.Sheets); i++ {
+		sheet := r.Sheets[i]
+		fmt.Fprintf(&b, "\n%q -> %s: %d bosses, %d members\n", sheet.Title, sheet.Expansion, len(sheet.Columns), sheet.Members)
+		headers := make([]string, 0, len(sheet.Columns))
+		for header := range sheet.Columns {
+			headers = append(headers, header)
+		}
+		sort.Strings(headers)
+		for j := 0; j < len(headers); j++ {
+			if normalizeName(headers[j]) != normalizeName(string(sheet.Columns[headers[j]])) {
+				fmt.Fprintf(&b, "  column %q read as %s\n", headers[j], sheet.Columns[headers[j]])
+			}
+		}
+		if len(sheet.UnmatchedHeaders) > 0 {
+			fmt.Fprintf(&b, "  columns ignored: %s\n", strings.Join(sheet.UnmatchedHeaders, ", "))
+		}
+		if len(sheet.UnmatchedRows) > 0 {
+			fmt.Fprintf(&b, "  rows of unknown members: %s\n", strings.Join(sheet.UnmatchedRows, ", "))
+		}
+	}
+	if len(r.IgnoredSheets) > 0 {
+		fmt.Fprintf(&b, "\nsheets ignored: %s\n", strings.Join(r.IgnoredSheets, ", "))
+	}
+	return b.String()
+}
+
+// matchAdoptedSheet finds the header row of the sheet and the expansion whose bosses
+// best match it. it returns nil when no header names a boss.
+func matchAdoptedSheet(sheet *sheets.Sheet, bosses []*adoptBoss) *AdoptedSheet {
+	if len(sheet.Data) == 0 {
+		return nil
+	}
+	grid := sheet.Data[0].RowData
+	bossNames := make([]string, len(bosses))
+	for i := 0; i < len(bosses); i++ {
+		bossNames[i] = string(bosses[i].name)
+	}
+	headerRow := -1
+	var headerMatches map[int]int
+	for i := 0; i < len(grid) && i < adoptHeaderSearchRows; i++ {
+		headers := make([]string, len(grid[i].Values))
+		for j := 0; j < len(headers); j++ {
+			headers[j] = cellText(grid[i], j)
+		}
+		matches := matchColumns(headers, bossNames)
+		if len(matches) > len(headerMatches) {
+			headerRow = i
+			headerMatches = matches
+		}
+	}
+	if headerRow < 0 {
+		return nil
+	}
+	// the expansion named by the most headers, then only its bosses are matched
+	counts := map[ExpansionID]int{}
+	var expansionID ExpansionID
+	for _, bossIndex := range headerMatches {
+		id := bosses[bossIndex].expansionID
+		counts[id]++
+		if counts[id] > counts[expansionID] || (counts[id] == counts[expansionID] && id < expansionID) {
+			expansionID = id
+		}
+	}
+	expansionBosses := []*adoptBoss{}
+	expansionBossNames := []string{}
+	for i := 0; i < len(bosses); i++ {
+		if bosses[i].expansionID == expansionID {
+			expansionBosses = append(expansionBosses, bosses[i])
+			expansionBossNames = append(expansionBossNames, string(bosses[i].name))
+		}
+	}
+	headers := make([]string, len(grid[headerRow].Values))
+	for j := 0; j < len(headers); j++ {
+		headers[j] = cellText(grid[headerRow], j)
+	}
+	adopted := &AdoptedSheet{
+		Title:            sheet.Properties.Title,
+		Columns:          map[string]BossName{},
+		UnmatchedHeaders: []string{},
+		UnmatchedRows:    []string{},
+		sheetID:          SheetID(sheet.Properties.SheetId),
+		expansionID:      expansionID,
+		headerRow:        headerRow,
+		bosses:           map[int]*adoptBoss{},
+	}
+	matches := matchColumns(headers, expansionBossNames)
+	for column := 0; column < len(headers); column++ {
+		bossIndex, ok := matches[column]
+		if !ok {
+			if headers[column] != "" {
+				adopted.UnmatchedHeaders = append(adopted.UnmatchedHeaders, headers[column])
+			}
+			continue
+		}
+		adopted.bosses[column] = expansionBosses[bossIndex]
+		adopted.Columns[headers[column]] = expansionBosses[bossIndex].name
+	}
+	return adopted
+}
+
+// readAdoptedMounts reads which mounts the members on the rows below the header own.
+// a row belongs to the member whose discord ID or name is in one of its other columns.
+func readAdoptedMounts(sheet *sheets.Sheet, adopted *AdoptedSheet, members []*Member, owned map[MemberID]map[CollectibleID]bool) {
+	memberIDs := map[string]MemberID{}
+	nameCounts := map[string]int{}
+	memberNames := map[string]MemberID{}
+	for i := 0; i < len(members); i++ {
+		memberIDs[string(members[i].id)] = members[i].id
+		name := normalizeName(members[i].name)
+		nameCounts[name]++
+		memberNames[name] = members[i].id
+	}
+	grid := sheet.Data[0].RowData
+	for i := adopted.headerRow + 1; i < len(grid); i++ {
+		var memberID MemberID
+		found := false
+		firstText := ""
+		for column := 0; column < len(grid[i].Values) && !found; column++ {
+			if _, ok := adopted.bosses[column]; ok {
+				continue
+			}
+			text := cellText(grid[i], column)
+			if text == "" {
+				continue
+			}
+			if firstText == "" {
+				firstText = text
+			}
+			if id, ok := memberIDs[text]; ok {
+				memberID, found = id, true
+			} else if name := normalizeName(text); nameCounts[name] == 1 {
+				memberID, found = memberNames[name], true
+			}
+		}
+		if !found {
+			if firstText != "" {
+				adopted.UnmatchedRows = append(adopted.UnmatchedRows, firstText)
+			}
+			continue
+		}
+		adopted.Members++
+		if owned[memberID] == nil {
+			owned[memberID] = map[CollectibleID]bool{}
+		}
+		for column, boss := range adopted.bosses {
+			var cell *sheets.CellData
+			if column < len(grid[i].Values) {
+				cell = grid[i].Values[column]
+			}
+			ticked := isTickedCell(cell)
+			for j := 0; j < len(boss.mountIDs); j++ {
+				owned[memberID][boss.mountIDs[j]] = owned[memberID][boss.mountIDs[j]] || ticked
+			}
+		}
+	}
+}
+
+// FileInUseError is returned when the spreadsheet to adopt is already the spreadsheet of
+// another role
+type FileInUseError struct {
+	FileID FileID
+	RoleID RoleID
+}
+
+func (e *FileInUseError) Error() string {
+	return fmt.Sprintf("spreadsheet %s is already the spreadsheet of role %s, unset that role first", e.FileID, e.RoleID)
+}
+
+// getFileRole gets the role whose spreadsheet the file is, empty when it is none's. files
+// saved before roles were tracked have no role when no role was set at the time.
+func getFileRole(ctx context.Context, fileID FileID) (RoleID, error) {
+	var roleID *string
+	err := dbpool.QueryRow(ctx, `select role_id from bot.file_ref where file_gcp_id = $1`, string(fileID)).Scan(&roleID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get bot.file_ref error: [%w]", err)
+	}
+	if roleID == nil {
+		return "", nil
+	}
+	return RoleID(*roleID), nil
+}
+
+// adoptSpreadsheet takes over a spreadsheet that was kept by hand. its sheets are matched
+// to expansions and their headers to bosses, the ticked checkboxes of known members are
+// imported, and sheets in the layout of the bot are added to the file, which becomes the
+// spreadsheet of the tracker. the adopted sheets are renamed and kept as they were.
+func adoptSpreadsheet(ctx context.Context, tracker *Tracker, fileID FileID) (*AdoptReport, error) {
+	logger := loggerFromContext(ctx)
+	owner, err := getFileRole(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("getFileRole() error: [%w]", err)
+	}
+	if owner != "" && owner != tracker.RoleID {
+		return nil, &FileInUseError{FileID: fileID, RoleID: owner}
+	}
+	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(string(fileID)).IncludeGridData(true).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gsheetsSvc.Spreadsheets.Get() 1 error, is the spreadsheet shared with the bot's service account: [%w]", err)
+	}
+	expansions, err := getTrackerExpansions(ctx, tracker)
+	if err != nil {
+		return nil, fmt.Errorf("getTrackerExpansions() error: [%w]", err)
+	}
+	expansionNames := map[ExpansionID]ExpansionName{}
+	for i := 0; i < len(expansions); i++ {
+		expansionNames[expansions[i].ID] = expansions[i].Name
+	}
+	bosses, err := getAdoptBosses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getAdoptBosses() error: [%w]", err)
+	}
+	members, err := getRoleMembersFromDB(ctx, tracker.RoleID)
+	if err != nil {
+		return nil, fmt.Errorf("getRoleMembersFromDB() error: [%w]", err)
+	}
+
+	// match the sheets, each expansion goes to the sheet naming the most of its bosses
+	report := &AdoptReport{
+		FileID:        fileID,
+		Sheets:        []*AdoptedSheet{},
+		IgnoredSheets: []string{},
+	}
+	candidates := []*AdoptedSheet{}
+	sheetsByID := map[SheetID]*sheets.Sheet{}
+	for i := 0; i < len(spreadsheet.Sheets); i++ {
+		sheetsByID[SheetID(spreadsheet.Sheets[i].Properties.SheetId)] = spreadsheet.Sheets[i]
+		adopted := matchAdoptedSheet(spreadsheet.Sheets[i], bosses)
+		if adopted == nil {
+			report.IgnoredSheets = append(report.IgnoredSheets, spreadsheet.Sheets[i].Properties.Title)
+			continue
+		}
+		candidates = append(candidates, adopted)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].bosses) > len(candidates[j].bosses)
+	})
+	adoptedExpansions := map[ExpansionID]bool{}
+	for i := 0; i < len(candidates); i++ {
+		// the expansion is taken, or is not tracked in the spreadsheet of the role
+		if _, ok := expansionNames[candidates[i].expansionID]; adoptedExpansions[candidates[i].expansionID] || !ok {
+			report.IgnoredSheets = append(report.IgnoredSheets, candidates[i].Title)
+			continue
+		}
+		adoptedExpansions[candidates[i].expansionID] = true
+		candidates[i].Expansion = expansionNames[candidates[i].expansionID]
+		report.Sheets = append(report.Sheets, candidates[i])
+	}
+	if len(report.Sheets) == 0 {
+		return nil, fmt.Errorf("no sheet of %s has boss names in its first %d rows", fileID, adoptHeaderSearchRows)
+	}
+	owned := map[MemberID]map[CollectibleID]bool{}
+	for i := 0; i < len(report.Sheets); i++ {
+		readAdoptedMounts(sheetsByID[report.Sheets[i].sheetID], report.Sheets[i], members, owned)
+	}
+
+	expansionTypes, err := getExpansionCollectibleTypes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getExpansionCollectibleTypes() error: [%w]", err)
+	}
+	// the new sheets are titled in the language of the spreadsheet
+	lang := tracker.Language
+	translations, err := getTranslations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getTranslations() error: [%w]", err)
+	}
+	planned := planCollectibleSheets(localizeExpansions(expansions, translations, lang), expansionTypes, lang)
+
+	// keep the adopted sheets, and any sheet named like a new sheet, out of the way of
+	// the new sheets
+	renamed := map[SheetID]bool{}
+	for i := 0; i < len(report.Sheets); i++ {
+		renamed[report.Sheets[i].sheetID] = true
+	}
+	for i := 0; i < len(spreadsheet.Sheets); i++ {
+		for j := 0; j < len(planned); j++ {
+			if strings.EqualFold(spreadsheet.Sheets[i].Properties.Title, planned[j].title()) {
+				renamed[SheetID(spreadsheet.Sheets[i].Properties.SheetId)] = true
+			}
+		}
+	}
+	requests := []*sheets.Request{}
+	for i := 0; i < len(spreadsheet.Sheets); i++ {
+		props := spreadsheet.Sheets[i].Properties
+		if !renamed[SheetID(props.SheetId)] {
+			continue
+		}
+		requests = append(requests, &sheets.Request{
+			UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+				Fields: "title",
+				Properties: &sheets.SheetProperties{
+					SheetId: props.SheetId,
+					Title:   fmt.Sprintf("%s (before adoption)", props.Title),
+				},
+			},
+		})
+	}
+	for i := 0; i < len(planned); i++ {
+		requests = append(requests, &sheets.Request{
+			AddSheet: &sheets.AddSheetRequest{
+				Properties: &sheets.SheetProperties{
+					Index: int64(i),
+					Title: planned[i].title(),
+				},
+			},
+		})
+	}
+	start := time.Now()
+	resp, err := gsheetsSvc.Spreadsheets.BatchUpdate(string(fileID), &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: requests,
+	}).Context(ctx).Do()
+	observeSheetsBatchUpdate(start, resp, err)
+	if err != nil {
+		return nil, fmt.Errorf("gsheetsSvc.Spreadsheets.BatchUpdate() error: [%w]", err)
+	}
+	logger.Debug("sheets added to the adopted spreadsheet")
+
+	// the replies may be empty, so the new sheets are found by their title
+	spreadsheet, err = gsheetsSvc.Spreadsheets.Get(string(fileID)).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gsheetsSvc.Spreadsheets.Get() 2 error: [%w]", err)
+	}
+	collectibleSheetMap := map[SheetID]CollectibleSheet{}
+	sheetData := []*SheetMetadata{}
+	for i := 0; i < len(spreadsheet.Sheets); i++ {
+		props := spreadsheet.Sheets[i].Properties
+		for j := 0; j < len(planned); j++ {
+			if props.Title == planned[j].title() {
+				collectibleSheetMap[SheetID(props.SheetId)] = planned[j]
+				sheetData = append(sheetData, &SheetMetadata{
+					ID:    SheetID(props.SheetId),
+					Index: SheetIndex(props.Index),
+				})
+			}
+		}
+	}
+
+	dbcon, err := dbpool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("database connection acquire error: [%w]", err)
+	}
+	defer dbcon.Release()
+	tx, err := dbcon.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dbcon.Begin() error: [%w]", err)
+	}
+	defer tx.Rollback(ctx)
+	// mounts are never lost, so a ticked checkbox in either place wins
+	for memberID, mounts := range owned {
+		for mountID, hasMount := range mounts {
+			_, err = tx.Exec(
+				ctx,
+				`
+				insert into bot.member_collectible(member_discord_id,collectible_id,has_collectible) values($1,$2,$3)
+				on conflict (member_discord_id,collectible_id) do update
+				set has_collectible = bot.member_collectible.has_collectible or excluded.has_collectible
+				`,
+				string(memberID),
+				string(mountID),
+				hasMount,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("tx.Exec() 1 error; member=%s, mount=%s: [%w]", memberID, mountID, err)
+			}
+			if hasMount {
+				report.Imported++
+			}
+		}
+	}
+	// replace the old file, the sheets and permissions of the old file are deleted with it,
+	// as is the file when it was saved without a role. a file another role took meanwhile
+	// fails the insert below instead of being taken away.
+	_, err = tx.Exec(
+		ctx,
+		`delete from bot.file_ref where role_id = $1 or (file_gcp_id = $2 and role_id is null)`,
+		string(tracker.RoleID),
+		string(fileID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Exec() 2 error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `insert into bot.file_ref(file_gcp_id,role_id) values($1,$2)`, string(fileID), string(tracker.RoleID))
+	if err != nil {
+		return nil, fmt.Errorf("tx.Exec() 3 error: [%w]", err)
+	}
+	for i := 0; i < len(sheetData); i++ {
+		_, err = tx.Exec(
+			ctx,
+			`insert into bot.sheet_metadata(file_gcp_id,sheet_gcp_id,sheet_index,collectible_type) values($1,$2,$3,$4)`,
+			string(fileID),
+			sheetData[i].ID.String(),
+			sheetData[i].Index.String(),
+			string(collectibleSheetMap[sheetData[i].ID].Type),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("tx.Exec() 4 error; sheet_gcp_id=%s: [%w]", sheetData[i].ID.String(), err)
+		}
+		_, err = tx.Exec(
+			ctx,
+			`insert into bot.sheet_expansion_map(sheet_gcp_id,expansion_id) values($1,$2)`,
+			sheetData[i].ID.String(),
+			collectibleSheetMap[sheetData[i].ID].Expansion.ID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("tx.Exec() 5 error; sheet_gcp_id=%s: [%w]", sheetData[i].ID.String(), err)
+		}
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	dbcon.Release()
+	logger.Infof("spreadsheet %s adopted, %d mount checkboxes imported", fileID, report.Imported)
+
+	tracker.FileID = fileID
+	columnMap, err := NewColumnMap(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("NewColumnMap() error: [%w]", err)
+	}
+	err = sendSheetBatchUpdateAndWait(ctx, &SheetBatchUpdate{
+		ID: string(fileID),
+		Batch: &sheets.BatchUpdateSpreadsheetRequest{
+			Requests: sheetHeaderRequests(columnMap, collectibleSheetMap),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sendSheetBatchUpdateAndWait() error: [%w]", err)
+	}
+	err = populateSpreadsheet(ctx, tracker)
+	if err != nil {
+		return nil, fmt.Errorf("populateSpreadsheet() error: [%w]", err)
+	}
+	err = syncTrackerPermissions(ctx, tracker, nil)
+	if err != nil {
+		return nil, fmt.Errorf("syncTrackerPermissions() error: [%w]", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+func Test_levenshtein(t *testing.T) {
+	type args struct {
+		a string
+		b string
+	}
+	tests := []struct {
+		name string
+		args args
+		want int
+	}{
+		{
+			name: "same",
+			args: args{a: "garuda", b: "garuda"},
+			want: 0,
+		},
+		{
+			name: "one missing letter",
+			args: args{a: "bismarck", b: "bismark"},
+			want: 1,
+		},
+		{
+			name: "empty",
+			args: args{a: "", b: "titan"},
+			want: 5,
+		},
+		{
+			name: "kitten sitting",
+			args: args{a: "kitten", b: "sitting"},
+			want: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := levenshtein(tt.args.a, tt.args.b); got != tt.want {
+				t.Errorf("levenshtein() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_matchColumns(t *testing.T) {
+	names := []string{"Titan", "Titania", "Sri Lakshmi", "Bismark", "O4S", "O8S"}
+	type args struct {
+		headers []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want map[int]int
+	}{
+		{
+			name: "exact and differently written names",
+			args: args{headers: []string{"Name", "titan", "Bismarck", "sri-lakshmi"}},
+			want: map[int]int{1: 0, 2: 3, 3: 2},
+		},
+		{
+			name: "a name contained in the boss name",
+			args: args{headers: []string{"Lakshmi"}},
+			want: map[int]int{0: 2},
+		},
+		{
+			name: "the closest boss wins",
+			args: args{headers: []string{"Titania", "Titan"}},
+			want: map[int]int{0: 1, 1: 0},
+		},
+		{
+			name: "short names need to be exact",
+			args: args{headers: []string{"O12S", "o8s"}},
+			want: map[int]int{1: 5},
+		},
+		{
+			name: "a boss goes to one column only",
+			args: args{headers: []string{"Titan", "Titan"}},
+			want: map[int]int{0: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchColumns(tt.args.headers, names); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseSpreadsheetID(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    FileID
+		wantErr bool
+	}{
+		{
+			name: "id",
+			s:    "1AbC_d-2",
+			want: "1AbC_d-2",
+		},
+		{
+			name: "url",
+			s:    "https://docs.google.com/spreadsheets/d/1AbC_d-2/edit#gid=0",
+			want: "1AbC_d-2",
+		},
+		{
+			name:    "not an id",
+			s:       "my spreadsheet",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSpreadsheetID(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSpreadsheetID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseSpreadsheetID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readAdoptedMounts(t *testing.T) {
+	textRow := func(values ...string) *sheets.RowData {
+		row := &sheets.RowData{}
+		for i := 0; i < len(values); i++ {
+			row.Values = append(row.Values, &sheets.CellData{FormattedValue: values[i]})
+		}
+		return row
+	}
+	ticked := true
+	unticked := false
+	sheet := &sheets.Sheet{
+		Properties: &sheets.SheetProperties{Title: "ARR", SheetId: 7},
+		Data: []*sheets.GridData{
+			{
+				RowData: []*sheets.RowData{
+					textRow("Farm tracker"),
+					textRow("Player", "Garuda", "Titan", "Notes"),
+					{
+						Values: []*sheets.CellData{
+							{FormattedValue: "alice"},
+							{EffectiveValue: &sheets.ExtendedValue{BoolValue: &ticked}},
+							{EffectiveValue: &sheets.ExtendedValue{BoolValue: &unticked}},
+						},
+					},
+					textRow("200", "", "x"),
+					textRow("carol", "x", "x"),
+				},
+			},
+		},
+	}
+	bosses := []*adoptBoss{
+		{name: "Garuda", expansionID: "arr", mountIDs: []CollectibleID{"garuda-mount"}},
+		{name: "Titan", expansionID: "arr", mountIDs: []CollectibleID{"titan-mount"}},
+		{name: "Susano", expansionID: "sb", mountIDs: []CollectibleID{"susano-mount"}},
+	}
+	adopted := matchAdoptedSheet(sheet, bosses)
+	if adopted == nil {
+		t.Fatal("matchAdoptedSheet() = nil")
+	}
+	if adopted.headerRow != 1 || adopted.expansionID != "arr" {
+		t.Errorf("matchAdoptedSheet() headerRow = %d, expansionID = %s, want 1, arr", adopted.headerRow, adopted.expansionID)
+	}
+	if !reflect.DeepEqual(adopted.UnmatchedHeaders, []string{"Player", "Notes"}) {
+		t.Errorf("matchAdoptedSheet() UnmatchedHeaders = %v", adopted.UnmatchedHeaders)
+	}
+
+	members := []*Member{
+		{id: "100", name: "Alice"},
+		{id: "200", name: "Bob"},
+	}
+	owned := map[MemberID]map[CollectibleID]bool{}
+	readAdoptedMounts(sheet, adopted, members, owned)
+	want := map[MemberID]map[CollectibleID]bool{
+		"100": {"garuda-mount": true, "titan-mount": false},
+		"200": {"garuda-mount": false, "titan-mount": true},
+	}
+	if !reflect.DeepEqual(owned, want) {
+		t.Errorf("readAdoptedMounts() owned = %v, want %v", owned, want)
+	}
+	if adopted.Members != 2 || !reflect.DeepEqual(adopted.UnmatchedRows, []string{"carol"}) {
+		t.Errorf("readAdoptedMounts() Members = %d, UnmatchedRows = %v", adopted.Members, adopted.UnmatchedRows)
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+)
+
+const (
+	// discord shows at most 25 autocomplete choices
+	autocompleteMaxChoices = 25
+	// names and values of autocomplete choices are at most 100 characters long
+	autocompleteMaxLength = 100
+	// how many characters found by searches are kept for autocompleting names and IDs
+	characterCacheSize = 500
+)
+
+// autocompleter gets the choices for the focused option of a command from what the user
+// typed in it so far
+type autocompleter func(ctx context.Context, event *events.AutocompleteInteractionCreate, typed string) ([]discord.AutocompleteChoice, error)
+
+// autocompleters maps command names to the autocompleters of their options. options
+// listed here need Autocomplete set in createSlashCommands.
+var autocompleters = map[string]map[string]autocompleter{
+	"set_role": {
+		"expansions": autocompleteExpansionList,
+	},
+	"set_role_styling": {
+		"boss": autocompleteBoss,
+	},
+	"any_xiv_char_search": {
+		"xiv_character_name": autocompleteCharacterName,
+	},
+	"xiv_char_search": {
+		"xiv_character_name": autocompleteCharacterName,
+	},
+	"map_any_xiv_char_id": {
+		"xiv_character_id": autocompleteCharacterID,
+	},
+	"map_xiv_char_id": {
+		"xiv_character_id": autocompleteCharacterID,
+	},
+	"add_xiv_alt": {
+		"xiv_character_id": autocompleteCharacterID,
+	},
+	"remove_xiv_alt": {
+		"xiv_character_id": autocompleteAlt,
+	},
+	"set_primary_xiv_char": {
+		"xiv_character_id": autocompleteAlt,
+	},
+}
+
+// focusedOption gets the name of the option the user is typing in and what they typed
+func focusedOption(data discord.AutocompleteInteractionData) (string, string, bool) {
+	for name, option := range data.Options {
+		if !option.Focused {
+			continue
+		}
+		var typed string
+		if err := json.Unmarshal(option.Value, &typed); err != nil {
+			// numbers are sent as they are typed
+			typed = string(option.Value)
+		}
+		return name, typed, true
+	}
+	return "", "", false
+}
+
+func autocompleteHandler(event *events.AutocompleteInteractionCreate) {
+	name, typed, ok := focusedOption(event.Data)
+	if !ok {
+		return
+	}
+	complete, ok := autocompleters[event.Data.CommandName][name]
+	if !ok {
+		return
+	}
+	logger := autocompleteLogger(event, name)
+
+	choices, err := complete(withLogger(ctx, logger), event, typed)
+	if err != nil {
+		logger.Error(err)
+		choices = []discord.AutocompleteChoice{}
+	}
+	err = event.Result(choices)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// autocompleteCandidate is a choice offered when what the user typed matches one of its
+// keys
+type autocompleteCandidate struct {
+	Name  string
+	Value string
+	Keys  []string
+}
+
+// suggest gets the choices of the candidates matching typed, case insensitively. the
+// candidates with a key starting with typed come first, then the ones with a key
+// containing it, each in the order of the candidates.
+func suggest(candidates []autocompleteCandidate, typed string) []discord.AutocompleteChoice {
+	typed = strings.ToLower(strings.TrimSpace(typed))
+	prefixed := []autocompleteCandidate{}
+	contained := []autocompleteCandidate{}
+	for i := 0; i < len(candidates); i++ {
+		match := 0
+		for _, key := range candidates[i].Keys {
+			key = strings.ToLower(key)
+			if strings.HasPrefix(key, typed) {
+				match = 2
+				break
+			}
+			if strings.Contains(key, typed) {
+				match = 1
+			}
+		}
+		switch match {
+		case 2:
+			prefixed = append(prefixed, candidates[i])
+		case 1:
+			contained = append(contained, candidates[i])
+		}
+	}
+	matched := append(prefixed, contained...)
+	choices := []discord.AutocompleteChoice{}
+	for i := 0; i < len(matched) && len(choices) < autocompleteMaxChoices; i++ {
+		// a cut value would not be the one the option expects
+		if len(matched[i].Value) > autocompleteMaxLength {
+			continue
+		}
+		choices = append(choices, discord.AutocompleteChoiceString{
+			Name:  truncate(matched[i].Name, autocompleteMaxLength),
+			Value: matched[i].Value,
+		})
+	}
+	return choices
+}
+
+// truncate cuts s to at most max characters, ending it with an ellipsis when it is cut
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max-1]) + "…"
+}
+
+// Boss is a boss of the catalog with the mounts it drops
+type Boss struct {
+	ID     BossID
+	Name   BossName
+	Mounts []*Collectible
+}
+
+func getBosses(ctx context.Context) ([]*Boss, error) {
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select
+			b.boss_id,
+			b.boss_name,
+			coalesce(c.collectible_id, ''),
+			coalesce(c.collectible_name, '')
+		from bot.boss_metadata b
+		left join bot.boss_collectible_map bc
+		on bc.boss_id = b.boss_id
+		left join bot.collectible_metadata c
+		on c.collectible_id = bc.collectible_id and c.collectible_type = $1
+		order by b.boss_name, c.collectible_name
+		`,
+		string(CollectibleTypeMount),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get boss metadata error: [%w]", err)
+	}
+	defer rows.Close()
+	bosses := []*Boss{}
+	byID := map[BossID]*Boss{}
+	for rows.Next() {
+		var bossID string
+		var bossName string
+		var mountID string
+		var mountName string
+		err = rows.Scan(&bossID, &bossName, &mountID, &mountName)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		boss, ok := byID[BossID(bossID)]
+		if !ok {
+			boss = &Boss{ID: BossID(bossID), Name: BossName(bossName)}
+			byID[boss.ID] = boss
+			bosses = append(bosses, boss)
+		}
+		if mountID != "" {
+			boss.Mounts = append(boss.Mounts, &Collectible{
+				ID:   CollectibleID(mountID),
+				Type: CollectibleTypeMount,
+				Name: CollectibleName(mountName),
+			})
+		}
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return bosses, nil
+}
+
+// bossCandidates offers the bosses by their name or the name of a mount they drop, in
+// any language. the value is the name /set_role_styling looks the boss up by.
+func bossCandidates(bosses []*Boss, t Translations, lang Language) []autocompleteCandidate {
+	candidates := make([]autocompleteCandidate, len(bosses))
+	for i := 0; i < len(bosses); i++ {
+		name := t.name(string(bosses[i].ID), lang, string(bosses[i].Name))
+		keys := append([]string{string(bosses[i].Name)}, translationsOf(t, string(bosses[i].ID))...)
+		mounts := make([]string, len(bosses[i].Mounts))
+		for j := 0; j < len(bosses[i].Mounts); j++ {
+			mount := bosses[i].Mounts[j]
+			mounts[j] = t.name(string(mount.ID), lang, string(mount.Name))
+			keys = append(keys, string(mount.Name))
+			keys = append(keys, translationsOf(t, string(mount.ID))...)
+		}
+		if len(mounts) > 0 {
+			name = fmt.Sprintf("%s (%s)", name, strings.Join(mounts, ", "))
+		}
+		candidates[i] = autocompleteCandidate{
+			Name:  name,
+			Value: string(bosses[i].Name),
+			Keys:  keys,
+		}
+	}
+	return candidates
+}
+
+// translationsOf gets every translation of the name of the object
+func translationsOf(t Translations, id string) []string {
+	names := []string{}
+	for _, name := range t[id] {
+		names = append(names, name)
+	}
+	return names
+}
+
+func autocompleteBoss(ctx context.Context, event *events.AutocompleteInteractionCreate, typed string) ([]discord.AutocompleteChoice, error) {
+	bosses, err := getBosses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getBosses() error: [%w]", err)
+	}
+	t, err := getTranslations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getTranslations() error: [%w]", err)
+	}
+	return suggest(bossCandidates(bosses, t, localeLanguage(event.Locale())), typed), nil
+}
+
+// expansionListChoices completes the last expansion of a comma separated list with the
+// expansions not in the list yet, keeping the ones typed before it
+func expansionListChoices(typed string, expansions []*Expansion, t Translations, lang Language) []discord.AutocompleteChoice {
+	parts := strings.Split(typed, ",")
+	current := parts[len(parts)-1]
+	chosen := map[ExpansionID]bool{}
+	head := []string{}
+	for i := 0; i < len(parts)-1; i++ {
+		part := strings.TrimSpace(parts[i])
+		if part == "" {
+			continue
+		}
+		head = append(head, part)
+		ids, err := parseExpansionList(part, expansions, t, lang)
+		if err == nil && len(ids) == 1 {
+			chosen[ids[0]] = true
+		}
+	}
+	sorted := selectExpansions(expansions, nil)
+	candidates := []autocompleteCandidate{}
+	for i := 0; i < len(sorted); i++ {
+		if chosen[sorted[i].ID] {
+			continue
+		}
+		name := t.name(string(sorted[i].ID), lang, string(sorted[i].Name))
+		list := strings.Join(append(append([]string{}, head...), name), ", ")
+		keys := append([]string{string(sorted[i].Name), string(sorted[i].ID)}, translationsOf(t, string(sorted[i].ID))...)
+		candidates = append(candidates, autocompleteCandidate{
+			Name:  list,
+			Value: list,
+			Keys:  keys,
+		})
+	}
+	return suggest(candidates, current)
+}
+
+func autocompleteExpansionList(ctx context.Context, event *events.AutocompleteInteractionCreate, typed string) ([]discord.AutocompleteChoice, error) {
+	expansions, err := getExpansions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getExpansions() error: [%w]", err)
+	}
+	t, err := getTranslations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getTranslations() error: [%w]", err)
+	}
+	return expansionListChoices(typed, expansions, t, localeLanguage(event.Locale())), nil
+}
+
+// characterCache keeps the characters found by the latest searches, the most recent
+// first, so their names and IDs can be offered without asking XIVAPI again
+type characterCache struct {
+	mu         sync.Mutex
+	size       int
+	characters []XivReducedCharacterProfile
+}
+
+func newCharacterCache(size int) *characterCache {
+	return &characterCache{size: size}
+}
+
+var characterSearchCache = newCharacterCache(characterCacheSize)
+
+// remember adds the characters of a search result, moving the ones already kept to the
+// front
+func (c *characterCache) remember(results []XivReducedCharacterProfile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := map[uint]bool{}
+	characters := []XivReducedCharacterProfile{}
+	for i := 0; i < len(results); i++ {
+		if results[i].ID == 0 || found[results[i].ID] {
+			continue
+		}
+		found[results[i].ID] = true
+		characters = append(characters, results[i])
+	}
+	for i := 0; i < len(c.characters); i++ {
+		if !found[c.characters[i].ID] {
+			characters = append(characters, c.characters[i])
+		}
+	}
+	if len(characters) > c.size {
+		characters = characters[:c.size]
+	}
+	c.characters = characters
+}
+
+func (c *characterCache) all() []XivReducedCharacterProfile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]XivReducedCharacterProfile{}, c.characters...)
+}
+
+// characterLabel names a found character in a choice
+func characterLabel(character XivReducedCharacterProfile) string {
+	if character.Server == "" {
+		return fmt.Sprintf("%s (%d)", character.Name, character.ID)
+	}
+	return fmt.Sprintf("%s, %s (%d)", character.Name, character.Server, character.ID)
+}
+
+// characterNameCandidates offers each name of the found characters once
+func characterNameCandidates(characters []XivReducedCharacterProfile) []autocompleteCandidate {
+	found := map[string]bool{}
+	candidates := []autocompleteCandidate{}
+	for i := 0; i < len(characters); i++ {
+		key := strings.ToLower(characters[i].Name)
+		if characters[i].Name == "" || found[key] {
+			continue
+		}
+		found[key] = true
+		candidates = append(candidates, autocompleteCandidate{
+			Name:  characters[i].Name,
+			Value: characters[i].Name,
+			Keys:  []string{characters[i].Name},
+		})
+	}
+	return candidates
+}
+
+// characterIDCandidates offers the IDs of the found characters by their name or ID
+func characterIDCandidates(characters []XivReducedCharacterProfile) []autocompleteCandidate {
+	candidates := make([]autocompleteCandidate, len(characters))
+	for i := 0; i < len(characters); i++ {
+		id := strconv.FormatUint(uint64(characters[i].ID), 10)
+		candidates[i] = autocompleteCandidate{
+			Name:  characterLabel(characters[i]),
+			Value: id,
+			Keys:  []string{characters[i].Name, id},
+		}
+	}
+	return candidates
+}
+
+// altCandidates offers the alts of a member by their name or ID
+func altCandidates(characters []MemberCharacter) []autocompleteCandidate {
+	candidates := []autocompleteCandidate{}
+	for i := 0; i < len(characters); i++ {
+		if characters[i].Primary {
+			continue
+		}
+		name := characters[i].XivID
+		if characters[i].Name != "" {
+			name = fmt.Sprintf("%s (%s)", characters[i].Name, characters[i].XivID)
+		}
+		candidates = append(candidates, autocompleteCandidate{
+			Name:  name,
+			Value: characters[i].XivID,
+			Keys:  []string{characters[i].Name, characters[i].XivID},
+		})
+	}
+	return candidates
+}
+
+func autocompleteCharacterName(ctx context.Context, event *events.AutocompleteInteractionCreate, typed string) ([]discord.AutocompleteChoice, error) {
+	return suggest(characterNameCandidates(characterSearchCache.all()), typed), nil
+}
+
+func autocompleteCharacterID(ctx context.Context, event *events.AutocompleteInteractionCreate, typed string) ([]discord.AutocompleteChoice, error) {
+	return suggest(characterIDCandidates(characterSearchCache.all()), typed), nil
+}
+
+func autocompleteAlt(ctx context.Context, event *events.AutocompleteInteractionCreate, typed string) ([]discord.AutocompleteChoice, error) {
+	memberID := MemberID(event.User().ID.String())
+	characters, err := getMemberCharacters(ctx, memberID)
+	if err != nil {
+		return nil, fmt.Errorf("getMemberCharacters() error: [%w]", err)
+	}
+	return suggest(altCandidates(characters[memberID]), typed), nil
+}
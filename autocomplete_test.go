@@ -0,0 +1,281 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/json"
+)
+
+func Test_focusedOption(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   map[string]discord.AutocompleteOption
+		wantName  string
+		wantTyped string
+		wantOk    bool
+	}{
+		{
+			name:    "nothing focused",
+			options: map[string]discord.AutocompleteOption{"boss": {Value: json.RawMessage(`"ult"`)}},
+		},
+		{
+			name: "focused string",
+			options: map[string]discord.AutocompleteOption{
+				"role": {Value: json.RawMessage(`"1234"`)},
+				"boss": {Value: json.RawMessage(`"ult"`), Focused: true},
+			},
+			wantName:  "boss",
+			wantTyped: "ult",
+			wantOk:    true,
+		},
+		{
+			name:      "focused number",
+			options:   map[string]discord.AutocompleteOption{"page": {Value: json.RawMessage(`12`), Focused: true}},
+			wantName:  "page",
+			wantTyped: "12",
+			wantOk:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotName, gotTyped, gotOk := focusedOption(discord.AutocompleteInteractionData{Options: tt.options})
+			if gotName != tt.wantName || gotTyped != tt.wantTyped || gotOk != tt.wantOk {
+				t.Errorf("focusedOption() = %q, %q, %v, want %q, %q, %v", gotName, gotTyped, gotOk, tt.wantName, tt.wantTyped, tt.wantOk)
+			}
+		})
+	}
+}
+
+// choiceValues gets the values of string choices
+func choiceValues(choices []discord.AutocompleteChoice) []string {
+	values := []string{}
+	for i := 0; i < len(choices); i++ {
+		values = append(values, choices[i].(discord.AutocompleteChoiceString).Value)
+	}
+	return values
+}
+
+func Test_suggest(t *testing.T) {
+	candidates := []autocompleteCandidate{
+		{Name: "The Ultima Weapon", Value: "a", Keys: []string{"The Ultima Weapon"}},
+		{Name: "Ultima", Value: "b", Keys: []string{"Ultima"}},
+		{Name: "Titan", Value: "c", Keys: []string{"Titan", "Gaia"}},
+		{Name: "Long", Value: strings.Repeat("v", autocompleteMaxLength+1), Keys: []string{"Ultimate"}},
+	}
+	many := make([]autocompleteCandidate, autocompleteMaxChoices+5)
+	for i := 0; i < len(many); i++ {
+		many[i] = autocompleteCandidate{Name: "n", Value: "v", Keys: []string{"k"}}
+	}
+	capped := make([]string, autocompleteMaxChoices)
+	for i := 0; i < len(capped); i++ {
+		capped[i] = "v"
+	}
+	tests := []struct {
+		name       string
+		candidates []autocompleteCandidate
+		typed      string
+		want       []string
+	}{
+		{name: "empty input offers everything that fits", candidates: candidates, typed: "", want: []string{"a", "b", "c"}},
+		{name: "prefix matches come first", candidates: candidates, typed: " ULT", want: []string{"b", "a"}},
+		{name: "any key matches", candidates: candidates, typed: "gai", want: []string{"c"}},
+		{name: "no match", candidates: candidates, typed: "shiva", want: []string{}},
+		{name: "capped", candidates: many, typed: "k", want: capped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := choiceValues(suggest(tt.candidates, tt.typed))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("suggest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_truncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{name: "short", s: "Titan", max: 10, want: "Titan"},
+		{name: "cut", s: "Ultima Weapon", max: 6, want: "Ultim…"},
+		{name: "cut between runes", s: "アルテマウェポン", max: 4, want: "アルテ…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate(tt.s, tt.max); got != tt.want {
+				t.Errorf("truncate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_bossCandidates(t *testing.T) {
+	bosses := []*Boss{
+		{ID: "b1", Name: "Ultima", Mounts: []*Collectible{{ID: "m1", Name: "Magitek Predator"}}},
+		{ID: "b2", Name: "Titan"},
+	}
+	translations := Translations{
+		"b1": {LanguageFrench: "Ultima (fr)"},
+		"m1": {LanguageFrench: "Prédateur magitek"},
+	}
+	tests := []struct {
+		name  string
+		lang  Language
+		typed string
+		want  []discord.AutocompleteChoice
+	}{
+		{
+			name:  "boss name",
+			typed: "tit",
+			want:  []discord.AutocompleteChoice{discord.AutocompleteChoiceString{Name: "Titan", Value: "Titan"}},
+		},
+		{
+			name:  "mount name",
+			typed: "magitek",
+			want:  []discord.AutocompleteChoice{discord.AutocompleteChoiceString{Name: "Ultima (Magitek Predator)", Value: "Ultima"}},
+		},
+		{
+			name:  "translated mount name in french",
+			lang:  LanguageFrench,
+			typed: "prédateur",
+			want:  []discord.AutocompleteChoice{discord.AutocompleteChoiceString{Name: "Ultima (fr) (Prédateur magitek)", Value: "Ultima"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suggest(bossCandidates(bosses, translations, tt.lang), tt.typed); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("suggest(bossCandidates()) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_expansionListChoices(t *testing.T) {
+	expansions := []*Expansion{
+		{ID: "e2", Name: "Heavensward", Index: 2},
+		{ID: "e1", Name: "A Realm Reborn", Index: 1},
+		{ID: "e3", Name: "Stormblood", Index: 3},
+	}
+	translations := Translations{"e3": {LanguageGerman: "Stormblood (de)"}}
+	tests := []struct {
+		name  string
+		typed string
+		lang  Language
+		want  []string
+	}{
+		{name: "empty input in expansion order", typed: "", want: []string{"A Realm Reborn", "Heavensward", "Stormblood"}},
+		{name: "first expansion", typed: "heav", want: []string{"Heavensward"}},
+		{name: "next expansion keeps the list", typed: "Heavensward, st", want: []string{"Heavensward, Stormblood"}},
+		{name: "listed expansions are not offered again", typed: "Heavensward,", want: []string{"Heavensward, A Realm Reborn", "Heavensward, Stormblood"}},
+		{name: "translated", typed: "sto", lang: LanguageGerman, want: []string{"Stormblood (de)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := choiceValues(expansionListChoices(tt.typed, expansions, translations, tt.lang)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expansionListChoices() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_characterCache_remember(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		results [][]XivReducedCharacterProfile
+		want    []uint
+	}{
+		{
+			name:    "most recent first",
+			size:    10,
+			results: [][]XivReducedCharacterProfile{{{ID: 1}, {ID: 2}}, {{ID: 3}}},
+			want:    []uint{3, 1, 2},
+		},
+		{
+			name:    "found again moves to the front",
+			size:    10,
+			results: [][]XivReducedCharacterProfile{{{ID: 1}, {ID: 2}}, {{ID: 2}, {ID: 2}}},
+			want:    []uint{2, 1},
+		},
+		{
+			name:    "oldest are dropped",
+			size:    2,
+			results: [][]XivReducedCharacterProfile{{{ID: 1}, {ID: 2}}, {{ID: 3}, {ID: 0}}},
+			want:    []uint{3, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCharacterCache(tt.size)
+			for i := 0; i < len(tt.results); i++ {
+				c.remember(tt.results[i])
+			}
+			got := []uint{}
+			for _, character := range c.all() {
+				got = append(got, character.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("characterCache.all() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_characterCandidates(t *testing.T) {
+	characters := []XivReducedCharacterProfile{
+		{ID: 11, Name: "Tataru Taru", Server: "Behemoth"},
+		{ID: 12, Name: "tataru taru"},
+		{ID: 13, Name: "Alphinaud Leveilleur", Server: "Behemoth"},
+	}
+	tests := []struct {
+		name       string
+		candidates []autocompleteCandidate
+		typed      string
+		want       []discord.AutocompleteChoice
+	}{
+		{
+			name:       "names are offered once",
+			candidates: characterNameCandidates(characters),
+			typed:      "tat",
+			want:       []discord.AutocompleteChoice{discord.AutocompleteChoiceString{Name: "Tataru Taru", Value: "Tataru Taru"}},
+		},
+		{
+			name:       "IDs by name",
+			candidates: characterIDCandidates(characters),
+			typed:      "alph",
+			want:       []discord.AutocompleteChoice{discord.AutocompleteChoiceString{Name: "Alphinaud Leveilleur, Behemoth (13)", Value: "13"}},
+		},
+		{
+			name:       "IDs by ID",
+			candidates: characterIDCandidates(characters),
+			typed:      "12",
+			want:       []discord.AutocompleteChoice{discord.AutocompleteChoiceString{Name: "tataru taru (12)", Value: "12"}},
+		},
+		{
+			name: "alts leave out the primary character",
+			candidates: altCandidates([]MemberCharacter{
+				{XivID: "11", Name: "Tataru Taru", Primary: true},
+				{XivID: "12", Name: "Alt Character"},
+				{XivID: "13"},
+			}),
+			typed: "",
+			want: []discord.AutocompleteChoice{
+				discord.AutocompleteChoiceString{Name: "Alt Character (12)", Value: "12"},
+				discord.AutocompleteChoiceString{Name: "13", Value: "13"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suggest(tt.candidates, tt.typed); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("suggest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const (
+	// XIVAPI returns 50 characters per page of a character search
+	xivapiCharacterSearchPageSize = 50
+	// discord allows 25 options in a select menu
+	characterSearchPageSize = 25
+	// discord allows 10 embeds in a message, the rest of the page is only in the menu
+	characterSearchMaxEmbeds = 10
+	// full character names are at most 21 characters long, longer names would not fit
+	// the 100 characters of a custom ID
+	characterSearchMaxNameLength = 32
+
+	characterSearchPick = "xiv_char_pick"
+	characterSearchPage = "xiv_char_page"
+)
+
+// characterSearch is a page of the characters found by name for the picker of the
+// character of a discord user. the search is carried in the custom IDs of the picker,
+// so the bot keeps nothing between clicks.
+type characterSearch struct {
+	UserID snowflake.ID
+	// the user has to prove owning the picked character, otherwise an admin is mapping it
+	Verify bool
+	Name   string
+	// starts at 0
+	Page int
+}
+
+func (s characterSearch) valid() bool {
+	return s.Name != "" && len(s.Name) <= characterSearchMaxNameLength && !strings.Contains(s.Name, ":")
+}
+
+// apiPage gets the XIVAPI search page with the characters of the page, which starts at
+// 1, and the index of the first character of the page in it
+func (s characterSearch) apiPage() (int, int) {
+	first := s.Page * characterSearchPageSize
+	return first/xivapiCharacterSearchPageSize + 1, first % xivapiCharacterSearchPageSize
+}
+
+func (s characterSearch) customID(kind string) string {
+	mode := "a"
+	if s.Verify {
+		mode = "v"
+	}
+	return fmt.Sprintf("%s:%s:%s:%d:%s", kind, mode, s.UserID, s.Page, s.Name)
+}
+
+// parseCharacterSearchCustomID gets the kind of the component and the search from the
+// custom ID of a component of the picker
+func parseCharacterSearchCustomID(customID string) (string, characterSearch, error) {
+	parts := strings.SplitN(customID, ":", 5)
+	if len(parts) != 5 || (parts[0] != characterSearchPick && parts[0] != characterSearchPage) {
+		return "", characterSearch{}, fmt.Errorf("%q is not a character search component", customID)
+	}
+	if parts[1] != "a" && parts[1] != "v" {
+		return "", characterSearch{}, fmt.Errorf("unknown mode %q", parts[1])
+	}
+	userID, err := snowflake.Parse(parts[2])
+	if err != nil {
+		return "", characterSearch{}, fmt.Errorf("snowflake.Parse() error: [%w]", err)
+	}
+	page, err := strconv.Atoi(parts[3])
+	if err != nil || page < 0 {
+		return "", characterSearch{}, fmt.Errorf("invalid page %q", parts[3])
+	}
+	return parts[0], characterSearch{
+		UserID: userID,
+		Verify: parts[1] == "v",
+		Name:   parts[4],
+		Page:   page,
+	}, nil
+}
+
+// allowed checks if the user clicking the picker may pick the character. members pick
+// their own character, admins pick anyone's.
+func (s characterSearch) allowed(userID snowflake.ID, perms discord.Permissions) bool {
+	if s.Verify {
+		return userID == s.UserID
+	}
+	return perms.Has(discord.PermissionAdministrator)
+}
+
+// message builds the picker of the page of the search result of the XIVAPI search page
+func (s characterSearch) message(result XivCharacterSearch) discord.MessageUpdate {
+	_, offset := s.apiPage()
+	results := []XivReducedCharacterProfile{}
+	if offset < len(result.Results) {
+		results = result.Results[offset:]
+	}
+	if len(results) > characterSearchPageSize {
+		results = results[:characterSearchPageSize]
+	}
+	embeds := []discord.Embed{}
+	components := []discord.ContainerComponent{}
+	if len(results) == 0 {
+		content := "No matching search results were found"
+		return discord.MessageUpdate{
+			Content:    &content,
+			Embeds:     &embeds,
+			Components: &components,
+		}
+	}
+	total := result.Pagination.ResultsTotal
+	if total < s.Page*characterSearchPageSize+len(results) {
+		total = s.Page*characterSearchPageSize + len(results)
+	}
+	pages := (total + characterSearchPageSize - 1) / characterSearchPageSize
+
+	options := make([]discord.StringSelectMenuOption, len(results))
+	for i := 0; i < len(results); i++ {
+		options[i] = discord.NewStringSelectMenuOption(results[i].Name, strconv.FormatUint(uint64(results[i].ID), 10))
+		if results[i].Server != "" {
+			options[i] = options[i].WithDescription(results[i].Server)
+		}
+		if i < characterSearchMaxEmbeds {
+			embed := discord.NewEmbedBuilder().
+				SetTitle(results[i].Name).
+				SetDescription(results[i].Server)
+			if results[i].Avatar != "" {
+				embed.SetThumbnail(results[i].Avatar)
+			}
+			embeds = append(embeds, embed.Build())
+		}
+	}
+	components = append(components, discord.NewActionRow(
+		discord.NewStringSelectMenu(s.customID(characterSearchPick), "Choose the character", options...),
+	))
+	if pages > 1 {
+		prev := s
+		prev.Page--
+		next := s
+		next.Page++
+		components = append(components, discord.NewActionRow(
+			discord.NewSecondaryButton("Previous", prev.customID(characterSearchPage)).WithDisabled(s.Page == 0),
+			discord.NewSecondaryButton("Next", next.customID(characterSearchPage)).WithDisabled(s.Page+1 >= pages),
+		))
+	}
+	content := fmt.Sprintf(
+		"%d characters named %s were found, page %d of %d. Choose the character of <@%s>.",
+		total,
+		s.Name,
+		s.Page+1,
+		pages,
+		s.UserID,
+	)
+	return discord.MessageUpdate{
+		Content:    &content,
+		Embeds:     &embeds,
+		Components: &components,
+	}
+}
+
+// pick gets the reply to picking the character. the character is mapped right away when
+// an admin picks it, otherwise its verification starts.
+func (s characterSearch) pick(ctx context.Context, xivCharID string) (string, error) {
+	user := discord.User{ID: s.UserID}
+	if s.Verify {
+		content, err := startXivCharacterVerification(ctx, user, xivCharID, false)
+		if err != nil {
+			return "", fmt.Errorf("startXivCharacterVerification() error: [%w]", err)
+		}
+		return content, nil
+	}
+	content, err := mapXivCharacter(ctx, user, xivCharID)
+	if err != nil {
+		return "", fmt.Errorf("mapXivCharacter() error: [%w]", err)
+	}
+	return content, nil
+}
+
+func characterSearchComponentHandler(event *events.ComponentInteractionCreate) {
+	kind, search, err := parseCharacterSearchCustomID(event.Data.CustomID())
+	if err != nil {
+		return
+	}
+	logger := componentLogger(event)
+
+	var perms discord.Permissions
+	if event.Member() != nil {
+		perms = event.Member().Permissions
+	}
+	if !search.allowed(event.User().ID, perms) {
+		content := "Only the member searching for their character can pick it"
+		err = event.CreateMessage(discord.MessageCreate{
+			Content: content,
+			Flags:   discord.MessageFlagEphemeral,
+		})
+		if err != nil {
+			logger.Error(err)
+		}
+		return
+	}
+	err = event.DeferUpdateMessage()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if kind == characterSearchPage {
+		err = xivCharacterSearch(
+			withLogger(ctx, logger),
+			discord.User{ID: search.UserID},
+			search.Verify,
+			search.Name,
+			search.Page,
+			event.Client(),
+			event.ApplicationID(),
+			event.Token(),
+		)
+		if err != nil {
+			logger.Error(err)
+		}
+		return
+	}
+	values := event.StringSelectMenuInteractionData().Values
+	if len(values) == 0 {
+		return
+	}
+	content, err := search.pick(withLogger(ctx, logger), values[0])
+	if err != nil {
+		logger.Error(err)
+		content = "Failed to save the picked character"
+	}
+	embeds := []discord.Embed{}
+	components := []discord.ContainerComponent{}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content:    &content,
+			Embeds:     &embeds,
+			Components: &components,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+}
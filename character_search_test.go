@@ -0,0 +1,198 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func Test_characterSearch_apiPage(t *testing.T) {
+	tests := []struct {
+		name       string
+		page       int
+		wantPage   int
+		wantOffset int
+	}{
+		{name: "first page", page: 0, wantPage: 1, wantOffset: 0},
+		{name: "second half of the first api page", page: 1, wantPage: 1, wantOffset: 25},
+		{name: "second api page", page: 2, wantPage: 2, wantOffset: 0},
+		{name: "second half of the third api page", page: 5, wantPage: 3, wantOffset: 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPage, gotOffset := characterSearch{Page: tt.page}.apiPage()
+			if gotPage != tt.wantPage || gotOffset != tt.wantOffset {
+				t.Errorf("characterSearch.apiPage() = %v, %v, want %v, %v", gotPage, gotOffset, tt.wantPage, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func Test_parseCharacterSearchCustomID(t *testing.T) {
+	search := characterSearch{UserID: snowflake.ID(1234), Verify: true, Name: "Tataru Taru", Page: 3}
+	tests := []struct {
+		name     string
+		customID string
+		wantKind string
+		want     characterSearch
+		wantErr  bool
+	}{
+		{
+			name:     "pick round trip",
+			customID: search.customID(characterSearchPick),
+			wantKind: characterSearchPick,
+			want:     search,
+		},
+		{
+			name:     "admin page",
+			customID: "xiv_char_page:a:1234:0:Tataru Taru",
+			wantKind: characterSearchPage,
+			want:     characterSearch{UserID: snowflake.ID(1234), Name: "Tataru Taru"},
+		},
+		{name: "other component", customID: "share_confirm:1", wantErr: true},
+		{name: "unknown mode", customID: "xiv_char_pick:x:1234:0:Tataru Taru", wantErr: true},
+		{name: "bad user", customID: "xiv_char_pick:v:user:0:Tataru Taru", wantErr: true},
+		{name: "negative page", customID: "xiv_char_page:v:1234:-1:Tataru Taru", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKind, got, err := parseCharacterSearchCustomID(tt.customID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCharacterSearchCustomID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotKind != tt.wantKind || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCharacterSearchCustomID() = %v, %v, want %v, %v", gotKind, got, tt.wantKind, tt.want)
+			}
+		})
+	}
+}
+
+func Test_characterSearch_allowed(t *testing.T) {
+	member := snowflake.ID(1)
+	other := snowflake.ID(2)
+	tests := []struct {
+		name   string
+		search characterSearch
+		userID snowflake.ID
+		perms  discord.Permissions
+		want   bool
+	}{
+		{name: "member picks their own character", search: characterSearch{UserID: member, Verify: true}, userID: member, want: true},
+		{name: "member picks another member's character", search: characterSearch{UserID: member, Verify: true}, userID: other, want: false},
+		{name: "admin maps a character", search: characterSearch{UserID: member}, userID: other, perms: discord.PermissionAdministrator, want: true},
+		{name: "member maps a character without being an admin", search: characterSearch{UserID: member}, userID: member, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.search.allowed(tt.userID, tt.perms); got != tt.want {
+				t.Errorf("characterSearch.allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func characterSearchResults(n int) []XivReducedCharacterProfile {
+	results := make([]XivReducedCharacterProfile, n)
+	for i := 0; i < n; i++ {
+		results[i] = XivReducedCharacterProfile{ID: uint(i + 1), Name: "Tataru Taru", Server: "Behemoth"}
+	}
+	return results
+}
+
+func Test_characterSearch_message(t *testing.T) {
+	tests := []struct {
+		name        string
+		page        int
+		result      XivCharacterSearch
+		wantContent string
+		wantOptions int
+		wantFirst   string
+		wantEmbeds  int
+		// disabled state of the previous and next buttons, nil without buttons
+		wantButtons []bool
+	}{
+		{
+			name:        "nothing found",
+			wantContent: "No matching search results were found",
+		},
+		{
+			name:        "one page",
+			result:      XivCharacterSearch{Pagination: XivPagination{ResultsTotal: 3}, Results: characterSearchResults(3)},
+			wantContent: "3 characters named Tataru Taru were found, page 1 of 1. Choose the character of <@1>.",
+			wantOptions: 3,
+			wantFirst:   "1",
+			wantEmbeds:  3,
+		},
+		{
+			name:        "first of several pages",
+			result:      XivCharacterSearch{Pagination: XivPagination{ResultsTotal: 60}, Results: characterSearchResults(50)},
+			wantContent: "60 characters named Tataru Taru were found, page 1 of 3. Choose the character of <@1>.",
+			wantOptions: 25,
+			wantFirst:   "1",
+			wantEmbeds:  10,
+			wantButtons: []bool{true, false},
+		},
+		{
+			name:        "second half of the api page",
+			page:        1,
+			result:      XivCharacterSearch{Pagination: XivPagination{ResultsTotal: 60}, Results: characterSearchResults(50)},
+			wantContent: "60 characters named Tataru Taru were found, page 2 of 3. Choose the character of <@1>.",
+			wantOptions: 25,
+			wantFirst:   "26",
+			wantEmbeds:  10,
+			wantButtons: []bool{false, false},
+		},
+		{
+			name:        "last page",
+			page:        2,
+			result:      XivCharacterSearch{Pagination: XivPagination{ResultsTotal: 60}, Results: characterSearchResults(10)},
+			wantContent: "60 characters named Tataru Taru were found, page 3 of 3. Choose the character of <@1>.",
+			wantOptions: 10,
+			wantFirst:   "1",
+			wantEmbeds:  10,
+			wantButtons: []bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			search := characterSearch{UserID: snowflake.ID(1), Verify: true, Name: "Tataru Taru", Page: tt.page}
+			got := search.message(tt.result)
+			if *got.Content != tt.wantContent {
+				t.Errorf("characterSearch.message() content = %q, want %q", *got.Content, tt.wantContent)
+			}
+			if len(*got.Embeds) != tt.wantEmbeds {
+				t.Errorf("characterSearch.message() embeds = %d, want %d", len(*got.Embeds), tt.wantEmbeds)
+			}
+			components := *got.Components
+			if tt.wantOptions == 0 {
+				if len(components) != 0 {
+					t.Errorf("characterSearch.message() components = %v, want none", components)
+				}
+				return
+			}
+			menu := components[0].(discord.ActionRowComponent).Components()[0].(discord.StringSelectMenuComponent)
+			if len(menu.Options) != tt.wantOptions || menu.Options[0].Value != tt.wantFirst {
+				t.Errorf("characterSearch.message() options = %d starting at %s, want %d starting at %s", len(menu.Options), menu.Options[0].Value, tt.wantOptions, tt.wantFirst)
+			}
+			if !strings.HasPrefix(menu.CustomID, characterSearchPick+":v:1:") {
+				t.Errorf("characterSearch.message() menu custom ID = %s", menu.CustomID)
+			}
+			if tt.wantButtons == nil {
+				if len(components) != 1 {
+					t.Errorf("characterSearch.message() components = %d, want 1", len(components))
+				}
+				return
+			}
+			buttons := components[1].(discord.ActionRowComponent).Components()
+			for i := 0; i < len(tt.wantButtons); i++ {
+				if buttons[i].(discord.ButtonComponent).Disabled != tt.wantButtons[i] {
+					t.Errorf("characterSearch.message() button %d disabled = %v, want %v", i, !tt.wantButtons[i], tt.wantButtons[i])
+				}
+			}
+		})
+	}
+}
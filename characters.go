@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+// OwnershipMode is how the spreadsheets and commands of a guild show the collectibles
+// of members with several characters
+type OwnershipMode string
+
+const (
+	// a collectible is owned when any character of the member owns it
+	OwnershipAny OwnershipMode = "any"
+	// the characters owning each collectible are listed too, in the checkbox notes of
+	// the spreadsheets
+	OwnershipPerCharacter OwnershipMode = "per_character"
+)
+
+func parseOwnershipMode(s string) (OwnershipMode, error) {
+	switch OwnershipMode(strings.ToLower(strings.TrimSpace(s))) {
+	case OwnershipAny:
+		return OwnershipAny, nil
+	case OwnershipPerCharacter:
+		return OwnershipPerCharacter, nil
+	}
+	return "", fmt.Errorf("must be one of %s, %s", OwnershipAny, OwnershipPerCharacter)
+}
+
+// getGuildOwnershipMode gets the ownership mode of the guild, any until one is set
+func getGuildOwnershipMode(ctx context.Context, guildID snowflake.ID) (OwnershipMode, error) {
+	var mode string
+	err := dbpool.QueryRow(
+		ctx,
+		`
+		select coalesce(
+			(select ownership_mode from bot.guild_settings where guild_id = $1),
+			$2
+		)
+		`,
+		guildID.String(),
+		string(OwnershipAny),
+	).Scan(&mode)
+	if err != nil {
+		return "", fmt.Errorf("get bot.guild_settings error: [%w]", err)
+	}
+	return OwnershipMode(mode), nil
+}
+
+func setGuildOwnershipMode(ctx context.Context, guildID snowflake.ID, mode OwnershipMode) error {
+	_, err := dbpool.Exec(
+		ctx,
+		`
+		insert into bot.guild_settings(guild_id,ownership_mode) values($1,$2)
+		on conflict (guild_id) do update set ownership_mode = excluded.ownership_mode
+		`,
+		guildID.String(),
+		string(mode),
+	)
+	if err != nil {
+		return fmt.Errorf("upsert bot.guild_settings error: [%w]", err)
+	}
+	return nil
+}
+
+// memberCharactersQuery selects the primary character of each member from
+// bot.member_metadata together with their alts
+const memberCharactersQuery = `
+	select
+		member_discord_id,
+		member_xiv_id,
+		true as is_primary,
+		member_xiv_id_verified as verified
+	from bot.member_metadata
+	where member_xiv_id is not null
+	union all
+	select
+		member_discord_id,
+		member_xiv_id,
+		false,
+		verified
+	from bot.member_character
+`
+
+// MemberCharacter is a FF14 character linked to a member
+type MemberCharacter struct {
+	XivID string
+	// empty until the character is scanned
+	Name     string
+	Primary  bool
+	Verified bool
+}
+
+func (c MemberCharacter) displayName() string {
+	if c.Name == "" {
+		return c.XivID
+	}
+	return c.Name
+}
+
+// getMemberCharacters gets the characters of every member, or only of onlyMemberID when
+// it is set, with the primary character first
+func getMemberCharacters(ctx context.Context, onlyMemberID MemberID) (map[MemberID][]MemberCharacter, error) {
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select
+			c.member_discord_id,
+			c.member_xiv_id,
+			coalesce(x.character_name, ''),
+			c.is_primary,
+			c.verified
+		from (`+memberCharactersQuery+`) c
+		left join bot.xiv_character x
+		on x.member_xiv_id = c.member_xiv_id
+		where $1 = '' or c.member_discord_id = $1
+		order by c.member_discord_id, c.is_primary desc, x.character_name
+		`,
+		string(onlyMemberID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get member characters error: [%w]", err)
+	}
+	defer rows.Close()
+	characters := map[MemberID][]MemberCharacter{}
+	for rows.Next() {
+		var memberID string
+		var c MemberCharacter
+		err = rows.Scan(&memberID, &c.XivID, &c.Name, &c.Primary, &c.Verified)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		characters[MemberID(memberID)] = append(characters[MemberID(memberID)], c)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return characters, nil
+}
+
+// CharacterCollectibles are the collectibles found on each character of a member, by
+// character ID
+type CharacterCollectibles map[string]map[CollectibleID]bool
+
+// getCharacterCollectibles gets the collectibles found on the characters still linked
+// to each member
+func getCharacterCollectibles(ctx context.Context) (map[MemberID]CharacterCollectibles, error) {
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select
+			cc.member_discord_id,
+			cc.member_xiv_id,
+			cc.collectible_id
+		from bot.character_collectible cc
+		inner join (`+memberCharactersQuery+`) c
+		on c.member_discord_id = cc.member_discord_id and c.member_xiv_id = cc.member_xiv_id
+		`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get character collectibles error: [%w]", err)
+	}
+	defer rows.Close()
+	owned := map[MemberID]CharacterCollectibles{}
+	for rows.Next() {
+		var memberID string
+		var xivID string
+		var collectibleID string
+		err = rows.Scan(&memberID, &xivID, &collectibleID)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		if owned[MemberID(memberID)] == nil {
+			owned[MemberID(memberID)] = CharacterCollectibles{}
+		}
+		if owned[MemberID(memberID)][xivID] == nil {
+			owned[MemberID(memberID)][xivID] = map[CollectibleID]bool{}
+		}
+		owned[MemberID(memberID)][xivID][CollectibleID(collectibleID)] = true
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return owned, nil
+}
+
+// characterOwners gets the names of the characters owning each collectible, in the
+// order of the characters
+func characterOwners(characters []MemberCharacter, owned CharacterCollectibles) map[CollectibleID][]string {
+	owners := map[CollectibleID][]string{}
+	for i := 0; i < len(characters); i++ {
+		ids := []CollectibleID{}
+		for id := range owned[characters[i].XivID] {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+		for j := 0; j < len(ids); j++ {
+			owners[ids[j]] = append(owners[ids[j]], characters[i].displayName())
+		}
+	}
+	return owners
+}
+
+// getCharacterOwners gets the names of the characters of each member owning each
+// collectible
+func getCharacterOwners(ctx context.Context) (map[MemberID]map[CollectibleID][]string, error) {
+	characters, err := getMemberCharacters(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("getMemberCharacters() error: [%w]", err)
+	}
+	owned, err := getCharacterCollectibles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getCharacterCollectibles() error: [%w]", err)
+	}
+	owners := map[MemberID]map[CollectibleID][]string{}
+	for memberID, c := range characters {
+		owners[memberID] = characterOwners(c, owned[memberID])
+	}
+	return owners, nil
+}
+
+// removeXivAlt unlinks the alt from the member together with the collectibles found on it
+func removeXivAlt(ctx context.Context, memberID MemberID, xivCharID string) (bool, error) {
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("dbpool.Begin() error: [%w]", err)
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(
+		ctx,
+		`delete from bot.member_character where member_discord_id = $1 and member_xiv_id = $2`,
+		string(memberID),
+		xivCharID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("delete from bot.member_character error: [%w]", err)
+	}
+	_, err = tx.Exec(
+		ctx,
+		`delete from bot.character_collectible where member_discord_id = $1 and member_xiv_id = $2`,
+		string(memberID),
+		xivCharID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("delete from bot.character_collectible error: [%w]", err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// setPrimaryXivCharacter makes the alt the primary character of the member. the former
+// primary character becomes an alt.
+func setPrimaryXivCharacter(ctx context.Context, memberID MemberID, xivCharID string) (bool, error) {
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("dbpool.Begin() error: [%w]", err)
+	}
+	defer tx.Rollback(ctx)
+	var verified bool
+	err = tx.QueryRow(
+		ctx,
+		`
+		delete from bot.member_character
+		where member_discord_id = $1 and member_xiv_id = $2
+		returning verified
+		`,
+		string(memberID),
+		xivCharID,
+	).Scan(&verified)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("delete from bot.member_character error: [%w]", err)
+	}
+	_, err = tx.Exec(
+		ctx,
+		`
+		insert into bot.member_character(member_discord_id,member_xiv_id,verified)
+		select member_discord_id, member_xiv_id, member_xiv_id_verified
+		from bot.member_metadata
+		where member_discord_id = $1 and member_xiv_id is not null
+		`,
+		string(memberID),
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert into bot.member_character error: [%w]", err)
+	}
+	_, err = tx.Exec(
+		ctx,
+		`update bot.member_metadata set member_xiv_id=$1, member_xiv_id_verified=$2 where member_discord_id=$3`,
+		xivCharID,
+		verified,
+		string(memberID),
+	)
+	if err != nil {
+		return false, fmt.Errorf("update bot.member_metadata error: [%w]", err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	return true, nil
+}
+
+// collectibleCounts gets the number of collectibles of each type, like "Mounts: 3,
+// Minions: 1", or "nothing" without any
+func collectibleCounts(ids map[CollectibleID]bool, collectibles map[CollectibleID]*Collectible, lang Language) string {
+	counts := map[CollectibleType]int{}
+	for id := range ids {
+		if c, ok := collectibles[id]; ok {
+			counts[c.Type]++
+		}
+	}
+	parts := []string{}
+	for i := 0; i < len(collectibleTypes); i++ {
+		if counts[collectibleTypes[i]] > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", collectibleTypes[i].plural(lang), counts[collectibleTypes[i]]))
+		}
+	}
+	if len(parts) == 0 {
+		return "nothing"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// renderMemberCharacters lists the characters of a member with the collectibles they own,
+// per character or as the collectibles owned by any of them
+func renderMemberCharacters(
+	characters []MemberCharacter,
+	owned CharacterCollectibles,
+	anyOwned map[CollectibleID]bool,
+	collectibles map[CollectibleID]*Collectible,
+	mode OwnershipMode,
+	lang Language,
+) string {
+	if len(characters) == 0 {
+		return "No character is linked, use /map_xiv_char_id to link one"
+	}
+	lines := []string{}
+	for i := 0; i < len(characters); i++ {
+		c := characters[i]
+		flags := []string{}
+		if c.Primary {
+			flags = append(flags, "primary")
+		} else {
+			flags = append(flags, "alt")
+		}
+		if c.Verified {
+			flags = append(flags, "verified")
+		}
+		line := fmt.Sprintf("%s (%s), %s", c.displayName(), c.XivID, strings.Join(flags, ", "))
+		if mode == OwnershipPerCharacter {
+			line += ": " + collectibleCounts(owned[c.XivID], collectibles, lang)
+		}
+		lines = append(lines, line)
+	}
+	if mode != OwnershipPerCharacter {
+		lines = append(lines, "Owned by any character: "+collectibleCounts(anyOwned, collectibles, lang))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// syncOwnershipNotes rewrites the scanned checkboxes of the spreadsheets of the guild and
+// their notes from the collectibles saved in the database, after its ownership mode changed
+func syncOwnershipNotes(ctx context.Context, guildID snowflake.ID) error {
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	owned, err := getOwnedCollectibles(ctx)
+	if err != nil {
+		return fmt.Errorf("getOwnedCollectibles() error: [%w]", err)
+	}
+	owners, err := getCharacterOwners(ctx)
+	if err != nil {
+		return fmt.Errorf("getCharacterOwners() error: [%w]", err)
+	}
+	members, err := getMembersFromDB(ctx)
+	if err != nil {
+		return fmt.Errorf("getMembersFromDB() error: [%w]", err)
+	}
+	ownedSets := map[snowflake.ID]map[CollectibleID]bool{}
+	memberNames := map[snowflake.ID]string{}
+	for i := 0; i < len(members); i++ {
+		memberID, err := snowflake.Parse(string(members[i].id))
+		if err != nil {
+			return fmt.Errorf("snowflake.Parse() error; member_discord_id=%s: [%w]", members[i].id, err)
+		}
+		ownedSets[memberID] = owned[members[i].id]
+		memberNames[memberID] = members[i].name
+	}
+	for i := 0; i < len(trackers); i++ {
+		if trackers[i].GuildID != guildID.String() || trackers[i].FileID == "" {
+			continue
+		}
+		err = updateSheetCollectibles(ctx, trackers[i], ownedSets, owners, memberNames, nil)
+		if err != nil {
+			return fmt.Errorf("updateSheetCollectibles() error; role_id=%s: [%w]", trackers[i].RoleID, err)
+		}
+	}
+	return nil
+}
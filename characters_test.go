@@ -0,0 +1,183 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseOwnershipMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    OwnershipMode
+		wantErr bool
+	}{
+		{name: "any", s: "any", want: OwnershipAny},
+		{name: "per character with other casing", s: " Per_Character ", want: OwnershipPerCharacter},
+		{name: "unknown", s: "each", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOwnershipMode(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseOwnershipMode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseOwnershipMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_characterOwners(t *testing.T) {
+	characters := []MemberCharacter{
+		{XivID: "1", Name: "Main Character", Primary: true},
+		{XivID: "2", Name: "Alt Character"},
+		{XivID: "3"},
+	}
+	tests := []struct {
+		name  string
+		owned CharacterCollectibles
+		want  map[CollectibleID][]string
+	}{
+		{
+			name:  "nothing scanned",
+			owned: nil,
+			want:  map[CollectibleID][]string{},
+		},
+		{
+			name: "owners in the order of the characters",
+			owned: CharacterCollectibles{
+				"1": {"a": true, "b": true},
+				"2": {"a": true},
+				"3": {"b": true},
+			},
+			want: map[CollectibleID][]string{
+				"a": {"Main Character", "Alt Character"},
+				"b": {"Main Character", "3"},
+			},
+		},
+		{
+			name: "unlinked characters are left out",
+			owned: CharacterCollectibles{
+				"2":  {"a": true},
+				"99": {"b": true},
+			},
+			want: map[CollectibleID][]string{
+				"a": {"Alt Character"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := characterOwners(characters, tt.owned); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("characterOwners() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracker_owners(t *testing.T) {
+	characterOwners := map[CollectibleID][]string{"a": {"Main Character"}}
+	tests := []struct {
+		name    string
+		tracker *Tracker
+		want    []string
+		wantNil bool
+	}{
+		{name: "any character", tracker: &Tracker{Ownership: OwnershipAny}, wantNil: true},
+		{name: "per character", tracker: &Tracker{Ownership: OwnershipPerCharacter}, want: []string{"Main Character"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.tracker.owners(characterOwners)
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("Tracker.owners() nil = %v, want %v", got == nil, tt.wantNil)
+			}
+			if got != nil && !reflect.DeepEqual(got("a"), tt.want) {
+				t.Errorf("Tracker.owners()(a) = %v, want %v", got("a"), tt.want)
+			}
+		})
+	}
+}
+
+func Test_renderMemberCharacters(t *testing.T) {
+	collectibles := map[CollectibleID]*Collectible{
+		"a": {ID: "a", Type: CollectibleTypeMount},
+		"b": {ID: "b", Type: CollectibleTypeMount},
+		"c": {ID: "c", Type: CollectibleTypeMinion},
+	}
+	characters := []MemberCharacter{
+		{XivID: "1", Name: "Main Character", Primary: true, Verified: true},
+		{XivID: "2"},
+	}
+	owned := CharacterCollectibles{
+		"1": {"a": true, "c": true},
+		"2": {"b": true},
+	}
+	anyOwned := map[CollectibleID]bool{"a": true, "b": true, "c": true}
+	tests := []struct {
+		name       string
+		characters []MemberCharacter
+		mode       OwnershipMode
+		lang       Language
+		want       string
+	}{
+		{
+			name: "no character",
+			mode: OwnershipAny,
+			want: "No character is linked, use /map_xiv_char_id to link one",
+		},
+		{
+			name:       "any character",
+			characters: characters,
+			mode:       OwnershipAny,
+			want:       "Main Character (1), primary, verified\n2 (2), alt\nOwned by any character: Mounts: 2, Minions: 1",
+		},
+		{
+			name:       "per character",
+			characters: characters,
+			mode:       OwnershipPerCharacter,
+			want:       "Main Character (1), primary, verified: Mounts: 1, Minions: 1\n2 (2), alt: Mounts: 1",
+		},
+		{
+			name:       "per character in french",
+			characters: characters[1:],
+			mode:       OwnershipPerCharacter,
+			lang:       LanguageFrench,
+			want:       "2 (2), alt: Mounts: 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderMemberCharacters(tt.characters, owned, anyOwned, collectibles, tt.mode, tt.lang); got != tt.want {
+				t.Errorf("renderMemberCharacters() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_collectibleCounts(t *testing.T) {
+	collectibles := map[CollectibleID]*Collectible{
+		"a": {ID: "a", Type: CollectibleTypeMinion},
+		"b": {ID: "b", Type: CollectibleTypeMinion},
+	}
+	tests := []struct {
+		name string
+		ids  map[CollectibleID]bool
+		lang Language
+		want string
+	}{
+		{name: "nothing", ids: nil, want: "nothing"},
+		{name: "untracked collectibles are left out", ids: map[CollectibleID]bool{"a": true, "z": true}, want: "Minions: 1"},
+		{name: "translated type", ids: map[CollectibleID]bool{"a": true, "b": true}, lang: LanguageGerman, want: "Begleiter: 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collectibleCounts(tt.ids, collectibles, tt.lang); got != tt.want {
+				t.Errorf("collectibleCounts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
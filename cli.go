@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// cliCommand is a subcommand of the tataru binary. Every command takes the config
+// flags as well as its own.
+type cliCommand struct {
+	name    string
+	summary string
+	// setup adds the command's own flags to fs and returns the function that runs the
+	// command once the flags and the config are parsed
+	setup func(fs *flag.FlagSet) func(ctx context.Context, config *Config) error
+}
+
+func cliCommands() []cliCommand {
+	return []cliCommand{
+		{
+			name:    "run",
+			summary: "run the bot (default)",
+			setup: func(fs *flag.FlagSet) func(ctx context.Context, config *Config) error {
+				return runBot
+			},
+		},
+		{
+			name:    "migrate",
+			summary: "apply the pending database migrations",
+			setup:   migrateCommand,
+		},
+		{
+			name:    "seed",
+			summary: "copy the initial data into the empty reference tables",
+			setup:   seedCommand,
+		},
+		{
+			name:    "rebuild-sheet",
+			summary: "build a new spreadsheet from the database, and sync the members of a guild",
+			setup:   rebuildSheetCommand,
+		},
+		{
+			name:    "adopt",
+			summary: "take over an existing spreadsheet and import its checkboxes",
+			setup:   adoptCommand,
+		},
+		{
+			name:    "scan",
+			summary: "scan the mounts of every member, or of one member",
+			setup:   scanCommand,
+		},
+		{
+			name:    "export",
+			summary: "export the tracker data to a JSON bundle or a directory of CSV files",
+			setup:   exportCommand,
+		},
+		{
+			name:    "import",
+			summary: "import tracker data exported by the export command",
+			setup:   importCommand,
+		},
+		{
+			name:    "doctor",
+			summary: "check the config, the database and the external services",
+			setup:   doctorCommand,
+		},
+	}
+}
+
+var (
+	cancelWorkers   context.CancelFunc = func() {}
+	stopWorkersOnce sync.Once
+)
+
+// runCLI runs the command named by the first argument and returns the exit code.
+// without a command name the bot is run.
+func runCLI(args []string) int {
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name = args[0]
+		args = args[1:]
+	}
+	if name == "help" {
+		printCLIUsage(os.Stdout)
+		return 0
+	}
+	var cmd *cliCommand
+	commands := cliCommands()
+	for i := 0; i < len(commands); i++ {
+		if commands[i].name == name {
+			cmd = &commands[i]
+			break
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		printCLIUsage(os.Stderr)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("tataru "+name, flag.ContinueOnError)
+	run := cmd.setup(fs)
+	config, err := LoadConfigWithFlags(fs, args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		log.Error(err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return 2
+	}
+	configArgs = args
+	setBotConfig(config)
+	configureLogger(config.LogLevel, config.LogFormat, configSecrets(config)...)
+	log.Debug("parsed bot config")
+
+	// the root context is cancelled on shutdown and is passed to every worker and db call
+	var stop context.CancelFunc
+	ctx, stop = signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	var workerCtx context.Context
+	workerCtx, cancelWorkers = context.WithCancel(ctx)
+	workers = NewWorkerSupervisor(workerCtx)
+
+	err = run(ctx, config)
+	stopWorkers()
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	return 0
+}
+
+func printCLIUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: tataru [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	commands := cliCommands()
+	for i := 0; i < len(commands); i++ {
+		fmt.Fprintf(w, "  %-14s %s\n", commands[i].name, commands[i].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "run 'tataru <command> -h' for the flags of a command")
+}
+
+// stopWorkers cancels the workers and waits for them to stop, so that queued sheet
+// updates are written before the db pool and the process go away. commands defer it
+// after they open the db pool.
+func stopWorkers() {
+	stopWorkersOnce.Do(func() {
+		cancelWorkers()
+		stopped := make(chan struct{})
+		go func() {
+			workers.Wait()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			log.Info("all workers stopped")
+		case <-time.After(shutdownTimeout):
+			log.Warnf("workers did not stop within %s", shutdownTimeout)
+		}
+	})
+}
+
+// newDiscordRest creates a discord REST client for commands that do not open the gateway
+func newDiscordRest(config *Config) rest.Rest {
+	return rest.New(rest.NewClient(config.DiscordToken, rest.WithLogger(log)))
+}
+
+func migrateCommand(fs *flag.FlagSet) func(ctx context.Context, config *Config) error {
+	status := fs.Bool("status", false, "list the applied and pending migrations without applying any")
+	return func(ctx context.Context, config *Config) error {
+		var err error
+		dbpool, err = connectDB(ctx, config)
+		if err != nil {
+			return fmt.Errorf("connectDB() error: [%w]", err)
+		}
+		defer dbpool.Close()
+		if *status {
+			applied, err := getAppliedMigrations(ctx)
+			if err != nil {
+				return fmt.Errorf("getAppliedMigrations() error: [%w]", err)
+			}
+			for i := 0; i < len(applied); i++ {
+				fmt.Printf("applied  %3d  %s  (%s)\n", applied[i].Version, applied[i].Name, applied[i].AppliedAt.Format(time.RFC3339))
+			}
+			pending := pendingMigrations(applied)
+			for i := 0; i < len(pending); i++ {
+				fmt.Printf("pending  %3d  %s\n", pending[i].version, pending[i].name)
+			}
+			return nil
+		}
+		applied, err := migrateDB(ctx)
+		for i := 0; i < len(applied); i++ {
+			fmt.Printf("applied  %3d  %s\n", applied[i].version, applied[i].name)
+		}
+		if err != nil {
+			return fmt.Errorf("migrateDB() error: [%w]", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return nil
+	}
+}
+
+func seedCommand(fs *flag.FlagSet) func(ctx context.Context, config *Config) error {
+	return func(ctx context.Context, config *Config) error {
+		var err error
+		dbpool, err = connectDB(ctx, config)
+		if err != nil {
+			return fmt.Errorf("connectDB() error: [%w]", err)
+		}
+		defer dbpool.Close()
+		seeded, err := seedDB(ctx)
+		if err != nil {
+			return fmt.Errorf("seedDB() error: [%w]", err)
+		}
+		for i := 0; i < len(seeded); i++ {
+			fmt.Printf("seeded %s\n", seeded[i])
+		}
+		if len(seeded) == 0 {
+			fmt.Println("every reference table already has data")
+		}
+		return nil
+	}
+}
+
+func rebuildSheetCommand(fs *flag.FlagSet) func(ctx context.Context, config *Config) error {
+	guild := fs.String("guild", "", "ID of the guild whose members are synced into the new spreadsheet")
+	trashOld := fs.Bool("trash-old", false, "move the previous spreadsheet to the google drive trash")
+	role := fs.String("role", "", "ID of the watched role whose spreadsheet is rebuilt, when several roles are watched")
+	return func(ctx context.Context, config *Config) error {
+		guildID := nullSnowflake
+		if *guild != "" {
+			var err error
+			guildID, err = snowflake.Parse(*guild)
+			if err != nil {
+				return fmt.Errorf("-guild must be a guild ID: [%w]", err)
+			}
+		}
+		var err error
+		dbpool, err = connectDB(ctx, config)
+		if err != nil {
+			return fmt.Errorf("connectDB() error: [%w]", err)
+		}
+		defer dbpool.Close()
+		defer stopWorkers()
+		err = initGoogleServices(ctx, config)
+		if err != nil {
+			return fmt.Errorf("initGoogleServices() error: [%w]", err)
+		}
+		startGoogleSheetsWriter()
+
+		tracker, err := resolveTracker(ctx, RoleID(*role))
+		if err != nil {
+			return fmt.Errorf("resolveTracker() error: [%w]", err)
+		}
+		fileID, err := rebuildSpreadsheet(withLogger(ctx, jobLogger("rebuild_spreadsheet")), tracker, *trashOld)
+		if err != nil {
+			return fmt.Errorf("rebuildSpreadsheet() error: [%w]", err)
+		}
+		fmt.Printf("spreadsheet rebuilt from the database: %s\n", *fileID)
+		if guildID == nullSnowflake {
+			return nil
+		}
+
+		discordRest := newDiscordRest(config)
+		defer discordRest.Close(context.Background())
+		members, err := discordRest.GetMembers(guildID, guildMemberCountRequestLimit, nullSnowflake)
+		if err != nil {
+			return fmt.Errorf("GetMembers() error: [%w]", err)
+		}
+		err = syncRoleMembers(ctx, tracker, members, nil)
+		if err != nil {
+			return fmt.Errorf("syncRoleMembers() error: [%w]", err)
+		}
+		err = discordNicknameScan(ctx, guildID, members)
+		if err != nil {
+			return fmt.Errorf("discordNicknameScan() error: [%w]", err)
+		}
+		fmt.Println("members synced")
+		return nil
+	}
+}
+
+func adoptCommand(fs *flag.FlagSet) func(ctx context.Context, config *Config) error {
+	spreadsheet := fs.String("spreadsheet", "", "ID or URL of the spreadsheet to adopt (required)")
+	role := fs.String("role", "", "ID of the watched role that adopts the spreadsheet, when several roles are watched")
+	return func(ctx context.Context, config *Config) error {
+		fileID, err := parseSpreadsheetID(*spreadsheet)
+		if err != nil {
+			return fmt.Errorf("-spreadsheet error: [%w]", err)
+		}
+		dbpool, err = connectDB(ctx, config)
+		if err != nil {
+			return fmt.Errorf("connectDB() error: [%w]", err)
+		}
+		defer dbpool.Close()
+		defer stopWorkers()
+		err = initGoogleServices(ctx, config)
+		if err != nil {
+			return fmt.Errorf("initGoogleServices() error: [%w]", err)
+		}
+		startGoogleSheetsWriter()
+
+		tracker, err := resolveTracker(ctx, RoleID(*role))
+		if err != nil {
+			return fmt.Errorf("resolveTracker() error: [%w]", err)
+		}
+		report, err := adoptSpreadsheet(withLogger(ctx, jobLogger("adopt_spreadsheet")), tracker, fileID)
+		if err != nil {
+			return fmt.Errorf("adoptSpreadsheet() error: [%w]", err)
+		}
+		fmt.Print(report.Render())
+		return nil
+	}
+}
+
+func scanCommand(fs *flag.FlagSet) func(ctx context.Context, config *Config) error {
+	member := fs.String("member", "", "discord ID of the only member to scan")
+	dryRun := fs.Bool("dry-run", false, "print what would change without changing anything")
+	return func(ctx context.Context, config *Config) error {
+		memberID := nullSnowflake
+		if *member != "" {
+			var err error
+			memberID, err = snowflake.Parse(*member)
+			if err != nil {
+				return fmt.Errorf("-member must be a discord user ID: [%w]", err)
+			}
+		}
+		var err error
+		dbpool, err = connectDB(ctx, config)
+		if err != nil {
+			return fmt.Errorf("connectDB() error: [%w]", err)
+		}
+		defer dbpool.Close()
+		defer stopWorkers()
+		err = initGoogleServices(ctx, config)
+		if err != nil {
+			return fmt.Errorf("initGoogleServices() error: [%w]", err)
+		}
+		xivapiClient = NewXivApiClient(config.XivapiApiKey, nil)
+		startGoogleSheetsWriter()
+		startXivapiLodestoneLimiter()
+
+		var plan *SyncPlan
+		if *dryRun {
+			plan = &SyncPlan{}
+		}
+		start := time.Now()
+		err = xivCollectibleScan(withLogger(ctx, jobLogger("mount_scan")), memberID, plan)
+		observeScan("mount", start, err)
+		if err != nil {
+			return fmt.Errorf("xivCollectibleScan() error: [%w]", err)
+		}
+		if plan != nil {
+			fmt.Print(plan.Render())
+			return nil
+		}
+		fmt.Println("mount scan completed")
+		return nil
+	}
+}
+
+func exportCommand(fs *flag.FlagSet) func(ctx context.Context, config *Config) error {
+	out := fs.String("out", "-", "file for the JSON bundle, - for stdout, or the directory for -format csv")
+	format := fs.String("format", "json", "json or csv")
+	return func(ctx context.Context, config *Config) error {
+		if *format != "json" && *format != "csv" {
+			return fmt.Errorf("-format must be json or csv, not %q", *format)
+		}
+		if *format == "csv" && *out == "-" {
+			return fmt.Errorf("-format csv needs -out to be a directory")
+		}
+		var err error
+		dbpool, err = connectDB(ctx, config)
+		if err != nil {
+			return fmt.Errorf("connectDB() error: [%w]", err)
+		}
+		defer dbpool.Close()
+		bundle, err := exportData(ctx)
+		if err != nil {
+			return fmt.Errorf("exportData() error: [%w]", err)
+		}
+		if *format == "csv" {
+			err = writeBundleCSV(*out, bundle)
+			if err != nil {
+				return fmt.Errorf("writeBundleCSV() error: [%w]", err)
+			}
+			return nil
+		}
+		if *out == "-" {
+			return writeBundleJSON(os.Stdout, bundle)
+		}
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("os.Create() error: [%w]", err)
+		}
+		defer file.Close()
+		err = writeBundleJSON(file, bundle)
+		if err != nil {
+			return fmt.Errorf("writeBundleJSON() error: [%w]", err)
+		}
+		return file.Close()
+	}
+}
+
+func importCommand(fs *flag.FlagSet) func(ctx context.Context, config *Config) error {
+	in := fs.String("in", "", "JSON bundle, - for stdin, or a directory of CSV files (required)")
+	modeFlag := fs.String("mode", string(ImportModeSkip), "what to do with rows that already exist: skip, overwrite or merge")
+	return func(ctx context.Context, config *Config) error {
+		mode, err := parseImportMode(*modeFlag)
+		if err != nil {
+			return err
+		}
+		var bundle *ExportBundle
+		switch info, statErr := os.Stat(*in); {
+		case *in == "":
+			return fmt.Errorf("-in is required")
+		case *in == "-":
+			bundle, err = readBundleJSON(os.Stdin)
+		case statErr != nil:
+			return fmt.Errorf("os.Stat() error: [%w]", statErr)
+		case info.IsDir():
+			bundle, err = readBundleCSV(*in)
+		default:
+			var file *os.File
+			file, err = os.Open(*in)
+			if err != nil {
+				return fmt.Errorf("os.Open() error: [%w]", err)
+			}
+			defer file.Close()
+			bundle, err = readBundleJSON(file)
+		}
+		if err != nil {
+			return fmt.Errorf("reading the export error: [%w]", err)
+		}
+
+		dbpool, err = connectDB(ctx, config)
+		if err != nil {
+			return fmt.Errorf("connectDB() error: [%w]", err)
+		}
+		defer dbpool.Close()
+		_, err = migrateDB(ctx)
+		if err != nil {
+			return fmt.Errorf("migrateDB() error: [%w]", err)
+		}
+		results, err := importData(ctx, bundle, mode)
+		if err != nil {
+			return fmt.Errorf("importData() error: [%w]", err)
+		}
+		for i := 0; i < len(results); i++ {
+			fmt.Printf(
+				"%-24s %5d inserted %5d updated %5d skipped\n",
+				results[i].Table,
+				results[i].Inserted,
+				results[i].Updated,
+				results[i].Skipped,
+			)
+		}
+		fmt.Println("run the member sync or tataru rebuild-sheet to update the spreadsheet")
+		return nil
+	}
+}
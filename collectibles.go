@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type BossID string
+type BossName string
+
+// CollectibleType is the category of a collectible. each category gets its own sheet
+// in every expansion that has a boss dropping one.
+type CollectibleType string
+
+const (
+	CollectibleTypeMount       CollectibleType = "mount"
+	CollectibleTypeMinion      CollectibleType = "minion"
+	CollectibleTypeOrchestrion CollectibleType = "orchestrion"
+	CollectibleTypeAchievement CollectibleType = "achievement"
+)
+
+// collectibleTypes are in the order of the sheets of an expansion
+var collectibleTypes = []CollectibleType{
+	CollectibleTypeMount,
+	CollectibleTypeMinion,
+	CollectibleTypeOrchestrion,
+	CollectibleTypeAchievement,
+}
+
+// plural gets the name of the type in sheet titles in the language
+func (t CollectibleType) plural(lang Language) string {
+	if name, ok := collectiblePlurals[lang][t]; ok {
+		return name
+	}
+	switch t {
+	case CollectibleTypeMount:
+		return "Mounts"
+	case CollectibleTypeMinion:
+		return "Minions"
+	case CollectibleTypeOrchestrion:
+		return "Orchestrion Rolls"
+	case CollectibleTypeAchievement:
+		return "Achievements"
+	}
+	return string(t)
+}
+
+// sheetTitle gets the name of the sheet of the collectibles of the type in the expansion.
+// mount sheets are named after the expansion alone, like they were before other
+// collectibles were tracked.
+func (t CollectibleType) sheetTitle(expansionName ExpansionName, lang Language) string {
+	if t == CollectibleTypeMount {
+		return string(expansionName)
+	}
+	return fmt.Sprintf("%s %s", expansionName, t.plural(lang))
+}
+
+// characterData gets the character data that lists the collectibles of the type.
+// orchestrion rolls are not on character profiles, so they are only ticked by hand.
+func (t CollectibleType) characterData() (XivCharacterData, bool) {
+	switch t {
+	case CollectibleTypeMount, CollectibleTypeMinion:
+		return XivCharacterDataMountsMinions, true
+	case CollectibleTypeAchievement:
+		return XivCharacterDataAchievements, true
+	}
+	return "", false
+}
+
+// gameDataContent gets the XIVAPI game data content the collectibles of the type are in
+func (t CollectibleType) gameDataContent() XivGameDataContent {
+	switch t {
+	case CollectibleTypeMinion:
+		return XivGameDataCompanion
+	case CollectibleTypeOrchestrion:
+		return XivGameDataOrchestrion
+	case CollectibleTypeAchievement:
+		return XivGameDataAchievement
+	}
+	return XivGameDataMount
+}
+
+type CollectibleID string
+type CollectibleName string
+type Collectible struct {
+	ID   CollectibleID
+	Type CollectibleType
+	Name CollectibleName
+	// empty when the collectible has no icon
+	Icon string
+	// ID of the collectible in the game data, 0 until it is resolved from XIVAPI
+	GameID uint
+}
+
+func getCollectibles(ctx context.Context) ([]*Collectible, error) {
+	dbcon, err := dbpool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("database connection acquire error: [%w]", err)
+	}
+	defer dbcon.Release()
+	query := `
+		select
+			collectible_id,
+			collectible_type,
+			collectible_name,
+			coalesce(icon_url, ''),
+			coalesce(game_id, 0)
+		from bot.collectible_metadata
+	`
+	rows, err := dbcon.Query(
+		ctx,
+		query,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get collectible metadata error: [%w]", err)
+	}
+	defer rows.Close()
+	collectibles := []*Collectible{}
+	for rows.Next() {
+		var collectibleID string
+		var collectibleType string
+		var collectibleName string
+		var icon string
+		var gameID int32
+		err = rows.Scan(&collectibleID, &collectibleType, &collectibleName, &icon, &gameID)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		collectibles = append(
+			collectibles,
+			&Collectible{
+				ID:     CollectibleID(collectibleID),
+				Type:   CollectibleType(collectibleType),
+				Name:   CollectibleName(collectibleName),
+				Icon:   icon,
+				GameID: uint(gameID),
+			},
+		)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return collectibles, nil
+}
+
+// collectibleCharacterData gets the character data needed to scan the collectibles,
+// without duplicates
+func collectibleCharacterData(collectibles []*Collectible) []XivCharacterData {
+	data := []XivCharacterData{}
+	seen := map[XivCharacterData]bool{}
+	for i := 0; i < len(collectibleTypes); i++ {
+		d, ok := collectibleTypes[i].characterData()
+		if !ok || seen[d] {
+			continue
+		}
+		for j := 0; j < len(collectibles); j++ {
+			if collectibles[j].Type == collectibleTypes[i] {
+				data = append(data, d)
+				seen[d] = true
+				break
+			}
+		}
+	}
+	return data
+}
+
+// characterCollectibleEntries gets the collectibles of the type on the character profile
+func characterCollectibleEntries(c XivCharacter, t CollectibleType) []XivGameData {
+	entries := []XivGameData{}
+	switch t {
+	case CollectibleTypeMount:
+		for i := 0; i < len(c.Mounts); i++ {
+			entries = append(entries, XivGameData{ID: c.Mounts[i].ID, Name: c.Mounts[i].Name})
+		}
+	case CollectibleTypeMinion:
+		for i := 0; i < len(c.Minions); i++ {
+			entries = append(entries, XivGameData{ID: c.Minions[i].ID, Name: c.Minions[i].Name})
+		}
+	case CollectibleTypeAchievement:
+		for i := 0; i < len(c.Achievements); i++ {
+			entries = append(entries, XivGameData{ID: c.Achievements[i].ID, Name: c.Achievements[i].Name})
+		}
+	}
+	return entries
+}
+
+// matches checks if the entry of a character profile is the collectible. the game IDs
+// are compared when both are known, the names are only compared as a fallback.
+func (c *Collectible) matches(entry XivGameData) bool {
+	if c.GameID != 0 && entry.ID != 0 {
+		return c.GameID == entry.ID
+	}
+	return string(c.Name) == entry.Name
+}
+
+// matchCharacterCollectibles gets the tracked collectibles on the character profile
+func matchCharacterCollectibles(c XivCharacter, collectibles []*Collectible) []*Collectible {
+	entries := map[CollectibleType][]XivGameData{}
+	matched := []*Collectible{}
+	for i := 0; i < len(collectibles); i++ {
+		t := collectibles[i].Type
+		if entries[t] == nil {
+			entries[t] = characterCollectibleEntries(c, t)
+		}
+		for j := 0; j < len(entries[t]); j++ {
+			if collectibles[i].matches(entries[t][j]) {
+				matched = append(matched, collectibles[i])
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// catalogProblem describes why the game data row found for the collectible does not
+// confirm it, or is empty when it does
+func catalogProblem(c *Collectible, row XivGameData) string {
+	if row.ID == 0 {
+		if c.GameID != 0 {
+			return fmt.Sprintf("%s %d does not exist", c.Type.gameDataContent(), c.GameID)
+		}
+		return fmt.Sprintf("no %s is named %q", c.Type.gameDataContent(), c.Name)
+	}
+	if !strings.EqualFold(row.Name, string(c.Name)) {
+		return fmt.Sprintf("%s %d is named %q", c.Type.gameDataContent(), row.ID, row.Name)
+	}
+	return ""
+}
+
+// getOwnedCollectibles gets the collectibles each member is saved to own
+func getOwnedCollectibles(ctx context.Context) (map[MemberID]map[CollectibleID]bool, error) {
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select
+			member_discord_id,
+			collectible_id
+		from bot.member_collectible
+		where has_collectible
+		`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get owned collectibles error: [%w]", err)
+	}
+	defer rows.Close()
+	owned := map[MemberID]map[CollectibleID]bool{}
+	for rows.Next() {
+		var memberID string
+		var collectibleID string
+		err = rows.Scan(&memberID, &collectibleID)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		if owned[MemberID(memberID)] == nil {
+			owned[MemberID(memberID)] = map[CollectibleID]bool{}
+		}
+		owned[MemberID(memberID)][CollectibleID(collectibleID)] = true
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return owned, nil
+}
+
+// CollectibleSheet is a sheet of the collectibles of one type dropped in one expansion,
+// titled in the language of the spreadsheet
+type CollectibleSheet struct {
+	Expansion *Expansion
+	Type      CollectibleType
+	Language  Language
+}
+
+func (s CollectibleSheet) title() string {
+	return s.Type.sheetTitle(s.Expansion.Name, s.Language)
+}
+
+// getExpansionCollectibleTypes gets the types of the collectibles dropped by the bosses
+// of each expansion
+func getExpansionCollectibleTypes(ctx context.Context) (map[ExpansionID]map[CollectibleType]bool, error) {
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select distinct
+			m.expansion_id,
+			c.collectible_type
+		from bot.boss_expansion_map m
+		inner join bot.boss_collectible_map bc
+		on bc.boss_id = m.boss_id
+		inner join bot.collectible_metadata c
+		on c.collectible_id = bc.collectible_id
+		`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get expansion collectible types error: [%w]", err)
+	}
+	defer rows.Close()
+	types := map[ExpansionID]map[CollectibleType]bool{}
+	for rows.Next() {
+		var expansionID string
+		var collectibleType string
+		err = rows.Scan(&expansionID, &collectibleType)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		if types[ExpansionID(expansionID)] == nil {
+			types[ExpansionID(expansionID)] = map[CollectibleType]bool{}
+		}
+		types[ExpansionID(expansionID)][CollectibleType(collectibleType)] = true
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return types, nil
+}
+
+// planCollectibleSheets gets the sheets of a spreadsheet of the expansions, in the order
+// of the expansions and then of collectibleTypes. every expansion has a mount sheet,
+// the other types only get a sheet where a boss drops one.
+func planCollectibleSheets(expansions []*Expansion, types map[ExpansionID]map[CollectibleType]bool, lang Language) []CollectibleSheet {
+	planned := []CollectibleSheet{}
+	for i := 0; i < len(expansions); i++ {
+		for j := 0; j < len(collectibleTypes); j++ {
+			t := collectibleTypes[j]
+			if t != CollectibleTypeMount && !types[expansions[i].ID][t] {
+				continue
+			}
+			planned = append(planned, CollectibleSheet{Expansion: expansions[i], Type: t, Language: lang})
+		}
+	}
+	return planned
+}
+
+// getCollectibleSheets gets the sheets of the spreadsheet file, with their expansions
+// named in the language
+func getCollectibleSheets(ctx context.Context, fileID FileID, lang Language) (map[SheetID]CollectibleSheet, error) {
+	translations, err := getTranslations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getTranslations() error: [%w]", err)
+	}
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select
+			s.sheet_gcp_id,
+			s.collectible_type,
+			e.expansion_id,
+			e.expansion_name,
+			e.expansion_index
+		from bot.sheet_metadata s
+		inner join bot.sheet_expansion_map sm
+		on sm.sheet_gcp_id = s.sheet_gcp_id
+		inner join bot.expansion_metadata e
+		on e.expansion_id = sm.expansion_id
+		where s.file_gcp_id = $1
+		`,
+		string(fileID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get collectible sheets error: [%w]", err)
+	}
+	defer rows.Close()
+	collectibleSheets := map[SheetID]CollectibleSheet{}
+	for rows.Next() {
+		var sheetIDStr string
+		var collectibleType string
+		var expansionID string
+		var expansionName string
+		var expansionIndex int
+		err = rows.Scan(&sheetIDStr, &collectibleType, &expansionID, &expansionName, &expansionIndex)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		sheetID, err := strconv.ParseInt(sheetIDStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("strconv.ParseInt() error: [%w]", err)
+		}
+		expansion := &Expansion{
+			ID:    ExpansionID(expansionID),
+			Name:  ExpansionName(translations.name(expansionID, lang, expansionName)),
+			Index: ExpansionIndex(expansionIndex),
+		}
+		collectibleSheets[SheetID(sheetID)] = CollectibleSheet{
+			Expansion: expansion,
+			Type:      CollectibleType(collectibleType),
+			Language:  lang,
+		}
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return collectibleSheets, nil
+}
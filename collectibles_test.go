@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_planCollectibleSheets(t *testing.T) {
+	expansions := selectExpansions(testExpansions(), nil)
+	types := map[ExpansionID]map[CollectibleType]bool{
+		"2": {CollectibleTypeMount: true},
+		"4": {CollectibleTypeMount: true, CollectibleTypeAchievement: true, CollectibleTypeMinion: true},
+	}
+	tests := []struct {
+		name string
+		lang Language
+		want []string
+	}{
+		{
+			name: "english",
+			lang: LanguageEnglish,
+			want: []string{
+				"A Realm Reborn",
+				"Heavensward",
+				"Stormblood",
+				"Stormblood Minions",
+				"Stormblood Achievements",
+			},
+		},
+		{
+			name: "german",
+			lang: LanguageGerman,
+			want: []string{
+				"A Realm Reborn",
+				"Heavensward",
+				"Stormblood",
+				"Stormblood Begleiter",
+				"Stormblood Errungenschaften",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, s := range planCollectibleSheets(expansions, types, tt.lang) {
+				got = append(got, s.title())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planCollectibleSheets() titles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_collectibleCharacterData(t *testing.T) {
+	tests := []struct {
+		name         string
+		collectibles []*Collectible
+		want         []XivCharacterData
+	}{
+		{
+			name:         "mounts and minions share the data",
+			collectibles: []*Collectible{{Type: CollectibleTypeMinion}, {Type: CollectibleTypeMount}},
+			want:         []XivCharacterData{XivCharacterDataMountsMinions},
+		},
+		{
+			name:         "orchestrion rolls are not on profiles",
+			collectibles: []*Collectible{{Type: CollectibleTypeOrchestrion}},
+			want:         []XivCharacterData{},
+		},
+		{
+			name:         "achievements",
+			collectibles: []*Collectible{{Type: CollectibleTypeAchievement}, {Type: CollectibleTypeMount}},
+			want:         []XivCharacterData{XivCharacterDataMountsMinions, XivCharacterDataAchievements},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collectibleCharacterData(tt.collectibles); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collectibleCharacterData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_matchCharacterCollectibles(t *testing.T) {
+	collectibles := []*Collectible{
+		{ID: "1", Type: CollectibleTypeMount, Name: "Ixion"},
+		{ID: "2", Type: CollectibleTypeMinion, Name: "Wind-up Ixion"},
+		{ID: "3", Type: CollectibleTypeAchievement, Name: "Ixion"},
+		{ID: "4", Type: CollectibleTypeOrchestrion, Name: "Ixion"},
+		{ID: "5", Type: CollectibleTypeMount, Name: "Renamed Lanner", GameID: 100},
+		{ID: "6", Type: CollectibleTypeMount, Name: "Gullfaxi", GameID: 101},
+	}
+	c := XivCharacter{
+		Mounts:       []XivMount{{Name: "Ixion"}, {ID: 100, Name: "Dark Lanner"}, {ID: 102, Name: "Gullfaxi"}},
+		Achievements: []XivAchievement{{Name: "Ixion"}},
+	}
+	got := []CollectibleID{}
+	for _, m := range matchCharacterCollectibles(c, collectibles) {
+		got = append(got, m.ID)
+	}
+	want := []CollectibleID{"1", "3", "5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("matchCharacterCollectibles() = %v, want %v", got, want)
+	}
+}
+
+func Test_catalogProblem(t *testing.T) {
+	tests := []struct {
+		name        string
+		collectible *Collectible
+		row         XivGameData
+		wantProblem bool
+	}{
+		{
+			name:        "found by name",
+			collectible: &Collectible{Type: CollectibleTypeMount, Name: "Gwiber Of Light"},
+			row:         XivGameData{ID: 1, Name: "Gwiber of Light"},
+		},
+		{
+			name:        "no row named like the collectible",
+			collectible: &Collectible{Type: CollectibleTypeMount, Name: "Xanthos"},
+			wantProblem: true,
+		},
+		{
+			name:        "unknown game id",
+			collectible: &Collectible{Type: CollectibleTypeMinion, Name: "Wind-up Ixion", GameID: 9999},
+			wantProblem: true,
+		},
+		{
+			name:        "game id of another collectible",
+			collectible: &Collectible{Type: CollectibleTypeMount, Name: "Xanthos", GameID: 2},
+			row:         XivGameData{ID: 2, Name: "Gullfaxi"},
+			wantProblem: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := catalogProblem(tt.collectible, tt.row); (got != "") != tt.wantProblem {
+				t.Errorf("catalogProblem() = %q, wantProblem %v", got, tt.wantProblem)
+			}
+		})
+	}
+}
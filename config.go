@@ -2,8 +2,26 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configEnvPrefix       = "TATARU_"
+	configFileEnv         = configEnvPrefix + "CONFIG"
+	configFileFlag        = "config"
+	defaultConfigFilepath = "/app/config.json"
 )
 
 type Config struct {
@@ -18,66 +36,412 @@ type Config struct {
 	DBIP                           string
 	DBPort                         string
 	DBName                         string
-	LogLevel                       uint32
+	LogLevel                       logrus.Level
+	LogFormat                      string
+	HTTPListenAddress              string
+	GoogleCredentialsFilepath      string
+	FilePermissionsFilepath        string
+	InitialDBDataDir               string
+	CharacterScanInterval          time.Duration
+	MountScanInterval              time.Duration
+	GoogleSheetsWriteRateLimit     float64 // req / sec
+	XivapiRateLimit                float64 // req / sec
+	MaxRetryDuration               time.Duration
+	DBDSN                          string
+	DBSSLMode                      string
+	DBSSLRootCert                  string
+	DBSSLCert                      string
+	DBSSLKey                       string
+	DBPoolMaxConns                 int32
+	DBPoolMinConns                 int32
+	DBPoolMaxConnLifetime          time.Duration
+	DBPoolMaxConnIdleTime          time.Duration
+	DBPoolHealthCheckPeriod        time.Duration
+	DBStatementTimeout             time.Duration
+	DBConnectTimeout               time.Duration
+	LinkEmailRole                  string
+	SpreadsheetLanguage            Language
+	// the config file the settings were read from, empty if there was none
+	ConfigFilepath string
+}
+
+var (
+	botConfigMu sync.RWMutex
+	botConfig   *Config
+)
+
+// getBotConfig gets the current config. the config is replaced rather than
+// modified on reload, so the returned value must not be changed.
+func getBotConfig() *Config {
+	botConfigMu.RLock()
+	defer botConfigMu.RUnlock()
+	return botConfig
+}
+
+func setBotConfig(c *Config) {
+	botConfigMu.Lock()
+	defer botConfigMu.Unlock()
+	botConfig = c
+}
+
+// ConfigError lists every setting that could not be loaded
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config:\n\t%s", strings.Join(e.Problems, "\n\t"))
+}
+
+type configSetting struct {
+	// snake_case name. the env var is TATARU_ + NAME and the flag is -kebab-case-name.
+	// file keys are matched ignoring case and underscores, so BotName matches bot_name.
+	name     string
+	usage    string
+	def      string
+	required bool
+	set      func(c *Config, value string) error
+}
+
+func (s configSetting) env() string {
+	return configEnvPrefix + strings.ToUpper(s.name)
+}
+
+func (s configSetting) flag() string {
+	return strings.ReplaceAll(s.name, "_", "-")
+}
+
+func stringSetting(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func durationSetting(field func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 30m or 1h")
+		}
+		if d <= 0 {
+			return fmt.Errorf("must be greater than 0")
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func rateSetting(field func(c *Config) *float64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		if f <= 0 {
+			return fmt.Errorf("must be greater than 0")
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func connCountSetting(field func(c *Config) *int32) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("must be a whole number")
+		}
+		if n < 0 {
+			return fmt.Errorf("must not be negative")
+		}
+		*field(c) = int32(n)
+		return nil
+	}
+}
+
+func configSettings() []configSetting {
+	return []configSetting{
+		{name: "bot_name", usage: "name of the bot", set: stringSetting(func(c *Config) *string { return &c.BotName })},
+		{name: "mount_spreadsheet_file_name", usage: "name of the spreadsheet file in google drive", set: stringSetting(func(c *Config) *string { return &c.MountSpreadsheetFileName })},
+		{name: "mount_spreadsheet_title", usage: "title of the spreadsheet", set: stringSetting(func(c *Config) *string { return &c.MountSpreadsheetTitle })},
+		{name: "google_drive_destination_folder_id", usage: "google drive folder the spreadsheet is created in", required: true, set: stringSetting(func(c *Config) *string { return &c.GoogleDriveDestinationFolderId })},
+		{name: "discord_token", usage: "discord bot token", required: true, set: stringSetting(func(c *Config) *string { return &c.DiscordToken })},
+		{name: "xivapi_api_key", usage: "xivapi private key", set: stringSetting(func(c *Config) *string { return &c.XivapiApiKey })},
+		{name: "db_dsn", usage: "postgres connection string, used instead of the other db connection settings", set: stringSetting(func(c *Config) *string { return &c.DBDSN })},
+		{name: "db_username", usage: "database user, required without db_dsn", set: stringSetting(func(c *Config) *string { return &c.DBUsername })},
+		{name: "db_user_password", usage: "database user password", set: stringSetting(func(c *Config) *string { return &c.DBUserPassword })},
+		{name: "db_ip", usage: "database host, required without db_dsn", set: stringSetting(func(c *Config) *string { return &c.DBIP })},
+		{
+			name:     "db_port",
+			usage:    "database port",
+			def:      "5432",
+			required: true,
+			set: func(c *Config, value string) error {
+				port, err := strconv.Atoi(value)
+				if err != nil || port < 1 || port > 65535 {
+					return fmt.Errorf("must be a port number")
+				}
+				c.DBPort = value
+				return nil
+			},
+		},
+		{name: "db_name", usage: "database name, required without db_dsn", set: stringSetting(func(c *Config) *string { return &c.DBName })},
+		{
+			name:  "db_sslmode",
+			usage: "one of disable, allow, prefer, require, verify-ca or verify-full",
+			set: func(c *Config, value string) error {
+				switch value {
+				case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+				default:
+					return fmt.Errorf("must be one of disable, allow, prefer, require, verify-ca or verify-full")
+				}
+				c.DBSSLMode = value
+				return nil
+			},
+		},
+		{name: "db_ssl_root_cert", usage: "CA certificate file used to verify the database server", set: stringSetting(func(c *Config) *string { return &c.DBSSLRootCert })},
+		{name: "db_ssl_cert", usage: "client certificate file", set: stringSetting(func(c *Config) *string { return &c.DBSSLCert })},
+		{name: "db_ssl_key", usage: "client certificate key file", set: stringSetting(func(c *Config) *string { return &c.DBSSLKey })},
+		{name: "db_pool_max_conns", usage: "maximum connections in the pool", set: connCountSetting(func(c *Config) *int32 { return &c.DBPoolMaxConns })},
+		{name: "db_pool_min_conns", usage: "connections the pool keeps open", set: connCountSetting(func(c *Config) *int32 { return &c.DBPoolMinConns })},
+		{name: "db_pool_max_conn_lifetime", usage: "time after which a connection is closed", set: durationSetting(func(c *Config) *time.Duration { return &c.DBPoolMaxConnLifetime })},
+		{name: "db_pool_max_conn_idle_time", usage: "time after which an idle connection is closed", set: durationSetting(func(c *Config) *time.Duration { return &c.DBPoolMaxConnIdleTime })},
+		{name: "db_pool_health_check_period", usage: "time between checks of idle connections", set: durationSetting(func(c *Config) *time.Duration { return &c.DBPoolHealthCheckPeriod })},
+		{name: "db_statement_timeout", usage: "postgres statement_timeout of every connection", set: durationSetting(func(c *Config) *time.Duration { return &c.DBStatementTimeout })},
+		{name: "db_connect_timeout", usage: "how long to retry connecting to the database at startup", def: "2m", set: durationSetting(func(c *Config) *time.Duration { return &c.DBConnectTimeout })},
+		{
+			name:  "log_level",
+			usage: "one of trace, debug, info, warn, error, fatal or panic",
+			def:   "info",
+			set: func(c *Config, value string) error {
+				lvl, err := logrus.ParseLevel(value)
+				if err != nil {
+					return fmt.Errorf("must be one of trace, debug, info, warn, error, fatal or panic")
+				}
+				c.LogLevel = lvl
+				return nil
+			},
+		},
+		{
+			name:  "log_format",
+			usage: "one of text or json",
+			def:   LogFormatText,
+			set: func(c *Config, value string) error {
+				if value != LogFormatText && value != LogFormatJSON {
+					return fmt.Errorf("must be one of %s or %s", LogFormatText, LogFormatJSON)
+				}
+				c.LogFormat = value
+				return nil
+			},
+		},
+		{name: "http_listen_address", usage: "address the metrics and health endpoints listen on", def: ":8080", required: true, set: stringSetting(func(c *Config) *string { return &c.HTTPListenAddress })},
+		{name: "google_credentials_file", usage: "google service account credentials file", def: "/app/svc-creds.json", required: true, set: stringSetting(func(c *Config) *string { return &c.GoogleCredentialsFilepath })},
+		{name: "file_permissions_file", usage: "spreadsheet file permissions file", def: "/app/file-permissions.json", required: true, set: stringSetting(func(c *Config) *string { return &c.FilePermissionsFilepath })},
+		{
+			name:  "link_email_role",
+			usage: "role given to the email addresses linked with /link_email, one of commenter or writer",
+			def:   "commenter",
+			set: func(c *Config, value string) error {
+				if value != "commenter" && value != "writer" {
+					return fmt.Errorf("must be one of commenter or writer")
+				}
+				c.LinkEmailRole = value
+				return nil
+			},
+		},
+		{
+			name:  "spreadsheet_language",
+			usage: "language of the boss, collectible and expansion names in the spreadsheets of guilds without a language of their own, one of en, fr, de or ja",
+			def:   string(LanguageEnglish),
+			set: func(c *Config, value string) error {
+				lang, err := parseLanguage(value)
+				if err != nil {
+					return err
+				}
+				c.SpreadsheetLanguage = lang
+				return nil
+			},
+		},
+		{name: "initial_db_data_dir", usage: "directory with the csv files the database is seeded from", def: "/app/initial-db-data", required: true, set: stringSetting(func(c *Config) *string { return &c.InitialDBDataDir })},
+		{name: "character_scan_interval", usage: "time between character id scans", def: "1h", set: durationSetting(func(c *Config) *time.Duration { return &c.CharacterScanInterval })},
+		{name: "mount_scan_interval", usage: "time between mount scans", def: "30m", set: durationSetting(func(c *Config) *time.Duration { return &c.MountScanInterval })},
+		{name: "google_sheets_write_rate_limit", usage: "google sheets writes per second", def: "1", set: rateSetting(func(c *Config) *float64 { return &c.GoogleSheetsWriteRateLimit })},
+		{name: "xivapi_rate_limit", usage: "xivapi requests per second", def: "1", set: rateSetting(func(c *Config) *float64 { return &c.XivapiRateLimit })},
+		{name: "max_retry_duration", usage: "longest wait between retries of rate limited requests", def: "1h", set: durationSetting(func(c *Config) *time.Duration { return &c.MaxRetryDuration })},
+	}
 }
 
-func NewConfig(configFilepath string) (*Config, error) {
-	configFile, err := os.Open(configFilepath)
+// normalizeConfigKey lets file keys be written as BotName, botName or bot_name
+func normalizeConfigKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+type configValue struct {
+	value  string
+	source string
+}
+
+// LoadConfig layers the settings from their defaults, then the config file, then
+// TATARU_* env vars, then the command line flags. The config file is JSON unless
+// it has a .yaml or .yml extension.
+func LoadConfig(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	return LoadConfigWithFlags(flag.NewFlagSet("tataru", flag.ContinueOnError), args, lookupEnv)
+}
+
+// LoadConfigWithFlags is LoadConfig with the config flags added to fs, so that a
+// subcommand can parse its own flags alongside them
+func LoadConfigWithFlags(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	settings := configSettings()
+
+	configFilepath := fs.String(configFileFlag, "", fmt.Sprintf("config file (env %s, default %s)", configFileEnv, defaultConfigFilepath))
+	flagVals := map[string]*string{}
+	for i := 0; i < len(settings); i++ {
+		usage := fmt.Sprintf("%s (env %s", settings[i].usage, settings[i].env())
+		if settings[i].def != "" {
+			usage = fmt.Sprintf("%s, default %s", usage, settings[i].def)
+		}
+		flagVals[settings[i].flag()] = fs.String(settings[i].flag(), "", usage+")")
+	}
+	err := fs.Parse(args)
 	if err != nil {
-		return nil, fmt.Errorf("os.Open() error: [%w]", err)
-	}
-	defer configFile.Close()
-
-	rawConfig := struct {
-		BotName                        string
-		MountSpreadsheetFileName       string
-		MountSpreadsheetTitle          string
-		GoogleDriveDestinationFolderId string
-		DiscordToken                   string
-		XivapiApiKey                   string
-		DBUsername                     string
-		DBUserPassword                 string
-		DBIP                           string
-		DBPort                         string
-		DBName                         string
-		LogLevel                       string
-	}{}
-	err = json.NewDecoder(configFile).Decode(&rawConfig)
+		return nil, err
+	}
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	problems := []string{}
+	values := map[string]configValue{}
+	for i := 0; i < len(settings); i++ {
+		if settings[i].def != "" {
+			values[settings[i].name] = configValue{value: settings[i].def, source: "default"}
+		}
+	}
+
+	// config file
+	path := defaultConfigFilepath
+	pathIsExplicit := false
+	if envPath, ok := lookupEnv(configFileEnv); ok && envPath != "" {
+		path = envPath
+		pathIsExplicit = true
+	}
+	if setFlags[configFileFlag] {
+		path = *configFilepath
+		pathIsExplicit = true
+	}
+	fileVals, err := readConfigFile(path)
+	if err != nil && (pathIsExplicit || !errors.Is(err, os.ErrNotExist)) {
+		return nil, fmt.Errorf("readConfigFile() error: [%w]", err)
+	}
+	if err != nil {
+		path = ""
+	}
+	keyToName := map[string]string{}
+	for i := 0; i < len(settings); i++ {
+		keyToName[normalizeConfigKey(settings[i].name)] = settings[i].name
+	}
+	for key, value := range fileVals {
+		name, ok := keyToName[normalizeConfigKey(key)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s (from file %s): unknown setting", key, path))
+			continue
+		}
+		values[name] = configValue{value: value, source: "file " + path}
+	}
+
+	// env vars then flags
+	for i := 0; i < len(settings); i++ {
+		if value, ok := lookupEnv(settings[i].env()); ok {
+			values[settings[i].name] = configValue{value: value, source: "env " + settings[i].env()}
+		}
+		if setFlags[settings[i].flag()] {
+			values[settings[i].name] = configValue{value: *flagVals[settings[i].flag()], source: "flag -" + settings[i].flag()}
+		}
+	}
+
+	config := &Config{ConfigFilepath: path}
+	for i := 0; i < len(settings); i++ {
+		v := values[settings[i].name]
+		if v.value == "" {
+			if settings[i].required {
+				problems = append(problems, fmt.Sprintf("%s: is required (set %s)", settings[i].name, settings[i].env()))
+			}
+			continue
+		}
+		err = settings[i].set(config, v.value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s (from %s): %s", settings[i].name, v.source, err))
+		}
+	}
+	problems = append(problems, config.validate()...)
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, &ConfigError{Problems: problems}
+	}
+	return config, nil
+}
+
+// validate checks the settings that depend on each other
+func (c *Config) validate() []string {
+	problems := []string{}
+	if c.DBDSN == "" {
+		if c.DBUsername == "" {
+			problems = append(problems, "db_username: is required without db_dsn")
+		}
+		if c.DBIP == "" {
+			problems = append(problems, "db_ip: is required without db_dsn")
+		}
+		if c.DBName == "" {
+			problems = append(problems, "db_name: is required without db_dsn")
+		}
+	} else if c.DBSSLMode != "" || c.DBSSLRootCert != "" || c.DBSSLCert != "" || c.DBSSLKey != "" {
+		problems = append(problems, "db_dsn: the tls settings must be part of db_dsn when it is set")
+	}
+	if (c.DBSSLCert == "") != (c.DBSSLKey == "") {
+		problems = append(problems, "db_ssl_cert: db_ssl_cert and db_ssl_key must be set together")
+	}
+	if c.DBPoolMaxConns > 0 && c.DBPoolMinConns > c.DBPoolMaxConns {
+		problems = append(problems, "db_pool_min_conns: must not be more than db_pool_max_conns")
+	}
+	return problems
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("json.NewDecoder().Decode() error: [%w]", err)
-	}
-
-	var lvl uint32
-	switch rawConfig.LogLevel {
-	case "panic":
-		lvl = 6
-	case "fatal":
-		lvl = 5
-	case "error":
-		lvl = 4
-	case "warn":
-		lvl = 3
-	case "info":
-		lvl = 2
-	case "debug":
-		lvl = 1
-	case "trace":
-		lvl = 0
+		return nil, fmt.Errorf("os.ReadFile() error: [%w]", err)
+	}
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+		if err != nil {
+			return nil, fmt.Errorf("yaml.Unmarshal() error: [%w]", err)
+		}
 	default:
-		lvl = 2
-	}
-	return &Config{
-		BotName:                        rawConfig.BotName,
-		MountSpreadsheetFileName:       rawConfig.MountSpreadsheetFileName,
-		MountSpreadsheetTitle:          rawConfig.MountSpreadsheetTitle,
-		GoogleDriveDestinationFolderId: rawConfig.GoogleDriveDestinationFolderId,
-		DiscordToken:                   rawConfig.DiscordToken,
-		XivapiApiKey:                   rawConfig.XivapiApiKey,
-		DBUsername:                     rawConfig.DBUsername,
-		DBUserPassword:                 rawConfig.DBUserPassword,
-		DBIP:                           rawConfig.DBIP,
-		DBPort:                         rawConfig.DBPort,
-		DBName:                         rawConfig.DBName,
-		LogLevel:                       lvl,
-	}, nil
+		err = json.Unmarshal(b, &raw)
+		if err != nil {
+			return nil, fmt.Errorf("json.Unmarshal() error: [%w]", err)
+		}
+	}
+	vals := map[string]string{}
+	for key, value := range raw {
+		switch v := value.(type) {
+		case nil:
+			vals[key] = ""
+		case string:
+			vals[key] = v
+		case float64:
+			vals[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case int:
+			vals[key] = strconv.Itoa(v)
+		case bool:
+			vals[key] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("setting %s must be a string or a number", key)
+		}
+	}
+	return vals, nil
 }
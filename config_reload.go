@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+const configWatchInterval = time.Duration(10) * time.Second
+
+// settings that are only read at startup, so changing them needs a restart
+var restartOnlySettings = []struct {
+	name  string
+	field string
+}{
+	{name: "discord_token", field: "DiscordToken"},
+	{name: "xivapi_api_key", field: "XivapiApiKey"},
+	{name: "db_dsn", field: "DBDSN"},
+	{name: "db_username", field: "DBUsername"},
+	{name: "db_user_password", field: "DBUserPassword"},
+	{name: "db_ip", field: "DBIP"},
+	{name: "db_port", field: "DBPort"},
+	{name: "db_name", field: "DBName"},
+	{name: "db_sslmode", field: "DBSSLMode"},
+	{name: "db_ssl_root_cert", field: "DBSSLRootCert"},
+	{name: "db_ssl_cert", field: "DBSSLCert"},
+	{name: "db_ssl_key", field: "DBSSLKey"},
+	{name: "db_pool_max_conns", field: "DBPoolMaxConns"},
+	{name: "db_pool_min_conns", field: "DBPoolMinConns"},
+	{name: "db_pool_max_conn_lifetime", field: "DBPoolMaxConnLifetime"},
+	{name: "db_pool_max_conn_idle_time", field: "DBPoolMaxConnIdleTime"},
+	{name: "db_pool_health_check_period", field: "DBPoolHealthCheckPeriod"},
+	{name: "db_statement_timeout", field: "DBStatementTimeout"},
+	{name: "http_listen_address", field: "HTTPListenAddress"},
+	{name: "google_credentials_file", field: "GoogleCredentialsFilepath"},
+}
+
+// configSecrets gets the settings that must never be logged
+func configSecrets(c *Config) []string {
+	return []string{
+		c.DiscordToken,
+		c.XivapiApiKey,
+		c.DBUserPassword,
+		c.DBDSN,
+	}
+}
+
+// mergeReloadedConfig takes the reloaded config but keeps the running values of the
+// settings that are only read at startup. it returns the names of those that changed.
+func mergeReloadedConfig(running, reloaded *Config) (*Config, []string) {
+	merged := *reloaded
+	restartRequired := []string{}
+	runningVal := reflect.ValueOf(running).Elem()
+	mergedVal := reflect.ValueOf(&merged).Elem()
+	for i := 0; i < len(restartOnlySettings); i++ {
+		runningField := runningVal.FieldByName(restartOnlySettings[i].field)
+		mergedField := mergedVal.FieldByName(restartOnlySettings[i].field)
+		if runningField.Interface() != mergedField.Interface() {
+			restartRequired = append(restartRequired, restartOnlySettings[i].name)
+			mergedField.Set(runningField)
+		}
+	}
+	return &merged, restartRequired
+}
+
+// reloadConfig loads the config again and applies the changes. an invalid config is
+// rejected as a whole and the running config is kept.
+func reloadConfig(ctx context.Context, args []string, syncPerms, syncStyling bool) error {
+	logger := jobLogger("config_reload")
+	reloaded, err := LoadConfig(args, os.LookupEnv)
+	if err != nil {
+		return fmt.Errorf("LoadConfig() error: [%w]", err)
+	}
+	running := getBotConfig()
+	config, restartRequired := mergeReloadedConfig(running, reloaded)
+	for i := 0; i < len(restartRequired); i++ {
+		logger.Warnf("%s changed but only takes effect after a restart", restartRequired[i])
+	}
+	setBotConfig(config)
+	if config.LogLevel != running.LogLevel || config.LogFormat != running.LogFormat {
+		configureLogger(config.LogLevel, config.LogFormat, configSecrets(config)...)
+	}
+	logger.Info("config reloaded")
+
+	ctx = withLogger(ctx, logger)
+	if syncPerms || config.FilePermissionsFilepath != running.FilePermissionsFilepath {
+		err = syncFilePermissions(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("syncFilePermissions() error: [%w]", err)
+		}
+		logger.Info("file permissions synced after reload")
+	}
+	// the headers and sheet titles are renamed with the styling
+	if syncStyling || config.SpreadsheetLanguage != running.SpreadsheetLanguage {
+		err = syncSpreadsheetStyling(ctx)
+		if err != nil {
+			return fmt.Errorf("syncSpreadsheetStyling() error: [%w]", err)
+		}
+		logger.Info("spreadsheet styling synced after reload")
+	}
+	return nil
+}
+
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+func statFileStamp(path string) fileStamp {
+	if path == "" {
+		return fileStamp{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{
+		exists:  true,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+}
+
+func (s fileStamp) changed(other fileStamp) bool {
+	return s.exists != other.exists || s.size != other.size || !s.modTime.Equal(other.modTime)
+}
+
+// watchConfig reloads the config when the config or permissions file changes, and on
+// SIGHUP. SIGHUP also re-syncs the drive permissions and the spreadsheet styling.
+func watchConfig(ctx context.Context, args []string) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	config := getBotConfig()
+	configStamp := statFileStamp(config.ConfigFilepath)
+	permsStamp := statFileStamp(config.FilePermissionsFilepath)
+	for {
+		forced := false
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			log.Info("reloading config on SIGHUP")
+			forced = true
+		case <-ticker.C:
+		}
+		config = getBotConfig()
+		newConfigStamp := statFileStamp(config.ConfigFilepath)
+		newPermsStamp := statFileStamp(config.FilePermissionsFilepath)
+		permsChanged := newPermsStamp.exists && newPermsStamp.changed(permsStamp)
+		if !forced && !newConfigStamp.changed(configStamp) && !permsChanged {
+			continue
+		}
+		configStamp = newConfigStamp
+		err := reloadConfig(ctx, args, forced || permsChanged, forced)
+		if err != nil {
+			log.Error(err)
+		}
+		// the permissions file may have moved with the reload
+		permsStamp = statFileStamp(getBotConfig().FilePermissionsFilepath)
+	}
+}
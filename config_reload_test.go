@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_mergeReloadedConfig(t *testing.T) {
+	running := &Config{
+		DiscordToken:            "token",
+		DBIP:                    "db",
+		MountScanInterval:       time.Hour,
+		XivapiRateLimit:         1,
+		FilePermissionsFilepath: "/app/file-permissions.json",
+	}
+	tests := []struct {
+		name                string
+		reloaded            *Config
+		want                *Config
+		wantRestartRequired []string
+	}{
+		{
+			name: "reloadable settings are applied",
+			reloaded: &Config{
+				DiscordToken:            "token",
+				DBIP:                    "db",
+				MountScanInterval:       time.Minute,
+				XivapiRateLimit:         0.5,
+				FilePermissionsFilepath: "/etc/tataru/file-permissions.json",
+			},
+			want: &Config{
+				DiscordToken:            "token",
+				DBIP:                    "db",
+				MountScanInterval:       time.Minute,
+				XivapiRateLimit:         0.5,
+				FilePermissionsFilepath: "/etc/tataru/file-permissions.json",
+			},
+			wantRestartRequired: []string{},
+		},
+		{
+			name: "startup only settings keep their running values",
+			reloaded: &Config{
+				DiscordToken:            "new-token",
+				DBIP:                    "new-db",
+				MountScanInterval:       time.Hour,
+				XivapiRateLimit:         2,
+				FilePermissionsFilepath: "/app/file-permissions.json",
+			},
+			want: &Config{
+				DiscordToken:            "token",
+				DBIP:                    "db",
+				MountScanInterval:       time.Hour,
+				XivapiRateLimit:         2,
+				FilePermissionsFilepath: "/app/file-permissions.json",
+			},
+			wantRestartRequired: []string{"discord_token", "db_ip"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotRestartRequired := mergeReloadedConfig(running, tt.reloaded)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeReloadedConfig() got = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotRestartRequired, tt.wantRestartRequired) {
+				t.Errorf("mergeReloadedConfig() restartRequired = %v, want %v", gotRestartRequired, tt.wantRestartRequired)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testLookupEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+const testJSONConfig = `{
+	"BotName": "tataru",
+	"GoogleDriveDestinationFolderId": "folder",
+	"DiscordToken": "file-token",
+	"DBUsername": "tataru",
+	"DBIP": "localhost",
+	"DBPort": "5432",
+	"DBName": "tataru",
+	"LogLevel": "debug"
+}`
+
+func TestLoadConfig_layers(t *testing.T) {
+	jsonPath := writeTestConfigFile(t, "config.json", testJSONConfig)
+	yamlPath := writeTestConfigFile(t, "config.yaml", `
+bot_name: tataru
+google_drive_destination_folder_id: folder
+discord_token: yaml-token
+db_username: tataru
+db_ip: localhost
+db_port: 5433
+db_name: tataru
+mount_scan_interval: 10m
+xivapi_rate_limit: 0.5
+`)
+	tests := []struct {
+		name  string
+		args  []string
+		env   map[string]string
+		check func(t *testing.T, c *Config)
+	}{
+		{
+			name: "json file over defaults",
+			args: []string{"-config", jsonPath},
+			check: func(t *testing.T, c *Config) {
+				if c.DiscordToken != "file-token" {
+					t.Errorf("DiscordToken = %s, want file-token", c.DiscordToken)
+				}
+				if c.LogLevel.String() != "debug" {
+					t.Errorf("LogLevel = %s, want debug", c.LogLevel)
+				}
+				if c.CharacterScanInterval != time.Hour {
+					t.Errorf("CharacterScanInterval = %s, want the 1h default", c.CharacterScanInterval)
+				}
+				if c.FilePermissionsFilepath != "/app/file-permissions.json" {
+					t.Errorf("FilePermissionsFilepath = %s, want the default", c.FilePermissionsFilepath)
+				}
+			},
+		},
+		{
+			name: "yaml file",
+			env:  map[string]string{"TATARU_CONFIG": yamlPath},
+			check: func(t *testing.T, c *Config) {
+				if c.DiscordToken != "yaml-token" {
+					t.Errorf("DiscordToken = %s, want yaml-token", c.DiscordToken)
+				}
+				if c.DBPort != "5433" {
+					t.Errorf("DBPort = %s, want 5433", c.DBPort)
+				}
+				if c.MountScanInterval != 10*time.Minute {
+					t.Errorf("MountScanInterval = %s, want 10m", c.MountScanInterval)
+				}
+				if c.XivapiRateLimit != 0.5 {
+					t.Errorf("XivapiRateLimit = %v, want 0.5", c.XivapiRateLimit)
+				}
+			},
+		},
+		{
+			name: "env over file",
+			args: []string{"-config", jsonPath},
+			env: map[string]string{
+				"TATARU_DISCORD_TOKEN":           "env-token",
+				"TATARU_CHARACTER_SCAN_INTERVAL": "2h",
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.DiscordToken != "env-token" {
+					t.Errorf("DiscordToken = %s, want env-token", c.DiscordToken)
+				}
+				if c.CharacterScanInterval != 2*time.Hour {
+					t.Errorf("CharacterScanInterval = %s, want 2h", c.CharacterScanInterval)
+				}
+			},
+		},
+		{
+			name: "flags over env",
+			args: []string{"-config", jsonPath, "-discord-token", "flag-token"},
+			env:  map[string]string{"TATARU_DISCORD_TOKEN": "env-token"},
+			check: func(t *testing.T, c *Config) {
+				if c.DiscordToken != "flag-token" {
+					t.Errorf("DiscordToken = %s, want flag-token", c.DiscordToken)
+				}
+			},
+		},
+		{
+			name: "env only without the default config file",
+			env: map[string]string{
+				"TATARU_GOOGLE_DRIVE_DESTINATION_FOLDER_ID": "folder",
+				"TATARU_DISCORD_TOKEN":                      "env-token",
+				"TATARU_DB_USERNAME":                        "tataru",
+				"TATARU_DB_IP":                              "db",
+				"TATARU_DB_NAME":                            "tataru",
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.DBPort != "5432" {
+					t.Errorf("DBPort = %s, want the 5432 default", c.DBPort)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := LoadConfig(tt.args, testLookupEnv(tt.env))
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			tt.check(t, c)
+		})
+	}
+}
+
+func TestLoadConfig_validation(t *testing.T) {
+	path := writeTestConfigFile(t, "config.json", `{
+		"DBPort": "not a port",
+		"LogFormat": "xml",
+		"DiscordToken": "token",
+		"Unknown": "value"
+	}`)
+	_, err := LoadConfig(
+		[]string{"-config", path},
+		testLookupEnv(map[string]string{
+			"TATARU_MOUNT_SCAN_INTERVAL": "often",
+			"TATARU_XIVAPI_RATE_LIMIT":   "-1",
+		}),
+	)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("LoadConfig() error = %v, want a *ConfigError", err)
+	}
+	wantProblems := []string{
+		"db_port",
+		"log_format",
+		"Unknown",
+		"mount_scan_interval",
+		"xivapi_rate_limit",
+		"google_drive_destination_folder_id",
+		"db_username",
+		"db_ip",
+		"db_name",
+	}
+	if len(configErr.Problems) != len(wantProblems) {
+		t.Errorf("got %d problems, want %d: %v", len(configErr.Problems), len(wantProblems), configErr.Problems)
+	}
+	for i := 0; i < len(wantProblems); i++ {
+		if !strings.Contains(err.Error(), wantProblems[i]) {
+			t.Errorf("error does not mention %s: %s", wantProblems[i], err)
+		}
+	}
+}
+
+func TestLoadConfig_missingExplicitFile(t *testing.T) {
+	_, err := LoadConfig([]string{"-config", filepath.Join(t.TempDir(), "missing.json")}, testLookupEnv(nil))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadConfig() error = %v, want a not exist error", err)
+	}
+}
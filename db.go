@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -11,300 +13,131 @@ import (
 type InitDataPath string
 
 const (
-	InitDataRootPath              InitDataPath = "/app/initial-db-data"
-	InitDataBossExpansionMapPath  InitDataPath = InitDataRootPath + "/bot.boss_expansion_map.csv"
-	InitDataBossMetadataPath      InitDataPath = InitDataRootPath + "/bot.boss_metadata.csv"
-	InitDataBossMountMapPath      InitDataPath = InitDataRootPath + "/bot.boss_mount_map.csv"
-	InitDataBossStylingDataPath   InitDataPath = InitDataRootPath + "/bot.boss_styling_data.csv"
-	InitDataExpansionMetadataPath InitDataPath = InitDataRootPath + "/bot.expansion_metadata.csv"
-	InitDataMountMetadataPath     InitDataPath = InitDataRootPath + "/bot.mount_metadata.csv"
+	// relative to the configured initial db data directory
+	InitDataBossCollectibleMapPath     InitDataPath = "bot.boss_collectible_map.csv"
+	InitDataBossExpansionMapPath       InitDataPath = "bot.boss_expansion_map.csv"
+	InitDataBossMetadataPath           InitDataPath = "bot.boss_metadata.csv"
+	InitDataBossStylingDataPath        InitDataPath = "bot.boss_styling_data.csv"
+	InitDataCollectibleMetadataPath    InitDataPath = "bot.collectible_metadata.csv"
+	InitDataExpansionMetadataPath      InitDataPath = "bot.expansion_metadata.csv"
+	InitDataExpansionLocalizedNamePath InitDataPath = "bot.expansion_localized_name.csv"
 )
 
 func getInitDataPaths() []InitDataPath {
 	return []InitDataPath{
+		InitDataBossCollectibleMapPath,
 		InitDataBossExpansionMapPath,
 		InitDataBossMetadataPath,
-		InitDataBossMountMapPath,
 		InitDataBossStylingDataPath,
+		InitDataCollectibleMetadataPath,
 		InitDataExpansionMetadataPath,
-		InitDataMountMetadataPath,
+		InitDataExpansionLocalizedNamePath,
 	}
 }
 
 type InitDataObjectName string
 
 const (
-	InitDataSchemaName                 InitDataObjectName = "bot"
-	InitDataBossExpansionMapTableName  InitDataObjectName = "boss_expansion_map"
-	InitDataBossMetadataTableName      InitDataObjectName = "boss_metadata"
-	InitDataBossMountMapTableName      InitDataObjectName = "boss_mount_map"
-	InitDataBossStylingDataTableName   InitDataObjectName = "boss_styling_data"
-	InitDataExpansionMetadataTableName InitDataObjectName = "expansion_metadata"
-	InitDataMountMetadataTableName     InitDataObjectName = "mount_metadata"
+	InitDataSchemaName                      InitDataObjectName = "bot"
+	InitDataBossCollectibleMapTableName     InitDataObjectName = "boss_collectible_map"
+	InitDataBossExpansionMapTableName       InitDataObjectName = "boss_expansion_map"
+	InitDataBossMetadataTableName           InitDataObjectName = "boss_metadata"
+	InitDataBossStylingDataTableName        InitDataObjectName = "boss_styling_data"
+	InitDataCollectibleMetadataTableName    InitDataObjectName = "collectible_metadata"
+	InitDataExpansionMetadataTableName      InitDataObjectName = "expansion_metadata"
+	InitDataExpansionLocalizedNameTableName InitDataObjectName = "expansion_localized_name"
 )
 
 func getInitDataTableMap() map[InitDataPath]InitDataObjectName {
 	return map[InitDataPath]InitDataObjectName{
-		InitDataBossExpansionMapPath:  InitDataBossExpansionMapTableName,
-		InitDataBossMetadataPath:      InitDataBossMetadataTableName,
-		InitDataBossMountMapPath:      InitDataBossMountMapTableName,
-		InitDataBossStylingDataPath:   InitDataBossStylingDataTableName,
-		InitDataExpansionMetadataPath: InitDataExpansionMetadataTableName,
-		InitDataMountMetadataPath:     InitDataMountMetadataTableName,
+		InitDataBossCollectibleMapPath:     InitDataBossCollectibleMapTableName,
+		InitDataBossExpansionMapPath:       InitDataBossExpansionMapTableName,
+		InitDataBossMetadataPath:           InitDataBossMetadataTableName,
+		InitDataBossStylingDataPath:        InitDataBossStylingDataTableName,
+		InitDataCollectibleMetadataPath:    InitDataCollectibleMetadataTableName,
+		InitDataExpansionMetadataPath:      InitDataExpansionMetadataTableName,
+		InitDataExpansionLocalizedNamePath: InitDataExpansionLocalizedNameTableName,
 	}
 }
 
-func initDB() error {
+// seedDB copies the initial data into the reference tables that are still empty
+// and returns the names of the tables it seeded
+func seedDB(ctx context.Context) ([]string, error) {
 	dbcon, err := dbpool.Acquire(ctx)
 	if err != nil {
-		return fmt.Errorf("database connection acquire error: [%w]", err)
+		return nil, fmt.Errorf("database connection acquire error: [%w]", err)
 	}
 	defer dbcon.Release()
-
-	// create the db objects
 	tx, err := dbcon.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("dbcon.Begin() 1 error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `create schema bot`)
-	if err != nil {
-		return fmt.Errorf("create schema error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.file_ref (
-			file_gcp_id varchar(128) primary key not null
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.file_ref error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.permissions (
-			file_gcp_id varchar(128) not null,
-			perm_gcp_id varchar(128) primary key not null,
-			email varchar(128),
-			role varchar(128) not null,
-			role_type varchar(128) not null,
-			constraint fk_file_ref
-				foreign key (file_gcp_id)
-					references bot.file_ref(file_gcp_id)
-					on delete cascade
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.permissions error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.expansion_metadata (
-			expansion_id varchar(36) primary key not null,
-			expansion_name varchar(128) not null,
-			expansion_index int not null
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.expansion_metadata error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.sheet_metadata (
-			file_gcp_id varchar(128) not null,
-			sheet_gcp_id varchar(128) primary key not null,
-			sheet_index int not null,
-			constraint fk_file_ref
-				foreign key (file_gcp_id)
-					references bot.file_ref(file_gcp_id)
-					on delete cascade
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.sheet_metadata error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.sheet_expansion_map (
-			sheet_gcp_id varchar(128) not null,
-			expansion_id varchar(36) not null,
-			primary key (
-				sheet_gcp_id,
-				expansion_id
-			),
-			constraint fk_sheet_gcp_id
-				foreign key (sheet_gcp_id)
-					references bot.sheet_metadata(sheet_gcp_id)
-					on delete cascade
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.sheet_expansion_map error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.member_metadata (
-			member_discord_id varchar(128) primary key not null,
-			member_name varchar(128) not null,
-			member_xiv_id varchar(128)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.member_metadata error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.role_ref (
-			role_id varchar(128) primary key not null
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.role_ref error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.boss_metadata (
-			boss_id varchar(36) primary key not null,
-			boss_name varchar(128) not null
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.boss_metadata error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.boss_expansion_map (
-			boss_id varchar(36) not null,
-			expansion_id varchar(36) not null,
-			boss_expansion_index int not null,
-			primary key (
-				boss_id,
-				expansion_id
-			)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.boss_expansion_map error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.mount_metadata (
-			mount_id varchar(36) primary key not null,
-			mount_name varchar(128) not null
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.mount_metadata error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.boss_mount_map (
-			boss_id varchar(36) not null,
-			mount_id varchar(36) not null,
-			primary key (
-				boss_id,
-				mount_id
-			)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.boss_mount_map error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.member_data (
-			member_discord_id varchar(128) not null,
-			mount_id varchar(36) not null,
-			has_mount boolean not null,
-			primary key (
-				member_discord_id,
-				mount_id
-			),
-			constraint fk_member_discord_id
-				foreign key (member_discord_id)
-					references bot.member_metadata(member_discord_id)
-					on delete cascade
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.member_data error: [%w]", err)
-	}
-	_, err = tx.Exec(ctx, `
-		create table bot.boss_styling_data (
-			boss_id varchar(36) primary key not null,
-			header_background_hex_color varchar(9) not null,
-			header_foreground_hex_color varchar(9) not null,
-			checkbox_background_hex_color varchar(9) not null,
-			checkbox_foreground_hex_color varchar(9) not null
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create bot.boss_styling_data error: [%w]", err)
-	}
-	err = tx.Commit(ctx)
-	if err != nil {
-		return fmt.Errorf("tx.Commit() 1 error: [%w]", err)
+		return nil, fmt.Errorf("dbcon.Begin() error: [%w]", err)
 	}
+	defer tx.Rollback(ctx)
 
-	// insert initial data into db
+	seeded := []string{}
+	initMap := getInitDataTableMap()
 	initPaths := getInitDataPaths()
 	for i := 0; i < len(initPaths); i++ {
 		initPath := initPaths[i]
-		file, err := os.Open(string(initPath))
+		table := pgx.Identifier{string(InitDataSchemaName), string(initMap[initPath])}
+		var hasRows bool
+		err = tx.QueryRow(ctx, fmt.Sprintf(`select exists(select 1 from %s)`, table.Sanitize())).Scan(&hasRows)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("row scan error; table=%s: [%w]", table.Sanitize(), err)
 		}
-		defer file.Close()
-
-		reader := csv.NewReader(file)
-		headerRow, err := reader.Read()
-		if err != nil {
-			panic(err)
+		if hasRows {
+			continue
 		}
-		data, err := reader.ReadAll()
+		headerRow, csvData, err := readInitDataFile(initPath)
 		if err != nil {
-			panic(err)
-		}
-
-		csvData := make([][]interface{}, len(data))
-		for i := 0; i < len(data); i++ {
-			row := data[i]
-			csvRow := make([]interface{}, len(row))
-			for j := 0; j < len(row); j++ {
-				csvRow[j] = row[j]
-			}
-			csvData[i] = csvRow
+			return nil, fmt.Errorf("readInitDataFile() error: [%w]", err)
 		}
-
-		initMap := getInitDataTableMap()
-		_, err = dbcon.CopyFrom(
+		_, err = tx.CopyFrom(
 			ctx,
-			pgx.Identifier(
-				[]string{
-					string(InitDataSchemaName),
-					string(initMap[initPath]),
-				},
-			),
+			table,
 			headerRow,
 			pgx.CopyFromRows(csvData),
 		)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("tx.CopyFrom() error; table=%s: [%w]", table.Sanitize(), err)
 		}
+		seeded = append(seeded, table.Sanitize())
 	}
-
-	return nil
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	return seeded, nil
 }
 
-func isValidDatabase() (bool, error) {
-	dbcon, err := dbpool.Acquire(ctx)
+// readInitDataFile reads the header row and the data rows of an initial data csv file
+func readInitDataFile(initPath InitDataPath) ([]string, [][]interface{}, error) {
+	file, err := os.Open(filepath.Join(getBotConfig().InitialDBDataDir, string(initPath)))
 	if err != nil {
-		return false, fmt.Errorf("database connection acquire error: [%w]", err)
+		return nil, nil, fmt.Errorf("os.Open() error: [%w]", err)
 	}
-	defer dbcon.Release()
-	row := dbcon.QueryRow(
-		ctx,
-		`
-			select exists (
-				select 1
-				from pg_catalog.pg_namespace
-				where nspname = 'bot'
-			)
-		`,
-	)
-	var schemaExists bool
-	err = row.Scan(&schemaExists)
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	headerRow, err := reader.Read()
 	if err != nil {
-		return false, fmt.Errorf("row scan error: [%w]", err)
+		return nil, nil, fmt.Errorf("reader.Read() error; file=%s: [%w]", initPath, err)
 	}
-	return schemaExists, nil
+	data, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reader.ReadAll() error; file=%s: [%w]", initPath, err)
+	}
+
+	csvData := make([][]interface{}, len(data))
+	for i := 0; i < len(data); i++ {
+		row := data[i]
+		csvRow := make([]interface{}, len(row))
+		for j := 0; j < len(row); j++ {
+			csvRow[j] = row[j]
+		}
+		csvData[i] = csvRow
+	}
+	return headerRow, csvData, nil
 }
 
 type MemberID string
@@ -314,7 +147,7 @@ type Member struct {
 	xivid *string
 }
 
-func getMembersFromDB() ([]*Member, error) {
+func getMembersFromDB(ctx context.Context) ([]*Member, error) {
 	dbcon, err := dbpool.Acquire(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("database connection acquire error: [%w]", err)
@@ -353,3 +186,11 @@ func getMembersFromDB() ([]*Member, error) {
 	}
 	return members, nil
 }
+
+// nullIfEmpty saves an empty string as null
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	dbConnectMinRetryDelay = time.Duration(1) * time.Second
+	dbConnectMaxRetryDelay = time.Duration(30) * time.Second
+)
+
+// dbConnString gets the db_dsn setting, or builds a postgres URL from the separate
+// connection settings with the user and password escaped
+func dbConnString(c *Config) string {
+	if c.DBDSN != "" {
+		return c.DBDSN
+	}
+	u := url.URL{
+		Scheme: "postgres",
+		Host:   c.DBIP,
+		Path:   "/" + c.DBName,
+	}
+	if c.DBPort != "" {
+		u.Host = net.JoinHostPort(c.DBIP, c.DBPort)
+	}
+	if c.DBUserPassword != "" {
+		u.User = url.UserPassword(c.DBUsername, c.DBUserPassword)
+	} else {
+		u.User = url.User(c.DBUsername)
+	}
+	query := url.Values{}
+	if c.DBSSLMode != "" {
+		query.Set("sslmode", c.DBSSLMode)
+	}
+	if c.DBSSLRootCert != "" {
+		query.Set("sslrootcert", c.DBSSLRootCert)
+	}
+	if c.DBSSLCert != "" {
+		query.Set("sslcert", c.DBSSLCert)
+	}
+	if c.DBSSLKey != "" {
+		query.Set("sslkey", c.DBSSLKey)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// dbPoolConfig parses the connection string and applies the pool settings that are set
+func dbPoolConfig(c *Config) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(dbConnString(c))
+	if err != nil {
+		// the parse error can contain the connection string, password included
+		return nil, fmt.Errorf("invalid database connection settings")
+	}
+	if c.DBPoolMaxConns > 0 {
+		poolConfig.MaxConns = c.DBPoolMaxConns
+	}
+	if c.DBPoolMinConns > 0 {
+		poolConfig.MinConns = c.DBPoolMinConns
+	}
+	if c.DBPoolMaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = c.DBPoolMaxConnLifetime
+	}
+	if c.DBPoolMaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = c.DBPoolMaxConnIdleTime
+	}
+	if c.DBPoolHealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = c.DBPoolHealthCheckPeriod
+	}
+	if c.DBStatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(c.DBStatementTimeout.Milliseconds(), 10)
+	}
+	return poolConfig, nil
+}
+
+// connectDB creates the pool and retries until the database answers a ping or
+// the connect timeout runs out
+func connectDB(ctx context.Context, c *Config) (*pgxpool.Pool, error) {
+	poolConfig, err := dbPoolConfig(c)
+	if err != nil {
+		return nil, fmt.Errorf("dbPoolConfig() error: [%w]", err)
+	}
+	connectCtx, cancel := context.WithTimeout(ctx, c.DBConnectTimeout)
+	defer cancel()
+	retryDelay := dbConnectMinRetryDelay
+	for attempt := 1; ; attempt++ {
+		pool, err := pgxpool.NewWithConfig(connectCtx, poolConfig)
+		if err == nil {
+			err = pool.Ping(connectCtx)
+			if err == nil {
+				return pool, nil
+			}
+			pool.Close()
+		}
+		log.WithField("attempt", attempt).Warnf("connecting to the database failed, retrying in %s: %s", retryDelay, err)
+		if sleepContext(connectCtx, retryDelay) != nil {
+			return nil, fmt.Errorf("database unreachable after %d attempts: [%w]", attempt, err)
+		}
+		retryDelay *= 2
+		if retryDelay > dbConnectMaxRetryDelay {
+			retryDelay = dbConnectMaxRetryDelay
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// the doctor should not wait out the full db_connect_timeout on an unreachable database
+const doctorDBConnectTimeout = time.Duration(10) * time.Second
+
+type doctorReport struct {
+	w      io.Writer
+	failed int
+}
+
+func (r *doctorReport) check(name string, detail string, err error) bool {
+	if err != nil {
+		r.failed++
+		fmt.Fprintf(r.w, "FAIL  %s: %s\n", name, err)
+		return false
+	}
+	if detail != "" {
+		fmt.Fprintf(r.w, "OK    %s: %s\n", name, detail)
+	} else {
+		fmt.Fprintf(r.w, "OK    %s\n", name)
+	}
+	return true
+}
+
+func (r *doctorReport) skip(name string, reason string) {
+	fmt.Fprintf(r.w, "SKIP  %s: %s\n", name, reason)
+}
+
+func doctorCommand(fs *flag.FlagSet) func(ctx context.Context, config *Config) error {
+	return func(ctx context.Context, config *Config) error {
+		report := &doctorReport{w: os.Stdout}
+		runDoctor(ctx, config, report)
+		if report.failed > 0 {
+			return fmt.Errorf("%d checks failed", report.failed)
+		}
+		return nil
+	}
+}
+
+// runDoctor checks every dependency of the bot in turn. checks that depend on a
+// failed one are skipped.
+func runDoctor(ctx context.Context, config *Config, report *doctorReport) {
+	configSource := config.ConfigFilepath
+	if configSource == "" {
+		configSource = "defaults, env vars and flags only"
+	}
+	report.check("config", configSource, nil)
+
+	dbConfig := *config
+	if dbConfig.DBConnectTimeout > doctorDBConnectTimeout {
+		dbConfig.DBConnectTimeout = doctorDBConnectTimeout
+	}
+	var err error
+	dbpool, err = connectDB(ctx, &dbConfig)
+	dbOK := report.check("database", "", err)
+	if dbOK {
+		defer dbpool.Close()
+		applied, err := getAppliedMigrations(ctx)
+		version := 0
+		if err == nil {
+			if len(applied) > 0 {
+				version = applied[len(applied)-1].Version
+			}
+			if pending := pendingMigrations(applied); len(pending) > 0 {
+				err = fmt.Errorf("%d migrations pending, run tataru migrate", len(pending))
+			}
+		}
+		dbOK = report.check("schema", fmt.Sprintf("version %d", version), err)
+	} else {
+		report.skip("schema", "database unreachable")
+	}
+
+	err = initGoogleServices(ctx, config)
+	googleOK := report.check("google credentials", config.GoogleCredentialsFilepath, err)
+	if !googleOK {
+		report.skip("google drive folder", "no google credentials")
+	} else if config.GoogleDriveDestinationFolderId == "" {
+		report.skip("google drive folder", "google_drive_destination_folder_id is not set")
+	} else {
+		start := time.Now()
+		folder, err := gdriveSvc.Files.Get(config.GoogleDriveDestinationFolderId).SupportsAllDrives(true).Fields("id", "name").Context(ctx).Do()
+		observeDriveCall("files.get", start, err)
+		detail := ""
+		if err == nil {
+			detail = folder.Name
+		}
+		report.check("google drive folder", detail, err)
+	}
+	if dbOK && googleOK {
+		report.check("spreadsheet file", "", checkSpreadsheetFile(ctx))
+	} else {
+		report.skip("spreadsheet file", "needs the database and google credentials")
+	}
+
+	discordRest := newDiscordRest(config)
+	defer discordRest.Close(context.Background())
+	app, err := discordRest.GetBotApplicationInfo()
+	detail := ""
+	if err == nil {
+		detail = app.Name
+	}
+	report.check("discord token", detail, err)
+
+	xivapiClient = NewXivApiClient(config.XivapiApiKey, nil)
+	resp, err := xivapiClient.SearchForCharacter(ctx, "Tataru Taru")
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+	}
+	report.check("xivapi", "", err)
+}
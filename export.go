@@ -0,0 +1,758 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// exportBundleVersion is bumped whenever the bundle layout changes in a way older
+// versions of the bot cannot read
+const exportBundleVersion = 1
+
+const exportManifestFilename = "manifest.json"
+
+type exportColumnKind int
+
+const (
+	exportColumnText exportColumnKind = iota
+	exportColumnInt
+	exportColumnBool
+	exportColumnTime
+)
+
+type exportColumn struct {
+	name     string
+	kind     exportColumnKind
+	key      bool
+	nullable bool
+	// value of the column in exports made before the column was added
+	fallback interface{}
+}
+
+type exportTable struct {
+	name    string
+	columns []exportColumn
+	// rows of file scoped tables belong to one spreadsheet file and are only imported
+	// when that file is tracked by one of the roles
+	fileScoped bool
+}
+
+// getExportTables gets the tables in the bundle in the order they are imported, so that
+// referenced rows are imported first. The spreadsheet file and sheet tables are left
+// out since they only make sense for the deployment that created the file.
+func getExportTables() []exportTable {
+	return []exportTable{
+		{
+			name: "expansion_metadata",
+			columns: []exportColumn{
+				{name: "expansion_id", kind: exportColumnText, key: true},
+				{name: "expansion_name", kind: exportColumnText},
+				{name: "expansion_index", kind: exportColumnInt},
+			},
+		},
+		{
+			name: "boss_metadata",
+			columns: []exportColumn{
+				{name: "boss_id", kind: exportColumnText, key: true},
+				{name: "boss_name", kind: exportColumnText},
+			},
+		},
+		{
+			name: "boss_expansion_map",
+			columns: []exportColumn{
+				{name: "boss_id", kind: exportColumnText, key: true},
+				{name: "expansion_id", kind: exportColumnText, key: true},
+				{name: "boss_expansion_index", kind: exportColumnInt},
+			},
+		},
+		{
+			name: "collectible_metadata",
+			columns: []exportColumn{
+				{name: "collectible_id", kind: exportColumnText, key: true},
+				{name: "collectible_type", kind: exportColumnText},
+				{name: "collectible_name", kind: exportColumnText},
+				{name: "icon_url", kind: exportColumnText, nullable: true},
+				{name: "game_id", kind: exportColumnInt, nullable: true},
+			},
+		},
+		{
+			name: "boss_collectible_map",
+			columns: []exportColumn{
+				{name: "boss_id", kind: exportColumnText, key: true},
+				{name: "collectible_id", kind: exportColumnText, key: true},
+			},
+		},
+		{
+			name: "expansion_localized_name",
+			columns: []exportColumn{
+				{name: "expansion_id", kind: exportColumnText, key: true},
+				{name: "language", kind: exportColumnText, key: true},
+				{name: "expansion_name", kind: exportColumnText},
+			},
+		},
+		{
+			name: "boss_localized_name",
+			columns: []exportColumn{
+				{name: "boss_id", kind: exportColumnText, key: true},
+				{name: "language", kind: exportColumnText, key: true},
+				{name: "boss_name", kind: exportColumnText},
+			},
+		},
+		{
+			name: "collectible_localized_name",
+			columns: []exportColumn{
+				{name: "collectible_id", kind: exportColumnText, key: true},
+				{name: "language", kind: exportColumnText, key: true},
+				{name: "collectible_name", kind: exportColumnText},
+			},
+		},
+		{
+			name: "boss_styling_data",
+			columns: []exportColumn{
+				{name: "boss_id", kind: exportColumnText, key: true},
+				{name: "header_background_hex_color", kind: exportColumnText},
+				{name: "header_foreground_hex_color", kind: exportColumnText},
+				{name: "checkbox_background_hex_color", kind: exportColumnText},
+				{name: "checkbox_foreground_hex_color", kind: exportColumnText},
+			},
+		},
+		{
+			name: "member_metadata",
+			columns: []exportColumn{
+				{name: "member_discord_id", kind: exportColumnText, key: true},
+				{name: "member_name", kind: exportColumnText},
+				{name: "member_xiv_id", kind: exportColumnText, nullable: true},
+				{name: "member_xiv_id_verified", kind: exportColumnBool, fallback: false},
+			},
+		},
+		{
+			name: "member_collectible",
+			columns: []exportColumn{
+				{name: "member_discord_id", kind: exportColumnText, key: true},
+				{name: "collectible_id", kind: exportColumnText, key: true},
+				{name: "has_collectible", kind: exportColumnBool},
+			},
+		},
+		{
+			name: "member_character",
+			columns: []exportColumn{
+				{name: "member_discord_id", kind: exportColumnText, key: true},
+				{name: "member_xiv_id", kind: exportColumnText, key: true},
+				{name: "verified", kind: exportColumnBool},
+			},
+		},
+		{
+			name: "xiv_character",
+			columns: []exportColumn{
+				{name: "member_xiv_id", kind: exportColumnText, key: true},
+				{name: "character_name", kind: exportColumnText},
+			},
+		},
+		{
+			name: "character_collectible",
+			columns: []exportColumn{
+				{name: "member_discord_id", kind: exportColumnText, key: true},
+				{name: "member_xiv_id", kind: exportColumnText, key: true},
+				{name: "collectible_id", kind: exportColumnText, key: true},
+			},
+		},
+		{
+			name: "guild_settings",
+			columns: []exportColumn{
+				{name: "guild_id", kind: exportColumnText, key: true},
+				{name: "ownership_mode", kind: exportColumnText},
+				{name: "spreadsheet_language", kind: exportColumnText, nullable: true},
+			},
+		},
+		{
+			name: "role_ref",
+			columns: []exportColumn{
+				{name: "role_id", kind: exportColumnText, key: true},
+				{name: "title", kind: exportColumnText, nullable: true},
+				{name: "guild_id", kind: exportColumnText, nullable: true},
+			},
+		},
+		{
+			name: "role_expansion_map",
+			columns: []exportColumn{
+				{name: "role_id", kind: exportColumnText, key: true},
+				{name: "expansion_id", kind: exportColumnText, key: true},
+			},
+		},
+		{
+			name: "role_member",
+			columns: []exportColumn{
+				{name: "role_id", kind: exportColumnText, key: true},
+				{name: "member_discord_id", kind: exportColumnText, key: true},
+			},
+		},
+		{
+			name: "role_boss_styling_data",
+			columns: []exportColumn{
+				{name: "role_id", kind: exportColumnText, key: true},
+				{name: "boss_id", kind: exportColumnText, key: true},
+				{name: "header_background_hex_color", kind: exportColumnText},
+				{name: "header_foreground_hex_color", kind: exportColumnText},
+				{name: "checkbox_background_hex_color", kind: exportColumnText},
+				{name: "checkbox_foreground_hex_color", kind: exportColumnText},
+			},
+		},
+		{
+			name: "permissions",
+			columns: []exportColumn{
+				{name: "perm_gcp_id", kind: exportColumnText, key: true},
+				{name: "file_gcp_id", kind: exportColumnText},
+				{name: "email", kind: exportColumnText, nullable: true},
+				{name: "role", kind: exportColumnText},
+				{name: "role_type", kind: exportColumnText},
+				{name: "source", kind: exportColumnText, fallback: string(PermissionSourceFile)},
+				{name: "domain", kind: exportColumnText, nullable: true},
+				{name: "allow_file_discovery", kind: exportColumnBool, fallback: false},
+				{name: "expiration_time", kind: exportColumnTime, nullable: true},
+			},
+			fileScoped: true,
+		},
+	}
+}
+
+// legacyExportTables are the tables of bundles exported before collectibles replaced
+// mounts, with the table and columns upgradeBundle renames them to
+var legacyExportTables = []struct {
+	name    string
+	table   string
+	columns map[string]string
+}{
+	{
+		name:    "mount_metadata",
+		table:   "collectible_metadata",
+		columns: map[string]string{"mount_id": "collectible_id", "mount_name": "collectible_name"},
+	},
+	{
+		name:    "boss_mount_map",
+		table:   "boss_collectible_map",
+		columns: map[string]string{"boss_id": "boss_id", "mount_id": "collectible_id"},
+	},
+	{
+		name:    "member_data",
+		table:   "member_collectible",
+		columns: map[string]string{"member_discord_id": "member_discord_id", "mount_id": "collectible_id", "has_mount": "has_collectible"},
+	},
+}
+
+// upgradeBundle moves the rows of legacy tables to the collectible tables. every
+// legacy collectible is a mount.
+func upgradeBundle(bundle *ExportBundle) {
+	for i := 0; i < len(legacyExportTables); i++ {
+		legacy := legacyExportTables[i]
+		rows, ok := bundle.Tables[legacy.name]
+		if !ok {
+			continue
+		}
+		delete(bundle.Tables, legacy.name)
+		for j := 0; j < len(rows); j++ {
+			row := ExportRow{}
+			for from, to := range legacy.columns {
+				row[to] = rows[j][from]
+			}
+			if legacy.table == "collectible_metadata" {
+				row["collectible_type"] = string(CollectibleTypeMount)
+				row["icon_url"] = nil
+			}
+			bundle.Tables[legacy.table] = append(bundle.Tables[legacy.table], row)
+		}
+	}
+}
+
+func (t exportTable) identifier() pgx.Identifier {
+	return pgx.Identifier{string(InitDataSchemaName), t.name}
+}
+
+// qualifiedName gets the table name with its schema, which also names its CSV file
+func (t exportTable) qualifiedName() string {
+	return string(InitDataSchemaName) + "." + t.name
+}
+
+func (t exportTable) columnIndex(name string) int {
+	for i := 0; i < len(t.columns); i++ {
+		if t.columns[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t exportTable) columnNames() []string {
+	names := make([]string, len(t.columns))
+	for i := 0; i < len(t.columns); i++ {
+		names[i] = t.columns[i].name
+	}
+	return names
+}
+
+// ExportRow maps the column names of a table to their values: a string, an int64,
+// a bool, a time.Time, or nil for NULL
+type ExportRow map[string]interface{}
+
+type ExportBundle struct {
+	Version       int                    `json:"version"`
+	SchemaVersion int                    `json:"schema_version"`
+	ExportedAt    time.Time              `json:"exported_at"`
+	Tables        map[string][]ExportRow `json:"tables,omitempty"`
+}
+
+// parseExportValue converts a value read from a JSON bundle, a CSV file or the database
+// to the Go type of the column
+func parseExportValue(col exportColumn, value interface{}) (interface{}, error) {
+	if s, ok := value.(string); ok && s == "" && col.nullable {
+		value = nil
+	}
+	if value == nil && col.fallback != nil {
+		value = col.fallback
+	}
+	if value == nil {
+		if !col.nullable {
+			return nil, fmt.Errorf("%s: must not be empty", col.name)
+		}
+		return nil, nil
+	}
+	switch col.kind {
+	case exportColumnText:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: %v is not a string", col.name, value)
+		}
+		return s, nil
+	case exportColumnInt:
+		switch v := value.(type) {
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case json.Number:
+			i, err := v.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s is not an integer", col.name, v)
+			}
+			return i, nil
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s is not an integer", col.name, v)
+			}
+			return i, nil
+		}
+	case exportColumnBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s is not true or false", col.name, v)
+			}
+			return b, nil
+		}
+	case exportColumnTime:
+		switch v := value.(type) {
+		case time.Time:
+			return v.UTC(), nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s is not an RFC 3339 time", col.name, v)
+			}
+			return t.UTC(), nil
+		}
+	}
+	return nil, fmt.Errorf("%s: unexpected value %v", col.name, value)
+}
+
+func formatExportValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if t, ok := value.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// exportData reads every exported table into a bundle
+func exportData(ctx context.Context) (*ExportBundle, error) {
+	applied, err := getAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getAppliedMigrations() error: [%w]", err)
+	}
+	bundle := &ExportBundle{
+		Version:    exportBundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Tables:     map[string][]ExportRow{},
+	}
+	if len(applied) > 0 {
+		bundle.SchemaVersion = applied[len(applied)-1].Version
+	}
+	tables := getExportTables()
+	for i := 0; i < len(tables); i++ {
+		rows, err := exportTableRows(ctx, tables[i])
+		if err != nil {
+			return nil, fmt.Errorf("exportTableRows() error; table=%s: [%w]", tables[i].name, err)
+		}
+		bundle.Tables[tables[i].name] = rows
+	}
+	return bundle, nil
+}
+
+func exportTableRows(ctx context.Context, t exportTable) ([]ExportRow, error) {
+	names := t.columnNames()
+	keys := []string{}
+	for i := 0; i < len(t.columns); i++ {
+		if t.columns[i].key {
+			keys = append(keys, t.columns[i].name)
+		}
+	}
+	query := fmt.Sprintf(
+		`select %s from %s order by %s`,
+		strings.Join(names, ","),
+		t.identifier().Sanitize(),
+		strings.Join(keys, ","),
+	)
+	rows, err := dbpool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("dbpool.Query() error: [%w]", err)
+	}
+	defer rows.Close()
+	exported := []ExportRow{}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, fmt.Errorf("rows.Values() error: [%w]", err)
+		}
+		row := ExportRow{}
+		for i := 0; i < len(t.columns); i++ {
+			value, err := parseExportValue(t.columns[i], values[i])
+			if err != nil {
+				return nil, fmt.Errorf("parseExportValue() error: [%w]", err)
+			}
+			row[t.columns[i].name] = value
+		}
+		exported = append(exported, row)
+	}
+	return exported, rows.Err()
+}
+
+func writeBundleJSON(w io.Writer, bundle *ExportBundle) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bundle)
+}
+
+func readBundleJSON(r io.Reader) (*ExportBundle, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	bundle := &ExportBundle{}
+	err := dec.Decode(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("dec.Decode() error: [%w]", err)
+	}
+	err = checkBundleVersion(bundle)
+	if err != nil {
+		return nil, err
+	}
+	upgradeBundle(bundle)
+	return bundle, nil
+}
+
+// writeBundleCSV writes the manifest and one CSV file per table, named like the
+// initial data files, to dir
+func writeBundleCSV(dir string, bundle *ExportBundle) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("os.MkdirAll() error: [%w]", err)
+	}
+	manifest := *bundle
+	manifest.Tables = nil
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent() error: [%w]", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, exportManifestFilename), append(b, '\n'), 0o644)
+	if err != nil {
+		return fmt.Errorf("os.WriteFile() error: [%w]", err)
+	}
+	tables := getExportTables()
+	for i := 0; i < len(tables); i++ {
+		err = writeTableCSV(filepath.Join(dir, tables[i].qualifiedName()+".csv"), tables[i], bundle.Tables[tables[i].name])
+		if err != nil {
+			return fmt.Errorf("writeTableCSV() error; table=%s: [%w]", tables[i].name, err)
+		}
+	}
+	return nil
+}
+
+func writeTableCSV(path string, t exportTable, rows []ExportRow) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("os.Create() error: [%w]", err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	err = writer.Write(t.columnNames())
+	if err != nil {
+		return fmt.Errorf("writer.Write() error: [%w]", err)
+	}
+	for i := 0; i < len(rows); i++ {
+		record := make([]string, len(t.columns))
+		for j := 0; j < len(t.columns); j++ {
+			record[j] = formatExportValue(rows[i][t.columns[j].name])
+		}
+		err = writer.Write(record)
+		if err != nil {
+			return fmt.Errorf("writer.Write() error: [%w]", err)
+		}
+	}
+	writer.Flush()
+	if writer.Error() != nil {
+		return fmt.Errorf("writer.Flush() error: [%w]", writer.Error())
+	}
+	return file.Close()
+}
+
+// readBundleCSV reads a bundle written by writeBundleCSV. tables without a CSV file
+// are left out of the bundle.
+func readBundleCSV(dir string) (*ExportBundle, error) {
+	b, err := os.ReadFile(filepath.Join(dir, exportManifestFilename))
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile() error: [%w]", err)
+	}
+	bundle := &ExportBundle{}
+	err = json.Unmarshal(b, bundle)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal() error: [%w]", err)
+	}
+	err = checkBundleVersion(bundle)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Tables = map[string][]ExportRow{}
+	tables := getExportTables()
+	for i := 0; i < len(tables); i++ {
+		rows, err := readTableCSV(filepath.Join(dir, tables[i].qualifiedName()+".csv"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("readTableCSV() error; table=%s: [%w]", tables[i].name, err)
+		}
+		bundle.Tables[tables[i].name] = rows
+	}
+	for i := 0; i < len(legacyExportTables); i++ {
+		name := legacyExportTables[i].name
+		rows, err := readTableCSV(filepath.Join(dir, string(InitDataSchemaName)+"."+name+".csv"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("readTableCSV() error; table=%s: [%w]", name, err)
+		}
+		bundle.Tables[name] = rows
+	}
+	upgradeBundle(bundle)
+	return bundle, nil
+}
+
+func readTableCSV(path string) ([]ExportRow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.Open() error: [%w]", err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	headerRow, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reader.Read() error: [%w]", err)
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reader.ReadAll() error: [%w]", err)
+	}
+	rows := make([]ExportRow, len(records))
+	for i := 0; i < len(records); i++ {
+		row := ExportRow{}
+		for j := 0; j < len(headerRow) && j < len(records[i]); j++ {
+			row[headerRow[j]] = records[i][j]
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+func checkBundleVersion(bundle *ExportBundle) error {
+	if bundle.Version < 1 {
+		return fmt.Errorf("not a tataru export: missing version")
+	}
+	if bundle.Version > exportBundleVersion {
+		return fmt.Errorf("export version %d is newer than the supported version %d", bundle.Version, exportBundleVersion)
+	}
+	return nil
+}
+
+type ImportMode string
+
+const (
+	// existing rows are left as they are
+	ImportModeSkip ImportMode = "skip"
+	// existing rows are replaced by the imported ones
+	ImportModeOverwrite ImportMode = "overwrite"
+	// existing values are kept, missing values are filled in from the import and
+	// collectible ownership is combined
+	ImportModeMerge ImportMode = "merge"
+)
+
+func parseImportMode(s string) (ImportMode, error) {
+	switch mode := ImportMode(s); mode {
+	case ImportModeSkip, ImportModeOverwrite, ImportModeMerge:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown import mode %q, must be skip, overwrite or merge", s)
+}
+
+type ImportTableResult struct {
+	Table    string
+	Inserted int
+	Updated  int
+	Skipped  int
+}
+
+// importQuery builds the upsert for one row of the table. it returns whether the row
+// was inserted, and no row when it was skipped.
+func importQuery(t exportTable, mode ImportMode) string {
+	names := t.columnNames()
+	placeholders := make([]string, len(names))
+	keys := []string{}
+	updates := []string{}
+	for i := 0; i < len(t.columns); i++ {
+		col := t.columns[i]
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		if col.key {
+			keys = append(keys, col.name)
+			continue
+		}
+		switch {
+		case mode == ImportModeOverwrite:
+			updates = append(updates, fmt.Sprintf("%s=excluded.%s", col.name, col.name))
+		case mode == ImportModeMerge && col.kind == exportColumnBool:
+			updates = append(updates, fmt.Sprintf("%s=existing.%s or excluded.%s", col.name, col.name, col.name))
+		case mode == ImportModeMerge && col.nullable:
+			updates = append(updates, fmt.Sprintf("%s=coalesce(existing.%s,excluded.%s)", col.name, col.name, col.name))
+		}
+	}
+	conflict := "do nothing"
+	if len(updates) > 0 {
+		conflict = "do update set " + strings.Join(updates, ",")
+	}
+	return fmt.Sprintf(
+		`insert into %s as existing(%s) values(%s) on conflict (%s) %s returning (xmax = 0)`,
+		t.identifier().Sanitize(),
+		strings.Join(names, ","),
+		strings.Join(placeholders, ","),
+		strings.Join(keys, ","),
+		conflict,
+	)
+}
+
+// importData writes the bundle into the database in one transaction
+func importData(ctx context.Context, bundle *ExportBundle, mode ImportMode) ([]ImportTableResult, error) {
+	applied, err := getAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getAppliedMigrations() error: [%w]", err)
+	}
+	if len(applied) == 0 || bundle.SchemaVersion > applied[len(applied)-1].Version {
+		return nil, fmt.Errorf("the export is from schema version %d, migrate the database first", bundle.SchemaVersion)
+	}
+	dbcon, err := dbpool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("database connection acquire error: [%w]", err)
+	}
+	defer dbcon.Release()
+	tx, err := dbcon.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dbcon.Begin() error: [%w]", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// file scoped rows only apply to the files tracked by this deployment
+	fileIDs := map[string]bool{}
+	fileRows, err := tx.Query(ctx, `select file_gcp_id from bot.file_ref`)
+	if err != nil {
+		return nil, fmt.Errorf("get file ids error: [%w]", err)
+	}
+	for fileRows.Next() {
+		var fileID string
+		err = fileRows.Scan(&fileID)
+		if err != nil {
+			fileRows.Close()
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		fileIDs[fileID] = true
+	}
+	fileRows.Close()
+	if fileRows.Err() != nil {
+		return nil, fmt.Errorf("fileRows.Err() error: [%w]", fileRows.Err())
+	}
+
+	results := []ImportTableResult{}
+	tables := getExportTables()
+	for i := 0; i < len(tables); i++ {
+		t := tables[i]
+		rows, ok := bundle.Tables[t.name]
+		if !ok {
+			continue
+		}
+		result := ImportTableResult{Table: t.qualifiedName()}
+		query := importQuery(t, mode)
+		for j := 0; j < len(rows); j++ {
+			args := make([]interface{}, len(t.columns))
+			for k := 0; k < len(t.columns); k++ {
+				args[k], err = parseExportValue(t.columns[k], rows[j][t.columns[k].name])
+				if err != nil {
+					return nil, fmt.Errorf("%s row %d: %w", t.name, j+1, err)
+				}
+			}
+			if t.fileScoped && !fileIDs[args[t.columnIndex("file_gcp_id")].(string)] {
+				result.Skipped++
+				continue
+			}
+			var inserted bool
+			err = tx.QueryRow(ctx, query, args...).Scan(&inserted)
+			if err == pgx.ErrNoRows {
+				result.Skipped++
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("import error; table=%s, row=%d: [%w]", t.name, j+1, err)
+			}
+			if inserted {
+				result.Inserted++
+			} else {
+				result.Updated++
+			}
+		}
+		results = append(results, result)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	return results, nil
+}
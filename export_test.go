@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_importQuery(t *testing.T) {
+	var memberMetadata, memberCollectible exportTable
+	tables := getExportTables()
+	for i := 0; i < len(tables); i++ {
+		switch tables[i].name {
+		case "member_metadata":
+			memberMetadata = tables[i]
+		case "member_collectible":
+			memberCollectible = tables[i]
+		}
+	}
+	tests := []struct {
+		name  string
+		table exportTable
+		mode  ImportMode
+		want  string
+	}{
+		{
+			name:  "skip",
+			table: memberMetadata,
+			mode:  ImportModeSkip,
+			want:  `insert into "bot"."member_metadata" as existing(member_discord_id,member_name,member_xiv_id,member_xiv_id_verified) values($1,$2,$3,$4) on conflict (member_discord_id) do nothing returning (xmax = 0)`,
+		},
+		{
+			name:  "overwrite",
+			table: memberMetadata,
+			mode:  ImportModeOverwrite,
+			want:  `insert into "bot"."member_metadata" as existing(member_discord_id,member_name,member_xiv_id,member_xiv_id_verified) values($1,$2,$3,$4) on conflict (member_discord_id) do update set member_name=excluded.member_name,member_xiv_id=excluded.member_xiv_id,member_xiv_id_verified=excluded.member_xiv_id_verified returning (xmax = 0)`,
+		},
+		{
+			name:  "merge fills in missing values",
+			table: memberMetadata,
+			mode:  ImportModeMerge,
+			want:  `insert into "bot"."member_metadata" as existing(member_discord_id,member_name,member_xiv_id,member_xiv_id_verified) values($1,$2,$3,$4) on conflict (member_discord_id) do update set member_xiv_id=coalesce(existing.member_xiv_id,excluded.member_xiv_id),member_xiv_id_verified=existing.member_xiv_id_verified or excluded.member_xiv_id_verified returning (xmax = 0)`,
+		},
+		{
+			name:  "merge combines collectible ownership",
+			table: memberCollectible,
+			mode:  ImportModeMerge,
+			want:  `insert into "bot"."member_collectible" as existing(member_discord_id,collectible_id,has_collectible) values($1,$2,$3) on conflict (member_discord_id,collectible_id) do update set has_collectible=existing.has_collectible or excluded.has_collectible returning (xmax = 0)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := importQuery(tt.table, tt.mode); got != tt.want {
+				t.Errorf("importQuery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// parsedBundleRows converts the rows of every table to their column types, so that
+// bundles read from JSON and CSV can be compared
+func parsedBundleRows(t *testing.T, bundle *ExportBundle) map[string][]ExportRow {
+	parsed := map[string][]ExportRow{}
+	tables := getExportTables()
+	for i := 0; i < len(tables); i++ {
+		rows := bundle.Tables[tables[i].name]
+		for j := 0; j < len(rows); j++ {
+			row := ExportRow{}
+			for k := 0; k < len(tables[i].columns); k++ {
+				value, err := parseExportValue(tables[i].columns[k], rows[j][tables[i].columns[k].name])
+				if err != nil {
+					t.Fatalf("parseExportValue() error = %v", err)
+				}
+				row[tables[i].columns[k].name] = value
+			}
+			parsed[tables[i].name] = append(parsed[tables[i].name], row)
+		}
+	}
+	return parsed
+}
+
+func Test_exportBundleRoundTrip(t *testing.T) {
+	bundle := &ExportBundle{
+		Version:       exportBundleVersion,
+		SchemaVersion: 1,
+		ExportedAt:    time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tables: map[string][]ExportRow{
+			"expansion_metadata": {
+				{"expansion_id": "arr", "expansion_name": "A Realm Reborn, \"ARR\"", "expansion_index": int64(0)},
+			},
+			"member_metadata": {
+				{"member_discord_id": "1", "member_name": "Tataru", "member_xiv_id": "123", "member_xiv_id_verified": true},
+				{"member_discord_id": "2", "member_name": "Krile", "member_xiv_id": nil, "member_xiv_id_verified": false},
+			},
+			"collectible_metadata": {
+				{"collectible_id": "m1", "collectible_type": "mount", "collectible_name": "Ixion", "icon_url": nil},
+			},
+			"member_collectible": {
+				{"member_discord_id": "1", "collectible_id": "m1", "has_collectible": true},
+			},
+			"permissions": {
+				{"perm_gcp_id": "p1", "file_gcp_id": "f1", "email": "a@gmail.com", "role": "reader", "role_type": "user", "source": "file", "domain": nil, "allow_file_discovery": false, "expiration_time": time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+				{"perm_gcp_id": "p2", "file_gcp_id": "f1", "email": nil, "role": "reader", "role_type": "domain", "source": "file", "domain": "example.com", "allow_file_discovery": true, "expiration_time": nil},
+			},
+		},
+	}
+	want := parsedBundleRows(t, bundle)
+
+	buf := &bytes.Buffer{}
+	err := writeBundleJSON(buf, bundle)
+	if err != nil {
+		t.Fatalf("writeBundleJSON() error = %v", err)
+	}
+	fromJSON, err := readBundleJSON(buf)
+	if err != nil {
+		t.Fatalf("readBundleJSON() error = %v", err)
+	}
+	if got := parsedBundleRows(t, fromJSON); !reflect.DeepEqual(got, want) {
+		t.Errorf("json round trip = %v, want %v", got, want)
+	}
+	if fromJSON.SchemaVersion != 1 || !fromJSON.ExportedAt.Equal(bundle.ExportedAt) {
+		t.Errorf("json round trip manifest = %+v", fromJSON)
+	}
+
+	dir := t.TempDir()
+	err = writeBundleCSV(dir, bundle)
+	if err != nil {
+		t.Fatalf("writeBundleCSV() error = %v", err)
+	}
+	fromCSV, err := readBundleCSV(dir)
+	if err != nil {
+		t.Fatalf("readBundleCSV() error = %v", err)
+	}
+	if got := parsedBundleRows(t, fromCSV); !reflect.DeepEqual(got, want) {
+		t.Errorf("csv round trip = %v, want %v", got, want)
+	}
+}
+
+func Test_readBundleJSON_version(t *testing.T) {
+	_, err := readBundleJSON(bytes.NewBufferString(`{"version": 99, "tables": {}}`))
+	if err == nil {
+		t.Errorf("readBundleJSON() accepted a newer bundle version")
+	}
+	_, err = readBundleJSON(bytes.NewBufferString(`{"tables": {}}`))
+	if err == nil {
+		t.Errorf("readBundleJSON() accepted a bundle without a version")
+	}
+}
+
+func Test_upgradeBundle(t *testing.T) {
+	bundle := &ExportBundle{
+		Tables: map[string][]ExportRow{
+			"mount_metadata": {
+				{"mount_id": "m1", "mount_name": "Ixion"},
+			},
+			"boss_mount_map": {
+				{"boss_id": "b1", "mount_id": "m1"},
+			},
+			"member_data": {
+				{"member_discord_id": "1", "mount_id": "m1", "has_mount": true},
+			},
+		},
+	}
+	upgradeBundle(bundle)
+	want := map[string][]ExportRow{
+		"collectible_metadata": {
+			{"collectible_id": "m1", "collectible_type": "mount", "collectible_name": "Ixion", "icon_url": nil},
+		},
+		"boss_collectible_map": {
+			{"boss_id": "b1", "collectible_id": "m1"},
+		},
+		"member_collectible": {
+			{"member_discord_id": "1", "collectible_id": "m1", "has_collectible": true},
+		},
+	}
+	if !reflect.DeepEqual(bundle.Tables, want) {
+		t.Errorf("upgradeBundle() tables = %v, want %v", bundle.Tables, want)
+	}
+}
+
+func Test_readBundleCSV_legacy(t *testing.T) {
+	dir := t.TempDir()
+	err := writeBundleCSV(dir, &ExportBundle{Version: exportBundleVersion, Tables: map[string][]ExportRow{}})
+	if err != nil {
+		t.Fatalf("writeBundleCSV() error = %v", err)
+	}
+	legacy := map[string]string{
+		"mount_metadata": "mount_id,mount_name\nm1,Ixion\nm2,Kirin\n",
+		"boss_mount_map": "boss_id,mount_id\nb1,m1\n",
+		"member_data":    "member_discord_id,mount_id,has_mount\n1,m1,true\n",
+	}
+	for name, content := range legacy {
+		err = os.WriteFile(filepath.Join(dir, string(InitDataSchemaName)+"."+name+".csv"), []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("os.WriteFile() error = %v", err)
+		}
+	}
+	bundle, err := readBundleCSV(dir)
+	if err != nil {
+		t.Fatalf("readBundleCSV() error = %v", err)
+	}
+	want := map[string]int{"collectible_metadata": 2, "boss_collectible_map": 1, "member_collectible": 1}
+	for table, count := range want {
+		if got := len(bundle.Tables[table]); got != count {
+			t.Errorf("readBundleCSV() %s rows = %d, want %d", table, got, count)
+		}
+	}
+}
@@ -1,77 +1,247 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/disgoorg/log"
 	"google.golang.org/api/sheets/v4"
 )
 
 type SheetBatchUpdate struct {
 	ID    string
 	Batch *sheets.BatchUpdateSpreadsheetRequest
+	// closed once the batch is handed to the sheet writer
+	handed chan struct{}
+	// closed by the sheet writer once the batch is written or given up on
+	written chan struct{}
 }
 
-func RetrySheetBatchUpdate(req *SheetBatchUpdate, prevLimit, maxWaitSeconds float64, hasSuggestedRetryDur bool) {
+// number of batches handed to the sheet writer that have not been written yet
+var pendingSheetBatchUpdates int64
+
+// sheetBatchQueue keeps the batches queued without blocking their callers, in the order
+// they were queued. rows are addressed by index, so a batch written before an earlier
+// one could change the wrong row.
+var sheetBatchQueue = struct {
+	sync.Mutex
+	reqs    []*SheetBatchUpdate
+	queued  chan struct{}
+	forward sync.Once
+}{
+	queued: make(chan struct{}, 1),
+}
+
+// queueSheetBatchUpdate hands the batch to the sheet writer without blocking the caller
+func queueSheetBatchUpdate(req *SheetBatchUpdate) {
+	atomic.AddInt64(&pendingSheetBatchUpdates, 1)
+	sheetBatchQueue.Lock()
+	sheetBatchQueue.reqs = append(sheetBatchQueue.reqs, req)
+	sheetBatchQueue.Unlock()
+	sheetBatchQueue.forward.Do(func() {
+		go forwardSheetBatchUpdates(googleSheetsWriteReqs)
+	})
+	select {
+	case sheetBatchQueue.queued <- struct{}{}:
+	default:
+	}
+}
+
+// forwardSheetBatchUpdates hands the queued batches to the sheet writer one at a time
+func forwardSheetBatchUpdates(reqs chan<- *SheetBatchUpdate) {
+	for range sheetBatchQueue.queued {
+		for {
+			sheetBatchQueue.Lock()
+			if len(sheetBatchQueue.reqs) == 0 {
+				sheetBatchQueue.Unlock()
+				break
+			}
+			req := sheetBatchQueue.reqs[0]
+			sheetBatchQueue.reqs[0] = nil
+			sheetBatchQueue.reqs = sheetBatchQueue.reqs[1:]
+			sheetBatchQueue.Unlock()
+			reqs <- req
+			if req.handed != nil {
+				close(req.handed)
+			}
+		}
+	}
+}
+
+// unqueueSheetBatchUpdate takes the batch back out of the queue, false when it was
+// already taken by the forwarder
+func unqueueSheetBatchUpdate(req *SheetBatchUpdate) bool {
+	sheetBatchQueue.Lock()
+	defer sheetBatchQueue.Unlock()
+	for i := 0; i < len(sheetBatchQueue.reqs); i++ {
+		if sheetBatchQueue.reqs[i] == req {
+			sheetBatchQueue.reqs = append(sheetBatchQueue.reqs[:i], sheetBatchQueue.reqs[i+1:]...)
+			atomic.AddInt64(&pendingSheetBatchUpdates, -1)
+			return true
+		}
+	}
+	return false
+}
+
+// sendSheetBatchUpdate blocks until the sheet writer has picked up the batch. the batch
+// goes through the queue so that it is written after the batches queued before it.
+func sendSheetBatchUpdate(ctx context.Context, req *SheetBatchUpdate) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	req.handed = make(chan struct{})
+	queueSheetBatchUpdate(req)
+	select {
+	case <-req.handed:
+		return nil
+	case <-ctx.Done():
+		if unqueueSheetBatchUpdate(req) {
+			return ctx.Err()
+		}
+		// the forwarder took the batch already, it is written like the ones before it
+		return nil
+	}
+}
+
+// sendSheetBatchUpdateAndWait blocks until the sheet writer has written the batch, for
+// callers that read the spreadsheet back afterwards
+func sendSheetBatchUpdateAndWait(ctx context.Context, req *SheetBatchUpdate) error {
+	req.written = make(chan struct{})
+	err := sendSheetBatchUpdate(ctx, req)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-req.written:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func RetrySheetBatchUpdate(ctx context.Context, req *SheetBatchUpdate, prevLimit, maxWaitSeconds float64, hasSuggestedRetryDur bool) {
 	var waitDur float64
 	if hasSuggestedRetryDur {
 		waitDur = prevLimit
 	} else {
 		waitDur = CalcThrottledWaitDuration(prevLimit, maxWaitSeconds)
 	}
-	<-time.After(time.Duration(waitDur) * time.Second)
-	resp, err := gsheetsSvc.Spreadsheets.BatchUpdate(req.ID, req.Batch).Do()
-	log.Debugf("google sheets batch update response HTTP status code: %d", resp.HTTPStatusCode)
-	if resp.HTTPStatusCode == 429 {
-		durStr := resp.Header.Get("Retry-After")
-		var initWait float64
-		innerHasSuggestedRetryDur := false
-		if durStr == "" {
-			initWait = waitDur
-		} else {
-			initWait, err = strconv.ParseFloat(durStr, 64)
-			if err != nil {
-				log.Error(err)
-				return
+	err := sleepContext(ctx, time.Duration(waitDur)*time.Second)
+	if err != nil {
+		log.Errorf("sheet batch update retry for spreadsheet %s abandoned: %s", req.ID, err)
+		return
+	}
+	start := time.Now()
+	resp, err := gsheetsSvc.Spreadsheets.BatchUpdate(req.ID, req.Batch).Context(ctx).Do()
+	observeSheetsBatchUpdate(start, resp, err)
+	if resp != nil {
+		log.Debugf("google sheets batch update response HTTP status code: %d", resp.HTTPStatusCode)
+		if resp.HTTPStatusCode == 429 {
+			durStr := resp.Header.Get("Retry-After")
+			var initWait float64
+			innerHasSuggestedRetryDur := false
+			if durStr == "" {
+				initWait = waitDur
+			} else {
+				initWait, err = strconv.ParseFloat(durStr, 64)
+				if err != nil {
+					log.Error(err)
+					return
+				}
+				innerHasSuggestedRetryDur = true
 			}
-			innerHasSuggestedRetryDur = true
+			RetrySheetBatchUpdate(ctx, req, initWait, maxWaitSeconds, innerHasSuggestedRetryDur)
 		}
-		RetrySheetBatchUpdate(req, initWait, maxWaitSeconds, innerHasSuggestedRetryDur)
 	}
 	if err != nil {
 		log.Error(err)
 	}
 }
 
-func googleSheetBatchUpdateRateLimiter(rateLimit, maxRetryDuration float64, reqs <-chan *SheetBatchUpdate) {
-	for {
-		waitDur := CalcWaitDuration(rateLimit)
-		req := <-reqs
-		resp, err := gsheetsSvc.Spreadsheets.BatchUpdate(req.ID, req.Batch).Do()
-		if resp != nil {
-			log.Debugf("google sheets batch update response HTTP status code: %d", resp.HTTPStatusCode)
-			if resp.HTTPStatusCode == 429 {
-				durStr := resp.Header.Get("Retry-After")
-				var initWait float64
-				hasSuggestedRetryDur := false
-				if durStr == "" {
-					initWait = waitDur
-				} else {
-					initWait, err = strconv.ParseFloat(durStr, 64)
-					if err != nil {
-						log.Error(err)
-						continue
-					}
-					hasSuggestedRetryDur = true
+func writeSheetBatchUpdate(ctx context.Context, req *SheetBatchUpdate, waitDur, maxRetryDuration float64) {
+	defer atomic.AddInt64(&pendingSheetBatchUpdates, -1)
+	if req.written != nil {
+		defer close(req.written)
+	}
+	start := time.Now()
+	resp, err := gsheetsSvc.Spreadsheets.BatchUpdate(req.ID, req.Batch).Context(ctx).Do()
+	observeSheetsBatchUpdate(start, resp, err)
+	if resp != nil {
+		log.Debugf("google sheets batch update response HTTP status code: %d", resp.HTTPStatusCode)
+		if resp.HTTPStatusCode == 429 {
+			durStr := resp.Header.Get("Retry-After")
+			var initWait float64
+			hasSuggestedRetryDur := false
+			if durStr == "" {
+				initWait = waitDur
+			} else {
+				initWait, err = strconv.ParseFloat(durStr, 64)
+				if err != nil {
+					log.Error(err)
+					return
 				}
-				RetrySheetBatchUpdate(req, initWait, 3600, hasSuggestedRetryDur)
+				hasSuggestedRetryDur = true
 			}
+			RetrySheetBatchUpdate(ctx, req, initWait, maxRetryDuration, hasSuggestedRetryDur)
+		}
+	}
+	if err != nil {
+		log.Error(err)
+	}
+	log.Debugf("wrote google sheets batch with %d updates for spreadsheet %s", len(req.Batch.Requests), req.ID)
+}
+
+// googleSheetBatchUpdateRateLimiter writes the queued batches one at a time. the rate
+// limits are read from the config for every batch so reloads apply without a restart.
+func googleSheetBatchUpdateRateLimiter(ctx context.Context, reqs <-chan *SheetBatchUpdate) error {
+	// writes get their own context so that queued and in-flight batches can still
+	// be written for a grace period after ctx is cancelled
+	writeCtx, cancelWrites := context.WithCancel(context.Background())
+	defer cancelWrites()
+	go func() {
+		select {
+		case <-writeCtx.Done():
+			return
+		case <-ctx.Done():
+		}
+		select {
+		case <-writeCtx.Done():
+		case <-time.After(sheetWriteDrainTimeout):
+			cancelWrites()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return drainSheetBatchUpdates(writeCtx, reqs)
+		case req := <-reqs:
+			config := getBotConfig()
+			waitDur := CalcWaitDuration(config.GoogleSheetsWriteRateLimit)
+			writeSheetBatchUpdate(writeCtx, req, waitDur, config.MaxRetryDuration.Seconds())
+			sleepContext(ctx, time.Duration(waitDur)*time.Second)
+		}
+	}
+}
+
+func drainSheetBatchUpdates(ctx context.Context, reqs <-chan *SheetBatchUpdate) error {
+	log.Infof("draining %d pending google sheets batch updates", atomic.LoadInt64(&pendingSheetBatchUpdates))
+	for atomic.LoadInt64(&pendingSheetBatchUpdates) > 0 {
+		config := getBotConfig()
+		waitDur := CalcWaitDuration(config.GoogleSheetsWriteRateLimit)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("drain deadline exceeded with %d google sheets batch updates pending", atomic.LoadInt64(&pendingSheetBatchUpdates))
+		case req := <-reqs:
+			writeSheetBatchUpdate(ctx, req, waitDur, config.MaxRetryDuration.Seconds())
 		}
-		if err != nil {
-			log.Error(err)
+		if atomic.LoadInt64(&pendingSheetBatchUpdates) > 0 {
+			sleepContext(ctx, time.Duration(waitDur)*time.Second)
 		}
-		log.Debugf("wrote google sheets batch with %d updates for spreadsheet %s", len(req.Batch.Requests), req.ID)
-		<-time.After(time.Duration(waitDur) * time.Second)
 	}
+	log.Info("google sheets batch updates drained")
+	return nil
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_queueSheetBatchUpdate(t *testing.T) {
+	defer atomic.StoreInt64(&pendingSheetBatchUpdates, 0)
+	ids := []string{"add", "remove", "rename"}
+	for i := 0; i < len(ids); i++ {
+		queueSheetBatchUpdate(&SheetBatchUpdate{ID: ids[i]})
+	}
+	for i := 0; i < len(ids); i++ {
+		select {
+		case req := <-googleSheetsWriteReqs:
+			if req.ID != ids[i] {
+				t.Errorf("queueSheetBatchUpdate() batch %d = %s, want %s", i, req.ID, ids[i])
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("queueSheetBatchUpdate() batch %d was not handed to the sheet writer", i)
+		}
+	}
+}
+
+func Test_sendSheetBatchUpdate(t *testing.T) {
+	defer atomic.StoreInt64(&pendingSheetBatchUpdates, 0)
+	// the sent batch waits for the batches queued before it
+	queueSheetBatchUpdate(&SheetBatchUpdate{ID: "remove"})
+	sent := make(chan error, 1)
+	go func() {
+		sent <- sendSheetBatchUpdate(context.Background(), &SheetBatchUpdate{ID: "header"})
+	}()
+	for _, want := range []string{"remove", "header"} {
+		select {
+		case req := <-googleSheetsWriteReqs:
+			if req.ID != want {
+				t.Errorf("sendSheetBatchUpdate() batch = %s, want %s", req.ID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("sendSheetBatchUpdate() batch %s was not handed to the sheet writer", want)
+		}
+	}
+	if err := <-sent; err != nil {
+		t.Errorf("sendSheetBatchUpdate() error = %v", err)
+	}
+
+	// a batch given up on before it is handed over is not written
+	queueSheetBatchUpdate(&SheetBatchUpdate{ID: "append"})
+	pending := atomic.LoadInt64(&pendingSheetBatchUpdates)
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := sendSheetBatchUpdate(timeoutCtx, &SheetBatchUpdate{ID: "populate"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("sendSheetBatchUpdate() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := atomic.LoadInt64(&pendingSheetBatchUpdates); got != pending {
+		t.Errorf("pendingSheetBatchUpdates = %d, want %d", got, pending)
+	}
+	if req := <-googleSheetsWriteReqs; req.ID != "append" {
+		t.Errorf("sendSheetBatchUpdate() batch = %s, want append", req.ID)
+	}
+	select {
+	case req := <-googleSheetsWriteReqs:
+		t.Errorf("sendSheetBatchUpdate() batch %s was handed over after it was given up on", req.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
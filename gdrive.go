@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
 )
 
 const fileMimeType = "application/vnd.google-apps.spreadsheet"
@@ -11,12 +16,20 @@ const fileMimeType = "application/vnd.google-apps.spreadsheet"
 type FileID string
 type PermissionID string
 
+// fileExists reports whether the file exists and is not in the trash
 func fileExists(fileId FileID) (*bool, error) {
-	f, err := gdriveSvc.Files.Get(string(fileId)).SupportsAllDrives(true).Do()
+	start := time.Now()
+	f, err := gdriveSvc.Files.Get(string(fileId)).SupportsAllDrives(true).Fields("id", "trashed").Do()
+	observeDriveCall("files.get", start, err)
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+		exists := false
+		return &exists, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("gdriveSvc.Files.Get() error: [%w]", err)
 	}
-	exists := f != nil
+	exists := f != nil && !f.Trashed
 	return &exists, nil
 }
 
@@ -25,12 +38,52 @@ func createFile(title string) (*FileID, error) {
 		MimeType:        fileMimeType,
 		Name:            title,
 		WritersCanShare: true,
-		Parents:         []string{botConfig.GoogleDriveDestinationFolderId},
+		Parents:         []string{getBotConfig().GoogleDriveDestinationFolderId},
 	}
+	start := time.Now()
 	f, err := gdriveSvc.Files.Create(file).SupportsAllDrives(true).Do()
+	observeDriveCall("files.create", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("gdriveSvc.Files.Create() error: [%w]", err)
 	}
 	fid := FileID(f.Id)
 	return &fid, err
 }
+
+// trashFile moves the file to the drive trash, where it can still be restored from
+func trashFile(ctx context.Context, fileId FileID) error {
+	start := time.Now()
+	_, err := gdriveSvc.Files.Update(string(fileId), &drive.File{Trashed: true}).SupportsAllDrives(true).Context(ctx).Do()
+	observeDriveCall("files.update", start, err)
+	if err != nil {
+		return fmt.Errorf("gdriveSvc.Files.Update() error: [%w]", err)
+	}
+	return nil
+}
+
+// listFilePermissions gets the permissions the file has in google drive, including the
+// ones that were changed outside the bot
+func listFilePermissions(ctx context.Context, fileId FileID) ([]*drive.Permission, error) {
+	perms := []*drive.Permission{}
+	pageToken := ""
+	for {
+		call := gdriveSvc.Permissions.List(string(fileId)).
+			SupportsAllDrives(true).
+			Fields("nextPageToken", "permissions(id,type,emailAddress,domain,role,pendingOwner,allowFileDiscovery,expirationTime)").
+			Context(ctx)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		start := time.Now()
+		resp, err := call.Do()
+		observeDriveCall("permissions.list", start, err)
+		if err != nil {
+			return nil, fmt.Errorf("gdriveSvc.Permissions.List() error: [%w]", err)
+		}
+		perms = append(perms, resp.Permissions...)
+		if resp.NextPageToken == "" {
+			return perms, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
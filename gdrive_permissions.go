@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"google.golang.org/api/drive/v3"
 )
@@ -24,5 +28,302 @@ func GetPermissions(mountSpreadsheetPermissionsFilepath string) ([]*drive.Permis
 	if err != nil {
 		return nil, fmt.Errorf("json.Unmarshal() error: [%w]", err)
 	}
+	for i := 0; i < len(perms); i++ {
+		err = validatePermission(perms[i])
+		if err != nil {
+			return nil, fmt.Errorf("permission %d error: [%w]", i, err)
+		}
+	}
 	return perms, nil
 }
+
+// validatePermission checks a permission from the permissions file against what
+// google drive accepts for its type
+func validatePermission(p *drive.Permission) error {
+	switch p.Type {
+	case "user", "group":
+		if p.EmailAddress == "" {
+			return fmt.Errorf("%s permissions need an emailAddress", p.Type)
+		}
+		if p.AllowFileDiscovery {
+			return fmt.Errorf("allowFileDiscovery is only for domain and anyone permissions")
+		}
+	case "domain":
+		if p.Domain == "" {
+			return fmt.Errorf("domain permissions need a domain")
+		}
+	case "anyone":
+	default:
+		return fmt.Errorf("%q is not one of the permission types user, group, domain or anyone", p.Type)
+	}
+	if p.ExpirationTime != "" {
+		if p.Type != "user" && p.Type != "group" {
+			return fmt.Errorf("expirationTime is only for user and group permissions")
+		}
+		_, err := time.Parse(time.RFC3339, p.ExpirationTime)
+		if err != nil {
+			return fmt.Errorf("expirationTime must be an RFC 3339 time: [%w]", err)
+		}
+	}
+	return nil
+}
+
+// permissionExpiration gets the expiration time of the permission, or nil if it does not expire
+func permissionExpiration(p *drive.Permission) *time.Time {
+	if p.ExpirationTime == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, p.ExpirationTime)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// isExpiredPermission reports whether the permission expired by now
+func isExpiredPermission(p *drive.Permission, now time.Time) bool {
+	t := permissionExpiration(p)
+	return t != nil && !t.After(now)
+}
+
+func sameExpiration(a, b *drive.Permission) bool {
+	ta := permissionExpiration(a)
+	tb := permissionExpiration(b)
+	if ta == nil || tb == nil {
+		return ta == tb
+	}
+	return ta.Equal(*tb)
+}
+
+type PermissionSource string
+
+const (
+	// granted by the permissions file and removed again when it leaves the file
+	PermissionSourceFile PermissionSource = "file"
+	// granted with /share, the permissions file sync leaves it alone
+	PermissionSourceDiscord PermissionSource = "discord"
+	// granted to a member of the watched role with /link_email
+	PermissionSourceMember PermissionSource = "member"
+)
+
+// TrackedPermission is a permission saved in bot.permissions
+type TrackedPermission struct {
+	*drive.Permission
+	Source PermissionSource
+}
+
+// getTrackedPermissions gets the saved permissions of the file keyed by their ID
+func getTrackedPermissions(ctx context.Context, fileID FileID) (map[string]*TrackedPermission, error) {
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select
+			perm_gcp_id,
+			coalesce(email, ''),
+			coalesce(domain, ''),
+			role,
+			role_type,
+			allow_file_discovery,
+			expiration_time,
+			source
+		from bot.permissions
+		where file_gcp_id = $1
+		`,
+		string(fileID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get perms from db error: [%w]", err)
+	}
+	defer rows.Close()
+	perms := map[string]*TrackedPermission{}
+	for rows.Next() {
+		var id string
+		var email string
+		var domain string
+		var role string
+		var roleType string
+		var allowFileDiscovery bool
+		var expirationTime *time.Time
+		var source string
+		err = rows.Scan(&id, &email, &domain, &role, &roleType, &allowFileDiscovery, &expirationTime, &source)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		p := &drive.Permission{
+			Id:                 id,
+			EmailAddress:       email,
+			Domain:             domain,
+			Role:               role,
+			Type:               roleType,
+			AllowFileDiscovery: allowFileDiscovery,
+		}
+		if expirationTime != nil {
+			p.ExpirationTime = expirationTime.UTC().Format(time.RFC3339)
+		}
+		perms[id] = &TrackedPermission{
+			Permission: p,
+			Source:     PermissionSource(source),
+		}
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return perms, nil
+}
+
+// PermissionDrift is how the live permissions of the file differ from the saved ones
+// because they were changed outside the bot. Roles maps the permission ID to its live role.
+type PermissionDrift struct {
+	Missing   []string
+	Roles     map[string]string
+	Untracked []*drive.Permission
+}
+
+// reconcilePermissions compares the saved permissions with the live permissions of the file
+func reconcilePermissions(tracked map[string]*TrackedPermission, live []*drive.Permission) PermissionDrift {
+	drift := PermissionDrift{
+		Missing:   []string{},
+		Roles:     map[string]string{},
+		Untracked: []*drive.Permission{},
+	}
+	liveByID := map[string]*drive.Permission{}
+	for i := 0; i < len(live); i++ {
+		liveByID[live[i].Id] = live[i]
+		p, ok := tracked[live[i].Id]
+		if !ok {
+			drift.Untracked = append(drift.Untracked, live[i])
+		} else if p.Role != live[i].Role {
+			drift.Roles[live[i].Id] = live[i].Role
+		}
+	}
+	for id := range tracked {
+		if _, ok := liveByID[id]; !ok {
+			drift.Missing = append(drift.Missing, id)
+		}
+	}
+	sort.Strings(drift.Missing)
+	return drift
+}
+
+// findPermission gets the permission of the grantee from the list, or nil
+func findPermission(perms []*drive.Permission, grantee *drive.Permission) *drive.Permission {
+	for i := 0; i < len(perms); i++ {
+		if samePermissionGrantee(perms[i], grantee) {
+			return perms[i]
+		}
+	}
+	return nil
+}
+
+// carriedPermissions gets the saved permissions of a file that do not come from the
+// permissions file, so a file replacing it can grant them again. grantees the
+// permissions file already covers are left to it.
+func carriedPermissions(tracked map[string]*TrackedPermission, fromFile []*drive.Permission) []*TrackedPermission {
+	carried := []*TrackedPermission{}
+	for _, p := range tracked {
+		if p.Source == PermissionSourceFile || findPermission(fromFile, p.Permission) != nil {
+			continue
+		}
+		carried = append(carried, p)
+	}
+	sort.Slice(carried, func(i, j int) bool {
+		return carried[i].Id < carried[j].Id
+	})
+	return carried
+}
+
+// PermissionDiff is what has to change on the file for its permissions to match the
+// permissions file. Update maps the permission ID to the new role and expiration time.
+type PermissionDiff struct {
+	Add    []*drive.Permission
+	Update map[string]*drive.Permission
+	Delete []string
+}
+
+// samePermissionGrantee reports whether both permissions are for the same grantee: the
+// same email address of a user or group, the same domain, or both anyone
+func samePermissionGrantee(a, b *drive.Permission) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case "anyone":
+		return true
+	case "domain":
+		return strings.EqualFold(a.Domain, b.Domain)
+	}
+	return strings.EqualFold(a.EmailAddress, b.EmailAddress)
+}
+
+// describePermission gets the grantee and role of a permission for logs and dry runs
+func describePermission(p *drive.Permission) string {
+	grantee := fmt.Sprintf("%s %s", p.Type, p.EmailAddress)
+	switch p.Type {
+	case "anyone":
+		grantee = "anyone"
+	case "domain":
+		grantee = fmt.Sprintf("domain %s", p.Domain)
+	}
+	details := []string{p.Role}
+	if p.AllowFileDiscovery {
+		details = append(details, "discoverable")
+	}
+	if p.ExpirationTime != "" {
+		details = append(details, "until "+p.ExpirationTime)
+	}
+	return fmt.Sprintf("%s (%s)", grantee, strings.Join(details, ", "))
+}
+
+// diffFilePermissions compares the permissions saved for the file, keyed by their
+// permission ID, with the permissions from the permissions file. permissions that expired
+// by now are left out of the file, so that their grants are deleted. drive cannot change
+// whether a permission is discoverable, so those permissions are deleted and added again.
+func diffFilePermissions(dbPerms map[string]*drive.Permission, permsOnDisk []*drive.Permission, now time.Time) PermissionDiff {
+	diff := PermissionDiff{
+		Add:    []*drive.Permission{},
+		Update: map[string]*drive.Permission{},
+		Delete: []string{},
+	}
+	wanted := []*drive.Permission{}
+	for i := 0; i < len(permsOnDisk); i++ {
+		if !isExpiredPermission(permsOnDisk[i], now) {
+			wanted = append(wanted, permsOnDisk[i])
+		}
+	}
+	matched := map[string]bool{}
+	for i := 0; i < len(wanted); i++ {
+		found := false
+		for dbPermID, dbPerm := range dbPerms {
+			if !samePermissionGrantee(wanted[i], dbPerm) {
+				continue
+			}
+			found = true
+			if wanted[i].AllowFileDiscovery != dbPerm.AllowFileDiscovery {
+				diff.Add = append(diff.Add, wanted[i])
+				break
+			}
+			matched[dbPermID] = true
+			if wanted[i].Role != dbPerm.Role || !sameExpiration(wanted[i], dbPerm) {
+				update := &drive.Permission{
+					Role:           wanted[i].Role,
+					ExpirationTime: wanted[i].ExpirationTime,
+				}
+				if update.ExpirationTime == "" && dbPerm.ExpirationTime != "" {
+					update.NullFields = []string{"ExpirationTime"}
+				}
+				diff.Update[dbPermID] = update
+			}
+			break
+		}
+		if !found {
+			diff.Add = append(diff.Add, wanted[i])
+		}
+	}
+	for dbPermID := range dbPerms {
+		if !matched[dbPermID] {
+			diff.Delete = append(diff.Delete, dbPermID)
+		}
+	}
+	sort.Strings(diff.Delete)
+	return diff
+}
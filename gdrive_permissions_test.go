@@ -1,6 +1,12 @@
 package main
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
 
 func Test_isGmailEmailAddress(t *testing.T) {
 	type args struct {
@@ -35,3 +41,228 @@ func Test_isGmailEmailAddress(t *testing.T) {
 		})
 	}
 }
+
+func Test_diffFilePermissions(t *testing.T) {
+	dbPerms := map[string]*drive.Permission{
+		"perm-anyone": {Type: "anyone", Role: "reader"},
+		"perm-a":      {Type: "user", EmailAddress: "a@gmail.com", Role: "writer"},
+		"perm-b":      {Type: "user", EmailAddress: "b@gmail.com", Role: "reader"},
+		"perm-c":      {Type: "user", EmailAddress: "c@gmail.com", Role: "reader"},
+	}
+	newPerm := &drive.Permission{Type: "user", EmailAddress: "d@gmail.com", Role: "reader"}
+	tests := []struct {
+		name        string
+		permsOnDisk []*drive.Permission
+		want        PermissionDiff
+	}{
+		{
+			name: "no changes, emails compared without case",
+			permsOnDisk: []*drive.Permission{
+				{Type: "anyone", Role: "reader"},
+				{Type: "user", EmailAddress: "A@gmail.com", Role: "writer"},
+				{Type: "user", EmailAddress: "b@gmail.com", Role: "reader"},
+				{Type: "user", EmailAddress: "c@gmail.com", Role: "reader"},
+			},
+			want: PermissionDiff{
+				Add:    []*drive.Permission{},
+				Update: map[string]*drive.Permission{},
+				Delete: []string{},
+			},
+		},
+		{
+			name: "add, update and delete",
+			permsOnDisk: []*drive.Permission{
+				{Type: "anyone", Role: "commenter"},
+				{Type: "user", EmailAddress: "a@gmail.com", Role: "writer"},
+				newPerm,
+			},
+			want: PermissionDiff{
+				Add: []*drive.Permission{newPerm},
+				Update: map[string]*drive.Permission{
+					"perm-anyone": {Role: "commenter"},
+				},
+				Delete: []string{"perm-b", "perm-c"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffFilePermissions(dbPerms, tt.permsOnDisk, time.Now()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffFilePermissions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_diffFilePermissions_domainsGroupsAndExpiration(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	dbPerms := map[string]*drive.Permission{
+		"perm-domain": {Type: "domain", Domain: "example.com", Role: "reader"},
+		"perm-group":  {Type: "group", EmailAddress: "raid@example.com", Role: "reader"},
+		"perm-user":   {Type: "user", EmailAddress: "a@gmail.com", Role: "reader", ExpirationTime: "2026-11-01T00:00:00Z"},
+	}
+	tests := []struct {
+		name        string
+		permsOnDisk []*drive.Permission
+		want        PermissionDiff
+	}{
+		{
+			name: "no changes, expiration times compared as times",
+			permsOnDisk: []*drive.Permission{
+				{Type: "domain", Domain: "EXAMPLE.com", Role: "reader"},
+				{Type: "group", EmailAddress: "raid@example.com", Role: "reader"},
+				{Type: "user", EmailAddress: "a@gmail.com", Role: "reader", ExpirationTime: "2026-11-01T01:00:00+01:00"},
+			},
+			want: PermissionDiff{
+				Add:    []*drive.Permission{},
+				Update: map[string]*drive.Permission{},
+				Delete: []string{},
+			},
+		},
+		{
+			name: "a user with the email of a group is another grantee",
+			permsOnDisk: []*drive.Permission{
+				{Type: "domain", Domain: "example.com", Role: "reader"},
+				{Type: "user", EmailAddress: "raid@example.com", Role: "reader"},
+				{Type: "user", EmailAddress: "a@gmail.com", Role: "reader", ExpirationTime: "2026-11-01T00:00:00Z"},
+			},
+			want: PermissionDiff{
+				Add:    []*drive.Permission{{Type: "user", EmailAddress: "raid@example.com", Role: "reader"}},
+				Update: map[string]*drive.Permission{},
+				Delete: []string{"perm-group"},
+			},
+		},
+		{
+			name: "expiration removed and discovery changed",
+			permsOnDisk: []*drive.Permission{
+				{Type: "domain", Domain: "example.com", Role: "reader", AllowFileDiscovery: true},
+				{Type: "group", EmailAddress: "raid@example.com", Role: "reader"},
+				{Type: "user", EmailAddress: "a@gmail.com", Role: "reader"},
+			},
+			want: PermissionDiff{
+				Add: []*drive.Permission{{Type: "domain", Domain: "example.com", Role: "reader", AllowFileDiscovery: true}},
+				Update: map[string]*drive.Permission{
+					"perm-user": {Role: "reader", NullFields: []string{"ExpirationTime"}},
+				},
+				Delete: []string{"perm-domain"},
+			},
+		},
+		{
+			name: "expired grants are deleted",
+			permsOnDisk: []*drive.Permission{
+				{Type: "domain", Domain: "example.com", Role: "reader"},
+				{Type: "group", EmailAddress: "raid@example.com", Role: "reader", ExpirationTime: "2026-10-19T12:00:00Z"},
+				{Type: "user", EmailAddress: "a@gmail.com", Role: "reader", ExpirationTime: "2026-10-01T00:00:00Z"},
+			},
+			want: PermissionDiff{
+				Add:    []*drive.Permission{},
+				Update: map[string]*drive.Permission{},
+				Delete: []string{"perm-group", "perm-user"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffFilePermissions(dbPerms, tt.permsOnDisk, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffFilePermissions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validatePermission(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *drive.Permission
+		wantErr bool
+	}{
+		{name: "user", p: &drive.Permission{Type: "user", EmailAddress: "a@gmail.com", Role: "reader", ExpirationTime: "2026-11-01T00:00:00Z"}},
+		{name: "discoverable domain", p: &drive.Permission{Type: "domain", Domain: "example.com", Role: "reader", AllowFileDiscovery: true}},
+		{name: "group without email", p: &drive.Permission{Type: "group", Role: "reader"}, wantErr: true},
+		{name: "expiring domain", p: &drive.Permission{Type: "domain", Domain: "example.com", Role: "reader", ExpirationTime: "2026-11-01T00:00:00Z"}, wantErr: true},
+		{name: "bad expiration time", p: &drive.Permission{Type: "user", EmailAddress: "a@gmail.com", Role: "reader", ExpirationTime: "tomorrow"}, wantErr: true},
+		{name: "unknown type", p: &drive.Permission{Type: "team", Role: "reader"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePermission(tt.p); (err != nil) != tt.wantErr {
+				t.Errorf("validatePermission() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_reconcilePermissions(t *testing.T) {
+	tracked := map[string]*TrackedPermission{
+		"perm-a": {Permission: &drive.Permission{Id: "perm-a", Type: "user", EmailAddress: "a@gmail.com", Role: "writer"}, Source: PermissionSourceFile},
+		"perm-b": {Permission: &drive.Permission{Id: "perm-b", Type: "user", EmailAddress: "b@gmail.com", Role: "reader"}, Source: PermissionSourceDiscord},
+		"perm-c": {Permission: &drive.Permission{Id: "perm-c", Type: "user", EmailAddress: "c@gmail.com", Role: "reader"}, Source: PermissionSourceFile},
+	}
+	live := []*drive.Permission{
+		{Id: "perm-owner", Type: "user", EmailAddress: "bot@project.iam.gserviceaccount.com", Role: "owner"},
+		{Id: "perm-a", Type: "user", EmailAddress: "a@gmail.com", Role: "writer"},
+		{Id: "perm-b", Type: "user", EmailAddress: "b@gmail.com", Role: "commenter"},
+		{Id: "perm-d", Type: "user", EmailAddress: "d@gmail.com", Role: "reader"},
+	}
+	got := reconcilePermissions(tracked, live)
+	want := PermissionDrift{
+		Missing:   []string{"perm-c"},
+		Roles:     map[string]string{"perm-b": "commenter"},
+		Untracked: []*drive.Permission{live[0], live[3]},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reconcilePermissions() = %+v, want %+v", got, want)
+	}
+
+	shares := mergeShares(tracked, live)
+	wantShares := []string{
+		"owner     bot@project.iam.gserviceaccount.com (shared outside the bot)",
+		"writer    a@gmail.com (file)",
+		"commenter b@gmail.com (discord, was reader)",
+		"reader    d@gmail.com (shared outside the bot)",
+		"reader    c@gmail.com (file, removed outside the bot)",
+	}
+	if len(shares) != len(wantShares) {
+		t.Fatalf("mergeShares() returned %d shares, want %d", len(shares), len(wantShares))
+	}
+	for i := 0; i < len(shares); i++ {
+		if shares[i].String() != wantShares[i] {
+			t.Errorf("mergeShares()[%d] = %q, want %q", i, shares[i].String(), wantShares[i])
+		}
+	}
+}
+
+func Test_carriedPermissions(t *testing.T) {
+	tracked := map[string]*TrackedPermission{
+		"p1": {Permission: &drive.Permission{Id: "p1", Type: "user", EmailAddress: "file@example.com", Role: "reader"}, Source: PermissionSourceFile},
+		"p2": {Permission: &drive.Permission{Id: "p2", Type: "user", EmailAddress: "shared@example.com", Role: "writer"}, Source: PermissionSourceDiscord},
+		"p3": {Permission: &drive.Permission{Id: "p3", Type: "user", EmailAddress: "member@example.com", Role: "reader"}, Source: PermissionSourceMember},
+		"p4": {Permission: &drive.Permission{Id: "p4", Type: "user", EmailAddress: "Both@example.com", Role: "reader"}, Source: PermissionSourceDiscord},
+	}
+	tests := []struct {
+		name     string
+		fromFile []*drive.Permission
+		want     []string
+	}{
+		{
+			name: "shared and linked permissions",
+			want: []string{"p2", "p3", "p4"},
+		},
+		{
+			name:     "grantees in the permissions file are left to it",
+			fromFile: []*drive.Permission{{Type: "user", EmailAddress: "both@example.com", Role: "writer"}},
+			want:     []string{"p2", "p3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, p := range carriedPermissions(tracked, tt.fromFile) {
+				got = append(got, p.Id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("carriedPermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
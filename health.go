@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/gateway"
+)
+
+const (
+	healthCheckTimeout   = time.Duration(5) * time.Second
+	fileCheckCacheExpiry = time.Duration(60) * time.Second
+)
+
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	OK     bool          `json:"ok"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+func writeHealthReport(w http.ResponseWriter, checks []HealthCheck) {
+	report := HealthReport{
+		OK:     true,
+		Checks: checks,
+	}
+	for i := 0; i < len(checks); i++ {
+		if !checks[i].OK {
+			report.OK = false
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if report.OK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// healthzHandler reports whether the process is alive and every started worker is running
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := []HealthCheck{}
+	states := workers.States()
+	for i := 0; i < len(states); i++ {
+		check := HealthCheck{
+			Name: "worker:" + states[i].Name,
+			OK:   states[i].Status == WorkerStatusRunning,
+		}
+		if !check.OK {
+			check.Error = fmt.Sprintf("worker is %s", states[i].Status)
+			if states[i].LastError != "" {
+				check.Error = fmt.Sprintf("%s: %s", check.Error, states[i].LastError)
+			}
+		}
+		checks = append(checks, check)
+	}
+	writeHealthReport(w, checks)
+}
+
+// the spreadsheet lookup goes through the drive api, so its result is cached to spare the quota
+type fileCheckCache struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+func (c *fileCheckCache) check(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < fileCheckCacheExpiry {
+		return c.err
+	}
+	c.err = checkSpreadsheetFile(ctx)
+	c.checkedAt = time.Now()
+	return c.err
+}
+
+func checkSpreadsheetFile(ctx context.Context) error {
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	for i := 0; i < len(trackers); i++ {
+		fileID, err := trackerFileID(trackers[i])
+		if err != nil {
+			return err
+		}
+		exists, err := fileExists(fileID)
+		if err != nil {
+			return fmt.Errorf("fileExists() error: [%w]", err)
+		}
+		if !*exists {
+			return fmt.Errorf("file %s of role %s does not exist", fileID, trackers[i].RoleID)
+		}
+	}
+	return nil
+}
+
+// readyzHandler reports whether the bot can serve commands: the db is reachable,
+// the gateway is connected and the spreadsheet file can be resolved
+func readyzHandler(client bot.Client) http.HandlerFunc {
+	fileCheck := &fileCheckCache{}
+	return func(w http.ResponseWriter, r *http.Request) {
+		checkCtx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+		checks := []HealthCheck{}
+
+		dbCheck := HealthCheck{Name: "database", OK: true}
+		err := dbpool.Ping(checkCtx)
+		if err != nil {
+			dbCheck.OK = false
+			dbCheck.Error = err.Error()
+		}
+		checks = append(checks, dbCheck)
+
+		gatewayCheck := HealthCheck{Name: "gateway", OK: true}
+		if client.Gateway() == nil {
+			gatewayCheck.OK = false
+			gatewayCheck.Error = "gateway is not configured"
+		} else if status := client.Gateway().Status(); status != gateway.StatusReady {
+			gatewayCheck.OK = false
+			gatewayCheck.Error = fmt.Sprintf("gateway status is %d", status)
+		}
+		checks = append(checks, gatewayCheck)
+
+		fileCheckResult := HealthCheck{Name: "spreadsheet", OK: true}
+		if !dbCheck.OK {
+			fileCheckResult.OK = false
+			fileCheckResult.Error = "database is unreachable"
+		} else if err = fileCheck.check(checkCtx); err != nil {
+			fileCheckResult.OK = false
+			fileCheckResult.Error = err.Error()
+		}
+		checks = append(checks, fileCheckResult)
+
+		writeHealthReport(w, checks)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func newHTTPServer(addr string, client bot.Client) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.Handle("/readyz", readyzHandler(client))
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: time.Duration(10) * time.Second,
+	}
+}
+
+// serveHTTP runs the server until ctx is cancelled
+func serveHTTP(ctx context.Context, srv *http.Server) error {
+	errs := make(chan error, 1)
+	go func() {
+		log.Infof("http server listening on %s", srv.Addr)
+		errs <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return fmt.Errorf("srv.ListenAndServe() error: [%w]", err)
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(5)*time.Second)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("srv.Shutdown() error: [%w]", err)
+	}
+	if err = <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("srv.ListenAndServe() error: [%w]", err)
+	}
+	return nil
+}
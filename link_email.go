@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// the mail servers of google accounts, gmail and google workspace domains use them
+var googleMXSuffixes = []string{".google.com.", ".googlemail.com."}
+
+// lookupMX is replaced in tests
+var lookupMX = net.DefaultResolver.LookupMX
+
+// validateLinkEmail checks that the email address is a google account that the
+// spreadsheet can be shared with, a gmail address or an address of a google workspace
+// domain, and returns it lower cased
+func validateLinkEmail(ctx context.Context, email string) (string, error) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != strings.TrimSpace(email) {
+		return "", fmt.Errorf("%q is not an email address", email)
+	}
+	email = strings.ToLower(addr.Address)
+	if isGmailEmailAddress(email) || strings.HasSuffix(email, "@googlemail.com") {
+		return email, nil
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	records, err := lookupMX(ctx, domain)
+	if err != nil {
+		return "", fmt.Errorf("the mail servers of %s could not be looked up: [%w]", domain, err)
+	}
+	for i := 0; i < len(records); i++ {
+		host := strings.ToLower(records[i].Host)
+		for j := 0; j < len(googleMXSuffixes); j++ {
+			if strings.HasSuffix(host, googleMXSuffixes[j]) {
+				return email, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s is not a gmail or google workspace address", email)
+}
+
+func hasRole(roleIDs []snowflake.ID, roleID string) bool {
+	for i := 0; i < len(roleIDs); i++ {
+		if roleIDs[i].String() == roleID {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTrackedRole reports whether the member has the role of any tracker
+func hasTrackedRole(trackers []*Tracker, roleIDs []snowflake.ID) bool {
+	for i := 0; i < len(trackers); i++ {
+		if hasRole(roleIDs, string(trackers[i].RoleID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// MemberEmail is the email address a member linked to get access to the spreadsheets of
+// their roles
+type MemberEmail struct {
+	MemberID    MemberID
+	Email       string
+	ConsentedAt time.Time
+}
+
+func getMemberEmail(ctx context.Context, memberID MemberID) (*MemberEmail, error) {
+	link := &MemberEmail{MemberID: memberID}
+	err := dbpool.QueryRow(
+		ctx,
+		`select email, consented_at from bot.member_email where member_discord_id = $1`,
+		string(memberID),
+	).Scan(&link.Email, &link.ConsentedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("row scan error: [%w]", err)
+	}
+	return link, nil
+}
+
+// getMemberPermissionID gets the permission the linked email address has on the file
+// through the member, or an empty string when it has none
+func getMemberPermissionID(ctx context.Context, fileID FileID, email string) (string, error) {
+	var permID *string
+	err := dbpool.QueryRow(
+		ctx,
+		`
+		select max(perm_gcp_id) from bot.permissions
+		where file_gcp_id = $1 and source = $2 and lower(email) = lower($3)
+		`,
+		string(fileID),
+		string(PermissionSourceMember),
+		email,
+	).Scan(&permID)
+	if err != nil {
+		return "", fmt.Errorf("row scan error: [%w]", err)
+	}
+	if permID == nil {
+		return "", nil
+	}
+	return *permID, nil
+}
+
+// grantMemberAccess shares the spreadsheet with the linked email address of the member,
+// and reports whether it was shared
+func grantMemberAccess(ctx context.Context, fileID FileID, link *MemberEmail) (bool, error) {
+	permID, err := getMemberPermissionID(ctx, fileID, link.Email)
+	if err != nil {
+		return false, fmt.Errorf("getMemberPermissionID() error: [%w]", err)
+	}
+	live, err := listFilePermissions(ctx, fileID)
+	if err != nil {
+		return false, fmt.Errorf("listFilePermissions() error: [%w]", err)
+	}
+	existing := findPermission(live, &drive.Permission{Type: "user", EmailAddress: link.Email})
+	if existing != nil {
+		if existing.Id != permID {
+			// access given some other way is left as it is, and is not revoked with the role
+			loggerFromContext(ctx).Infof("%s already has access to spreadsheet %s as a %s", link.Email, fileID, existing.Role)
+		}
+		return false, nil
+	}
+	role := getBotConfig().LinkEmailRole
+	start := time.Now()
+	p, err := gdriveSvc.Permissions.Create(string(fileID), &drive.Permission{
+		Type:         "user",
+		EmailAddress: link.Email,
+		Role:         role,
+	}).SupportsAllDrives(true).Context(ctx).Do()
+	observeDriveCall("permissions.create", start, err)
+	if err != nil {
+		return false, fmt.Errorf("gdriveSvc.Permissions.Create() error: [%w]", err)
+	}
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("dbpool.Begin() error: [%w]", err)
+	}
+	defer tx.Rollback(ctx)
+	// the permission that was removed outside the bot
+	if permID != "" {
+		_, err = tx.Exec(ctx, `delete from bot.permissions where perm_gcp_id = $1`, permID)
+		if err != nil {
+			return false, fmt.Errorf("delete from bot.permissions error: [%w]", err)
+		}
+	}
+	_, err = tx.Exec(
+		ctx,
+		`
+		insert into bot.permissions(file_gcp_id,perm_gcp_id,email,role,role_type,source) values($1,$2,$3,$4,$5,$6)
+		on conflict (perm_gcp_id) do update
+		set role = excluded.role, source = excluded.source
+		`,
+		string(fileID),
+		p.Id,
+		link.Email,
+		p.Role,
+		p.Type,
+		string(PermissionSourceMember),
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert into bot.permissions error: [%w]", err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	loggerFromContext(ctx).Infof("spreadsheet %s shared with the linked email of member %s as a %s", fileID, link.MemberID, p.Role)
+	return true, nil
+}
+
+// revokeMemberAccess stops sharing the spreadsheet with the linked email address of the
+// member. the link is kept, so that access is given back if the member gets the role again.
+func revokeMemberAccess(ctx context.Context, fileID FileID, link *MemberEmail) error {
+	permID, err := getMemberPermissionID(ctx, fileID, link.Email)
+	if err != nil {
+		return fmt.Errorf("getMemberPermissionID() error: [%w]", err)
+	}
+	if permID == "" {
+		return nil
+	}
+	start := time.Now()
+	err = gdriveSvc.Permissions.Delete(string(fileID), permID).SupportsAllDrives(true).Context(ctx).Do()
+	observeDriveCall("permissions.delete", start, err)
+	var gerr *googleapi.Error
+	// already removed outside the bot
+	if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("gdriveSvc.Permissions.Delete() error: [%w]", err)
+	}
+	_, err = dbpool.Exec(ctx, `delete from bot.permissions where perm_gcp_id = $1`, permID)
+	if err != nil {
+		return fmt.Errorf("delete from bot.permissions error: [%w]", err)
+	}
+	loggerFromContext(ctx).Infof("spreadsheet %s access of member %s revoked", fileID, link.MemberID)
+	return nil
+}
+
+// updateLinkAccess gives the linked email address access to the spreadsheets of the roles
+// in roleIDs and revokes it from the others. it returns how many spreadsheets were shared.
+func updateLinkAccess(ctx context.Context, trackers []*Tracker, link *MemberEmail, roleIDs []snowflake.ID) (int, error) {
+	granted := 0
+	for i := 0; i < len(trackers); i++ {
+		if trackers[i].FileID == "" {
+			continue
+		}
+		if !hasRole(roleIDs, string(trackers[i].RoleID)) {
+			err := revokeMemberAccess(ctx, trackers[i].FileID, link)
+			if err != nil {
+				return granted, fmt.Errorf("revokeMemberAccess() error; role_id=%s: [%w]", trackers[i].RoleID, err)
+			}
+			continue
+		}
+		shared, err := grantMemberAccess(ctx, trackers[i].FileID, link)
+		if err != nil {
+			return granted, fmt.Errorf("grantMemberAccess() error; role_id=%s: [%w]", trackers[i].RoleID, err)
+		}
+		if shared {
+			granted++
+		}
+	}
+	return granted, nil
+}
+
+// updateMemberAccess gives or revokes the access of the linked email address of a member
+// whose roles in the guild changed
+func updateMemberAccess(ctx context.Context, guildID snowflake.ID, memberID MemberID, roleIDs []snowflake.ID) error {
+	link, err := getMemberEmail(ctx, memberID)
+	if err != nil {
+		return fmt.Errorf("getMemberEmail() error: [%w]", err)
+	}
+	if link == nil {
+		return nil
+	}
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	_, err = updateLinkAccess(ctx, guildTrackers(trackers, guildID.String()), link, roleIDs)
+	if err != nil {
+		return fmt.Errorf("updateLinkAccess() error: [%w]", err)
+	}
+	return nil
+}
+
+// linkMemberEmail saves the email address the member consented to share and gives it
+// access to the spreadsheets of the roles of the member in the guild. a previously linked
+// address loses its access everywhere. it returns how many spreadsheets were shared.
+func linkMemberEmail(ctx context.Context, guildID snowflake.ID, memberID MemberID, email string, roleIDs []snowflake.ID) (int, error) {
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	old, err := getMemberEmail(ctx, memberID)
+	if err != nil {
+		return 0, fmt.Errorf("getMemberEmail() error: [%w]", err)
+	}
+	if old != nil && old.Email != email {
+		_, err = updateLinkAccess(ctx, trackers, old, nil)
+		if err != nil {
+			return 0, fmt.Errorf("updateLinkAccess() 1 error: [%w]", err)
+		}
+	}
+	link := &MemberEmail{
+		MemberID:    memberID,
+		Email:       email,
+		ConsentedAt: time.Now().UTC(),
+	}
+	_, err = dbpool.Exec(
+		ctx,
+		`
+		insert into bot.member_email(member_discord_id,email,consented_at) values($1,$2,$3)
+		on conflict (member_discord_id) do update
+		set email = excluded.email, consented_at = excluded.consented_at
+		`,
+		string(memberID),
+		email,
+		link.ConsentedAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insert into bot.member_email error: [%w]", err)
+	}
+	granted, err := updateLinkAccess(ctx, guildTrackers(trackers, guildID.String()), link, roleIDs)
+	if err != nil {
+		return granted, fmt.Errorf("updateLinkAccess() 2 error: [%w]", err)
+	}
+	return granted, nil
+}
+
+// unlinkMemberEmail withdraws the consent of the member, revoking the access of the
+// linked email address and forgetting it
+func unlinkMemberEmail(ctx context.Context, memberID MemberID) (bool, error) {
+	link, err := getMemberEmail(ctx, memberID)
+	if err != nil {
+		return false, fmt.Errorf("getMemberEmail() error: [%w]", err)
+	}
+	if link == nil {
+		return false, nil
+	}
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return false, fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	_, err = updateLinkAccess(ctx, trackers, link, nil)
+	if err != nil {
+		return false, fmt.Errorf("updateLinkAccess() error: [%w]", err)
+	}
+	_, err = dbpool.Exec(ctx, `delete from bot.member_email where member_discord_id = $1`, string(memberID))
+	if err != nil {
+		return false, fmt.Errorf("delete from bot.member_email error: [%w]", err)
+	}
+	return true, nil
+}
+
+// syncMemberAccess gives the linked email addresses of the guild members access to the
+// spreadsheets of their roles and revokes it everywhere else. access removed outside
+// the bot is given back.
+func syncMemberAccess(ctx context.Context, guildID snowflake.ID, guildMembers []discord.Member) error {
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	err = updateLinksAccess(ctx, guildTrackers(trackers, guildID.String()), guildMembers)
+	if err != nil {
+		return fmt.Errorf("updateLinksAccess() error: [%w]", err)
+	}
+	return nil
+}
+
+// updateLinksAccess gives the linked email addresses of the guild members access to the
+// spreadsheets of the trackers of their roles and revokes it from the others
+func updateLinksAccess(ctx context.Context, trackers []*Tracker, guildMembers []discord.Member) error {
+	memberRoles := map[MemberID][]snowflake.ID{}
+	for i := 0; i < len(guildMembers); i++ {
+		memberRoles[MemberID(guildMembers[i].User.ID.String())] = guildMembers[i].RoleIDs
+	}
+
+	rows, err := dbpool.Query(ctx, `select member_discord_id, email, consented_at from bot.member_email`)
+	if err != nil {
+		return fmt.Errorf("get member emails error: [%w]", err)
+	}
+	links := []*MemberEmail{}
+	for rows.Next() {
+		link := &MemberEmail{}
+		var memberID string
+		err = rows.Scan(&memberID, &link.Email, &link.ConsentedAt)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("row scan error: [%w]", err)
+		}
+		link.MemberID = MemberID(memberID)
+		links = append(links, link)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+
+	for i := 0; i < len(links); i++ {
+		_, err = updateLinkAccess(ctx, trackers, links[i], memberRoles[links[i].MemberID])
+		if err != nil {
+			return fmt.Errorf("member %s error: [%w]", links[i].MemberID, err)
+		}
+	}
+	return nil
+}
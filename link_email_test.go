@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func Test_validateLinkEmail(t *testing.T) {
+	oldLookupMX := lookupMX
+	defer func() { lookupMX = oldLookupMX }()
+	lookupMX = func(ctx context.Context, name string) ([]*net.MX, error) {
+		switch name {
+		case "workspace.example":
+			return []*net.MX{{Host: "aspmx.l.google.com.", Pref: 1}}, nil
+		case "other.example":
+			return []*net.MX{{Host: "mx.other.example.", Pref: 1}}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	tests := []struct {
+		name    string
+		email   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "gmail",
+			email: "Hello.World@gmail.com",
+			want:  "hello.world@gmail.com",
+		},
+		{
+			name:  "google workspace domain",
+			email: "member@workspace.example",
+			want:  "member@workspace.example",
+		},
+		{
+			name:    "not a google domain",
+			email:   "member@other.example",
+			wantErr: true,
+		},
+		{
+			name:    "unknown domain",
+			email:   "member@missing.example",
+			wantErr: true,
+		},
+		{
+			name:    "display name",
+			email:   "Member <member@gmail.com>",
+			wantErr: true,
+		},
+		{
+			name:    "not an email address",
+			email:   "member",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateLinkEmail(context.Background(), tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateLinkEmail() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("validateLinkEmail() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
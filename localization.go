@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Language is a language names are translated to, as the XIVAPI language code
+type Language string
+
+const (
+	LanguageEnglish  Language = "en"
+	LanguageFrench   Language = "fr"
+	LanguageGerman   Language = "de"
+	LanguageJapanese Language = "ja"
+)
+
+var languages = []Language{
+	LanguageEnglish,
+	LanguageFrench,
+	LanguageGerman,
+	LanguageJapanese,
+}
+
+func parseLanguage(s string) (Language, error) {
+	for i := 0; i < len(languages); i++ {
+		if strings.EqualFold(s, string(languages[i])) {
+			return languages[i], nil
+		}
+	}
+	names := make([]string, len(languages))
+	for i := 0; i < len(languages); i++ {
+		names[i] = string(languages[i])
+	}
+	return "", fmt.Errorf("must be one of %s", strings.Join(names, ", "))
+}
+
+// localeLanguage gets the language of the discord locale, or an empty language when
+// names are not translated to it
+func localeLanguage(locale discord.Locale) Language {
+	switch locale {
+	case discord.LocaleEnglishUS, discord.LocaleEnglishGB:
+		return LanguageEnglish
+	case discord.LocaleFrench:
+		return LanguageFrench
+	case discord.LocaleGerman:
+		return LanguageGerman
+	case discord.LocaleJapanese:
+		return LanguageJapanese
+	}
+	return ""
+}
+
+// collectiblePlurals are the names of the collectible types in sheet titles
+var collectiblePlurals = map[Language]map[CollectibleType]string{
+	LanguageFrench: {
+		CollectibleTypeMinion:      "Mascottes",
+		CollectibleTypeOrchestrion: "Rouleaux d'orchestrion",
+		CollectibleTypeAchievement: "Hauts faits",
+	},
+	LanguageGerman: {
+		CollectibleTypeMinion:      "Begleiter",
+		CollectibleTypeOrchestrion: "Orchestrion-Notenrollen",
+		CollectibleTypeAchievement: "Errungenschaften",
+	},
+	LanguageJapanese: {
+		CollectibleTypeMinion:      "ミニオン",
+		CollectibleTypeOrchestrion: "オーケストリオン譜",
+		CollectibleTypeAchievement: "アチーブメント",
+	},
+}
+
+// Translations maps the IDs of bosses, collectibles and expansions to their names in
+// each language. the IDs are UUIDs, so they do not collide across the tables.
+type Translations map[string]map[Language]string
+
+// name gets the name of the object in the language, or fallback when it has no
+// translation
+func (t Translations) name(id string, lang Language, fallback string) string {
+	if name, ok := t[id][lang]; ok {
+		return name
+	}
+	return fallback
+}
+
+// matches checks if s is the fallback name or any translation of the object
+func (t Translations) matches(id string, fallback string, s string) bool {
+	if strings.EqualFold(fallback, s) {
+		return true
+	}
+	for _, name := range t[id] {
+		if strings.EqualFold(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func getTranslations(ctx context.Context) (Translations, error) {
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select boss_id, language, boss_name from bot.boss_localized_name
+		union all
+		select collectible_id, language, collectible_name from bot.collectible_localized_name
+		union all
+		select expansion_id, language, expansion_name from bot.expansion_localized_name
+		`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get localized names error: [%w]", err)
+	}
+	defer rows.Close()
+	translations := Translations{}
+	for rows.Next() {
+		var id string
+		var lang string
+		var name string
+		err = rows.Scan(&id, &lang, &name)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		if translations[id] == nil {
+			translations[id] = map[Language]string{}
+		}
+		translations[id][Language(lang)] = name
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return translations, nil
+}
+
+// setGuildSpreadsheetLanguage sets the language of the spreadsheets of the guild, the
+// configured spreadsheet_language is used until one is set
+func setGuildSpreadsheetLanguage(ctx context.Context, guildID snowflake.ID, lang Language) error {
+	_, err := dbpool.Exec(
+		ctx,
+		`
+		insert into bot.guild_settings(guild_id,spreadsheet_language) values($1,$2)
+		on conflict (guild_id) do update set spreadsheet_language = excluded.spreadsheet_language
+		`,
+		guildID.String(),
+		string(lang),
+	)
+	if err != nil {
+		return fmt.Errorf("upsert bot.guild_settings error: [%w]", err)
+	}
+	return nil
+}
+
+// localizeExpansions gets copies of the expansions named in the language
+func localizeExpansions(expansions []*Expansion, t Translations, lang Language) []*Expansion {
+	localized := make([]*Expansion, len(expansions))
+	for i := 0; i < len(expansions); i++ {
+		e := *expansions[i]
+		e.Name = ExpansionName(t.name(string(e.ID), lang, string(e.Name)))
+		localized[i] = &e
+	}
+	return localized
+}
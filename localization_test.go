@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/disgoorg/disgo/discord"
+)
+
+func Test_localeLanguage(t *testing.T) {
+	tests := []struct {
+		locale discord.Locale
+		want   Language
+	}{
+		{locale: discord.LocaleEnglishGB, want: LanguageEnglish},
+		{locale: discord.LocaleFrench, want: LanguageFrench},
+		{locale: discord.LocaleJapanese, want: LanguageJapanese},
+		{locale: discord.LocaleKorean, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.locale), func(t *testing.T) {
+			if got := localeLanguage(tt.locale); got != tt.want {
+				t.Errorf("localeLanguage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslations_name(t *testing.T) {
+	translations := Translations{"ixion": {LanguageGerman: "Ixion-Zaum"}}
+	tests := []struct {
+		name string
+		id   string
+		lang Language
+		want string
+	}{
+		{name: "translated", id: "ixion", lang: LanguageGerman, want: "Ixion-Zaum"},
+		{name: "no translation in the language", id: "ixion", lang: LanguageJapanese, want: "Ixion"},
+		{name: "no language", id: "ixion", lang: "", want: "Ixion"},
+		{name: "unknown id", id: "xanthos", lang: LanguageGerman, want: "Ixion"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := translations.name(tt.id, tt.lang, "Ixion"); got != tt.want {
+				t.Errorf("Translations.name() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/disgoorg/disgo/events"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+const redactedLogValue = "[REDACTED]"
+
+// log is the process wide logger. it is also handed to disgo so that library
+// logs are written in the same format and go through the same redaction.
+var log = newLogger()
+
+func newLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	logger.SetReportCaller(true)
+	logger.SetFormatter(&redactingFormatter{Formatter: newLogFormatter(LogFormatText)})
+	return logger
+}
+
+func newLogFormatter(format string) logrus.Formatter {
+	// only keep the file name and line of the caller, like log.Lshortfile
+	callerPrettyfier := func(frame *runtime.Frame) (function string, file string) {
+		return "", fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+	}
+	if format == LogFormatJSON {
+		return &logrus.JSONFormatter{
+			CallerPrettyfier: callerPrettyfier,
+		}
+	}
+	return &logrus.TextFormatter{
+		FullTimestamp:    true,
+		CallerPrettyfier: callerPrettyfier,
+	}
+}
+
+// configureLogger sets the level and format of the logger. the secrets are
+// removed from every message and field before it is written.
+func configureLogger(level logrus.Level, format string, secrets ...string) {
+	formatter := &redactingFormatter{Formatter: newLogFormatter(format)}
+	for i := 0; i < len(secrets); i++ {
+		if secrets[i] != "" {
+			formatter.secrets = append(formatter.secrets, secrets[i])
+		}
+	}
+	log.SetLevel(level)
+	log.SetFormatter(formatter)
+}
+
+type redactingFormatter struct {
+	logrus.Formatter
+	secrets []string
+}
+
+func (f *redactingFormatter) redact(s string) string {
+	for i := 0; i < len(f.secrets); i++ {
+		s = strings.ReplaceAll(s, f.secrets[i], redactedLogValue)
+	}
+	return s
+}
+
+func (f *redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if len(f.secrets) == 0 {
+		return f.Formatter.Format(entry)
+	}
+	redacted := *entry
+	redacted.Message = f.redact(entry.Message)
+	redacted.Data = make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			redacted.Data[key] = f.redact(v)
+		case error:
+			redacted.Data[key] = f.redact(v.Error())
+		case fmt.Stringer:
+			redacted.Data[key] = f.redact(v.String())
+		default:
+			redacted.Data[key] = value
+		}
+	}
+	return f.Formatter.Format(&redacted)
+}
+
+// interactionLogger gets a logger with the fields identifying a slash command interaction
+func interactionLogger(event *events.ApplicationCommandInteractionCreate) *logrus.Entry {
+	fields := logrus.Fields{
+		"interaction_id": event.ID().String(),
+		"member_id":      event.User().ID.String(),
+		"command":        event.Data.CommandName(),
+	}
+	if event.GuildID() != nil {
+		fields["guild_id"] = event.GuildID().String()
+	}
+	return log.WithFields(fields)
+}
+
+// componentLogger gets a logger with the fields identifying a message component interaction
+func componentLogger(event *events.ComponentInteractionCreate) *logrus.Entry {
+	fields := logrus.Fields{
+		"interaction_id": event.ID().String(),
+		"member_id":      event.User().ID.String(),
+		"custom_id":      event.Data.CustomID(),
+	}
+	if event.GuildID() != nil {
+		fields["guild_id"] = event.GuildID().String()
+	}
+	return log.WithFields(fields)
+}
+
+// autocompleteLogger gets a logger with the fields identifying an autocomplete interaction
+func autocompleteLogger(event *events.AutocompleteInteractionCreate, option string) *logrus.Entry {
+	fields := logrus.Fields{
+		"interaction_id": event.ID().String(),
+		"member_id":      event.User().ID.String(),
+		"command":        event.Data.CommandName,
+		"option":         option,
+	}
+	if event.GuildID() != nil {
+		fields["guild_id"] = event.GuildID().String()
+	}
+	return log.WithFields(fields)
+}
+
+// jobLogger gets a logger for a single run of a background job
+func jobLogger(job string) *logrus.Entry {
+	return log.WithFields(logrus.Fields{
+		"job":    job,
+		"job_id": uuid.New().String(),
+	})
+}
+
+type loggerContextKey struct{}
+
+func withLogger(ctx context.Context, logger *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// loggerFromContext gets the logger stored on the context, falling back to the process logger
+func loggerFromContext(ctx context.Context) *logrus.Entry {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*logrus.Entry); ok {
+		return logger
+	}
+	return logrus.NewEntry(log)
+}
@@ -4,8 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/disgoorg/disgo"
@@ -13,7 +11,6 @@ import (
 	"github.com/disgoorg/disgo/cache"
 	"github.com/disgoorg/disgo/events"
 	"github.com/disgoorg/disgo/gateway"
-	"github.com/disgoorg/log"
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/oauth2/google"
@@ -23,19 +20,10 @@ import (
 )
 
 const (
-	gscope                              = "https://www.googleapis.com/auth/drive"
-	discordConfigFilepath               = "/app/config.json"
-	mountSpreadsheetPermissionsFilepath = "/app/file-permissions.json"
-	mountSpreadsheetColumnDataFilepath  = "/app/column-data.csv"
-	googleApiConfigRelativeFilepath     = "/app/svc-creds.json"
-	guildMemberCountRequestLimit        = 1000
-	nullSnowflake                       = snowflake.ID(0)
-)
-
-var (
-	maxRetryDuration           float64 = 3600
-	googleSheetsWriteRateLimit float64 = 1 // req / sec
-	xivapiLodestoneRateLimit   float64 = 1 // req / sec
+	gscope                             = "https://www.googleapis.com/auth/drive"
+	mountSpreadsheetColumnDataFilepath = "/app/column-data.csv"
+	guildMemberCountRequestLimit       = 1000
+	nullSnowflake                      = snowflake.ID(0)
 )
 
 var (
@@ -46,8 +34,8 @@ var (
 )
 
 var (
-	xivapiCharacterScanSleepDuration = time.Duration(3600) * time.Second
-	xivapiMountScanSleepDuration     = time.Duration(3600/2) * time.Second
+	sheetWriteDrainTimeout = time.Duration(30) * time.Second
+	shutdownTimeout        = sheetWriteDrainTimeout + time.Duration(10)*time.Second
 )
 
 var (
@@ -56,7 +44,9 @@ var (
 	xivapiClient *XivApiClient
 	ctx          context.Context
 	dbpool       *pgxpool.Pool
-	botConfig    *Config
+	workers      *WorkerSupervisor
+	// the args the config was loaded from, so that reloads read the same flags
+	configArgs []string
 )
 
 func onReadyHandler(event *events.Ready) {
@@ -64,74 +54,78 @@ func onReadyHandler(event *events.Ready) {
 }
 
 func main() {
-	log.SetFlags(log.Lshortfile)
-
-	var err error
-	botConfig, err = NewConfig(discordConfigFilepath)
-	if err != nil {
-		log.Fatal(err)
-		return
-	}
-	log.Debug("parsed bot config file")
-	log.SetLevel(log.Level(botConfig.LogLevel))
-	ctx = context.Background()
-
-	// init db pool
-	dbpool, err = pgxpool.New(
-		ctx,
-		fmt.Sprintf(
-			"postgres://%s:%s@%s:%s/%s",
-			botConfig.DBUsername,
-			botConfig.DBUserPassword,
-			botConfig.DBIP,
-			botConfig.DBPort,
-			botConfig.DBName,
-		),
-	)
-	if err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer dbpool.Close()
-	// ensure no issues with acquiring db connections
-	dbcon, err := dbpool.Acquire(ctx)
-	if err != nil {
-		log.Fatal(err)
-		return
-	}
-	dbcon.Release()
-	log.Debug("db pool initialized")
+	os.Exit(runCLI(os.Args[1:]))
+}
 
-	// init google api client
-	b, err := os.ReadFile(googleApiConfigRelativeFilepath)
+// initGoogleServices creates the drive and sheets services from the service account credentials
+func initGoogleServices(ctx context.Context, config *Config) error {
+	b, err := os.ReadFile(config.GoogleCredentialsFilepath)
 	if err != nil {
-		log.Fatal(err)
-		return
+		return fmt.Errorf("os.ReadFile() error: [%w]", err)
 	}
 	gconfig, err := google.JWTConfigFromJSON(b, gscope)
 	if err != nil {
-		log.Fatal(err)
-		return
+		return fmt.Errorf("google.JWTConfigFromJSON() error: [%w]", err)
 	}
 	gclient := gconfig.Client(ctx)
 	log.Debug("google client initialized")
 	gdriveSvc, err = drive.NewService(ctx, option.WithHTTPClient(gclient))
 	if err != nil {
-		log.Fatal(err)
-		return
+		return fmt.Errorf("drive.NewService() error: [%w]", err)
 	}
 	log.Debug("google drive service initialized")
 	gsheetsSvc, err = sheets.NewService(ctx, option.WithHTTPClient(gclient))
 	if err != nil {
-		return
+		return fmt.Errorf("sheets.NewService() error: [%w]", err)
 	}
 	log.Debug("google sheets service initialized")
-	// init xivapi client
-	xivapiClient = NewXivApiClient(botConfig.XivapiApiKey, nil)
+	return nil
+}
+
+func startGoogleSheetsWriter() {
+	workers.Go("google-sheets-writer", func(ctx context.Context) error {
+		return googleSheetBatchUpdateRateLimiter(ctx, googleSheetsWriteReqs)
+	})
+}
+
+func startXivapiLodestoneLimiter() {
+	workers.Go("xivapi-lodestone-limiter", func(ctx context.Context) error {
+		return xivApiLodestoneRequestRateLimiter(ctx, xivapiLodestoneReqs, xivapiLodestoneResps, xivapiLodestoneReqTokens)
+	})
+}
+
+// runBot migrates and seeds the database, then runs the bot until ctx is cancelled
+func runBot(ctx context.Context, config *Config) error {
+	var err error
+	dbpool, err = connectDB(ctx, config)
+	if err != nil {
+		return fmt.Errorf("connectDB() error: [%w]", err)
+	}
+	defer dbpool.Close()
+	defer stopWorkers()
+	log.Debug("db pool initialized")
+	_, err = migrateDB(ctx)
+	if err != nil {
+		return fmt.Errorf("migrateDB() error: [%w]", err)
+	}
+	seeded, err := seedDB(ctx)
+	if err != nil {
+		return fmt.Errorf("seedDB() error: [%w]", err)
+	}
+	for i := 0; i < len(seeded); i++ {
+		log.Infof("seeded %s", seeded[i])
+	}
+
+	err = initGoogleServices(ctx, config)
+	if err != nil {
+		return fmt.Errorf("initGoogleServices() error: [%w]", err)
+	}
+	xivapiClient = NewXivApiClient(config.XivapiApiKey, nil)
 
 	// init discord client
 	client, err := disgo.New(
-		botConfig.DiscordToken,
+		config.DiscordToken,
+		bot.WithLogger(log),
 		bot.WithDefaultGateway(),
 		bot.WithGatewayConfigOpts(
 			gateway.WithIntents(
@@ -149,34 +143,55 @@ func main() {
 		bot.WithEventListenerFunc(spreadsheetDiscordMemberSyncHandler),
 		bot.WithEventListenerFunc(onGuildMemberUpdateHandler),
 		bot.WithEventListenerFunc(syncSpreadsheetStylingHandler),
+		bot.WithEventListenerFunc(setRoleStylingHandler),
 		bot.WithEventListenerFunc(syncFilePermsHandler),
+		bot.WithEventListenerFunc(rebuildSpreadsheetHandler),
+		bot.WithEventListenerFunc(adoptSpreadsheetHandler),
+		bot.WithEventListenerFunc(shareHandler),
+		bot.WithEventListenerFunc(linkEmailHandler),
+		bot.WithEventListenerFunc(unlinkEmailHandler),
 		bot.WithEventListenerFunc(anyXivCharacterSearchHandler),
 		bot.WithEventListenerFunc(xivCharacterSearchHandler),
+		bot.WithEventListenerFunc(characterSearchComponentHandler),
 		bot.WithEventListenerFunc(mapAnyXivCharacterIDHandler),
 		bot.WithEventListenerFunc(mapXivCharacterIDHandler),
+		bot.WithEventListenerFunc(verifyXivCharacterHandler),
+		bot.WithEventListenerFunc(addXivAltHandler),
+		bot.WithEventListenerFunc(removeXivAltHandler),
+		bot.WithEventListenerFunc(setPrimaryXivCharacterHandler),
+		bot.WithEventListenerFunc(xivCharactersHandler),
+		bot.WithEventListenerFunc(setOwnershipModeHandler),
+		bot.WithEventListenerFunc(setSpreadsheetLanguageHandler),
 		bot.WithEventListenerFunc(scanXivMountsHandler),
 		bot.WithEventListenerFunc(updateMemberNamesHandler),
+		bot.WithEventListenerFunc(workerStatusHandler),
+		bot.WithEventListenerFunc(autocompleteHandler),
 		bot.WithCacheConfigOpts(cache.WithCaches(cache.FlagMembers)),
 	)
 	if err != nil {
-		log.Fatal(err)
-		return
+		return fmt.Errorf("disgo.New() error: [%w]", err)
 	}
-	defer client.Close(context.TODO())
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+		defer cancel()
+		client.Close(closeCtx)
+	}()
+	httpServer := newHTTPServer(config.HTTPListenAddress, client)
+	workers.Go("http-server", func(ctx context.Context) error {
+		return serveHTTP(ctx, httpServer)
+	})
 
 	slashCmds := createSlashCommands()
 	if _, err = client.Rest().SetGlobalCommands(client.ApplicationID(), slashCmds); err != nil {
-		log.Fatal("error while registering commands: ", err)
-		return
+		return fmt.Errorf("error while registering commands: [%w]", err)
 	}
 
-	if err = client.OpenGateway(context.TODO()); err != nil {
-		log.Fatal(err)
-		return
+	if err = client.OpenGateway(ctx); err != nil {
+		return fmt.Errorf("client.OpenGateway() error: [%w]", err)
 	}
 	log.Debug("bot initialized")
 
-	s := make(chan os.Signal, 1)
-	signal.Notify(s, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-s
+	<-ctx.Done()
+	log.Info("shutting down")
+	return nil
 }
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+const metricsNamespace = "tataru"
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	sheetsBatchUpdatesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "sheets",
+			Name:      "batch_updates_total",
+			Help:      "Google Sheets batch update calls by HTTP status code.",
+		},
+		[]string{"status"},
+	)
+	sheetsBatchUpdateDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "sheets",
+			Name:      "batch_update_duration_seconds",
+			Help:      "Latency of Google Sheets batch update calls.",
+			Buckets:   prometheus.DefBuckets,
+		},
+	)
+	sheetsWriteQueueDepth = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "sheets",
+			Name:      "write_queue_depth",
+			Help:      "Google Sheets batch updates waiting to be written.",
+		},
+		func() float64 {
+			return float64(atomic.LoadInt64(&pendingSheetBatchUpdates))
+		},
+	)
+	xivapiRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "xivapi",
+			Name:      "requests_total",
+			Help:      "XIVAPI requests by request type and HTTP status code.",
+		},
+		[]string{"request_type", "status"},
+	)
+	xivapiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "xivapi",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of XIVAPI requests by request type.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"request_type"},
+	)
+	driveCallsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "drive",
+			Name:      "calls_total",
+			Help:      "Google Drive API calls by operation and HTTP status code.",
+		},
+		[]string{"operation", "status"},
+	)
+	driveCallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "drive",
+			Name:      "call_duration_seconds",
+			Help:      "Latency of Google Drive API calls by operation.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+	scanDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "scan_duration_seconds",
+			Help:      "Duration of background scans by scan type and result.",
+			Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+		},
+		[]string{"scan", "result"},
+	)
+	mountScanCharactersTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "mount_scan",
+			Name:      "characters_total",
+			Help:      "Character profiles fetched by mount scans.",
+		},
+	)
+	mountScanOwnedCollectiblesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "mount_scan",
+			Name:      "owned_collectibles_total",
+			Help:      "Tracked collectibles found on character profiles by mount scans, by collectible type.",
+		},
+		[]string{"type"},
+	)
+	characterIDScanFoundTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "character_id_scan",
+			Name:      "found_total",
+			Help:      "Character IDs found by the automatic character ID scan.",
+		},
+	)
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		sheetsBatchUpdatesTotal,
+		sheetsBatchUpdateDuration,
+		sheetsWriteQueueDepth,
+		xivapiRequestsTotal,
+		xivapiRequestDuration,
+		driveCallsTotal,
+		driveCallDuration,
+		scanDuration,
+		mountScanCharactersTotal,
+		mountScanOwnedCollectiblesTotal,
+		characterIDScanFoundTotal,
+		&dbCollector{},
+	)
+}
+
+// googleApiStatus gets the HTTP status code of a google api call as a metric label
+func googleApiStatus(statusCode int, err error) string {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return strconv.Itoa(gerr.Code)
+	}
+	if err != nil {
+		return "error"
+	}
+	return strconv.Itoa(statusCode)
+}
+
+func observeSheetsBatchUpdate(start time.Time, resp *sheets.BatchUpdateSpreadsheetResponse, err error) {
+	sheetsBatchUpdateDuration.Observe(time.Since(start).Seconds())
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.HTTPStatusCode
+	}
+	sheetsBatchUpdatesTotal.WithLabelValues(googleApiStatus(statusCode, err)).Inc()
+}
+
+func observeDriveCall(operation string, start time.Time, err error) {
+	driveCallDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	// successful drive calls do not expose their status code through the typed responses
+	driveCallsTotal.WithLabelValues(operation, googleApiStatus(http.StatusOK, err)).Inc()
+}
+
+func observeXivapiRequest(requestType string, start time.Time, resp *http.Response, err error) {
+	xivapiRequestDuration.WithLabelValues(requestType).Observe(time.Since(start).Seconds())
+	status := "error"
+	if err == nil && resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	xivapiRequestsTotal.WithLabelValues(requestType, status).Inc()
+}
+
+func observeScan(scan string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	scanDuration.WithLabelValues(scan, result).Observe(time.Since(start).Seconds())
+}
+
+var (
+	dbPoolAcquiredConnsDesc   = prometheus.NewDesc(metricsNamespace+"_db_pool_acquired_conns", "Connections currently acquired from the pool.", nil, nil)
+	dbPoolIdleConnsDesc       = prometheus.NewDesc(metricsNamespace+"_db_pool_idle_conns", "Idle connections in the pool.", nil, nil)
+	dbPoolTotalConnsDesc      = prometheus.NewDesc(metricsNamespace+"_db_pool_total_conns", "Total connections in the pool.", nil, nil)
+	dbPoolMaxConnsDesc        = prometheus.NewDesc(metricsNamespace+"_db_pool_max_conns", "Maximum size of the pool.", nil, nil)
+	dbPoolAcquireCountDesc    = prometheus.NewDesc(metricsNamespace+"_db_pool_acquires_total", "Successful acquires from the pool.", nil, nil)
+	dbPoolEmptyAcquireDesc    = prometheus.NewDesc(metricsNamespace+"_db_pool_empty_acquires_total", "Acquires that had to wait for a connection.", nil, nil)
+	dbPoolCanceledAcquireDesc = prometheus.NewDesc(metricsNamespace+"_db_pool_canceled_acquires_total", "Acquires that were cancelled by their context.", nil, nil)
+	dbPoolAcquireSecondsDesc  = prometheus.NewDesc(metricsNamespace+"_db_pool_acquire_seconds_total", "Total time spent acquiring connections.", nil, nil)
+	membersTrackedDesc        = prometheus.NewDesc(metricsNamespace+"_members_tracked", "Members tracked in the database.", nil, nil)
+	membersWithCharacterDesc  = prometheus.NewDesc(metricsNamespace+"_members_with_character_id", "Tracked members with a mapped FF14 character ID.", nil, nil)
+)
+
+// dbCollector reports the pgxpool stats and the tracked member counts at scrape time
+type dbCollector struct{}
+
+func (c *dbCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbPoolAcquiredConnsDesc
+	ch <- dbPoolIdleConnsDesc
+	ch <- dbPoolTotalConnsDesc
+	ch <- dbPoolMaxConnsDesc
+	ch <- dbPoolAcquireCountDesc
+	ch <- dbPoolEmptyAcquireDesc
+	ch <- dbPoolCanceledAcquireDesc
+	ch <- dbPoolAcquireSecondsDesc
+	ch <- membersTrackedDesc
+	ch <- membersWithCharacterDesc
+}
+
+func (c *dbCollector) Collect(ch chan<- prometheus.Metric) {
+	if dbpool == nil {
+		return
+	}
+	stat := dbpool.Stat()
+	ch <- prometheus.MustNewConstMetric(dbPoolAcquiredConnsDesc, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(dbPoolIdleConnsDesc, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(dbPoolTotalConnsDesc, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(dbPoolMaxConnsDesc, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(dbPoolAcquireCountDesc, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(dbPoolEmptyAcquireDesc, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(dbPoolCanceledAcquireDesc, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(dbPoolAcquireSecondsDesc, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+
+	queryCtx, cancel := context.WithTimeout(context.Background(), time.Duration(5)*time.Second)
+	defer cancel()
+	var numMembers int
+	var numMembersWithCharacter int
+	row := dbpool.QueryRow(
+		queryCtx,
+		`
+			select
+				count(*),
+				count(member_xiv_id)
+			from bot.member_metadata
+		`,
+	)
+	err := row.Scan(&numMembers, &numMembersWithCharacter)
+	if err != nil {
+		log.Debugf("collecting member metrics error: %s", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(membersTrackedDesc, prometheus.GaugeValue, float64(numMembers))
+	ch <- prometheus.MustNewConstMetric(membersWithCharacterDesc, prometheus.GaugeValue, float64(numMembersWithCharacter))
+}
@@ -0,0 +1,750 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// arbitrary key so that only one process migrates the database at a time
+const dbMigrationLockKey int64 = 7414010
+
+type dbMigration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx pgx.Tx) error
+}
+
+// dbMigrations are applied in order and must never be edited once released;
+// schema changes are made by appending a new migration
+var dbMigrations = []dbMigration{
+	{version: 1, name: "initial schema", up: migrateInitialSchema},
+	{version: 2, name: "permission source", up: migratePermissionSource},
+	{version: 3, name: "member emails", up: migrateMemberEmails},
+	{version: 4, name: "permission domain and expiration", up: migratePermissionDomainAndExpiration},
+	{version: 5, name: "tracked roles", up: migrateTrackedRoles},
+	{version: 6, name: "collectibles", up: migrateCollectibles},
+	{version: 7, name: "collectible game ids", up: migrateCollectibleGameIDs},
+	{version: 8, name: "localized names", up: migrateLocalizedNames},
+	{version: 9, name: "character verification", up: migrateCharacterVerification},
+	{version: 10, name: "member characters", up: migrateMemberCharacters},
+	{version: 11, name: "guild spreadsheet language", up: migrateGuildSpreadsheetLanguage},
+}
+
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// migrateDB applies the migrations that have not been applied yet and returns them.
+// databases created before migrations were tracked are recorded as being at version 1.
+func migrateDB(ctx context.Context) ([]dbMigration, error) {
+	dbcon, err := dbpool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("database connection acquire error: [%w]", err)
+	}
+	defer dbcon.Release()
+	_, err = dbcon.Exec(ctx, `select pg_advisory_lock($1)`, dbMigrationLockKey)
+	if err != nil {
+		return nil, fmt.Errorf("pg_advisory_lock error: [%w]", err)
+	}
+	defer func() {
+		_, err := dbcon.Exec(context.Background(), `select pg_advisory_unlock($1)`, dbMigrationLockKey)
+		if err != nil {
+			log.Error(fmt.Errorf("pg_advisory_unlock error: [%w]", err))
+		}
+	}()
+
+	var schemaExists, trackingExists bool
+	row := dbcon.QueryRow(
+		ctx,
+		`
+			select
+				exists (
+					select 1
+					from pg_catalog.pg_namespace
+					where nspname = 'bot'
+				),
+				to_regclass('bot.schema_migrations') is not null
+		`,
+	)
+	err = row.Scan(&schemaExists, &trackingExists)
+	if err != nil {
+		return nil, fmt.Errorf("row scan 1 error: [%w]", err)
+	}
+	tx, err := dbcon.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dbcon.Begin() 1 error: [%w]", err)
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, `create schema if not exists bot`)
+	if err != nil {
+		return nil, fmt.Errorf("create schema error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table if not exists bot.schema_migrations (
+			version int primary key not null,
+			name varchar(128) not null,
+			applied_at timestamptz not null default now()
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("create bot.schema_migrations error: [%w]", err)
+	}
+	if schemaExists && !trackingExists {
+		_, err = tx.Exec(
+			ctx,
+			`insert into bot.schema_migrations(version,name) values($1,$2)`,
+			dbMigrations[0].version,
+			dbMigrations[0].name,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("record existing schema error: [%w]", err)
+		}
+		log.Info("existing schema recorded as migration version 1")
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Commit() 1 error: [%w]", err)
+	}
+
+	applied, err := getAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getAppliedMigrations() error: [%w]", err)
+	}
+	pending := pendingMigrations(applied)
+	for i := 0; i < len(pending); i++ {
+		m := pending[i]
+		tx, err := dbcon.Begin(ctx)
+		if err != nil {
+			return pending[:i], fmt.Errorf("dbcon.Begin() 2 error; version=%d: [%w]", m.version, err)
+		}
+		err = m.up(ctx, tx)
+		if err != nil {
+			tx.Rollback(ctx)
+			return pending[:i], fmt.Errorf("migration %d (%s) error: [%w]", m.version, m.name, err)
+		}
+		_, err = tx.Exec(ctx, `insert into bot.schema_migrations(version,name) values($1,$2)`, m.version, m.name)
+		if err != nil {
+			tx.Rollback(ctx)
+			return pending[:i], fmt.Errorf("record migration error; version=%d: [%w]", m.version, err)
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			return pending[:i], fmt.Errorf("tx.Commit() 2 error; version=%d: [%w]", m.version, err)
+		}
+		log.WithField("version", m.version).Infof("applied migration: %s", m.name)
+	}
+	return pending, nil
+}
+
+// getAppliedMigrations reads the migrations recorded in the database. a database
+// without the tracking table has none applied.
+func getAppliedMigrations(ctx context.Context) ([]AppliedMigration, error) {
+	var trackingExists bool
+	err := dbpool.QueryRow(ctx, `select to_regclass('bot.schema_migrations') is not null`).Scan(&trackingExists)
+	if err != nil {
+		return nil, fmt.Errorf("row scan error: [%w]", err)
+	}
+	if !trackingExists {
+		return []AppliedMigration{}, nil
+	}
+	rows, err := dbpool.Query(ctx, `select version, name, applied_at from bot.schema_migrations order by version`)
+	if err != nil {
+		return nil, fmt.Errorf("get applied migrations error: [%w]", err)
+	}
+	defer rows.Close()
+	applied := []AppliedMigration{}
+	for rows.Next() {
+		var m AppliedMigration
+		err = rows.Scan(&m.Version, &m.Name, &m.AppliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("rows.Scan() error: [%w]", err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, rows.Err()
+}
+
+func pendingMigrations(applied []AppliedMigration) []dbMigration {
+	appliedVersions := map[int]bool{}
+	for i := 0; i < len(applied); i++ {
+		appliedVersions[applied[i].Version] = true
+	}
+	pending := []dbMigration{}
+	for i := 0; i < len(dbMigrations); i++ {
+		if !appliedVersions[dbMigrations[i].version] {
+			pending = append(pending, dbMigrations[i])
+		}
+	}
+	return pending
+}
+
+func migrateInitialSchema(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		create table bot.file_ref (
+			file_gcp_id varchar(128) primary key not null
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.file_ref error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.permissions (
+			file_gcp_id varchar(128) not null,
+			perm_gcp_id varchar(128) primary key not null,
+			email varchar(128),
+			role varchar(128) not null,
+			role_type varchar(128) not null,
+			constraint fk_file_ref
+				foreign key (file_gcp_id)
+					references bot.file_ref(file_gcp_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.permissions error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.expansion_metadata (
+			expansion_id varchar(36) primary key not null,
+			expansion_name varchar(128) not null,
+			expansion_index int not null
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.expansion_metadata error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.sheet_metadata (
+			file_gcp_id varchar(128) not null,
+			sheet_gcp_id varchar(128) primary key not null,
+			sheet_index int not null,
+			constraint fk_file_ref
+				foreign key (file_gcp_id)
+					references bot.file_ref(file_gcp_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.sheet_metadata error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.sheet_expansion_map (
+			sheet_gcp_id varchar(128) not null,
+			expansion_id varchar(36) not null,
+			primary key (
+				sheet_gcp_id,
+				expansion_id
+			),
+			constraint fk_sheet_gcp_id
+				foreign key (sheet_gcp_id)
+					references bot.sheet_metadata(sheet_gcp_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.sheet_expansion_map error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.member_metadata (
+			member_discord_id varchar(128) primary key not null,
+			member_name varchar(128) not null,
+			member_xiv_id varchar(128)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.member_metadata error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.role_ref (
+			role_id varchar(128) primary key not null
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.role_ref error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.boss_metadata (
+			boss_id varchar(36) primary key not null,
+			boss_name varchar(128) not null
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.boss_metadata error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.boss_expansion_map (
+			boss_id varchar(36) not null,
+			expansion_id varchar(36) not null,
+			boss_expansion_index int not null,
+			primary key (
+				boss_id,
+				expansion_id
+			)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.boss_expansion_map error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.mount_metadata (
+			mount_id varchar(36) primary key not null,
+			mount_name varchar(128) not null
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.mount_metadata error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.boss_mount_map (
+			boss_id varchar(36) not null,
+			mount_id varchar(36) not null,
+			primary key (
+				boss_id,
+				mount_id
+			)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.boss_mount_map error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.member_data (
+			member_discord_id varchar(128) not null,
+			mount_id varchar(36) not null,
+			has_mount boolean not null,
+			primary key (
+				member_discord_id,
+				mount_id
+			),
+			constraint fk_member_discord_id
+				foreign key (member_discord_id)
+					references bot.member_metadata(member_discord_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.member_data error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.boss_styling_data (
+			boss_id varchar(36) primary key not null,
+			header_background_hex_color varchar(9) not null,
+			header_foreground_hex_color varchar(9) not null,
+			checkbox_background_hex_color varchar(9) not null,
+			checkbox_foreground_hex_color varchar(9) not null
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.boss_styling_data error: [%w]", err)
+	}
+	return nil
+}
+
+// migratePermissionSource records whether a permission comes from the permissions file
+// or was shared from discord, the existing permissions all came from the file
+func migratePermissionSource(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		alter table bot.permissions
+		add column source varchar(16) not null default 'file'
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.permissions error: [%w]", err)
+	}
+	return nil
+}
+
+// migrateMemberEmails adds the email addresses members linked to get access to the
+// spreadsheet. perm_gcp_id is null while the member has no access.
+func migrateMemberEmails(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		create table bot.member_email (
+			member_discord_id varchar(128) primary key not null,
+			email varchar(320) not null,
+			consented_at timestamptz not null,
+			perm_gcp_id varchar(128)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.member_email error: [%w]", err)
+	}
+	return nil
+}
+
+// migratePermissionDomainAndExpiration adds what domain permissions, discoverable
+// permissions and expiring permissions need
+func migratePermissionDomainAndExpiration(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		alter table bot.permissions
+		add column domain varchar(255),
+		add column allow_file_discovery boolean not null default false,
+		add column expiration_time timestamptz
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.permissions error: [%w]", err)
+	}
+	return nil
+}
+
+// migrateTrackedRoles lets several roles be watched, each with its own spreadsheet,
+// expansions, members and boss styling. the existing spreadsheet and members go to the
+// role that was set, a spreadsheet without a role goes to the next role that is set.
+func migrateTrackedRoles(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		alter table bot.role_ref
+		add column title varchar(256)
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.role_ref error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		alter table bot.file_ref
+		add column role_id varchar(128) unique,
+		add constraint fk_role_ref
+			foreign key (role_id)
+				references bot.role_ref(role_id)
+				on delete cascade
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.file_ref error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `update bot.file_ref set role_id = (select min(role_id) from bot.role_ref)`)
+	if err != nil {
+		return fmt.Errorf("update bot.file_ref error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.role_expansion_map (
+			role_id varchar(128) not null,
+			expansion_id varchar(36) not null,
+			primary key (
+				role_id,
+				expansion_id
+			),
+			constraint fk_role_ref
+				foreign key (role_id)
+					references bot.role_ref(role_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.role_expansion_map error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.role_member (
+			role_id varchar(128) not null,
+			member_discord_id varchar(128) not null,
+			primary key (
+				role_id,
+				member_discord_id
+			),
+			constraint fk_role_ref
+				foreign key (role_id)
+					references bot.role_ref(role_id)
+					on delete cascade,
+			constraint fk_member_discord_id
+				foreign key (member_discord_id)
+					references bot.member_metadata(member_discord_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.role_member error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		insert into bot.role_member(role_id,member_discord_id)
+		select r.role_id, m.member_discord_id
+		from bot.role_ref r
+		cross join bot.member_metadata m
+	`)
+	if err != nil {
+		return fmt.Errorf("insert into bot.role_member error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.role_boss_styling_data (
+			role_id varchar(128) not null,
+			boss_id varchar(36) not null,
+			header_background_hex_color varchar(9) not null,
+			header_foreground_hex_color varchar(9) not null,
+			checkbox_background_hex_color varchar(9) not null,
+			checkbox_foreground_hex_color varchar(9) not null,
+			primary key (
+				role_id,
+				boss_id
+			),
+			constraint fk_role_ref
+				foreign key (role_id)
+					references bot.role_ref(role_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.role_boss_styling_data error: [%w]", err)
+	}
+	// a linked email gets access to the spreadsheet of each role of the member, which is
+	// found by its permission with the member source
+	_, err = tx.Exec(ctx, `
+		alter table bot.member_email
+		drop column perm_gcp_id
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.member_email error: [%w]", err)
+	}
+	return nil
+}
+
+// migrateCollectibles replaces the mount tables with collectibles of any type, which
+// are dropped by bosses. the mounts, their bosses and who owns them are kept, and the
+// existing sheets are mount sheets.
+func migrateCollectibles(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		create table bot.collectible_metadata (
+			collectible_id varchar(36) primary key not null,
+			collectible_type varchar(32) not null,
+			collectible_name varchar(128) not null,
+			icon_url varchar(512),
+			unique (
+				collectible_type,
+				collectible_name
+			)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.collectible_metadata error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		insert into bot.collectible_metadata(collectible_id,collectible_type,collectible_name)
+		select mount_id, $1, mount_name from bot.mount_metadata
+	`, string(CollectibleTypeMount))
+	if err != nil {
+		return fmt.Errorf("insert into bot.collectible_metadata error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.boss_collectible_map (
+			boss_id varchar(36) not null,
+			collectible_id varchar(36) not null,
+			primary key (
+				boss_id,
+				collectible_id
+			)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.boss_collectible_map error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		insert into bot.boss_collectible_map(boss_id,collectible_id)
+		select boss_id, mount_id from bot.boss_mount_map
+	`)
+	if err != nil {
+		return fmt.Errorf("insert into bot.boss_collectible_map error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.member_collectible (
+			member_discord_id varchar(128) not null,
+			collectible_id varchar(36) not null,
+			has_collectible boolean not null,
+			primary key (
+				member_discord_id,
+				collectible_id
+			),
+			constraint fk_member_discord_id
+				foreign key (member_discord_id)
+					references bot.member_metadata(member_discord_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.member_collectible error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		insert into bot.member_collectible(member_discord_id,collectible_id,has_collectible)
+		select member_discord_id, mount_id, has_mount from bot.member_data
+	`)
+	if err != nil {
+		return fmt.Errorf("insert into bot.member_collectible error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		alter table bot.sheet_metadata
+		add column collectible_type varchar(32) not null default 'mount'
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.sheet_metadata error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `drop table bot.member_data, bot.boss_mount_map, bot.mount_metadata`)
+	if err != nil {
+		return fmt.Errorf("drop mount tables error: [%w]", err)
+	}
+	return nil
+}
+
+// migrateCollectibleGameIDs adds the ID of the collectible in the game data, which is
+// resolved from XIVAPI at startup
+func migrateCollectibleGameIDs(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		alter table bot.collectible_metadata
+		add column game_id integer
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.collectible_metadata error: [%w]", err)
+	}
+	return nil
+}
+
+// migrateLocalizedNames adds the names of bosses, collectibles and expansions in other
+// languages. names without a translation fall back to the english name.
+func migrateLocalizedNames(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		create table bot.boss_localized_name (
+			boss_id varchar(36) not null,
+			language varchar(8) not null,
+			boss_name varchar(128) not null,
+			primary key (boss_id, language)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.boss_localized_name error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.collectible_localized_name (
+			collectible_id varchar(36) not null,
+			language varchar(8) not null,
+			collectible_name varchar(128) not null,
+			primary key (collectible_id, language)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.collectible_localized_name error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.expansion_localized_name (
+			expansion_id varchar(36) not null,
+			language varchar(8) not null,
+			expansion_name varchar(128) not null,
+			primary key (expansion_id, language)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.expansion_localized_name error: [%w]", err)
+	}
+	return nil
+}
+
+// migrateCharacterVerification marks the character IDs whose ownership was proven with
+// a code in the lodestone bio, and adds the codes waiting to be found
+func migrateCharacterVerification(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		alter table bot.member_metadata
+		add column member_xiv_id_verified boolean not null default false
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.member_metadata error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.member_xiv_verification (
+			member_discord_id varchar(128) primary key not null,
+			member_xiv_id varchar(128) not null,
+			code varchar(32) not null,
+			expires_at timestamptz not null,
+			constraint fk_member_discord_id
+				foreign key (member_discord_id)
+					references bot.member_metadata(member_discord_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.member_xiv_verification error: [%w]", err)
+	}
+	return nil
+}
+
+// migrateMemberCharacters adds the alts of members next to the primary character in
+// bot.member_metadata, the collectibles found on each character and the guild setting
+// of how ownership is shown. roles are linked to their guild the next time it is ready.
+func migrateMemberCharacters(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		create table bot.member_character (
+			member_discord_id varchar(128) not null,
+			member_xiv_id varchar(128) not null,
+			verified boolean not null default false,
+			primary key (
+				member_discord_id,
+				member_xiv_id
+			),
+			constraint fk_member_discord_id
+				foreign key (member_discord_id)
+					references bot.member_metadata(member_discord_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.member_character error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.xiv_character (
+			member_xiv_id varchar(128) primary key not null,
+			character_name varchar(128) not null
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.xiv_character error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.character_collectible (
+			member_discord_id varchar(128) not null,
+			member_xiv_id varchar(128) not null,
+			collectible_id varchar(36) not null,
+			primary key (
+				member_discord_id,
+				member_xiv_id,
+				collectible_id
+			),
+			constraint fk_member_discord_id
+				foreign key (member_discord_id)
+					references bot.member_metadata(member_discord_id)
+					on delete cascade
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.character_collectible error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		alter table bot.member_xiv_verification
+		add column as_alt boolean not null default false
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.member_xiv_verification error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		alter table bot.role_ref
+		add column guild_id varchar(128)
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.role_ref error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `
+		create table bot.guild_settings (
+			guild_id varchar(128) primary key not null,
+			ownership_mode varchar(32) not null default 'any'
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create bot.guild_settings error: [%w]", err)
+	}
+	return nil
+}
+
+func migrateGuildSpreadsheetLanguage(ctx context.Context, tx pgx.Tx) error {
+	// guilds without a language of their own use the configured spreadsheet_language
+	_, err := tx.Exec(ctx, `
+		alter table bot.guild_settings
+		add column spreadsheet_language varchar(8)
+	`)
+	if err != nil {
+		return fmt.Errorf("alter bot.guild_settings error: [%w]", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_dbMigrations(t *testing.T) {
+	for i := 0; i < len(dbMigrations); i++ {
+		if dbMigrations[i].version != i+1 {
+			t.Errorf("dbMigrations[%d].version = %d, want %d", i, dbMigrations[i].version, i+1)
+		}
+		if dbMigrations[i].name == "" || dbMigrations[i].up == nil {
+			t.Errorf("dbMigrations[%d] is missing its name or up func", i)
+		}
+	}
+}
+
+func Test_pendingMigrations(t *testing.T) {
+	allVersions := []int{}
+	for i := 0; i < len(dbMigrations); i++ {
+		allVersions = append(allVersions, dbMigrations[i].version)
+	}
+	tests := []struct {
+		name    string
+		applied []AppliedMigration
+		want    []int
+	}{
+		{
+			name:    "new database",
+			applied: []AppliedMigration{},
+			want:    allVersions,
+		},
+		{
+			name:    "initial schema applied",
+			applied: []AppliedMigration{{Version: 1, Name: "initial schema"}},
+			want:    allVersions[1:],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []int{}
+			pending := pendingMigrations(tt.applied)
+			for i := 0; i < len(pending); i++ {
+				got = append(got, pending[i].version)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pendingMigrations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"fmt"
+
+	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
-	"github.com/disgoorg/log"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/api/sheets/v4"
 )
 
@@ -10,180 +14,147 @@ func onGuildMemberUpdateHandler(event *events.GuildMemberUpdate) {
 	if event.Member.User.Bot {
 		return
 	}
+	logger := log.WithFields(logrus.Fields{
+		"guild_id":  event.GuildID.String(),
+		"member_id": event.Member.User.ID.String(),
+	})
 
-	dbcon, err := dbpool.Acquire(ctx)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-	defer dbcon.Release()
-
-	// get the watched role
-	var roleID *string
-	row := dbcon.QueryRow(ctx, `select role_id from bot.role_ref`)
-	err = row.Scan(&roleID)
+	// get the watched roles
+	trackers, err := getTrackers(ctx)
 	if err != nil {
-		log.Error(err)
-		return
-	}
-	if roleID == nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
 
-	// determine to continue
-	oldMemberHasRole := false
-	for i := 0; i < len(event.OldMember.RoleIDs); i++ {
-		if event.OldMember.RoleIDs[i].String() == *roleID {
-			oldMemberHasRole = true
-			break
+	// each role is evaluated on its own, the member can get one role and lose another
+	nickHasUpdated := event.OldMember.Nick != event.Member.Nick
+	roleHasUpdated := false
+	for i := 0; i < len(trackers); i++ {
+		trackerLogger := logger.WithField("role_id", string(trackers[i].RoleID))
+		oldMemberHasRole := hasRole(event.OldMember.RoleIDs, string(trackers[i].RoleID))
+		newMemberHasRole := hasRole(event.Member.RoleIDs, string(trackers[i].RoleID))
+		if oldMemberHasRole != newMemberHasRole {
+			roleHasUpdated = true
+		} else if !nickHasUpdated || !newMemberHasRole {
+			continue
 		}
-	}
-	newMemberHasRole := false
-	for i := 0; i < len(event.Member.RoleIDs); i++ {
-		if event.Member.RoleIDs[i].String() == *roleID {
-			newMemberHasRole = true
-			break
+		if trackers[i].FileID == "" {
+			trackerLogger.Warn("the role has no spreadsheet yet")
+			continue
+		}
+		err = updateTrackedMember(withLogger(ctx, trackerLogger), trackers[i], event.Member, oldMemberHasRole, newMemberHasRole)
+		if err != nil {
+			trackerLogger.Error(err)
 		}
 	}
-	roleHasUpdated := !(oldMemberHasRole && newMemberHasRole)
-	nickHasUpdated := event.OldMember.Nick != event.Member.Nick
-	if !roleHasUpdated && !nickHasUpdated {
-		return
+	if roleHasUpdated {
+		err = updateMemberAccess(withLogger(ctx, logger), event.GuildID, MemberID(event.Member.User.ID.String()), event.Member.RoleIDs)
+		if err != nil {
+			logger.Error(err)
+		}
 	}
+}
 
-	// get file id
-	var fileID *string
-	row = dbcon.QueryRow(
-		ctx,
-		"select file_gcp_id from bot.file_ref",
-	)
-	err = row.Scan(&fileID)
+// updateTrackedMember adds the member to the spreadsheet of the tracker when they got its
+// role, removes them when they lost it and otherwise updates their name
+func updateTrackedMember(ctx context.Context, tracker *Tracker, member discord.Member, oldMemberHasRole bool, newMemberHasRole bool) error {
+	logger := loggerFromContext(ctx)
+	dbcon, err := dbpool.Acquire(ctx)
 	if err != nil {
-		log.Error(err)
-		return
-	}
-	if fileID == nil {
-		log.Error(err)
-		return
+		return fmt.Errorf("database connection acquire error: [%w]", err)
 	}
+	defer dbcon.Release()
 
 	// get column formatting
-	columnMap, err := NewColumnMap()
+	columnMap, err := NewColumnMap(ctx, tracker.FileID)
 	if err != nil {
-		log.Error(err)
-		return
+		return fmt.Errorf("NewColumnMap() error: [%w]", err)
 	}
 
 	// get the spreadsheet
-	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(*fileID).IncludeGridData(true).Do()
+	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(string(tracker.FileID)).IncludeGridData(true).Do()
 	if err != nil {
-		log.Error(err)
-		return
+		return fmt.Errorf("gsheetsSvc.Spreadsheets.Get() error: [%w]", err)
 	}
 
-	userID := event.Member.User.ID.String()
-	var username string
-	if event.Member.Nick == nil {
-		username = event.Member.User.Username
-	} else {
-		username = *event.Member.Nick
-	}
-	if roleHasUpdated {
-		if !oldMemberHasRole && newMemberHasRole {
-			// add the member to the spreadsheet
-			requests := make([]*sheets.Request, len(spreadsheet.Sheets))
-			for i := 0; i < len(spreadsheet.Sheets); i++ {
-				sheet := spreadsheet.Sheets[i]
-				vals := []*sheets.CellData{
-					{
-						UserEnteredValue: &sheets.ExtendedValue{
-							StringValue: &userID,
-						},
-						UserEnteredFormat: columnMap.Mapping[SheetMetadata{
-							ID:    SheetID(sheet.Properties.SheetId),
-							Index: SheetIndex(sheet.Properties.Index),
-						}][0].ColumnFormat,
-					},
-					{
-						UserEnteredValue: &sheets.ExtendedValue{
-							StringValue: &username,
-						},
-						UserEnteredFormat: columnMap.Mapping[SheetMetadata{
-							ID:    SheetID(sheet.Properties.SheetId),
-							Index: SheetIndex(sheet.Properties.Index),
-						}][1].ColumnFormat,
-					},
-				}
-				boolVal := false
-				numColumns := len(columnMap.Mapping[SheetMetadata{
-					ID:    SheetID(sheet.Properties.SheetId),
-					Index: SheetIndex(sheet.Properties.Index),
-				}])
-				for k := 0; k < numColumns-2; k++ {
-					vals = append(vals, &sheets.CellData{
-						UserEnteredFormat: columnMap.Mapping[SheetMetadata{
-							ID:    SheetID(sheet.Properties.SheetId),
-							Index: SheetIndex(sheet.Properties.Index),
-						}][ColumnIndex(k+2)].ColumnFormat,
-						UserEnteredValue: &sheets.ExtendedValue{
-							BoolValue: &boolVal,
-						},
-						DataValidation: &sheets.DataValidationRule{
-							Condition: &sheets.BooleanCondition{
-								Type: "BOOLEAN",
-							},
-						},
-					})
-				}
-				requests[i] = &sheets.Request{
-					AppendCells: &sheets.AppendCellsRequest{
-						Fields:  "*",
-						SheetId: spreadsheet.Sheets[i].Properties.SheetId,
-						Rows: []*sheets.RowData{
-							{
-								Values: vals,
-							},
-						},
+	userID := member.User.ID.String()
+	username := memberDisplayName(member)
+	if !oldMemberHasRole && newMemberHasRole {
+		// add the member to the spreadsheet, with the collectibles saved while they had another role
+		ownedCollectibles, err := getOwnedCollectibles(ctx)
+		if err != nil {
+			return fmt.Errorf("getOwnedCollectibles() error: [%w]", err)
+		}
+		owned := ownedCollectibles[MemberID(userID)]
+		owners, err := getCharacterOwners(ctx)
+		if err != nil {
+			return fmt.Errorf("getCharacterOwners() error: [%w]", err)
+		}
+		requests := make([]*sheets.Request, len(spreadsheet.Sheets))
+		for i := 0; i < len(spreadsheet.Sheets); i++ {
+			sheet := spreadsheet.Sheets[i]
+			sheetColumnMap := columnMap.Mapping[SheetMetadata{
+				ID:    SheetID(sheet.Properties.SheetId),
+				Index: SheetIndex(sheet.Properties.Index),
+			}]
+			requests[i] = &sheets.Request{
+				AppendCells: &sheets.AppendCellsRequest{
+					Fields:  "*",
+					SheetId: sheet.Properties.SheetId,
+					Rows: []*sheets.RowData{
+						memberRowData(sheetColumnMap, userID, username, func(id CollectibleID) bool {
+							return owned[id]
+						}, tracker.owners(owners[MemberID(userID)])),
 					},
-				}
+				},
 			}
-			if len(requests) > 0 {
-				go func() {
-					googleSheetsWriteReqs <- &SheetBatchUpdate{
-						ID: spreadsheet.SpreadsheetId,
-						Batch: &sheets.BatchUpdateSpreadsheetRequest{
-							Requests: requests,
-						},
-					}
-				}()
-				log.Debugf("member %s (id:%s) added to spreadsheet", username, userID)
+		}
+		if len(requests) == 0 {
+			return nil
+		}
+		queueSheetBatchUpdate(&SheetBatchUpdate{
+			ID: spreadsheet.SpreadsheetId,
+			Batch: &sheets.BatchUpdateSpreadsheetRequest{
+				Requests: requests,
+			},
+		})
+		logger.WithField("member_name", username).Debug("member added to spreadsheet")
 
-				_, err = dbcon.Exec(ctx, `insert into bot.member_metadata(member_discord_id,member_name) values($1,$2)`, userID, username)
-				if err != nil {
-					log.Error(err)
-					return
-				}
-				log.Debugf("member %s (id:%s) added to db", username, userID)
-			}
-		} else {
-			// delete the member from the spreadsheet
+		tx, err := dbcon.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("dbcon.Begin() error: [%w]", err)
+		}
+		defer tx.Rollback(ctx)
+		err = addRoleMember(ctx, tx, tracker.RoleID, MemberID(userID), username)
+		if err != nil {
+			return fmt.Errorf("addRoleMember() error: [%w]", err)
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			return fmt.Errorf("tx.Commit() error: [%w]", err)
+		}
+		logger.WithField("member_name", username).Debug("member added to db")
+		return nil
+	}
+	if oldMemberHasRole && !newMemberHasRole {
+		// delete the member from the spreadsheet
 
-			// map the row indices of each member to delete
-			var rowIndex *int64 = nil
-			testSheet := spreadsheet.Sheets[0]
-			numRows := len(testSheet.Data[0].RowData) - 1
-			for j := 0; j < numRows; j++ {
-				index := int64(j + 1)
-				row := testSheet.Data[0].RowData[index]
-				if *row.Values[0].EffectiveValue.StringValue == userID {
-					rowIndex = &index
-					break
-				}
+		// map the row indices of each member to delete
+		var rowIndex *int64 = nil
+		testSheet := spreadsheet.Sheets[0]
+		numRows := len(testSheet.Data[0].RowData) - 1
+		for j := 0; j < numRows; j++ {
+			index := int64(j + 1)
+			row := testSheet.Data[0].RowData[index]
+			if *row.Values[0].EffectiveValue.StringValue == userID {
+				rowIndex = &index
+				break
 			}
-			log.Debug("mapped row indices of member to delete")
+		}
+		logger.Debug("mapped row indices of member to delete")
 
-			// delete the members' rows in the spreadsheet
+		// delete the members' rows in the spreadsheet
+		if rowIndex != nil {
 			requests := make([]*sheets.Request, len(spreadsheet.Sheets))
 			for i := 0; i < len(spreadsheet.Sheets); i++ {
 				requests[i] = &sheets.Request{
@@ -197,76 +168,78 @@ func onGuildMemberUpdateHandler(event *events.GuildMemberUpdate) {
 					},
 				}
 			}
-			if len(requests) > 0 {
-				go func() {
-					googleSheetsWriteReqs <- &SheetBatchUpdate{
-						ID: spreadsheet.SpreadsheetId,
-						Batch: &sheets.BatchUpdateSpreadsheetRequest{
-							Requests: requests,
-						},
-					}
-				}()
-				log.Debugf("member %s (id:%s) deleted from spreadsheet", username, userID)
+			queueSheetBatchUpdate(&SheetBatchUpdate{
+				ID: spreadsheet.SpreadsheetId,
+				Batch: &sheets.BatchUpdateSpreadsheetRequest{
+					Requests: requests,
+				},
+			})
+			logger.WithField("member_name", username).Debug("member deleted from spreadsheet")
+		}
 
-				_, err = dbcon.Exec(ctx, `delete from bot.member_metadata where member_discord_id=$1`, userID)
-				if err != nil {
-					log.Error(err)
-					return
-				}
-				log.Debugf("member %s (id:%s) deleted from db", username, userID)
-			}
+		tx, err := dbcon.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("dbcon.Begin() error: [%w]", err)
+		}
+		defer tx.Rollback(ctx)
+		err = removeRoleMember(ctx, tx, tracker.RoleID, MemberID(userID))
+		if err != nil {
+			return fmt.Errorf("removeRoleMember() error: [%w]", err)
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			return fmt.Errorf("tx.Commit() error: [%w]", err)
 		}
+		logger.WithField("member_name", username).Debug("member deleted from db")
+		return nil
 	}
-	if nickHasUpdated && !roleHasUpdated {
-		// update the member name in the spreadsheet
-		requests := []*sheets.Request{}
-		for i := 0; i < len(spreadsheet.Sheets); i++ {
-			for j := 0; j < len(spreadsheet.Sheets[i].Data[0].RowData); j++ {
-				row := spreadsheet.Sheets[i].Data[0].RowData[j]
-				if *row.Values[0].EffectiveValue.StringValue != userID {
-					continue
-				}
-				requests = append(requests, &sheets.Request{
-					UpdateCells: &sheets.UpdateCellsRequest{
-						Fields: "userEnteredValue",
-						Range: &sheets.GridRange{
-							SheetId:          int64(spreadsheet.Sheets[i].Properties.SheetId),
-							StartRowIndex:    int64(j),
-							EndRowIndex:      int64(j + 1),
-							StartColumnIndex: 1,
-							EndColumnIndex:   2,
-						},
-						Rows: []*sheets.RowData{
-							{
-								Values: []*sheets.CellData{
-									{
-										UserEnteredValue: &sheets.ExtendedValue{
-											StringValue: &username,
-										},
+
+	// update the member name in the spreadsheet
+	requests := []*sheets.Request{}
+	for i := 0; i < len(spreadsheet.Sheets); i++ {
+		for j := 0; j < len(spreadsheet.Sheets[i].Data[0].RowData); j++ {
+			row := spreadsheet.Sheets[i].Data[0].RowData[j]
+			if *row.Values[0].EffectiveValue.StringValue != userID {
+				continue
+			}
+			requests = append(requests, &sheets.Request{
+				UpdateCells: &sheets.UpdateCellsRequest{
+					Fields: "userEnteredValue",
+					Range: &sheets.GridRange{
+						SheetId:          int64(spreadsheet.Sheets[i].Properties.SheetId),
+						StartRowIndex:    int64(j),
+						EndRowIndex:      int64(j + 1),
+						StartColumnIndex: 1,
+						EndColumnIndex:   2,
+					},
+					Rows: []*sheets.RowData{
+						{
+							Values: []*sheets.CellData{
+								{
+									UserEnteredValue: &sheets.ExtendedValue{
+										StringValue: &username,
 									},
 								},
 							},
 						},
 					},
-				})
-				break
-			}
+				},
+			})
+			break
 		}
-		if len(requests) > 0 {
-			go func() {
-				googleSheetsWriteReqs <- &SheetBatchUpdate{
-					ID: spreadsheet.SpreadsheetId,
-					Batch: &sheets.BatchUpdateSpreadsheetRequest{
-						Requests: requests,
-					},
-				}
-			}()
+	}
+	if len(requests) > 0 {
+		queueSheetBatchUpdate(&SheetBatchUpdate{
+			ID: spreadsheet.SpreadsheetId,
+			Batch: &sheets.BatchUpdateSpreadsheetRequest{
+				Requests: requests,
+			},
+		})
 
-			_, err = dbcon.Exec(ctx, `update bot.member_metadata set member_name=$1 where member_discord_id=$2`, username, userID)
-			if err != nil {
-				log.Error(err)
-				return
-			}
+		_, err = dbcon.Exec(ctx, `update bot.member_metadata set member_name=$1 where member_discord_id=$2`, username, userID)
+		if err != nil {
+			return fmt.Errorf("update bot.member_metadata error: [%w]", err)
 		}
 	}
+	return nil
 }
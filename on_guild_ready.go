@@ -1,110 +1,82 @@
 package main
 
 import (
+	"context"
+
 	"github.com/disgoorg/disgo/events"
-	"github.com/disgoorg/log"
 )
 
 func onGuildReady(event *events.GuildReady) {
-	dbcon, err := dbpool.Acquire(ctx)
+	logger := log.WithField("guild_id", event.GuildID.String())
+
+	// the workers are process wide singletons; repeated GuildReady events from
+	// gateway reconnects or additional guilds reuse the ones already running
+	startGoogleSheetsWriter()
+
+	// roles set before they were linked to their guild get the ownership mode of this one
+	roles, err := event.Client().Rest().GetRoles(event.GuildID)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	defer dbcon.Release()
-	isValidDb, err := isValidDatabase()
+	roleIDs := make([]string, len(roles))
+	for i := 0; i < len(roles); i++ {
+		roleIDs[i] = roles[i].ID.String()
+	}
+	err = linkGuildRoles(ctx, event.GuildID.String(), roleIDs)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	if isValidDb {
-		log.Debug("schema is valid")
-	} else {
-		log.Debug("schema is invalid")
-		err := initDB()
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		log.Debug("schema initialized")
-	}
 
-	// check if db has a record of the file
-	var fileRefExists bool
-	row := dbcon.QueryRow(
-		ctx,
-		"select exists(select file_gcp_id from bot.file_ref)",
-	)
-	err = row.Scan(&fileRefExists)
+	trackers, err := getTrackers(ctx)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-
-	go googleSheetBatchUpdateRateLimiter(googleSheetsWriteRateLimit, maxRetryDuration, googleSheetsWriteReqs)
-
-	var fileID *FileID
-	if fileRefExists {
-		var fileIDStr string
-		// check if the file exists in google drive
-		row := dbcon.QueryRow(
-			ctx,
-			"select file_gcp_id from bot.file_ref",
-		)
-		err = row.Scan(&fileIDStr)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		exists, err := fileExists(FileID(fileIDStr))
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		dbcon.Release()
-		if !*exists {
-			// create the file
-			log.Debug("file exists in db on startup but does not exist in google drive")
-			fileID, err = buildFile(false)
-			if err != nil {
-				log.Error(err)
-				return
-			}
-			log.Debug("file built")
-		} else {
-			fileID = (*FileID)(&fileIDStr)
-		}
-	} else {
-		dbcon.Release()
-		// create the file
-		log.Debug("file does not exist in db on startup")
-		fileID, err = buildFile(false)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		log.Debug("file built")
+	// the roles of the other guilds are synced by their own GuildReady
+	trackers = guildTrackers(trackers, event.GuildID.String())
+	if len(trackers) == 0 {
+		logger.Info("no role is watched yet, use /set_role to watch one")
 	}
 
-	// check if the file needs to be updated
+	// check if the files need to be built or updated
 	members, err := event.Client().Rest().GetMembers(event.GuildID, guildMemberCountRequestLimit, nullSnowflake)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	err = syncRoleMembers(*fileID, members)
+	for i := 0; i < len(trackers); i++ {
+		// one broken spreadsheet does not keep the others from syncing
+		trackerLogger := logger.WithField("role_id", string(trackers[i].RoleID))
+		err = ensureSpreadsheet(withLogger(ctx, trackerLogger), trackers[i])
+		if err != nil {
+			trackerLogger.Error(err)
+			continue
+		}
+		err = syncRoleMembers(withLogger(ctx, logger), trackers[i], members, nil)
+		if err != nil {
+			trackerLogger.Error(err)
+		}
+	}
+	err = discordNicknameScan(withLogger(ctx, logger), event.GuildID, members)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	err = discordNicknameScan(members)
+	err = syncMemberAccess(withLogger(ctx, logger), event.GuildID, members)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	log.Debug("sync successfully completed")
-	go xivApiLodestoneRequestRateLimiter(xivapiLodestoneRateLimit, maxRetryDuration, xivapiLodestoneReqs, xivapiLodestoneResps, xivapiLodestoneReqTokens)
-	go xivapiScanForCharacterIDs()
-	go scanForMounts()
-	log.Debug("routines launched")
+	logger.Debug("sync successfully completed")
+	startXivapiLodestoneLimiter()
+	workers.Go("xivapi-collectible-catalog-validation", xivapiValidateCollectibleCatalog)
+	workers.Go("xivapi-character-id-scan", xivapiScanForCharacterIDs)
+	workers.Go("xivapi-mount-scan", scanForMounts)
+	// the file is built and synced by now, so reloads can re-sync permissions and styling
+	workers.Go("config-watcher", func(ctx context.Context) error {
+		return watchConfig(ctx, configArgs)
+	})
+	logger.Debug("routines launched")
 }
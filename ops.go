@@ -1,55 +1,82 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/disgo/discord"
-	"github.com/disgoorg/log"
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/sheets/v4"
 )
 
 const DefaultSheetID int64 = 0
 
-func buildFile(badFileExists bool) (*FileID, error) {
+// buildFile creates a new spreadsheet file with a sheet per collectible type of each
+// expansion of the tracker and replaces the file_ref and sheet_metadata of the tracker with it in one transaction. the
+// new file has no member rows.
+func buildFile(ctx context.Context, tracker *Tracker) (*FileID, error) {
+	logger := loggerFromContext(ctx)
 	dbcon, err := dbpool.Acquire(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("database connection acquire error: [%w]", err)
 	}
 	defer dbcon.Release()
-	fileID, err := createFile(botConfig.MountSpreadsheetFileName)
+	fileID, err := createFile(tracker.fileName())
 	if err != nil {
 		return nil, fmt.Errorf("file creation error: [%w]", err)
 	}
-	log.Debugf("file created: %s", *fileID)
-	expansions, err := getExpansions()
+	logger.Debugf("file created: %s", *fileID)
+	expansions, err := getTrackerExpansions(ctx, tracker)
 	if err != nil {
-		return nil, fmt.Errorf("getExpansions() error: [%w]", err)
+		return nil, fmt.Errorf("getTrackerExpansions() error: [%w]", err)
 	}
+	expansionTypes, err := getExpansionCollectibleTypes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getExpansionCollectibleTypes() error: [%w]", err)
+	}
+	// the new sheets are titled in the language of the spreadsheet
+	lang := tracker.Language
+	translations, err := getTranslations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getTranslations() error: [%w]", err)
+	}
+	planned := planCollectibleSheets(localizeExpansions(expansions, translations, lang), expansionTypes, lang)
 
 	// add permissions to the file
-	permsFromDisk, err := GetPermissions(mountSpreadsheetPermissionsFilepath)
+	permsFromDisk, err := GetPermissions(getBotConfig().FilePermissionsFilepath)
 	if err != nil {
 		return nil, fmt.Errorf("GetPermissions() error: [%w]", err)
 	}
 	newPermMap := map[string]*drive.Permission{}
 	for i := 0; i < len(permsFromDisk); i++ {
+		if isExpiredPermission(permsFromDisk[i], time.Now()) {
+			continue
+		}
+		start := time.Now()
 		p, err := gdriveSvc.Permissions.Create(string(*fileID), permsFromDisk[i]).SupportsAllDrives(true).Do()
+		observeDriveCall("permissions.create", start, err)
 		if err != nil {
 			return nil, fmt.Errorf("gdriveSvc.PermissionsCreate() error; i=%d, permsFromDisk=[%v]: [%w]", i, permsFromDisk[i], err)
 		}
 		newPermMap[p.Id] = &drive.Permission{
-			EmailAddress: permsFromDisk[i].EmailAddress,
-			Type:         p.Type,
-			Role:         p.Role,
+			EmailAddress:       permsFromDisk[i].EmailAddress,
+			Domain:             permsFromDisk[i].Domain,
+			Type:               p.Type,
+			Role:               p.Role,
+			AllowFileDiscovery: permsFromDisk[i].AllowFileDiscovery,
+			ExpirationTime:     permsFromDisk[i].ExpirationTime,
 		}
-		log.Debugf(
+		logger.Debugf(
 			"permission added for: id=%s;email=%s;role=%s;type=%s",
 			p.Id,
 			permsFromDisk[i].EmailAddress,
@@ -58,12 +85,51 @@ func buildFile(badFileExists bool) (*FileID, error) {
 		)
 	}
 
+	// the old file is deleted with its permissions below, so the ones shared from discord
+	// or with a linked email are granted again on the new file
+	permSources := map[string]PermissionSource{}
+	if tracker.FileID != "" {
+		oldPerms, err := getTrackedPermissions(ctx, tracker.FileID)
+		if err != nil {
+			return nil, fmt.Errorf("getTrackedPermissions() error: [%w]", err)
+		}
+		carried := carriedPermissions(oldPerms, permsFromDisk)
+		for i := 0; i < len(carried); i++ {
+			if isExpiredPermission(carried[i].Permission, time.Now()) {
+				continue
+			}
+			start := time.Now()
+			p, err := gdriveSvc.Permissions.Create(string(*fileID), &drive.Permission{
+				Type:               carried[i].Type,
+				EmailAddress:       carried[i].EmailAddress,
+				Domain:             carried[i].Domain,
+				Role:               carried[i].Role,
+				AllowFileDiscovery: carried[i].AllowFileDiscovery,
+				ExpirationTime:     carried[i].ExpirationTime,
+			}).SupportsAllDrives(true).Context(ctx).Do()
+			observeDriveCall("permissions.create", start, err)
+			if err != nil {
+				return nil, fmt.Errorf("gdriveSvc.Permissions.Create() error; perm_gcp_id=%s: [%w]", carried[i].Id, err)
+			}
+			newPermMap[p.Id] = &drive.Permission{
+				EmailAddress:       carried[i].EmailAddress,
+				Domain:             carried[i].Domain,
+				Type:               p.Type,
+				Role:               p.Role,
+				AllowFileDiscovery: carried[i].AllowFileDiscovery,
+				ExpirationTime:     carried[i].ExpirationTime,
+			}
+			permSources[p.Id] = carried[i].Source
+			logger.Debugf("%s permission carried over for: id=%s;email=%s;role=%s", carried[i].Source, p.Id, carried[i].EmailAddress, p.Role)
+		}
+	}
+
 	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(string(*fileID)).Do()
 	if err != nil {
 		return nil, fmt.Errorf("gsheetsSvc.Spreadsheets.Get() 1 error: [%w]", err)
 	}
 	// create the sheets
-	numSheets := len(expansions)
+	numSheets := len(planned)
 	requests := make([]*sheets.Request, numSheets)
 	for i := 0; i < numSheets; i++ {
 		requests[i] = &sheets.Request{
@@ -78,23 +144,26 @@ func buildFile(badFileExists bool) (*FileID, error) {
 	requests = append(requests, &sheets.Request{
 		UpdateSpreadsheetProperties: &sheets.UpdateSpreadsheetPropertiesRequest{
 			Properties: &sheets.SpreadsheetProperties{
-				Title: botConfig.MountSpreadsheetTitle,
+				Title: tracker.spreadsheetTitle(),
 			},
 			Fields: "title",
 		},
 	})
 	// the sheets api docs state that some replies may be empty, so do not rely on the response to
 	// get the sheet IDs from the spreadsheet
-	_, err = gsheetsSvc.Spreadsheets.BatchUpdate(spreadsheet.SpreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{
+	start := time.Now()
+	resp, err := gsheetsSvc.Spreadsheets.BatchUpdate(spreadsheet.SpreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{
 		Requests: requests,
 	}).Do()
+	observeSheetsBatchUpdate(start, resp, err)
 	if err != nil {
 		return nil, fmt.Errorf("gsheetsSvc.Spreadsheets.BatchUpdate() error: [%w]", err)
 	}
-	log.Debug("sheets created")
+	logger.Debug("sheets created")
 
 	// delete default sheet
-	_, err = gsheetsSvc.Spreadsheets.BatchUpdate(spreadsheet.SpreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{
+	start = time.Now()
+	resp, err = gsheetsSvc.Spreadsheets.BatchUpdate(spreadsheet.SpreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{
 		Requests: []*sheets.Request{
 			{
 				DeleteSheet: &sheets.DeleteSheetRequest{
@@ -103,17 +172,18 @@ func buildFile(badFileExists bool) (*FileID, error) {
 			},
 		},
 	}).Do()
+	observeSheetsBatchUpdate(start, resp, err)
 	if err != nil {
 		return nil, fmt.Errorf("gsheetsSvc.Spreadsheets.BatchUpdate() error: [%w]", err)
 	}
-	log.Debug("default sheet deleted")
+	logger.Debug("default sheet deleted")
 
-	// collect and map sheet metadata to expansion metadata
+	// collect and map sheet metadata to the planned sheets
 	spreadsheet, err = gsheetsSvc.Spreadsheets.Get(spreadsheet.SpreadsheetId).Do()
 	if err != nil {
 		return nil, fmt.Errorf("gsheetsSvc.Spreadsheets.Get() 2 error: [%w]", err)
 	}
-	expansionSheetMap := make(map[SheetID]*Expansion)
+	collectibleSheetMap := make(map[SheetID]CollectibleSheet)
 	sheetData := make([]*SheetMetadata, len(spreadsheet.Sheets))
 	for i := 0; i < len(spreadsheet.Sheets); i++ {
 		sheet := spreadsheet.Sheets[i]
@@ -121,10 +191,9 @@ func buildFile(badFileExists bool) (*FileID, error) {
 			ID:    SheetID(sheet.Properties.SheetId),
 			Index: SheetIndex(sheet.Properties.Index),
 		}
-		for j := 0; j < len(expansions); j++ {
-			if int(sheet.Properties.Index) == int(expansions[j].Index) {
-				expansionSheetMap[SheetID(sheet.Properties.SheetId)] = expansions[j]
-			}
+		// the sheets were added in the order of the planned sheets
+		if int(sheet.Properties.Index) < len(planned) {
+			collectibleSheetMap[SheetID(sheet.Properties.SheetId)] = planned[sheet.Properties.Index]
 		}
 	}
 
@@ -133,25 +202,25 @@ func buildFile(badFileExists bool) (*FileID, error) {
 	if err != nil {
 		return nil, fmt.Errorf("dbcon.Begin() 1 error: [%w]", err)
 	}
-	if badFileExists {
-		// delete data in file id table
-		_, err = tx.Exec(ctx, `delete from bot.file_ref`)
-		if err != nil {
-			return nil, fmt.Errorf("tx.Exec() 1-1 error: [%w]", err)
-		}
+	defer tx.Rollback(ctx)
+	// replace the old file, the sheets and permissions of the old file are deleted with it
+	_, err = tx.Exec(ctx, `delete from bot.file_ref where role_id = $1`, string(tracker.RoleID))
+	if err != nil {
+		return nil, fmt.Errorf("tx.Exec() 1-1 error: [%w]", err)
 	}
 	// put file id into db
-	_, err = tx.Exec(ctx, `insert into bot.file_ref(file_gcp_id) values($1)`, string(*fileID))
+	_, err = tx.Exec(ctx, `insert into bot.file_ref(file_gcp_id,role_id) values($1,$2)`, string(*fileID), string(tracker.RoleID))
 	if err != nil {
 		return nil, fmt.Errorf("tx.Exec() 1-2 error: [%w]", err)
 	}
 	for i := 0; i < len(sheetData); i++ {
 		_, err = tx.Exec(
 			ctx,
-			`insert into bot.sheet_metadata(file_gcp_id,sheet_gcp_id,sheet_index) values($1,$2,$3)`,
+			`insert into bot.sheet_metadata(file_gcp_id,sheet_gcp_id,sheet_index,collectible_type) values($1,$2,$3,$4)`,
 			string(*fileID),
 			sheetData[i].ID.String(),
 			sheetData[i].Index.String(),
+			string(collectibleSheetMap[sheetData[i].ID].Type),
 		)
 		if err != nil {
 			return nil, fmt.Errorf(
@@ -166,7 +235,7 @@ func buildFile(badFileExists bool) (*FileID, error) {
 			ctx,
 			`insert into bot.sheet_expansion_map(sheet_gcp_id,expansion_id) values($1,$2)`,
 			sheetData[i].ID.String(),
-			expansionSheetMap[sheetData[i].ID].ID,
+			collectibleSheetMap[sheetData[i].ID].Expansion.ID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("tx.Exec() 1-4 error: [%w]", err)
@@ -177,13 +246,78 @@ func buildFile(badFileExists bool) (*FileID, error) {
 		return nil, fmt.Errorf("tx.Commit() 1 error: [%w]", err)
 	}
 
-	columnMap, err := NewColumnMap()
+	columnMap, err := NewColumnMap(ctx, *fileID)
 	if err != nil {
 		return nil, fmt.Errorf("NewColumnMap() error: [%w]", err)
 	}
 
 	// add the header row to each sheet & update each sheet's name
-	requests = []*sheets.Request{}
+	requests = sheetHeaderRequests(columnMap, collectibleSheetMap)
+
+	// intentional execution blocking, the member rows are appended below the headers
+	err = sendSheetBatchUpdateAndWait(ctx, &SheetBatchUpdate{
+		ID: spreadsheet.SpreadsheetId,
+		Batch: &sheets.BatchUpdateSpreadsheetRequest{
+			Requests: requests,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sendSheetBatchUpdateAndWait() error: [%w]", err)
+	}
+	logger.Debug("header rows added to each sheet")
+
+	// save what is needed to the db
+	tx, err = dbcon.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dbcon.Begin() 2 error: [%w]", err)
+	}
+	// put perm ids into db
+	for id, perm := range newPermMap {
+		source, ok := permSources[id]
+		if !ok {
+			source = PermissionSourceFile
+		}
+		_, err = tx.Exec(
+			ctx,
+			`
+			insert into bot.permissions(
+				file_gcp_id,
+				perm_gcp_id,
+				email,
+				domain,
+				role,
+				role_type,
+				allow_file_discovery,
+				expiration_time,
+				source
+			) values($1,$2,$3,$4,$5,$6,$7,$8,$9)
+			`,
+			string(*fileID),
+			id,
+			nullIfEmpty(perm.EmailAddress),
+			nullIfEmpty(perm.Domain),
+			perm.Role,
+			perm.Type,
+			perm.AllowFileDiscovery,
+			permissionExpiration(perm),
+			string(source),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("tx.Exec() 2-3 error; id=%s, perm=%v [%w]", id, *perm, err)
+		}
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	logger.Debug("required data saved to db")
+	return fileID, nil
+}
+
+// sheetHeaderRequests appends the header row to each sheet and names each sheet after
+// its expansion and collectible type
+func sheetHeaderRequests(columnMap *ColumnMap, collectibleSheetMap map[SheetID]CollectibleSheet) []*sheets.Request {
+	requests := []*sheets.Request{}
 	for sheet, columnIndexMap := range columnMap.Mapping {
 		numColumns := len(columnIndexMap)
 		cellData := make([]*sheets.CellData, numColumns)
@@ -215,7 +349,7 @@ func buildFile(badFileExists bool) (*FileID, error) {
 				UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
 					Fields: "title",
 					Properties: &sheets.SheetProperties{
-						Title:   string(expansionSheetMap[sheet.ID].Name),
+						Title:   collectibleSheetMap[sheet.ID].title(),
 						SheetId: int64(sheet.ID),
 						Index:   int64(sheet.Index),
 					},
@@ -223,69 +357,85 @@ func buildFile(badFileExists bool) (*FileID, error) {
 			},
 		)
 	}
+	return requests
+}
 
-	// intentional execution blocking
-	googleSheetsWriteReqs <- &SheetBatchUpdate{
-		ID: spreadsheet.SpreadsheetId,
-		Batch: &sheets.BatchUpdateSpreadsheetRequest{
-			Requests: requests,
+// memberRowData builds the spreadsheet row of a member. the checkbox of each collectible
+// column is ticked when owns reports the collectible as owned; a nil owns leaves every
+// checkbox unticked. a non nil owners notes the characters owning the collectible.
+func memberRowData(sheetColumnMap map[ColumnIndex]*ColumnStyleData, userID, username string, owns func(id CollectibleID) bool, owners func(id CollectibleID) []string) *sheets.RowData {
+	vals := []*sheets.CellData{
+		{
+			UserEnteredValue: &sheets.ExtendedValue{
+				StringValue: &userID,
+			},
+			UserEnteredFormat: sheetColumnMap[0].ColumnFormat,
+		},
+		{
+			UserEnteredValue: &sheets.ExtendedValue{
+				StringValue: &username,
+			},
+			UserEnteredFormat: sheetColumnMap[1].ColumnFormat,
 		},
 	}
-	log.Debug("header rows added to each sheet")
-
-	// save what is needed to the db
-	tx, err = dbcon.Begin(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("dbcon.Begin() 2 error: [%w]", err)
-	}
-	// put perm ids into db
-	for id, perm := range newPermMap {
-		_, err = tx.Exec(
-			ctx,
-			`insert into bot.permissions(file_gcp_id,perm_gcp_id,email,role,role_type) values($1,$2,$3,$4,$5)`,
-			string(*fileID),
-			id,
-			perm.EmailAddress,
-			perm.Role,
-			perm.Type,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("tx.Exec() 2-3 error; id=%s, perm=%v [%w]", id, *perm, err)
+	numColumns := len(sheetColumnMap)
+	for k := 0; k < numColumns-2; k++ {
+		id := sheetColumnMap[ColumnIndex(k+2)].Collectible.ID
+		boolVal := false
+		if owns != nil {
+			boolVal = owns(id)
 		}
+		note := ""
+		if owners != nil {
+			note = strings.Join(owners(id), "\n")
+		}
+		vals = append(vals, &sheets.CellData{
+			UserEnteredFormat: sheetColumnMap[ColumnIndex(k+2)].ColumnFormat,
+			UserEnteredValue: &sheets.ExtendedValue{
+				BoolValue: &boolVal,
+			},
+			DataValidation: &sheets.DataValidationRule{
+				Condition: &sheets.BooleanCondition{
+					Type: "BOOLEAN",
+				},
+			},
+			Note: note,
+		})
 	}
-	err = tx.Commit(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("tx.Commit() error: [%w]", err)
+	return &sheets.RowData{
+		Values: vals,
 	}
-	log.Debug("required data saved to db")
-	return fileID, nil
 }
 
-func syncRoleMembers(id FileID, guildMembers []discord.Member) error {
+// memberDisplayName gets the guild nickname of the member, or the username without one
+func memberDisplayName(member discord.Member) string {
+	if member.Nick == nil {
+		return member.User.Username
+	}
+	return *member.Nick
+}
+
+// syncRoleMembers adds the members with the role of the tracker to its spreadsheet and
+// the database and removes the ones without it. with a plan, the changes are only recorded.
+func syncRoleMembers(ctx context.Context, tracker *Tracker, guildMembers []discord.Member, plan *SyncPlan) error {
+	logger := loggerFromContext(ctx)
+	id, err := trackerFileID(tracker)
+	if err != nil {
+		return fmt.Errorf("trackerFileID() error: [%w]", err)
+	}
 	dbcon, err := dbpool.Acquire(ctx)
 	if err != nil {
 		return fmt.Errorf("database connection acquire error: [%w]", err)
 	}
 	defer dbcon.Release()
-	// get members from db
-	dbMembers, err := getMembersFromDB()
-	if err != nil && err != pgx.ErrNoRows {
-		return fmt.Errorf("getMembersFromDB() error: [%w]", err)
-	}
-	// get the watched role id
-	var roleID *string
-	row := dbcon.QueryRow(ctx, `select role_id from bot.role_ref`)
-	err = row.Scan(&roleID)
-	if err == pgx.ErrNoRows {
-		// exit if role is not set
-		return nil
-	} else if err != nil {
-		return fmt.Errorf("getting role_id error: [%w]", err)
+	// get the members of the role from db
+	dbMembers, err := getRoleMembersFromDB(ctx, tracker.RoleID)
+	if err != nil {
+		return fmt.Errorf("getRoleMembersFromDB() error: [%w]", err)
 	}
-	log.Debug("got role id")
 
 	// get column formatting
-	columnMap, err := NewColumnMap()
+	columnMap, err := NewColumnMap(ctx, id)
 	if err != nil {
 		return fmt.Errorf("NewColumnMap() error: [%w]", err)
 	}
@@ -296,15 +446,11 @@ func syncRoleMembers(id FileID, guildMembers []discord.Member) error {
 		if guildMembers[i].User.Bot {
 			continue
 		}
-
-		for j := 0; j < len(guildMembers[i].RoleIDs); j++ {
-			if guildMembers[i].RoleIDs[j].String() == *roleID {
-				roleMembers = append(roleMembers, guildMembers[i])
-				break
-			}
+		if hasRole(guildMembers[i].RoleIDs, string(tracker.RoleID)) {
+			roleMembers = append(roleMembers, guildMembers[i])
 		}
 	}
-	log.Debug("filtered members")
+	logger.Debugf("filtered members of role %s", tracker.RoleID)
 
 	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(string(id)).IncludeGridData(true).Do()
 	if err != nil {
@@ -330,7 +476,7 @@ func syncRoleMembers(id FileID, guildMembers []discord.Member) error {
 			filteredDBMembers = append(filteredDBMembers, dbMembers[i])
 		}
 	}
-	log.Debug("got members to delete")
+	logger.Debug("got members to delete")
 	// map the row indices of each member to delete
 	deleteMemberMap := map[int64]*Member{}
 	testSheet := spreadsheet.Sheets[0]
@@ -344,7 +490,7 @@ func syncRoleMembers(id FileID, guildMembers []discord.Member) error {
 			}
 		}
 	}
-	log.Debug("mapped row indices to each member to delete from spreadsheet")
+	logger.Debug("mapped row indices to each member to delete from spreadsheet")
 	// delete the members' rows in the spreadsheet
 	requests := make([]*sheets.Request, len(deleteMemberMap)*len(spreadsheet.Sheets))
 	requestIndex := 0
@@ -360,44 +506,51 @@ func syncRoleMembers(id FileID, guildMembers []discord.Member) error {
 					ShiftDimension: "ROWS",
 				},
 			}
-			log.Debugf("member %s (id:%s) queued to be deleted from spreadsheet %d", member.name, string(member.id), i)
+			logger.Debugf("member %s (id:%s) queued to be deleted from spreadsheet %d", member.name, string(member.id), i)
 			requestIndex++
 		}
 	}
+	for rowIndex, member := range deleteMemberMap {
+		plan.add(PlanTargetSheets, PlanOpDelete, "delete row %d of %s (%s) from %d sheets", rowIndex+1, member.name, member.id, len(spreadsheet.Sheets))
+	}
 	if len(requests) != 0 {
-		go func() {
-			googleSheetsWriteReqs <- &SheetBatchUpdate{
-				ID: spreadsheet.SpreadsheetId,
-				Batch: &sheets.BatchUpdateSpreadsheetRequest{
-					Requests: requests,
-				},
-			}
-		}()
-		log.Debug("members deleted from spreadsheet")
+		planOrQueueSheetBatchUpdate(plan, &SheetBatchUpdate{
+			ID: spreadsheet.SpreadsheetId,
+			Batch: &sheets.BatchUpdateSpreadsheetRequest{
+				Requests: requests,
+			},
+		})
+		logger.Debug("members deleted from spreadsheet")
 	} else {
-		log.Debug("members not deleted from spreadsheet")
+		logger.Debug("members not deleted from spreadsheet")
 	}
 
 	// delete members from the db
-	tx, err := dbcon.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("dbcon.Begin() 1 error: [%w]", err)
-	}
 	for i := 0; i < len(deleteMembers); i++ {
-		_, err = tx.Exec(ctx, `delete from bot.member_metadata where member_discord_id=$1`, string(deleteMembers[i].id))
+		plan.add(PlanTargetDB, PlanOpDelete, "bot.role_member %s (%s)", deleteMembers[i].name, deleteMembers[i].id)
+	}
+	if plan == nil {
+		tx, err := dbcon.Begin(ctx)
 		if err != nil {
-			return fmt.Errorf("delete from bot.member_metadata error; member_discord_id=%s: [%w]", string(deleteMembers[i].id), err)
+			return fmt.Errorf("dbcon.Begin() 1 error: [%w]", err)
 		}
-	}
-	err = tx.Commit(ctx)
-	if err != nil {
-		return fmt.Errorf("tx.Commit() 1 error: [%w]", err)
-	}
-	log.Debugf("deleted %d members from db", len(deleteMembers))
+		for i := 0; i < len(deleteMembers); i++ {
+			err = removeRoleMember(ctx, tx, tracker.RoleID, deleteMembers[i].id)
+			if err != nil {
+				tx.Rollback(ctx)
+				return fmt.Errorf("removeRoleMember() error; member_discord_id=%s: [%w]", string(deleteMembers[i].id), err)
+			}
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			return fmt.Errorf("tx.Commit() 1 error: [%w]", err)
+		}
+		logger.Debugf("deleted %d members from db", len(deleteMembers))
 
-	spreadsheet, err = gsheetsSvc.Spreadsheets.Get(string(id)).IncludeGridData(true).Do()
-	if err != nil {
-		return fmt.Errorf("gsheetsSvc.Spreadsheets.Get() 2 error: [%w]", err)
+		spreadsheet, err = gsheetsSvc.Spreadsheets.Get(string(id)).IncludeGridData(true).Do()
+		if err != nil {
+			return fmt.Errorf("gsheetsSvc.Spreadsheets.Get() 2 error: [%w]", err)
+		}
 	}
 	if len(filteredDBMembers) == len(roleMembers) && len(filteredDBMembers) == 0 {
 		return nil
@@ -416,7 +569,7 @@ func syncRoleMembers(id FileID, guildMembers []discord.Member) error {
 			addMembers = append(addMembers, roleMembers[i])
 		}
 	}
-	log.Debug("got members to add based on differences between discord and the database")
+	logger.Debug("got members to add based on differences between discord and the database")
 	// get members to add to the spreadsheet based on differences between the database and the spreadsheet
 	ssMembers := getSpreadsheetMembers(spreadsheet)
 	for i := 0; i < len(filteredDBMembers); i++ {
@@ -442,7 +595,16 @@ func syncRoleMembers(id FileID, guildMembers []discord.Member) error {
 			addMembers = append(addMembers, m)
 		}
 	}
-	log.Debug("got members to add based on differences between the database and the spreadsheet")
+	logger.Debug("got members to add based on differences between the database and the spreadsheet")
+	// members tracked for another role already have their collectibles saved
+	ownedCollectibles, err := getOwnedCollectibles(ctx)
+	if err != nil {
+		return fmt.Errorf("getOwnedCollectibles() error: [%w]", err)
+	}
+	owners, err := getCharacterOwners(ctx)
+	if err != nil {
+		return fmt.Errorf("getCharacterOwners() error: [%w]", err)
+	}
 	// add the members' rows in the spreadsheet
 	counter := 0
 	requests = make([]*sheets.Request, len(columnMap.Mapping))
@@ -450,46 +612,12 @@ func syncRoleMembers(id FileID, guildMembers []discord.Member) error {
 		rowData := []*sheets.RowData{}
 		for j := 0; j < len(addMembers); j++ {
 			userID := addMembers[j].User.ID.String()
-			var username string
-			if addMembers[j].Nick == nil {
-				username = addMembers[j].User.Username
-			} else {
-				username = *addMembers[j].Nick
-			}
-
-			vals := []*sheets.CellData{
-				{
-					UserEnteredValue: &sheets.ExtendedValue{
-						StringValue: &userID,
-					},
-					UserEnteredFormat: sheetColumnMap[0].ColumnFormat,
-				},
-				{
-					UserEnteredValue: &sheets.ExtendedValue{
-						StringValue: &username,
-					},
-					UserEnteredFormat: sheetColumnMap[1].ColumnFormat,
-				},
-			}
-			boolVal := false
-			numColumns := len(sheetColumnMap)
-			for k := 0; k < numColumns-2; k++ {
-				vals = append(vals, &sheets.CellData{
-					UserEnteredFormat: sheetColumnMap[ColumnIndex(k+2)].ColumnFormat,
-					UserEnteredValue: &sheets.ExtendedValue{
-						BoolValue: &boolVal,
-					},
-					DataValidation: &sheets.DataValidationRule{
-						Condition: &sheets.BooleanCondition{
-							Type: "BOOLEAN",
-						},
-					},
-				})
-			}
-			rowData = append(rowData, &sheets.RowData{
-				Values: vals,
-			})
-			log.Debugf("member %s (id:%s) queued to be added to spreadsheet %d", username, userID, sheetMetadata.Index)
+			username := memberDisplayName(addMembers[j])
+			owned := ownedCollectibles[MemberID(userID)]
+			rowData = append(rowData, memberRowData(sheetColumnMap, userID, username, func(id CollectibleID) bool {
+				return owned[id]
+			}, tracker.owners(owners[MemberID(userID)])))
+			logger.Debugf("member %s (id:%s) queued to be added to spreadsheet %d", username, userID, sheetMetadata.Index)
 		}
 		requests[counter] = &sheets.Request{
 			AppendCells: &sheets.AppendCellsRequest{
@@ -500,90 +628,100 @@ func syncRoleMembers(id FileID, guildMembers []discord.Member) error {
 		}
 		counter++
 	}
-	if len(requests) != 0 {
-		go func() {
-			googleSheetsWriteReqs <- &SheetBatchUpdate{
-				ID: spreadsheet.SpreadsheetId,
-				Batch: &sheets.BatchUpdateSpreadsheetRequest{
-					Requests: requests,
-				},
-			}
-		}()
-		log.Debug("members added to spreadsheet")
-	} else {
-		log.Debug("members not added to spreadsheet")
+	for i := 0; i < len(addMembers); i++ {
+		plan.add(PlanTargetSheets, PlanOpCreate, "add row of %s (%s) to %d sheets", memberDisplayName(addMembers[i]), addMembers[i].User.ID, len(columnMap.Mapping))
+		plan.add(PlanTargetDB, PlanOpCreate, "bot.role_member %s (%s)", memberDisplayName(addMembers[i]), addMembers[i].User.ID)
+	}
+	if len(addMembers) == 0 {
+		logger.Debug("members not added to spreadsheet")
+		return nil
 	}
+	planOrQueueSheetBatchUpdate(plan, &SheetBatchUpdate{
+		ID: spreadsheet.SpreadsheetId,
+		Batch: &sheets.BatchUpdateSpreadsheetRequest{
+			Requests: requests,
+		},
+	})
+	if plan != nil {
+		return nil
+	}
+	logger.Debug("members added to spreadsheet")
 
-	tx, err = dbcon.Begin(ctx)
+	tx, err := dbcon.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("dbcon.Begin() 2 error: [%w]", err)
 	}
+	defer tx.Rollback(ctx)
 	// add members to db
 	for i := 0; i < len(addMembers); i++ {
-		var name string
-		if addMembers[i].Nick == nil {
-			name = addMembers[i].User.Username
-		} else {
-			name = *addMembers[i].Nick
-		}
-		_, err = tx.Exec(
-			ctx,
-			`
-			insert into bot.member_metadata(
-				member_discord_id,
-				member_name
-			) values(
-				$1,
-				$2
-			) on conflict (
-				member_discord_id
-			) do nothing
-			`,
-			addMembers[i].User.ID.String(),
-			name,
-		)
+		err = addRoleMember(ctx, tx, tracker.RoleID, MemberID(addMembers[i].User.ID.String()), memberDisplayName(addMembers[i]))
 		if err != nil {
-			return fmt.Errorf("add member to db error; member_discord_id=%s: [%w]", addMembers[i].User.ID.String(), err)
+			return fmt.Errorf("addRoleMember() error; member_discord_id=%s: [%w]", addMembers[i].User.ID.String(), err)
 		}
 	}
 	err = tx.Commit(ctx)
 	if err != nil {
 		return fmt.Errorf("tx.Commit() 2 error: [%w]", err)
 	}
-	log.Debugf("added %d members to db", len(addMembers))
+	logger.Debugf("added %d members to db", len(addMembers))
 	return nil
 }
 
-func xivMountScan() error {
+// xivCollectibleScan scans the collectibles of every member with a character ID, or only
+// of onlyMemberID when it is set. with a plan, the changes are only recorded.
+func xivCollectibleScan(ctx context.Context, onlyMemberID snowflake.ID, plan *SyncPlan) error {
+	logger := loggerFromContext(ctx)
+	// only the character data listing a tracked collectible type is requested
+	collectibles, err := getCollectibles(ctx)
+	if err != nil {
+		return fmt.Errorf("getCollectibles() error: [%w]", err)
+	}
+	characterData := collectibleCharacterData(collectibles)
+	if len(characterData) == 0 {
+		logger.Debug("no tracked collectible is on character profiles")
+		return nil
+	}
 	dbcon, err := dbpool.Acquire(ctx)
 	if err != nil {
 		return fmt.Errorf("database connection acquire error: [%w]", err)
 	}
 	defer dbcon.Release()
-	// get all members that have xiv character IDs and create requests
+	// get the characters of all members and create requests
 	query := `
 		select
-			member_discord_id,
-			member_name,
-			member_xiv_id
-		from bot.member_metadata
-		where member_xiv_id is not null
-		order by member_name
+			c.member_discord_id,
+			m.member_name,
+			c.member_xiv_id,
+			c.is_primary,
+			c.verified
+		from (` + memberCharactersQuery + `) c
+		inner join bot.member_metadata m
+		on m.member_discord_id = c.member_discord_id
 	`
+	args := []interface{}{}
+	if onlyMemberID != nullSnowflake {
+		query += ` where c.member_discord_id = $1`
+		args = append(args, onlyMemberID.String())
+	}
+	query += ` order by m.member_name, c.is_primary desc`
 	rows, err := dbcon.Query(
 		ctx,
 		query,
+		args...,
 	)
 	if err != nil {
 		return fmt.Errorf("get all members for mount scan error: [%w]", err)
 	}
-	reqMap := map[snowflake.ID]XivCharacterRequest{}
+	memberCharacters := map[snowflake.ID][]MemberCharacter{}
+	memberNames := map[snowflake.ID]string{}
+	// a character linked to several members is only requested once
+	requested := map[string]bool{}
 	requests := []XivCharacterRequest{}
 	for rows.Next() {
 		var memberIDStr string
 		var membername string
-		var memberXivID string
-		err = rows.Scan(&memberIDStr, &membername, &memberXivID)
+		var character MemberCharacter
+		err = rows.Scan(&memberIDStr, &membername, &character.XivID, &character.Primary, &character.Verified)
 		if err != nil {
 			return fmt.Errorf("row scan 1 error: [%w]", err)
 		}
@@ -591,122 +729,237 @@ func xivMountScan() error {
 		if err != nil {
 			return fmt.Errorf("parse snowflake 1 error; member_discord_id=%s: [%w]", memberIDStr, err)
 		}
-		req := XivCharacterRequest{
-			Token: uuid.New().String(),
-			XivID: memberXivID,
-			Data: []XivCharacterData{
-				XivCharacterDataMountsMinions,
-			},
-			Do: xivapiClient.GetCharacter,
+		memberCharacters[memberID] = append(memberCharacters[memberID], character)
+		memberNames[memberID] = membername
+		if requested[character.XivID] {
+			continue
 		}
-		reqMap[memberID] = req
-		requests = append(requests, req)
+		requested[character.XivID] = true
+		requests = append(requests, XivCharacterRequest{
+			Token: uuid.New().String(),
+			XivID: character.XivID,
+			Data:  characterData,
+			Do:    xivapiClient.GetCharacter,
+		})
 	}
-	log.Debugf("# of character requests created: %d", len(requests))
+	rows.Close()
+	if rows.Err() != nil {
+		return fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	logger.Debugf("# of character requests created: %d", len(requests))
 	if len(requests) == 0 {
 		return nil
 	}
-	// send requests and collect character profiles containing the mount data
-	log.Debug("sending requests")
-	xivCharProfiles, err := xivapiCollectCharacterResponses(requests)
-	log.Debug("character profiles collected")
+	// send requests and collect character profiles containing the collectible data
+	logger.Debug("sending requests")
+	xivCharProfiles, err := xivapiCollectCharacterResponses(ctx, requests)
+	logger.Debug("character profiles collected")
 	if err != nil {
 		return fmt.Errorf("xivapiCollectCharacterResponses() error: [%w]", err)
 	}
+	mountScanCharactersTotal.Add(float64(len(xivCharProfiles)))
 	if len(xivCharProfiles) == 0 {
 		return nil
 	}
-	// map discord user IDs to xiv character profiles
-	profileMap := map[snowflake.ID]XivCharacter{}
+	// map xiv character IDs to character profiles
+	profileMap := map[string]XivCharacter{}
 	for i := 0; i < len(xivCharProfiles); i++ {
-		for discUserID, xivCharRequest := range reqMap {
-			if xivCharRequest.XivID == strconv.FormatUint(uint64(xivCharProfiles[i].Character.ID), 10) {
-				profileMap[discUserID] = xivCharProfiles[i]
-				break
+		if xivCharProfiles[i].Character.ID == 0 {
+			continue
+		}
+		profileMap[strconv.FormatUint(uint64(xivCharProfiles[i].Character.ID), 10)] = xivCharProfiles[i]
+	}
+	// match the collectibles of each character profile to the tracked collectibles. a
+	// member owns the collectibles found on any of their characters.
+	memberCollectibles := map[snowflake.ID][]*Collectible{}
+	characterCollectibles := map[snowflake.ID]CharacterCollectibles{}
+	for memberID, characters := range memberCharacters {
+		found := map[CollectibleID]bool{}
+		for i := 0; i < len(characters); i++ {
+			xivChar, ok := profileMap[characters[i].XivID]
+			if !ok {
+				continue
+			}
+			characters[i].Name = xivChar.Character.Name
+			if characterCollectibles[memberID] == nil {
+				characterCollectibles[memberID] = CharacterCollectibles{}
+			}
+			characterCollectibles[memberID][characters[i].XivID] = map[CollectibleID]bool{}
+			matched := matchCharacterCollectibles(xivChar, collectibles)
+			for j := 0; j < len(matched); j++ {
+				characterCollectibles[memberID][characters[i].XivID][matched[j].ID] = true
+				if !found[matched[j].ID] {
+					found[matched[j].ID] = true
+					memberCollectibles[memberID] = append(memberCollectibles[memberID], matched[j])
+				}
 			}
 		}
 	}
-	// update database with member data
-	mountMetadata, err := getXivMountMetadata()
-	if err != nil {
-		return fmt.Errorf("getXivMountMetadata() error: [%w]", err)
-	}
-	tx, err := dbcon.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("dbcon.Begin() 1 error: [%w]", err)
-	}
-	for memberID, xivChar := range profileMap {
-		for i := 0; i < len(mountMetadata); i++ {
-			for j := 0; j < len(xivChar.Mounts); j++ {
-				if string(mountMetadata[i].Name) == xivChar.Mounts[j].Name {
-					_, err = tx.Exec(
-						ctx,
-						`
-						insert into bot.member_data(
-							member_discord_id,
-							mount_id,
-							has_mount
-						) values(
-							$1,
-							$2,
-							$3
-						)
-						on conflict (
-							member_discord_id,
-							mount_id
-						)
-						do update set
-							has_mount=$3
-						where
-							member_data.member_discord_id=$1
-							and member_data.mount_id=$2
-						`,
-						memberID.String(),
-						mountMetadata[i].ID,
-						true,
+	if plan != nil {
+		err = planMemberCollectibles(ctx, plan, memberCollectibles, memberNames)
+		if err != nil {
+			return fmt.Errorf("planMemberCollectibles() error: [%w]", err)
+		}
+	} else {
+		tx, err := dbcon.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("dbcon.Begin() 1 error: [%w]", err)
+		}
+		for memberID, owned := range memberCollectibles {
+			for i := 0; i < len(owned); i++ {
+				_, err = tx.Exec(
+					ctx,
+					`
+					insert into bot.member_collectible(
+						member_discord_id,
+						collectible_id,
+						has_collectible
+					) values(
+						$1,
+						$2,
+						$3
 					)
-					if err != nil {
-						return fmt.Errorf("upsert member data error: [%w]", err)
-					}
-					break
+					on conflict (
+						member_discord_id,
+						collectible_id
+					)
+					do update set
+						has_collectible=$3
+					where
+						member_collectible.member_discord_id=$1
+						and member_collectible.collectible_id=$2
+					`,
+					memberID.String(),
+					string(owned[i].ID),
+					true,
+				)
+				if err != nil {
+					tx.Rollback(ctx)
+					return fmt.Errorf("upsert member collectible error: [%w]", err)
 				}
+				mountScanOwnedCollectiblesTotal.WithLabelValues(string(owned[i].Type)).Inc()
 			}
 		}
-	}
-	err = tx.Commit(ctx)
-	if err != nil {
-		return fmt.Errorf("tx.Commit() 1 error: [%w]", err)
+		err = saveCharacterCollectibles(ctx, tx, characterCollectibles, profileMap)
+		if err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("saveCharacterCollectibles() error: [%w]", err)
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			return fmt.Errorf("tx.Commit() 1 error: [%w]", err)
+		}
 	}
 
 	// everything below this tldr: sync member data in google sheets
-	bossMountMap, err := getXivBossMountMapping()
-	if err != nil {
-		return fmt.Errorf("getXivBossMountMapping() error: [%w]", err)
+	dbcon.Release()
+	ownedSets := map[snowflake.ID]map[CollectibleID]bool{}
+	for memberID, owned := range memberCollectibles {
+		ownedSets[memberID] = map[CollectibleID]bool{}
+		for i := 0; i < len(owned); i++ {
+			ownedSets[memberID][owned[i].ID] = true
+		}
+	}
+	owners := map[MemberID]map[CollectibleID][]string{}
+	for memberID, characters := range memberCharacters {
+		owners[MemberID(memberID.String())] = characterOwners(characters, characterCollectibles[memberID])
 	}
-	// get the spreadsheet file id
-	var fileID string
-	row := dbcon.QueryRow(ctx, `select file_gcp_id from bot.file_ref`)
-	err = row.Scan(&fileID)
+	trackers, err := getTrackers(ctx)
 	if err != nil {
-		return fmt.Errorf("row scan 2 error: [%w]", err)
+		return fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	for i := 0; i < len(trackers); i++ {
+		if trackers[i].FileID == "" {
+			continue
+		}
+		err = updateSheetCollectibles(ctx, trackers[i], ownedSets, owners, memberNames, plan)
+		if err != nil {
+			return fmt.Errorf("updateSheetCollectibles() error; role_id=%s: [%w]", trackers[i].RoleID, err)
+		}
+	}
+	return nil
+}
+
+// saveCharacterCollectibles replaces the collectibles saved for each scanned character
+// and saves the names of the characters
+func saveCharacterCollectibles(ctx context.Context, tx pgx.Tx, characterCollectibles map[snowflake.ID]CharacterCollectibles, profileMap map[string]XivCharacter) error {
+	for memberID, characters := range characterCollectibles {
+		for xivID, owned := range characters {
+			_, err := tx.Exec(
+				ctx,
+				`delete from bot.character_collectible where member_discord_id = $1 and member_xiv_id = $2`,
+				memberID.String(),
+				xivID,
+			)
+			if err != nil {
+				return fmt.Errorf("delete from bot.character_collectible error: [%w]", err)
+			}
+			for collectibleID := range owned {
+				_, err = tx.Exec(
+					ctx,
+					`insert into bot.character_collectible(member_discord_id,member_xiv_id,collectible_id) values($1,$2,$3)`,
+					memberID.String(),
+					xivID,
+					string(collectibleID),
+				)
+				if err != nil {
+					return fmt.Errorf("insert into bot.character_collectible error: [%w]", err)
+				}
+			}
+		}
+	}
+	for xivID, profile := range profileMap {
+		_, err := tx.Exec(
+			ctx,
+			`
+			insert into bot.xiv_character(member_xiv_id,character_name) values($1,$2)
+			on conflict (member_xiv_id) do update set character_name = excluded.character_name
+			`,
+			xivID,
+			profile.Character.Name,
+		)
+		if err != nil {
+			return fmt.Errorf("upsert bot.xiv_character error: [%w]", err)
+		}
 	}
+	return nil
+}
+
+// updateSheetCollectibles ticks the checkboxes of the spreadsheet of the tracker according
+// to the collectibles found on the character profiles of each member. the checkboxes of
+// collectibles that are not on character profiles are left as they are. the checkbox
+// notes list the owning characters when the guild shows ownership per character.
+func updateSheetCollectibles(
+	ctx context.Context,
+	tracker *Tracker,
+	ownedSets map[snowflake.ID]map[CollectibleID]bool,
+	owners map[MemberID]map[CollectibleID][]string,
+	memberNames map[snowflake.ID]string,
+	plan *SyncPlan,
+) error {
+	logger := loggerFromContext(ctx)
+	fileID := tracker.FileID
 	// get the spreadsheet with all file data
-	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(fileID).IncludeGridData(true).Do()
+	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(string(fileID)).IncludeGridData(true).Context(ctx).Do()
 	if err != nil {
 		return fmt.Errorf("gsheetsSvc.Spreadsheets.Get() error: [%w]", err)
 	}
 	// get the column format mapping
-	columnMap, err := NewColumnMap()
+	columnMap, err := NewColumnMap(ctx, fileID)
 	if err != nil {
 		return fmt.Errorf("NewColumnMap() error: [%w]", err)
 	}
 	// create sheets api requests to update values according
-	// to the mount list in the corresponding character profile
+	// to the collectibles found for the member
 	gapiRequests := []*sheets.Request{}
 	for i := 0; i < len(spreadsheet.Sheets); i++ {
-		for memberID, charProfile := range profileMap {
-			for j := 1; j < len(spreadsheet.Sheets[i].Data[0].RowData); j++ {
-				sheet := spreadsheet.Sheets[i]
+		sheet := spreadsheet.Sheets[i]
+		sheetColumnMap := columnMap.Mapping[SheetMetadata{
+			ID:    SheetID(sheet.Properties.SheetId),
+			Index: SheetIndex(sheet.Properties.Index),
+		}]
+		for memberID, owned := range ownedSets {
+			for j := 1; j < len(sheet.Data[0].RowData); j++ {
 				row := sheet.Data[0].RowData[j]
 				curID, err := snowflake.Parse(*row.Values[0].EffectiveValue.StringValue)
 				if err != nil {
@@ -716,32 +969,53 @@ func xivMountScan() error {
 					continue
 				}
 
+				memberOwners := tracker.owners(owners[MemberID(memberID.String())])
 				vals := []*sheets.CellData{}
+				changedColumns := []string{}
 				for k := 2; k < len(row.Values); k++ {
-					hasMount := false
-					bossName := columnMap.Mapping[SheetMetadata{
-						ID:    SheetID(sheet.Properties.SheetId),
-						Index: SheetIndex(sheet.Properties.Index),
-					}][ColumnIndex(k)].Name
-					for a := 0; a < len(charProfile.Mounts); a++ {
-						mountName := charProfile.Mounts[a].Name
-						if mountName == string(bossMountMap[BossName(bossName)]) {
-							hasMount = true
-							break
+					column := sheetColumnMap[ColumnIndex(k)]
+					cell := row.Values[k].EffectiveValue
+					hasCollectible := cell != nil && cell.BoolValue != nil && *cell.BoolValue
+					note := ""
+					if column != nil && column.Collectible != nil {
+						if _, scanned := column.Collectible.Type.characterData(); scanned {
+							hasCollectible = owned[column.Collectible.ID]
+						}
+						if memberOwners != nil {
+							note = strings.Join(memberOwners(column.Collectible.ID), "\n")
 						}
 					}
 					vals = append(vals, &sheets.CellData{
 						UserEnteredValue: &sheets.ExtendedValue{
-							BoolValue: &hasMount,
+							BoolValue: &hasCollectible,
 						},
+						Note: note,
 					})
+					if cell == nil || cell.BoolValue == nil || *cell.BoolValue != hasCollectible || row.Values[k].Note != note {
+						name := ""
+						if column != nil {
+							name = string(column.Name)
+						}
+						changedColumns = append(changedColumns, name)
+					}
+				}
+				if len(changedColumns) > 0 {
+					plan.add(
+						PlanTargetSheets,
+						PlanOpUpdate,
+						"%s: %s (%s): %s",
+						sheet.Properties.Title,
+						memberNames[memberID],
+						memberID,
+						strings.Join(changedColumns, ", "),
+					)
 				}
 
 				gapiRequests = append(gapiRequests, &sheets.Request{
 					UpdateCells: &sheets.UpdateCellsRequest{
-						Fields: "userEnteredValue",
+						Fields: "userEnteredValue,note",
 						Range: &sheets.GridRange{
-							SheetId:          spreadsheet.Sheets[i].Properties.SheetId,
+							SheetId:          sheet.Properties.SheetId,
 							StartRowIndex:    int64(j),
 							EndRowIndex:      int64(j + 1),
 							StartColumnIndex: 2,
@@ -758,46 +1032,77 @@ func xivMountScan() error {
 	}
 	if len(gapiRequests) > 0 {
 		// send the batch request
-		go func() {
-			googleSheetsWriteReqs <- &SheetBatchUpdate{
-				ID: spreadsheet.SpreadsheetId,
-				Batch: &sheets.BatchUpdateSpreadsheetRequest{
-					Requests: gapiRequests,
-				},
-			}
-		}()
-		log.Debug("Data in spreadsheet successfully queued to be updated")
+		planOrQueueSheetBatchUpdate(plan, &SheetBatchUpdate{
+			ID: spreadsheet.SpreadsheetId,
+			Batch: &sheets.BatchUpdateSpreadsheetRequest{
+				Requests: gapiRequests,
+			},
+		})
+		logger.Debug("Data in spreadsheet successfully queued to be updated")
 	} else {
-		log.Debug("Nothing to update")
+		logger.Debug("Nothing to update")
 	}
 	return nil
 }
 
-func scanForMounts() {
-	for {
-		err := xivMountScan()
-		if err != nil {
-			log.Error(err)
-		}
-		<-time.After(xivapiMountScanSleepDuration)
+// planMemberCollectibles records the owned collectibles that are not saved as owned yet
+func planMemberCollectibles(ctx context.Context, plan *SyncPlan, memberCollectibles map[snowflake.ID][]*Collectible, memberNames map[snowflake.ID]string) error {
+	rows, err := dbpool.Query(ctx, `select member_discord_id, collectible_id from bot.member_collectible where has_collectible`)
+	if err != nil {
+		return fmt.Errorf("get owned collectibles error: [%w]", err)
+	}
+	defer rows.Close()
+	saved := map[string]bool{}
+	for rows.Next() {
+		var memberID string
+		var collectibleID string
+		err = rows.Scan(&memberID, &collectibleID)
+		if err != nil {
+			return fmt.Errorf("row scan error: [%w]", err)
+		}
+		saved[memberID+"/"+collectibleID] = true
+	}
+	if rows.Err() != nil {
+		return fmt.Errorf("rows.Err() error: [%w]", rows.Err())
 	}
+	for memberID, owned := range memberCollectibles {
+		for i := 0; i < len(owned); i++ {
+			if !saved[memberID.String()+"/"+string(owned[i].ID)] {
+				plan.add(PlanTargetDB, PlanOpUpdate, "bot.member_collectible %s (%s) owns %s %s", memberNames[memberID], memberID, owned[i].Type, owned[i].Name)
+			}
+		}
+	}
+	return nil
 }
 
-func discordNicknameScan(discMembers []discord.Member) error {
+func scanForMounts(ctx context.Context) error {
+	for {
+		start := time.Now()
+		logger := jobLogger("mount_scan")
+		err := xivCollectibleScan(withLogger(ctx, logger), nullSnowflake, nil)
+		observeScan("mount", start, err)
+		if err != nil {
+			logger.Error(err)
+		}
+		if sleepContext(ctx, getBotConfig().MountScanInterval) != nil {
+			return nil
+		}
+	}
+}
+
+func discordNicknameScan(ctx context.Context, guildID snowflake.ID, discMembers []discord.Member) error {
 	dbcon, err := dbpool.Acquire(ctx)
 	if err != nil {
 		return fmt.Errorf("database connection acquire error: [%w]", err)
 	}
 	defer dbcon.Release()
-	// get file id
-	var fileID string
-	row := dbcon.QueryRow(ctx, `select file_gcp_id from bot.file_ref`)
-	err = row.Scan(&fileID)
+	trackers, err := getTrackers(ctx)
 	if err != nil {
-		return fmt.Errorf("getting file id error: [%w]", err)
+		return fmt.Errorf("getTrackers() error: [%w]", err)
 	}
+	trackers = guildTrackers(trackers, guildID.String())
 	// get all members in db
-	dbMembers, err := getMembersFromDB()
+	dbMembers, err := getMembersFromDB(ctx)
 	if err != nil {
 		return fmt.Errorf("getMembersFromDB() error: [%w]", err)
 	}
@@ -818,9 +1123,43 @@ func discordNicknameScan(discMembers []discord.Member) error {
 			break
 		}
 	}
-	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(fileID).IncludeGridData(true).Do()
+	renamed := false
+	for i := 0; i < len(trackers); i++ {
+		if trackers[i].FileID == "" {
+			continue
+		}
+		queued, err := updateSheetMemberNames(trackers[i].FileID, memberMap)
+		if err != nil {
+			return fmt.Errorf("updateSheetMemberNames() error; role_id=%s: [%w]", trackers[i].RoleID, err)
+		}
+		renamed = renamed || queued
+	}
+	// update in database
+	if renamed {
+		tx, err := dbcon.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("dbcon.Begin() error: [%w]", err)
+		}
+		for userID, userName := range memberMap {
+			_, err = tx.Exec(ctx, `update bot.member_metadata set member_name=$1 where member_discord_id=$2`, userName, userID)
+			if err != nil {
+				return fmt.Errorf("update bot.member_metadata error: [%w]", err)
+			}
+		}
+		err = tx.Commit(ctx)
+		if err != nil {
+			return fmt.Errorf("tx.Commit() error: [%w]", err)
+		}
+	}
+	return nil
+}
+
+// updateSheetMemberNames queues the renaming of the members whose name in the spreadsheet
+// differs from memberMap, and reports whether there was any
+func updateSheetMemberNames(fileID FileID, memberMap map[string]string) (bool, error) {
+	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(string(fileID)).IncludeGridData(true).Do()
 	if err != nil {
-		return fmt.Errorf("gsheetsSvc.Spreadsheets.Get() error: [%w]", err)
+		return false, fmt.Errorf("gsheetsSvc.Spreadsheets.Get() error: [%w]", err)
 	}
 	// update all member names in the spreadsheet
 	requests := []*sheets.Request{}
@@ -861,33 +1200,16 @@ func discordNicknameScan(discMembers []discord.Member) error {
 			}
 		}
 	}
-	// update in database
-	if len(requests) > 0 {
-		go func() {
-			googleSheetsWriteReqs <- &SheetBatchUpdate{
-				ID: spreadsheet.SpreadsheetId,
-				Batch: &sheets.BatchUpdateSpreadsheetRequest{
-					Requests: requests,
-				},
-			}
-		}()
-
-		tx, err := dbcon.Begin(ctx)
-		if err != nil {
-			return fmt.Errorf("dbcon.Begin() error: [%w]", err)
-		}
-		for userID, userName := range memberMap {
-			_, err = tx.Exec(ctx, `update bot.member_metadata set member_name=$1 where member_discord_id=$2`, userName, userID)
-			if err != nil {
-				return fmt.Errorf("update bot.member_metadata error: [%w]", err)
-			}
-		}
-		err = tx.Commit(ctx)
-		if err != nil {
-			return fmt.Errorf("tx.Commit() error: [%w]", err)
-		}
+	if len(requests) == 0 {
+		return false, nil
 	}
-	return nil
+	queueSheetBatchUpdate(&SheetBatchUpdate{
+		ID: spreadsheet.SpreadsheetId,
+		Batch: &sheets.BatchUpdateSpreadsheetRequest{
+			Requests: requests,
+		},
+	})
+	return true, nil
 }
 
 func getSpreadsheetMembers(ss *sheets.Spreadsheet) []*Member {
@@ -905,78 +1227,76 @@ func getSpreadsheetMembers(ss *sheets.Spreadsheet) []*Member {
 	return members
 }
 
+// xivCharacterSearch lists a page of the characters found by name for the picker of the
+// character of user. when verify is set the user has to prove owning the picked character
+// before its ID is saved.
 func xivCharacterSearch(
+	ctx context.Context,
 	user discord.User,
+	verify bool,
 	xivCharName string,
+	page int,
 	discClient bot.Client,
 	discAppID snowflake.ID,
 	discToken string,
 ) error {
-	searchResponses, err := xivapiCollectCharacterSearchResponses([]XivCharacterSearchRequest{
-		{
-			Token: uuid.New().String(),
-			Name:  xivCharName,
-			Params: []XivApiQueryParam{
-				{
-					Name:  "server",
-					Value: "Behemoth",
+	search := characterSearch{
+		UserID: user.ID,
+		Verify: verify,
+		Name:   xivCharName,
+		Page:   page,
+	}
+	var result XivCharacterSearch
+	if search.valid() {
+		apiPage, _ := search.apiPage()
+		searchResponses, err := xivapiCollectCharacterSearchResponses(ctx, []XivCharacterSearchRequest{
+			{
+				Token: uuid.New().String(),
+				Name:  xivCharName,
+				Params: []XivApiQueryParam{
+					{
+						Name:  "server",
+						Value: "Behemoth",
+					},
+					{
+						Name:  "page",
+						Value: strconv.Itoa(apiPage),
+					},
 				},
+				Do: xivapiClient.SearchForCharacter,
 			},
-			Do: xivapiClient.SearchForCharacter,
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("xivapiCollectCharacterSearchResponses() error: [%w]", err)
-	}
-	if len(searchResponses) == 0 {
-		content := "No matching search results were found"
-		_, err = discClient.Rest().UpdateInteractionResponse(
-			discAppID,
-			discToken,
-			discord.MessageUpdate{
-				Content: &content,
-			},
-		)
+		})
 		if err != nil {
-			return fmt.Errorf("discClient.Rest().UpdateInteractionResponse() 1 error: [%w]", err)
+			return fmt.Errorf("xivapiCollectCharacterSearchResponses() error: [%w]", err)
 		}
-		return nil
-	}
-	// discord ID -> xiv character ID
-	var xivCharID *string = nil
-	charSearch := searchResponses[0]
-	for j := 0; j < len(charSearch.Results); j++ {
-		if charSearch.Results[j].Name == xivCharName {
-			s := strconv.FormatUint(uint64(charSearch.Results[j].ID), 10)
-			xivCharID = &s
-			break
+		if len(searchResponses) > 0 {
+			result = searchResponses[0]
+			characterSearchCache.remember(result.Results)
 		}
 	}
-	if xivCharID == nil {
-		content := "No matching search results were found"
-		_, err = discClient.Rest().UpdateInteractionResponse(
-			discAppID,
-			discToken,
-			discord.MessageUpdate{
-				Content: &content,
-			},
-		)
-		if err != nil {
-			return fmt.Errorf("discClient.Rest().UpdateInteractionResponse() 2 error: [%w]", err)
-		}
-		return nil
-	}
-
-	dbcon, err := dbpool.Acquire(ctx)
+	_, err := discClient.Rest().UpdateInteractionResponse(
+		discAppID,
+		discToken,
+		search.message(result),
+	)
 	if err != nil {
-		return fmt.Errorf("database connection acquire error: [%w]", err)
+		return fmt.Errorf("discClient.Rest().UpdateInteractionResponse() error: [%w]", err)
 	}
-	defer dbcon.Release()
-	_, err = dbcon.Exec(ctx, `update bot.member_metadata set member_xiv_id=$1 where member_discord_id=$2`, *xivCharID, user.ID.String())
+	return nil
+}
+
+func mapXivCharacterID(
+	ctx context.Context,
+	user discord.User,
+	xivCharID string,
+	discClient bot.Client,
+	discAppID snowflake.ID,
+	discToken string,
+) error {
+	content, err := mapXivCharacter(ctx, user, xivCharID)
 	if err != nil {
-		return fmt.Errorf("update bot.member_metadata error: [%w]", err)
+		return fmt.Errorf("mapXivCharacter() error: [%w]", err)
 	}
-	content := fmt.Sprintf("Character ID %s was found with character name %s for discord user %s", *xivCharID, xivCharName, user.ID.String())
 	_, err = discClient.Rest().UpdateInteractionResponse(
 		discAppID,
 		discToken,
@@ -985,29 +1305,15 @@ func xivCharacterSearch(
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("discClient.Rest().UpdateInteractionResponse() 3 error: [%w]", err)
-	}
-	err = mapXivCharacterID(
-		user,
-		*xivCharID,
-		discClient,
-		discAppID,
-		discToken,
-	)
-	if err != nil {
-		return fmt.Errorf("mapXivCharacterID() error: [%w]", err)
+		return fmt.Errorf("discClient.Rest().UpdateInteractionResponse() error: [%w]", err)
 	}
 	return nil
 }
 
-func mapXivCharacterID(
-	user discord.User,
-	xivCharID string,
-	discClient bot.Client,
-	discAppID snowflake.ID,
-	discToken string,
-) error {
-	resps, err := xivapiCollectCharacterResponses([]XivCharacterRequest{
+// mapXivCharacter saves the character as the primary character of user without
+// verification, and gets the reply to the admin
+func mapXivCharacter(ctx context.Context, user discord.User, xivCharID string) (string, error) {
+	resps, err := xivapiCollectCharacterResponses(ctx, []XivCharacterRequest{
 		{
 			Token: uuid.New().String(),
 			XivID: xivCharID,
@@ -1016,42 +1322,527 @@ func mapXivCharacterID(
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("xivapiCollectCharacterResponses() error: [%w]", err)
+		return "", fmt.Errorf("xivapiCollectCharacterResponses() error: [%w]", err)
+	}
+	if len(resps) == 0 || resps[0].Character.ID == 0 {
+		return fmt.Sprintf("No matching character was found for character ID %s", xivCharID), nil
+	}
+	dbcon, err := dbpool.Acquire(ctx)
+	if err != nil {
+		return "", fmt.Errorf("database connection acquire error: [%w]", err)
+	}
+	defer dbcon.Release()
+	// the character stays verified only when it is the one the member proved owning
+	_, err = dbcon.Exec(
+		ctx,
+		`
+		update bot.member_metadata
+		set
+			member_xiv_id=$1,
+			member_xiv_id_verified=(member_xiv_id_verified and member_xiv_id is not distinct from $1)
+		where member_discord_id=$2
+		`,
+		xivCharID,
+		user.ID.String(),
+	)
+	if err != nil {
+		return "", fmt.Errorf("update bot.member_metadata error: [%w]", err)
+	}
+	// an alt that becomes the primary character is no longer an alt
+	_, err = dbcon.Exec(
+		ctx,
+		`delete from bot.member_character where member_discord_id = $1 and member_xiv_id = $2`,
+		user.ID.String(),
+		xivCharID,
+	)
+	if err != nil {
+		return "", fmt.Errorf("delete from bot.member_character error: [%w]", err)
+	}
+	return fmt.Sprintf("Character ID %s was found for discord user %s", xivCharID, user.ID.String()), nil
+}
+
+// syncSpreadsheetStyling reapplies the header and column formats from the db to every
+// sheet of every tracked spreadsheet
+func syncSpreadsheetStyling(ctx context.Context) error {
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	for i := 0; i < len(trackers); i++ {
+		if trackers[i].FileID == "" {
+			continue
+		}
+		err = syncTrackerStyling(ctx, trackers[i])
+		if err != nil {
+			return fmt.Errorf("syncTrackerStyling() error; role_id=%s: [%w]", trackers[i].RoleID, err)
+		}
+	}
+	return nil
+}
+
+// syncGuildStyling reapplies the styling of the spreadsheets of the guild, after its
+// spreadsheet language changed
+func syncGuildStyling(ctx context.Context, guildID snowflake.ID) error {
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	trackers = guildTrackers(trackers, guildID.String())
+	for i := 0; i < len(trackers); i++ {
+		if trackers[i].FileID == "" {
+			continue
+		}
+		err = syncTrackerStyling(ctx, trackers[i])
+		if err != nil {
+			return fmt.Errorf("syncTrackerStyling() error; role_id=%s: [%w]", trackers[i].RoleID, err)
+		}
+	}
+	return nil
+}
+
+// syncTrackerStyling reapplies the header and column formats from the db to every sheet
+// of the spreadsheet of the tracker, and renames the headers and sheets in the language
+// of its guild
+func syncTrackerStyling(ctx context.Context, tracker *Tracker) error {
+	logger := loggerFromContext(ctx)
+	fileID, err := trackerFileID(tracker)
+	if err != nil {
+		return fmt.Errorf("trackerFileID() error: [%w]", err)
+	}
+	columnMap, err := NewColumnMap(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("NewColumnMap() error: [%w]", err)
+	}
+	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(string(fileID)).IncludeGridData(true).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("gsheetsSvc.Spreadsheets.Get() error: [%w]", err)
+	}
+
+	// make requests for the header rows
+	requests := make([]*sheets.Request, len(spreadsheet.Sheets)*2)
+	for i := 0; i < len(spreadsheet.Sheets); i++ {
+		sheet := spreadsheet.Sheets[i]
+		row := sheet.Data[0].RowData[0]
+		vals := make([]*sheets.CellData, len(row.Values))
+		for k := 0; k < len(row.Values); k++ {
+			colName := string(columnMap.Mapping[SheetMetadata{
+				ID:    SheetID(sheet.Properties.SheetId),
+				Index: SheetIndex(sheet.Properties.Index),
+			}][ColumnIndex(k)].Name)
+			vals[k] = &sheets.CellData{
+				UserEnteredFormat: columnMap.Mapping[SheetMetadata{
+					ID:    SheetID(sheet.Properties.SheetId),
+					Index: SheetIndex(sheet.Properties.Index),
+				}][ColumnIndex(k)].HeaderFormat,
+				UserEnteredValue: &sheets.ExtendedValue{
+					StringValue: &colName,
+				},
+			}
+		}
+		requests[i] = &sheets.Request{
+			UpdateCells: &sheets.UpdateCellsRequest{
+				Fields: "userEnteredFormat,userEnteredValue",
+				Rows: []*sheets.RowData{
+					{
+						Values: vals,
+					},
+				},
+				Start: &sheets.GridCoordinate{
+					ColumnIndex: 0,
+					RowIndex:    0,
+					SheetId:     sheet.Properties.SheetId,
+				},
+			},
+		}
 	}
-	if len(resps) == 0 {
-		content := fmt.Sprintf("No matching character was found for character ID %s", xivCharID)
-		_, err = discClient.Rest().UpdateInteractionResponse(
-			discAppID,
-			discToken,
-			discord.MessageUpdate{
-				Content: &content,
+	// make requests for the cell data
+	for i := 0; i < len(spreadsheet.Sheets); i++ {
+		sheet := spreadsheet.Sheets[i]
+		rowData := make([]*sheets.RowData, len(sheet.Data[0].RowData))
+		for j := 1; j < len(sheet.Data[0].RowData); j++ {
+			row := sheet.Data[0].RowData[j]
+			vals := make([]*sheets.CellData, len(row.Values))
+			for k := 0; k < len(row.Values); k++ {
+				vals[k] = &sheets.CellData{
+					UserEnteredFormat: columnMap.Mapping[SheetMetadata{
+						ID:    SheetID(sheet.Properties.SheetId),
+						Index: SheetIndex(sheet.Properties.Index),
+					}][ColumnIndex(k)].ColumnFormat,
+				}
+			}
+			rowData[j] = &sheets.RowData{
+				Values: vals,
+			}
+		}
+		requests[i+len(spreadsheet.Sheets)] = &sheets.Request{
+			UpdateCells: &sheets.UpdateCellsRequest{
+				Fields: "userEnteredFormat",
+				Rows:   rowData,
+				Start: &sheets.GridCoordinate{
+					ColumnIndex: 0,
+					RowIndex:    1,
+					SheetId:     sheet.Properties.SheetId,
+				},
 			},
-		)
+		}
+	}
+	// rename the sheets made by the bot
+	collectibleSheets, err := getCollectibleSheets(ctx, fileID, tracker.Language)
+	if err != nil {
+		return fmt.Errorf("getCollectibleSheets() error: [%w]", err)
+	}
+	for i := 0; i < len(spreadsheet.Sheets); i++ {
+		collectibleSheet, ok := collectibleSheets[SheetID(spreadsheet.Sheets[i].Properties.SheetId)]
+		if !ok || collectibleSheet.title() == spreadsheet.Sheets[i].Properties.Title {
+			continue
+		}
+		requests = append(requests, &sheets.Request{
+			UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+				Fields: "title",
+				Properties: &sheets.SheetProperties{
+					Title:   collectibleSheet.title(),
+					SheetId: spreadsheet.Sheets[i].Properties.SheetId,
+				},
+			},
+		})
+	}
+	err = sendSheetBatchUpdate(ctx, &SheetBatchUpdate{
+		ID: spreadsheet.SpreadsheetId,
+		Batch: &sheets.BatchUpdateSpreadsheetRequest{
+			Requests: requests,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("sendSheetBatchUpdate() error: [%w]", err)
+	}
+	logger.Debug("formatting successfully synced")
+	return nil
+}
+
+// syncFilePermissions makes the permissions of every tracked spreadsheet match the
+// permissions file. with a plan, the changes are only recorded.
+func syncFilePermissions(ctx context.Context, plan *SyncPlan) error {
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	for i := 0; i < len(trackers); i++ {
+		if trackers[i].FileID == "" {
+			continue
+		}
+		err = syncTrackerPermissions(ctx, trackers[i], plan)
 		if err != nil {
-			return fmt.Errorf("discClient.Rest().UpdateInteractionResponse() 1 error: [%w]", err)
+			return fmt.Errorf("syncTrackerPermissions() error; role_id=%s: [%w]", trackers[i].RoleID, err)
 		}
-		return nil
+	}
+	return nil
+}
+
+// syncTrackerPermissions makes the permissions of the spreadsheet of the tracker match the
+// permissions file. the saved permissions are first checked against the live ones, so that
+// permissions removed or changed outside the bot are noticed. permissions shared from
+// discord are left alone. with a plan, the changes are only recorded.
+func syncTrackerPermissions(ctx context.Context, tracker *Tracker, plan *SyncPlan) error {
+	logger := loggerFromContext(ctx).WithField("role_id", string(tracker.RoleID))
+	fileID, err := trackerFileID(tracker)
+	if err != nil {
+		return fmt.Errorf("trackerFileID() error: [%w]", err)
 	}
 	dbcon, err := dbpool.Acquire(ctx)
 	if err != nil {
 		return fmt.Errorf("database connection acquire error: [%w]", err)
 	}
 	defer dbcon.Release()
-	_, err = dbcon.Exec(ctx, `update bot.member_metadata set member_xiv_id=$1 where member_discord_id=$2`, xivCharID, user.ID.String())
+	// get perms from db and check them against the perms the file has
+	tracked, err := getTrackedPermissions(ctx, fileID)
 	if err != nil {
-		return fmt.Errorf("update bot.member_metadata error: [%w]", err)
+		return fmt.Errorf("getTrackedPermissions() error: [%w]", err)
 	}
-	dbcon.Release()
-	content := fmt.Sprintf("Character ID %s was found for discord user %s", xivCharID, user.ID.String())
-	_, err = discClient.Rest().UpdateInteractionResponse(
-		discAppID,
-		discToken,
-		discord.MessageUpdate{
-			Content: &content,
+	live, err := listFilePermissions(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("listFilePermissions() error: [%w]", err)
+	}
+	drift := reconcilePermissions(tracked, live)
+	for i := 0; i < len(drift.Missing); i++ {
+		logger.Infof("file permission removed outside the bot: %s", describePermission(tracked[drift.Missing[i]].Permission))
+		plan.add(PlanTargetDB, PlanOpDelete, "bot.permissions %s, removed outside the bot", describePermission(tracked[drift.Missing[i]].Permission))
+		delete(tracked, drift.Missing[i])
+	}
+	for permID, role := range drift.Roles {
+		logger.Infof("file permission changed outside the bot: %s -> %s", describePermission(tracked[permID].Permission), role)
+		plan.add(PlanTargetDB, PlanOpUpdate, "bot.permissions %s -> %s, changed outside the bot", describePermission(tracked[permID].Permission), role)
+		tracked[permID].Role = role
+	}
+	dbPerms := map[string]*drive.Permission{}
+	for id, p := range tracked {
+		if p.Source == PermissionSourceFile {
+			dbPerms[id] = p.Permission
+		}
+	}
+
+	// get perms from the perm file
+	permsOnDisk, err := GetPermissions(getBotConfig().FilePermissionsFilepath)
+	if err != nil {
+		return fmt.Errorf("GetPermissions() error: [%w]", err)
+	}
+	diff := diffFilePermissions(dbPerms, permsOnDisk, time.Now())
+	permsToAdd := diff.Add
+	permsToUpdate := diff.Update
+	permIDsToDelete := diff.Delete
+	for i := 0; i < len(permsToAdd); i++ {
+		logger.Debugf("file permission queued to be created: %s", describePermission(permsToAdd[i]))
+		plan.add(PlanTargetDrive, PlanOpCreate, "%s", describePermission(permsToAdd[i]))
+		plan.add(PlanTargetDB, PlanOpCreate, "bot.permissions %s", describePermission(permsToAdd[i]))
+	}
+	for permID, perm := range permsToUpdate {
+		updated := *dbPerms[permID]
+		updated.Role = perm.Role
+		updated.ExpirationTime = perm.ExpirationTime
+		logger.Debugf("file permission queued to be updated: %s -> %s", describePermission(dbPerms[permID]), describePermission(&updated))
+		plan.add(PlanTargetDrive, PlanOpUpdate, "%s -> %s", describePermission(dbPerms[permID]), describePermission(&updated))
+		plan.add(PlanTargetDB, PlanOpUpdate, "bot.permissions %s -> %s", describePermission(dbPerms[permID]), describePermission(&updated))
+	}
+	for i := 0; i < len(permIDsToDelete); i++ {
+		logger.Debugf("file permission queued to be deleted: %s", describePermission(dbPerms[permIDsToDelete[i]]))
+		plan.add(PlanTargetDrive, PlanOpDelete, "%s", describePermission(dbPerms[permIDsToDelete[i]]))
+		plan.add(PlanTargetDB, PlanOpDelete, "bot.permissions %s", describePermission(dbPerms[permIDsToDelete[i]]))
+	}
+	if plan != nil {
+		return nil
+	}
+	// delete perms
+	for i := 0; i < len(permIDsToDelete); i++ {
+		start := time.Now()
+		err = gdriveSvc.Permissions.Delete(string(fileID), permIDsToDelete[i]).SupportsAllDrives(true).Context(ctx).Do()
+		observeDriveCall("permissions.delete", start, err)
+		// drive removes expired permissions by itself
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("gdriveSvc.Permissions.Delete() error: [%w]", err)
+		}
+	}
+	logger.Debug("perms deleted")
+	// update perms
+	for permID, perm := range permsToUpdate {
+		start := time.Now()
+		_, err = gdriveSvc.Permissions.Update(string(fileID), permID, perm).SupportsAllDrives(true).Context(ctx).Do()
+		observeDriveCall("permissions.update", start, err)
+		if err != nil {
+			return fmt.Errorf("gdriveSvc.Permissions.Update() error: [%w]", err)
+		}
+	}
+	logger.Debug("perms updated")
+	// create new perms
+	newPermMap := map[string]*drive.Permission{}
+	for i := 0; i < len(permsToAdd); i++ {
+		start := time.Now()
+		p, err := gdriveSvc.Permissions.Create(string(fileID), permsToAdd[i]).SupportsAllDrives(true).Context(ctx).Do()
+		observeDriveCall("permissions.create", start, err)
+		if err != nil {
+			return fmt.Errorf("gdriveSvc.Permissions.Create() error: [%w]", err)
+		}
+		newPermMap[p.Id] = &drive.Permission{
+			EmailAddress:       permsToAdd[i].EmailAddress,
+			Domain:             permsToAdd[i].Domain,
+			Type:               p.Type,
+			Role:               p.Role,
+			AllowFileDiscovery: permsToAdd[i].AllowFileDiscovery,
+			ExpirationTime:     permsToAdd[i].ExpirationTime,
+		}
+	}
+	logger.Debug("perms added")
+
+	tx, err := dbcon.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("dbcon.Begin() error: [%w]", err)
+	}
+	defer tx.Rollback(ctx)
+	// catch the db up with the changes made outside the bot
+	for i := 0; i < len(drift.Missing); i++ {
+		_, err = tx.Exec(ctx, `delete from bot.permissions where perm_gcp_id=$1`, drift.Missing[i])
+		if err != nil {
+			return fmt.Errorf("delete from bot.permissions error: [%w]", err)
+		}
+	}
+	for permID, role := range drift.Roles {
+		_, err = tx.Exec(ctx, `update bot.permissions set role=$1 where perm_gcp_id=$2`, role, permID)
+		if err != nil {
+			return fmt.Errorf("update bot.permissions error: [%w]", err)
+		}
+	}
+	// delete perms from db
+	for i := 0; i < len(permIDsToDelete); i++ {
+		_, err = tx.Exec(ctx, `delete from bot.permissions where perm_gcp_id=$1`, permIDsToDelete[i])
+		if err != nil {
+			return fmt.Errorf("delete from bot.permissions error: [%w]", err)
+		}
+	}
+	logger.Debug("perms queued to be deleted from db")
+	// add perms to db
+	for id, perm := range newPermMap {
+		_, err = tx.Exec(
+			ctx,
+			`
+			insert into bot.permissions(
+				file_gcp_id,
+				perm_gcp_id,
+				email,
+				domain,
+				role,
+				role_type,
+				allow_file_discovery,
+				expiration_time,
+				source
+			) values($1,$2,$3,$4,$5,$6,$7,$8,'file')
+			on conflict (perm_gcp_id) do update
+			set
+				role = excluded.role,
+				allow_file_discovery = excluded.allow_file_discovery,
+				expiration_time = excluded.expiration_time,
+				source = excluded.source
+			`,
+			string(fileID),
+			id,
+			nullIfEmpty(perm.EmailAddress),
+			nullIfEmpty(perm.Domain),
+			perm.Role,
+			perm.Type,
+			perm.AllowFileDiscovery,
+			permissionExpiration(perm),
+		)
+		if err != nil {
+			return fmt.Errorf("insert into bot.permissions error: [%w]", err)
+		}
+	}
+	logger.Debug("perms queued to be added to db")
+	// update perms in db
+	for permID, perm := range permsToUpdate {
+		_, err = tx.Exec(
+			ctx,
+			`update bot.permissions set
+				role=$1,
+				expiration_time=$2
+			where perm_gcp_id=$3`,
+			perm.Role,
+			permissionExpiration(perm),
+			permID,
+		)
+		if err != nil {
+			return fmt.Errorf("update bot.permissions error: [%w]", err)
+		}
+	}
+	logger.Debug("perms queued to be updated in db")
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	logger.Debug("file permissions successfully synced")
+	return nil
+}
+
+// rebuildSpreadsheet builds a new spreadsheet file in place of the one of the tracker and
+// fills it with the members of its role and their mount ownership saved in the database.
+// the old file is moved to the trash when trashOld is set.
+func rebuildSpreadsheet(ctx context.Context, tracker *Tracker, trashOld bool) (*FileID, error) {
+	logger := loggerFromContext(ctx)
+	oldFileID := tracker.FileID
+	fileID, err := buildFile(ctx, tracker)
+	if err != nil {
+		return nil, fmt.Errorf("buildFile() error: [%w]", err)
+	}
+	logger.Infof("spreadsheet %s of role %s built to replace %q", *fileID, tracker.RoleID, oldFileID)
+	tracker.FileID = *fileID
+	err = populateSpreadsheet(ctx, tracker)
+	if err != nil {
+		return fileID, fmt.Errorf("populateSpreadsheet() error: [%w]", err)
+	}
+	if trashOld && oldFileID != "" {
+		// the old file is often already gone, which is why it is being rebuilt
+		err = trashFile(ctx, oldFileID)
+		if err != nil {
+			logger.Warnf("the old spreadsheet %s was not moved to the trash: %s", oldFileID, err)
+		} else {
+			logger.Infof("the old spreadsheet %s was moved to the trash", oldFileID)
+		}
+	}
+	return fileID, nil
+}
+
+// ensureSpreadsheet builds the spreadsheet of the tracker when it has none yet, or when
+// its file is no longer in google drive
+func ensureSpreadsheet(ctx context.Context, tracker *Tracker) error {
+	logger := loggerFromContext(ctx)
+	if tracker.FileID != "" {
+		exists, err := fileExists(tracker.FileID)
+		if err != nil {
+			return fmt.Errorf("fileExists() error: [%w]", err)
+		}
+		if *exists {
+			return nil
+		}
+		logger.Info("the spreadsheet file is in the db but not in google drive, rebuilding it")
+	} else {
+		logger.Info("no spreadsheet file in the db, building it")
+	}
+	_, err := rebuildSpreadsheet(ctx, tracker, false)
+	if err != nil {
+		return fmt.Errorf("rebuildSpreadsheet() error: [%w]", err)
+	}
+	return nil
+}
+
+// populateSpreadsheet appends a row for every member of the role of the tracker to each
+// sheet of its spreadsheet, with the checkboxes of the collectibles they own ticked
+func populateSpreadsheet(ctx context.Context, tracker *Tracker) error {
+	members, err := getRoleMembersFromDB(ctx, tracker.RoleID)
+	if err != nil {
+		return fmt.Errorf("getRoleMembersFromDB() error: [%w]", err)
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	ownedCollectibles, err := getOwnedCollectibles(ctx)
+	if err != nil {
+		return fmt.Errorf("getOwnedCollectibles() error: [%w]", err)
+	}
+	owners, err := getCharacterOwners(ctx)
+	if err != nil {
+		return fmt.Errorf("getCharacterOwners() error: [%w]", err)
+	}
+	columnMap, err := NewColumnMap(ctx, tracker.FileID)
+	if err != nil {
+		return fmt.Errorf("NewColumnMap() error: [%w]", err)
+	}
+
+	requests := []*sheets.Request{}
+	for sheetMetadata, sheetColumnMap := range columnMap.Mapping {
+		rowData := make([]*sheets.RowData, len(members))
+		for i := 0; i < len(members); i++ {
+			owned := ownedCollectibles[members[i].id]
+			rowData[i] = memberRowData(sheetColumnMap, string(members[i].id), members[i].name, func(id CollectibleID) bool {
+				return owned[id]
+			}, tracker.owners(owners[members[i].id]))
+		}
+		requests = append(requests, &sheets.Request{
+			AppendCells: &sheets.AppendCellsRequest{
+				Fields:  "*",
+				SheetId: int64(sheetMetadata.ID),
+				Rows:    rowData,
+			},
+		})
+	}
+	err = sendSheetBatchUpdateAndWait(ctx, &SheetBatchUpdate{
+		ID: string(tracker.FileID),
+		Batch: &sheets.BatchUpdateSpreadsheetRequest{
+			Requests: requests,
 		},
-	)
+	})
 	if err != nil {
-		return fmt.Errorf("discClient.Rest().UpdateInteractionResponse() 2 error: [%w]", err)
+		return fmt.Errorf("sendSheetBatchUpdateAndWait() error: [%w]", err)
 	}
+	loggerFromContext(ctx).Debugf("%d members added to the rebuilt spreadsheet", len(members))
 	return nil
 }
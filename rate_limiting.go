@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"math"
 	"math/rand"
+	"time"
 )
 
 func RandomRange(min float64, max float64) float64 {
@@ -17,3 +19,13 @@ func CalcThrottledWaitDuration(rateLimit, maxWaitDuration float64) float64 {
 	jitter := RandomRange(0, rateLimit)
 	return math.Min(maxWaitDuration, math.Pow(rateLimit, 3)+jitter)
 }
+
+// sleepContext waits for the duration to pass or returns the context error if it is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
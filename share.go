@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// the roles that can be given with /share add
+var shareRoles = []string{"reader", "commenter", "writer"}
+
+// Share is a live permission of the file together with how the bot tracks it
+type Share struct {
+	Permission *drive.Permission
+	// empty when the permission is not in bot.permissions
+	Source PermissionSource
+	// the saved role, when it differs from the live role
+	SavedRole string
+	// the permission is saved but the file no longer has it
+	Removed bool
+}
+
+func (s Share) String() string {
+	grantee := s.Permission.EmailAddress
+	switch s.Permission.Type {
+	case "anyone":
+		grantee = "anyone with the link"
+	case "domain":
+		grantee = "anyone at " + s.Permission.Domain
+	}
+	notes := []string{}
+	switch {
+	case s.Removed:
+		notes = append(notes, string(s.Source), "removed outside the bot")
+	case s.Source == "":
+		notes = append(notes, "shared outside the bot")
+	default:
+		notes = append(notes, string(s.Source))
+	}
+	if s.SavedRole != "" {
+		notes = append(notes, fmt.Sprintf("was %s", s.SavedRole))
+	}
+	if s.Permission.PendingOwner {
+		notes = append(notes, "pending owner")
+	}
+	return fmt.Sprintf("%-9s %s (%s)", s.Permission.Role, grantee, strings.Join(notes, ", "))
+}
+
+// listShares gets who the file is shared with, from the live permissions of the file
+// compared with the saved ones
+func listShares(ctx context.Context, fileID FileID) ([]Share, error) {
+	tracked, err := getTrackedPermissions(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("getTrackedPermissions() error: [%w]", err)
+	}
+	live, err := listFilePermissions(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("listFilePermissions() error: [%w]", err)
+	}
+	return mergeShares(tracked, live), nil
+}
+
+// mergeShares lists the live permissions with their saved source, then the saved
+// permissions the file no longer has
+func mergeShares(tracked map[string]*TrackedPermission, live []*drive.Permission) []Share {
+	drift := reconcilePermissions(tracked, live)
+	shares := []Share{}
+	for i := 0; i < len(live); i++ {
+		share := Share{Permission: live[i]}
+		if p, ok := tracked[live[i].Id]; ok {
+			share.Source = p.Source
+			if _, changed := drift.Roles[live[i].Id]; changed {
+				share.SavedRole = p.Role
+			}
+		}
+		shares = append(shares, share)
+	}
+	for i := 0; i < len(drift.Missing); i++ {
+		p := tracked[drift.Missing[i]]
+		shares = append(shares, Share{Permission: p.Permission, Source: p.Source, Removed: true})
+	}
+	return shares
+}
+
+func isShareRole(role string) bool {
+	for i := 0; i < len(shareRoles); i++ {
+		if shareRoles[i] == role {
+			return true
+		}
+	}
+	return false
+}
+
+// inPermissionsFile reports whether the permissions file grants the email address a role
+func inPermissionsFile(email string) (bool, error) {
+	perms, err := GetPermissions(getBotConfig().FilePermissionsFilepath)
+	if err != nil {
+		return false, fmt.Errorf("GetPermissions() error: [%w]", err)
+	}
+	return findPermission(perms, &drive.Permission{Type: "user", EmailAddress: email}) != nil, nil
+}
+
+// isLinkedEmail reports whether a member linked the email address with /link_email
+func isLinkedEmail(ctx context.Context, email string) (bool, error) {
+	var linked bool
+	err := dbpool.QueryRow(ctx, `select count(*) > 0 from bot.member_email where email = lower($1)`, email).Scan(&linked)
+	if err != nil {
+		return false, fmt.Errorf("row scan error: [%w]", err)
+	}
+	return linked, nil
+}
+
+// saveSharedPermission saves a permission shared from discord, taking over the saved
+// permission of the same ID
+func saveSharedPermission(ctx context.Context, fileID FileID, p *drive.Permission, email string) error {
+	_, err := dbpool.Exec(
+		ctx,
+		`
+		insert into bot.permissions(file_gcp_id,perm_gcp_id,email,role,role_type,source) values($1,$2,$3,$4,$5,$6)
+		on conflict (perm_gcp_id) do update
+		set role = excluded.role, source = excluded.source
+		`,
+		string(fileID),
+		p.Id,
+		email,
+		p.Role,
+		p.Type,
+		string(PermissionSourceDiscord),
+	)
+	if err != nil {
+		return fmt.Errorf("insert into bot.permissions error: [%w]", err)
+	}
+	return nil
+}
+
+// shareFile gives the email address the role on the file, or changes the role of the
+// permission it already has. permissions granted by the permissions file have to be
+// changed there, or the next sync changes them back.
+func shareFile(ctx context.Context, fileID FileID, email string, role string) (*drive.Permission, error) {
+	if !isShareRole(role) {
+		return nil, fmt.Errorf("%q is not one of the roles %s", role, strings.Join(shareRoles, ", "))
+	}
+	inFile, err := inPermissionsFile(email)
+	if err != nil {
+		return nil, fmt.Errorf("inPermissionsFile() error: [%w]", err)
+	}
+	if inFile {
+		return nil, fmt.Errorf("%s is granted by the permissions file, change it there", email)
+	}
+	linked, err := isLinkedEmail(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("isLinkedEmail() error: [%w]", err)
+	}
+	if linked {
+		return nil, fmt.Errorf("%s was linked by a member with /link_email, its role follows the link_email_role setting", email)
+	}
+	live, err := listFilePermissions(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("listFilePermissions() error: [%w]", err)
+	}
+	var p *drive.Permission
+	existing := findPermission(live, &drive.Permission{Type: "user", EmailAddress: email})
+	if existing != nil {
+		if existing.Role == "owner" {
+			return nil, fmt.Errorf("%s owns the file", email)
+		}
+		start := time.Now()
+		p, err = gdriveSvc.Permissions.Update(string(fileID), existing.Id, &drive.Permission{Role: role}).SupportsAllDrives(true).Context(ctx).Do()
+		observeDriveCall("permissions.update", start, err)
+		if err != nil {
+			return nil, fmt.Errorf("gdriveSvc.Permissions.Update() error: [%w]", err)
+		}
+	} else {
+		start := time.Now()
+		p, err = gdriveSvc.Permissions.Create(string(fileID), &drive.Permission{
+			Type:         "user",
+			EmailAddress: email,
+			Role:         role,
+		}).SupportsAllDrives(true).Context(ctx).Do()
+		observeDriveCall("permissions.create", start, err)
+		if err != nil {
+			return nil, fmt.Errorf("gdriveSvc.Permissions.Create() error: [%w]", err)
+		}
+	}
+	err = saveSharedPermission(ctx, fileID, p, email)
+	if err != nil {
+		return nil, fmt.Errorf("saveSharedPermission() error: [%w]", err)
+	}
+	loggerFromContext(ctx).Infof("file shared: %s", describePermission(&drive.Permission{Type: p.Type, EmailAddress: email, Role: p.Role}))
+	return p, nil
+}
+
+// unshareFile removes the permission of the email address from the file. permissions
+// granted by the permissions file have to be removed there, or the next sync adds them back.
+func unshareFile(ctx context.Context, fileID FileID, email string) error {
+	inFile, err := inPermissionsFile(email)
+	if err != nil {
+		return fmt.Errorf("inPermissionsFile() error: [%w]", err)
+	}
+	if inFile {
+		return fmt.Errorf("%s is granted by the permissions file, remove it there", email)
+	}
+	linked, err := isLinkedEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("isLinkedEmail() error: [%w]", err)
+	}
+	if linked {
+		return fmt.Errorf("%s was linked by a member with /link_email, it is removed when they lose the role or run /unlink_email", email)
+	}
+	live, err := listFilePermissions(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("listFilePermissions() error: [%w]", err)
+	}
+	existing := findPermission(live, &drive.Permission{Type: "user", EmailAddress: email})
+	if existing != nil {
+		if existing.Role == "owner" {
+			return fmt.Errorf("%s owns the file", email)
+		}
+		start := time.Now()
+		err = gdriveSvc.Permissions.Delete(string(fileID), existing.Id).SupportsAllDrives(true).Context(ctx).Do()
+		observeDriveCall("permissions.delete", start, err)
+		if err != nil {
+			return fmt.Errorf("gdriveSvc.Permissions.Delete() error: [%w]", err)
+		}
+	}
+	// a permission removed outside the bot may still be saved
+	tag, err := dbpool.Exec(ctx, `delete from bot.permissions where file_gcp_id = $1 and lower(email) = lower($2)`, string(fileID), email)
+	if err != nil {
+		return fmt.Errorf("delete from bot.permissions error: [%w]", err)
+	}
+	if existing == nil && tag.RowsAffected() == 0 {
+		return fmt.Errorf("the file is not shared with %s", email)
+	}
+	loggerFromContext(ctx).Infof("file unshared: %s", email)
+	return nil
+}
+
+// transferFileOwnership makes the email address the owner of the file. gmail accounts
+// cannot be made owners directly, they are made pending owners and have to accept
+// the transfer in google drive.
+func transferFileOwnership(ctx context.Context, fileID FileID, email string) (pending bool, err error) {
+	live, err := listFilePermissions(ctx, fileID)
+	if err != nil {
+		return false, fmt.Errorf("listFilePermissions() error: [%w]", err)
+	}
+	pending = isGmailEmailAddress(email)
+	req := &drive.Permission{Role: "owner"}
+	if pending {
+		req = &drive.Permission{Role: "writer", PendingOwner: true}
+	}
+	var p *drive.Permission
+	existing := findPermission(live, &drive.Permission{Type: "user", EmailAddress: email})
+	if existing != nil {
+		if existing.Role == "owner" {
+			return false, fmt.Errorf("%s already owns the file", email)
+		}
+		start := time.Now()
+		p, err = gdriveSvc.Permissions.Update(string(fileID), existing.Id, req).
+			TransferOwnership(!pending).SupportsAllDrives(true).Context(ctx).Do()
+		observeDriveCall("permissions.update", start, err)
+		if err != nil {
+			return false, fmt.Errorf("gdriveSvc.Permissions.Update() error: [%w]", err)
+		}
+	} else {
+		req.Type = "user"
+		req.EmailAddress = email
+		start := time.Now()
+		p, err = gdriveSvc.Permissions.Create(string(fileID), req).
+			TransferOwnership(!pending).SupportsAllDrives(true).Context(ctx).Do()
+		observeDriveCall("permissions.create", start, err)
+		if err != nil {
+			return false, fmt.Errorf("gdriveSvc.Permissions.Create() error: [%w]", err)
+		}
+	}
+	err = saveSharedPermission(ctx, fileID, p, email)
+	if err != nil {
+		return false, fmt.Errorf("saveSharedPermission() error: [%w]", err)
+	}
+	loggerFromContext(ctx).Infof("file ownership transferred to %s, pending=%t", email, pending)
+	return pending, nil
+}
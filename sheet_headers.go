@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
@@ -17,7 +18,7 @@ type Expansion struct {
 	Index ExpansionIndex
 }
 
-func getExpansions() ([]*Expansion, error) {
+func getExpansions(ctx context.Context) ([]*Expansion, error) {
 	dbcon, err := dbpool.Acquire(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("database connection acquire error: [%w]", err)
@@ -57,34 +58,14 @@ func getExpansions() ([]*Expansion, error) {
 	return expansions, nil
 }
 
-func countExpansions() (*int, error) {
-	dbcon, err := dbpool.Acquire(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("database connection acquire error: [%w]", err)
-	}
-	defer dbcon.Release()
-	query := `
-		select count(*) as num_expansions
-		from bot.expansion_metadata
-	`
-	row := dbcon.QueryRow(
-		ctx,
-		query,
-	)
-	var numExpansions int
-	err = row.Scan(&numExpansions)
-	if err != nil {
-		return nil, fmt.Errorf("row scan error: [%w]", err)
-	}
-	return &numExpansions, nil
-}
-
 type ColumnName string
 
 type ColumnStyleData struct {
 	Name         ColumnName
 	HeaderFormat *sheets.CellFormat
 	ColumnFormat *sheets.CellFormat
+	// the collectible of the checkboxes of the column, nil for the member columns
+	Collectible *Collectible
 }
 
 type SheetIndex int
@@ -115,54 +96,84 @@ type HeaderForegroundColor *RGBA
 type CheckboxBackgroundColor *RGBA
 type CheckboxForegroundColor *RGBA
 
-func NewColumnMap() (*ColumnMap, error) {
-	numExpansions, err := countExpansions()
-	if err != nil {
-		return nil, fmt.Errorf("countExpansions() error: [%w]", err)
-	}
-
+// NewColumnMap gets the columns of every sheet of the spreadsheet, styled with the
+// colors of the role of the spreadsheet where it has its own. each sheet has a column
+// per collectible of its type dropped by the bosses of its expansion, named in the
+// language of the spreadsheets.
+func NewColumnMap(ctx context.Context, fileID FileID) (*ColumnMap, error) {
 	dbcon, err := dbpool.Acquire(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("database connection acquire error: [%w]", err)
 	}
 	defer dbcon.Release()
+	// a boss dropping several collectibles of the sheet's type gets a column for each
 	query := `
 		select
-			b.boss_name,
-			m.boss_expansion_index,
-			e.expansion_index,
+			case
+				when count(*) over (partition by s.sheet_gcp_id, b.boss_id) > 1
+				then coalesce(bl.boss_name, b.boss_name) || ' (' || coalesce(cl.collectible_name, c.collectible_name) || ')'
+				else coalesce(bl.boss_name, b.boss_name)
+			end,
+			row_number() over (
+				partition by s.sheet_gcp_id
+				order by m.boss_expansion_index, c.collectible_name
+			) - 1,
+			c.collectible_id,
+			c.collectible_type,
+			c.collectible_name,
+			coalesce(c.icon_url, ''),
 			s.sheet_gcp_id,
 			s.sheet_index,
-			bs.header_background_hex_color,
-			bs.header_foreground_hex_color,
-			bs.checkbox_background_hex_color,
-			bs.checkbox_foreground_hex_color
+			coalesce(rs.header_background_hex_color, bs.header_background_hex_color),
+			coalesce(rs.header_foreground_hex_color, bs.header_foreground_hex_color),
+			coalesce(rs.checkbox_background_hex_color, bs.checkbox_background_hex_color),
+			coalesce(rs.checkbox_foreground_hex_color, bs.checkbox_foreground_hex_color)
 		from bot.boss_metadata b
 		inner join bot.boss_expansion_map m
 		on b.boss_id = m.boss_id
-		inner join bot.expansion_metadata e
-		on e.expansion_id = m.expansion_id
 		inner join bot.sheet_expansion_map sm
-		on e.expansion_id = sm.expansion_id
+		on m.expansion_id = sm.expansion_id
 		inner join bot.sheet_metadata s
 		on s.sheet_gcp_id = sm.sheet_gcp_id
+		inner join bot.boss_collectible_map bc
+		on bc.boss_id = b.boss_id
+		inner join bot.collectible_metadata c
+		on c.collectible_id = bc.collectible_id and c.collectible_type = s.collectible_type
 		inner join bot.boss_styling_data bs
 		on b.boss_id = bs.boss_id
+		inner join bot.file_ref f
+		on f.file_gcp_id = s.file_gcp_id
+		left join bot.role_boss_styling_data rs
+		on rs.role_id = f.role_id and rs.boss_id = b.boss_id
+		left join bot.role_ref r
+		on r.role_id = f.role_id
+		left join bot.guild_settings g
+		on g.guild_id = r.guild_id
+		left join bot.boss_localized_name bl
+		on bl.boss_id = b.boss_id and bl.language = coalesce(g.spreadsheet_language, $2)
+		left join bot.collectible_localized_name cl
+		on cl.collectible_id = c.collectible_id and cl.language = coalesce(g.spreadsheet_language, $2)
+		where s.file_gcp_id = $1
 	`
 	rows, err := dbcon.Query(
 		ctx,
 		query,
+		string(fileID),
+		string(getBotConfig().SpreadsheetLanguage),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("get style data error: [%w]", err)
 	}
+	defer rows.Close()
 
 	innerMap := map[SheetMetadata]map[ColumnIndex]*ColumnStyleData{}
-	columnDataMaps := make([]map[ColumnIndex]*ColumnStyleData, *numExpansions)
 	for rows.Next() {
 		var bossName string
-		var bossExpansionIndex int
-		var expansionIndex int
+		var columnIndex int
+		var collectibleID string
+		var collectibleType string
+		var collectibleName string
+		var collectibleIcon string
 		var sheetIdStr string
 		var sheetIndex int
 		var headerBackgroundHex string
@@ -171,8 +182,11 @@ func NewColumnMap() (*ColumnMap, error) {
 		var checkboxForegroundHex string
 		err = rows.Scan(
 			&bossName,
-			&bossExpansionIndex,
-			&expansionIndex,
+			&columnIndex,
+			&collectibleID,
+			&collectibleType,
+			&collectibleName,
+			&collectibleIcon,
 			&sheetIdStr,
 			&sheetIndex,
 			&headerBackgroundHex,
@@ -241,25 +255,27 @@ func NewColumnMap() (*ColumnMap, error) {
 			},
 		}
 
-		oldCdataMap := columnDataMaps[expansionIndex]
-		cdata := &ColumnStyleData{
+		sheet := SheetMetadata{
+			ID:    SheetID(sheetId),
+			Index: SheetIndex(sheetIndex),
+		}
+		if innerMap[sheet] == nil {
+			innerMap[sheet] = map[ColumnIndex]*ColumnStyleData{}
+		}
+		innerMap[sheet][ColumnIndex(columnIndex+2)] = &ColumnStyleData{
 			Name:         ColumnName(bossName),
 			HeaderFormat: headerCellFormat,
 			ColumnFormat: columnFormat,
+			Collectible: &Collectible{
+				ID:   CollectibleID(collectibleID),
+				Type: CollectibleType(collectibleType),
+				Name: CollectibleName(collectibleName),
+				Icon: collectibleIcon,
+			},
 		}
-		cindex := ColumnIndex(bossExpansionIndex + 2)
-		if oldCdataMap == nil {
-			columnDataMaps[expansionIndex] = make(map[ColumnIndex]*ColumnStyleData)
-			columnDataMaps[expansionIndex][cindex] = cdata
-		} else {
-			oldCdataMap[ColumnIndex(cindex)] = cdata
-			columnDataMaps[expansionIndex] = oldCdataMap
-		}
-
-		innerMap[SheetMetadata{
-			ID:    SheetID(sheetId),
-			Index: SheetIndex(sheetIndex),
-		}] = columnDataMaps[expansionIndex]
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
 	}
 
 	mapping := &ColumnMap{Mapping: innerMap}
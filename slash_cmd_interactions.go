@@ -1,75 +1,103 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
-	"github.com/disgoorg/log"
+	"github.com/google/uuid"
 	"google.golang.org/api/drive/v3"
-	"google.golang.org/api/sheets/v4"
 )
 
+// optionTracker gets the tracker of the role option, or the only tracker when the option
+// is not given
+func optionTracker(ctx context.Context, eventData discord.SlashCommandInteractionData, name string) (*Tracker, error) {
+	var roleID RoleID
+	if role, ok := eventData.OptRole(name); ok {
+		roleID = RoleID(role.ID.String())
+	}
+	return resolveTracker(ctx, roleID)
+}
+
 func setRoleHandler(event *events.ApplicationCommandInteractionCreate) {
 	eventData := event.SlashCommandInteractionData()
 	if eventData.CommandName() != "set_role" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	// check if a role ref exists
-	dbcon, err := dbpool.Acquire(ctx)
+	content, err := setRole(withLogger(ctx, logger), event, eventData)
 	if err != nil {
-		log.Error(err)
-		return
+		logger.Error(err)
+		content = "The role could not be set, see the logs for details"
 	}
-	defer dbcon.Release()
-	row := dbcon.QueryRow(ctx, `select count(*) > 0 from bot.role_ref`)
-	var hasRoleID bool
-	err = row.Scan(&hasRoleID)
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
 	if err != nil {
-
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	if hasRoleID {
-		content := "A role is already set."
-		_, err = event.Client().Rest().UpdateInteractionResponse(
-			event.ApplicationID(),
-			event.Token(),
-			discord.MessageUpdate{
-				Content: &content,
-			},
-		)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-	} else {
-		// set role ref
-		role := eventData.Role("role")
-		_, err = dbcon.Exec(ctx, `insert into bot.role_ref(role_id) values($1)`, role.ID.String())
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		content := fmt.Sprintf("Role %s has been set.", role.Name)
-		_, err = event.Client().Rest().UpdateInteractionResponse(
-			event.ApplicationID(),
-			event.Token(),
-			discord.MessageUpdate{
-				Content: &content,
-			},
-		)
-		if err != nil {
-			log.Error(err)
-		}
+}
+
+// setRole gets the reply to /set_role. the returned error is for failures that are not
+// the admin's to fix.
+func setRole(ctx context.Context, event *events.ApplicationCommandInteractionCreate, eventData discord.SlashCommandInteractionData) (string, error) {
+	role := eventData.Role("role")
+	roleID := RoleID(role.ID.String())
+	existing, err := getTracker(ctx, roleID)
+	if err != nil {
+		return "", fmt.Errorf("getTracker() error: [%w]", err)
+	}
+	if existing != nil {
+		return fmt.Sprintf("Role %s is already set.", role.Name), nil
+	}
+	expansions, err := getExpansions(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getExpansions() error: [%w]", err)
+	}
+	translations, err := getTranslations(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getTranslations() error: [%w]", err)
+	}
+	expansionIDs, err := parseExpansionList(eventData.String("expansions"), expansions, translations, localeLanguage(event.Locale()))
+	if err != nil {
+		return err.Error(), nil
+	}
+	tracker, err := addTracker(ctx, roleID, event.GuildID().String(), strings.TrimSpace(eventData.String("title")), expansionIDs)
+	if err != nil {
+		return "", fmt.Errorf("addTracker() error: [%w]", err)
+	}
+	err = ensureSpreadsheet(ctx, tracker)
+	if err != nil {
+		return "", fmt.Errorf("ensureSpreadsheet() error: [%w]", err)
 	}
+	members, err := event.Client().Rest().GetMembers(*event.GuildID(), guildMemberCountRequestLimit, nullSnowflake)
+	if err != nil {
+		return "", fmt.Errorf("GetMembers() error: [%w]", err)
+	}
+	err = syncRoleMembers(ctx, tracker, members, nil)
+	if err != nil {
+		return "", fmt.Errorf("syncRoleMembers() error: [%w]", err)
+	}
+	err = syncMemberAccess(ctx, *event.GuildID(), members)
+	if err != nil {
+		return "", fmt.Errorf("syncMemberAccess() error: [%w]", err)
+	}
+	return fmt.Sprintf("Role %s has been set: https://docs.google.com/spreadsheets/d/%s", role.Name, tracker.FileID), nil
 }
 
 func unsetRoleHandler(event *events.ApplicationCommandInteractionCreate) {
@@ -77,59 +105,34 @@ func unsetRoleHandler(event *events.ApplicationCommandInteractionCreate) {
 	if eventData.CommandName() != "unset_role" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	// check if a role ref exists
-	dbcon, err := dbpool.Acquire(ctx)
+	role := eventData.Role("role")
+	removed, err := removeTracker(withLogger(ctx, logger), RoleID(role.ID.String()))
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	defer dbcon.Release()
-	row := dbcon.QueryRow(ctx, `select count(*) > 0 from bot.role_ref`)
-	var hasRoleID bool
-	err = row.Scan(&hasRoleID)
+	content := fmt.Sprintf("Role %s has been unset, its spreadsheet is kept in Google Drive.", role.Name)
+	if !removed {
+		content = fmt.Sprintf("Unable to unset role; %s is not set", role.Name)
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	if hasRoleID {
-		// unset role ref
-		_, err = dbcon.Exec(ctx, `truncate table bot.role_ref`)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		content := "Role has been unset."
-		_, err = event.Client().Rest().UpdateInteractionResponse(
-			event.ApplicationID(),
-			event.Token(),
-			discord.MessageUpdate{
-				Content: &content,
-			},
-		)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-	} else {
-		content := "Unable to unset role; a role ref has not been set"
-		_, err = event.Client().Rest().UpdateInteractionResponse(
-			event.ApplicationID(),
-			event.Token(),
-			discord.MessageUpdate{
-				Content: &content,
-			},
-		)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-	}
 }
 
 func spreadsheetDiscordMemberSyncHandler(event *events.ApplicationCommandInteractionCreate) {
@@ -137,44 +140,68 @@ func spreadsheetDiscordMemberSyncHandler(event *events.ApplicationCommandInterac
 	if eventData.CommandName() != "spreadsheet_discord_member_sync" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	dbcon, err := dbpool.Acquire(ctx)
-	if err != nil {
-		log.Error(err)
-		return
+	// every watched role of the guild is synced unless one is chosen, the members of the
+	// guild say nothing about the roles of the other guilds
+	var trackers []*Tracker
+	if role, ok := eventData.OptRole("role"); ok {
+		var tracker *Tracker
+		tracker, err = resolveTracker(ctx, RoleID(role.ID.String()))
+		trackers = []*Tracker{tracker}
+		if err == nil && tracker.GuildID != "" && tracker.GuildID != event.GuildID().String() {
+			content := fmt.Sprintf("<@&%s> is watched in another server", tracker.RoleID)
+			_, err = event.Client().Rest().UpdateInteractionResponse(
+				event.ApplicationID(),
+				event.Token(),
+				discord.MessageUpdate{
+					Content: &content,
+				},
+			)
+			if err != nil {
+				logger.Error(err)
+			}
+			return
+		}
+	} else {
+		trackers, err = getTrackers(ctx)
+		trackers = guildTrackers(trackers, event.GuildID().String())
 	}
-	defer dbcon.Release()
-
-	// get file id
-	var fileID string
-	row := dbcon.QueryRow(
-		ctx,
-		"select file_gcp_id from bot.file_ref",
-	)
-	err = row.Scan(&fileID)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	dbcon.Release()
 	// get the discord members
 	members, err := event.Client().Rest().GetMembers(*event.GuildID(), guildMemberCountRequestLimit, nullSnowflake)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	// sync the spreadsheet with the discord members
-	err = syncRoleMembers(FileID(fileID), members)
-	if err != nil {
-		log.Error(err)
+	// sync the spreadsheets with the discord members
+	var plan *SyncPlan
+	if eventData.Bool("dry_run") {
+		plan = &SyncPlan{}
+	}
+	for i := 0; i < len(trackers); i++ {
+		err = syncRoleMembers(withLogger(ctx, logger), trackers[i], members, plan)
+		if err != nil {
+			logger.WithField("role_id", string(trackers[i].RoleID)).Error(err)
+			return
+		}
+	}
+	if plan != nil {
+		err = respondWithSyncPlan(event, "Member sync", plan)
+		if err != nil {
+			logger.Error(err)
+		}
 		return
 	}
-	log.Debug("force member sync successfully completed")
+	logger.Debug("force member sync successfully completed")
 	content := "Force member sync successfully completed"
 	_, err = event.Client().Rest().UpdateInteractionResponse(
 		event.ApplicationID(),
@@ -184,7 +211,7 @@ func spreadsheetDiscordMemberSyncHandler(event *events.ApplicationCommandInterac
 		},
 	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
 }
@@ -194,122 +221,112 @@ func syncSpreadsheetStylingHandler(event *events.ApplicationCommandInteractionCr
 	if eventData.CommandName() != "sync_spreadsheet_styling" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	dbcon, err := dbpool.Acquire(ctx)
+	err = syncSpreadsheetStyling(withLogger(ctx, logger))
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	defer dbcon.Release()
-	// get file id
-	var fileID *string
-	row := dbcon.QueryRow(
-		ctx,
-		"select file_gcp_id from bot.file_ref",
+	logger.Debug("formatting successfully synced")
+	content := "Formatting successfully synced"
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
 	)
-	err = row.Scan(&fileID)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	dbcon.Release()
-	if fileID == nil {
-		log.Error(err)
+}
+
+func setRoleStylingHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "set_role_styling" {
 		return
 	}
+	logger := interactionLogger(event)
 
-	columnMap, err := NewColumnMap()
+	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	spreadsheet, err := gsheetsSvc.Spreadsheets.Get(*fileID).IncludeGridData(true).Do()
+	stylingCtx := withLogger(ctx, logger)
+	bossName := strings.TrimSpace(eventData.String("boss"))
+	content := fmt.Sprintf("The colors of %s were saved", bossName)
+	tracker, err := optionTracker(stylingCtx, eventData, "role")
+	if err == nil && eventData.Bool("reset") {
+		content = fmt.Sprintf("%s is back to its default colors", bossName)
+		err = resetRoleBossStyling(stylingCtx, tracker.RoleID, bossName)
+	} else if err == nil {
+		err = setRoleBossStyling(stylingCtx, tracker.RoleID, bossName, BossStyling{
+			HeaderBackground:   strings.TrimSpace(eventData.String("header_background")),
+			HeaderForeground:   strings.TrimSpace(eventData.String("header_foreground")),
+			CheckboxBackground: strings.TrimSpace(eventData.String("checkbox_background")),
+			CheckboxForeground: strings.TrimSpace(eventData.String("checkbox_foreground")),
+		})
+	}
+	// the spreadsheet is restyled right away when it is built
+	if err == nil && tracker.FileID != "" {
+		err = syncTrackerStyling(stylingCtx, tracker)
+	}
+	if err != nil {
+		logger.Error(err)
+		content = fmt.Sprintf("Styling could not be changed: %s", err)
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
+}
 
-	// make requests for the header rows
-	requests := make([]*sheets.Request, len(spreadsheet.Sheets)*2)
-	for i := 0; i < len(spreadsheet.Sheets); i++ {
-		sheet := spreadsheet.Sheets[i]
-		row := sheet.Data[0].RowData[0]
-		vals := make([]*sheets.CellData, len(row.Values))
-		for k := 0; k < len(row.Values); k++ {
-			colName := string(columnMap.Mapping[SheetMetadata{
-				ID:    SheetID(sheet.Properties.SheetId),
-				Index: SheetIndex(sheet.Properties.Index),
-			}][ColumnIndex(k)].Name)
-			vals[k] = &sheets.CellData{
-				UserEnteredFormat: columnMap.Mapping[SheetMetadata{
-					ID:    SheetID(sheet.Properties.SheetId),
-					Index: SheetIndex(sheet.Properties.Index),
-				}][ColumnIndex(k)].HeaderFormat,
-				UserEnteredValue: &sheets.ExtendedValue{
-					StringValue: &colName,
-				},
-			}
-		}
-		requests[i] = &sheets.Request{
-			UpdateCells: &sheets.UpdateCellsRequest{
-				Fields: "userEnteredFormat,userEnteredValue",
-				Rows: []*sheets.RowData{
-					{
-						Values: vals,
-					},
-				},
-				Start: &sheets.GridCoordinate{
-					ColumnIndex: 0,
-					RowIndex:    0,
-					SheetId:     sheet.Properties.SheetId,
-				},
-			},
-		}
+func syncFilePermsHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "sync_file_perms" {
+		return
 	}
-	// make requests for the cell data
-	for i := 0; i < len(spreadsheet.Sheets); i++ {
-		sheet := spreadsheet.Sheets[i]
-		rowData := make([]*sheets.RowData, len(sheet.Data[0].RowData))
-		for j := 1; j < len(sheet.Data[0].RowData); j++ {
-			row := sheet.Data[0].RowData[j]
-			vals := make([]*sheets.CellData, len(row.Values))
-			for k := 0; k < len(row.Values); k++ {
-				vals[k] = &sheets.CellData{
-					UserEnteredFormat: columnMap.Mapping[SheetMetadata{
-						ID:    SheetID(sheet.Properties.SheetId),
-						Index: SheetIndex(sheet.Properties.Index),
-					}][ColumnIndex(k)].ColumnFormat,
-				}
-			}
-			rowData[j] = &sheets.RowData{
-				Values: vals,
-			}
-		}
-		requests[i+len(spreadsheet.Sheets)-1] = &sheets.Request{
-			UpdateCells: &sheets.UpdateCellsRequest{
-				Fields: "userEnteredFormat",
-				Rows:   rowData,
-				Start: &sheets.GridCoordinate{
-					ColumnIndex: 0,
-					RowIndex:    1,
-					SheetId:     sheet.Properties.SheetId,
-				},
-			},
-		}
+	logger := interactionLogger(event)
+
+	err := event.DeferCreateMessage(true)
+	if err != nil {
+		logger.Error(err)
+		return
 	}
-	googleSheetsWriteReqs <- &SheetBatchUpdate{
-		ID: spreadsheet.SpreadsheetId,
-		Batch: &sheets.BatchUpdateSpreadsheetRequest{
-			Requests: requests,
-		},
+	var plan *SyncPlan
+	if eventData.Bool("dry_run") {
+		plan = &SyncPlan{}
 	}
-	log.Debug("formatting successfully synced")
-	content := "Formatting successfully synced"
+	err = syncFilePermissions(withLogger(ctx, logger), plan)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if plan != nil {
+		err = respondWithSyncPlan(event, "File permission sync", plan)
+		if err != nil {
+			logger.Error(err)
+		}
+		return
+	}
+	logger.Debug("file permissions successfully synced")
+
+	content := "File permissions successfully synced"
 	_, err = event.Client().Rest().UpdateInteractionResponse(
 		event.ApplicationID(),
 		event.Token(),
@@ -318,248 +335,284 @@ func syncSpreadsheetStylingHandler(event *events.ApplicationCommandInteractionCr
 		},
 	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
 }
 
-func syncFilePermsHandler(event *events.ApplicationCommandInteractionCreate) {
+func rebuildSpreadsheetHandler(event *events.ApplicationCommandInteractionCreate) {
 	eventData := event.SlashCommandInteractionData()
-	if eventData.CommandName() != "sync_file_perms" {
+	if eventData.CommandName() != "rebuild_spreadsheet" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
+		return
+	}
+	tracker, err := optionTracker(ctx, eventData, "role")
+	if err != nil {
+		logger.Error(err)
+		content := err.Error()
+		_, err = event.Client().Rest().UpdateInteractionResponse(
+			event.ApplicationID(),
+			event.Token(),
+			discord.MessageUpdate{
+				Content: &content,
+			},
+		)
+		if err != nil {
+			logger.Error(err)
+		}
+		return
+	}
+	fileID, err := rebuildSpreadsheet(withLogger(ctx, logger), tracker, eventData.Bool("trash_old"))
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	// members who joined since their last sync are only in discord
+	members, err := event.Client().Rest().GetMembers(*event.GuildID(), guildMemberCountRequestLimit, nullSnowflake)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	err = syncRoleMembers(withLogger(ctx, logger), tracker, members, nil)
+	if err != nil {
+		logger.Error(err)
 		return
 	}
-	dbcon, err := dbpool.Acquire(ctx)
+	// the members of the role get their linked email addresses shared with the new file
+	err = updateLinksAccess(withLogger(ctx, logger), []*Tracker{tracker}, members)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	defer dbcon.Release()
-	// get file id
-	var fileID *string
-	row := dbcon.QueryRow(
-		ctx,
-		"select file_gcp_id from bot.file_ref",
+	logger.Debugf("spreadsheet successfully rebuilt: %s", *fileID)
+	content := fmt.Sprintf("Spreadsheet successfully rebuilt: https://docs.google.com/spreadsheets/d/%s", *fileID)
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
 	)
-	err = row.Scan(&fileID)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	if fileID == nil {
-		log.Error(err)
+}
+
+func adoptSpreadsheetHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "adopt_spreadsheet" {
 		return
 	}
-	// get perms from db
-	rows, err := dbcon.Query(ctx, `select perm_gcp_id, email, role, role_type from bot.permissions`)
+	logger := interactionLogger(event)
+
+	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	dbPerms := map[string]*drive.Permission{}
-	for rows.Next() {
-		var id string
-		var email string
-		var role string
-		var roleType string
-		err = rows.Scan(&id, &email, &role, &roleType)
+	var content string
+	update := discord.MessageUpdate{
+		Content: &content,
+	}
+	fileID, err := parseSpreadsheetID(eventData.String("spreadsheet"))
+	tracker, trackerErr := optionTracker(ctx, eventData, "role")
+	if err != nil {
+		content = err.Error()
+	} else if trackerErr != nil {
+		content = trackerErr.Error()
+	} else if report, err := adoptSpreadsheet(withLogger(ctx, logger), tracker, fileID); err != nil {
+		var inUse *FileInUseError
+		if errors.As(err, &inUse) {
+			content = fmt.Sprintf("Spreadsheet %s is already the spreadsheet of <@&%s>, unset that role first", inUse.FileID, inUse.RoleID)
+		} else {
+			logger.Error(err)
+			content = "The spreadsheet could not be adopted, see the logs for details"
+		}
+	} else {
+		translations, err := getTranslations(ctx)
 		if err != nil {
-			log.Error(err)
-			return
+			// the report is still useful with the english names
+			logger.Error(err)
 		}
-		dbPerms[id] = &drive.Permission{
-			EmailAddress: email,
-			Role:         role,
-			Type:         roleType,
+		report.localize(translations, localeLanguage(event.Locale()))
+		rendered := report.Render()
+		content = fmt.Sprintf("```\n%s```", rendered)
+		if len(content) > discordMessageMaxLength {
+			content = "Spreadsheet adopted, see the attached report"
+			update.Files = []*discord.File{
+				discord.NewFile("adoption.txt", "", strings.NewReader(rendered)),
+			}
 		}
 	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		update,
+	)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+}
+
+func shareHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "share" || eventData.SubCommandName == nil {
+		return
+	}
+	logger := interactionLogger(event)
 
-	// get perms from the perm file
-	permsOnDisk, err := GetPermissions(mountSpreadsheetPermissionsFilepath)
+	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	// get perms from
-	// determine perms that need to be added
-	permsToAdd := []*drive.Permission{}
-	for i := 0; i < len(permsOnDisk); i++ {
-		alreadyExists := false
-		for _, dbPerm := range dbPerms {
-			if permsOnDisk[i].Type == dbPerm.Type && permsOnDisk[i].Type == "anyone" {
-				// the anyone permission
-				alreadyExists = true
-				break
-			} else if strings.EqualFold(permsOnDisk[i].EmailAddress, dbPerm.EmailAddress) {
-				// all other permissions
-				alreadyExists = true
-				break
-			}
+	shareCtx := withLogger(ctx, logger)
+	email := strings.TrimSpace(eventData.String("email"))
+	var content string
+	var fileID FileID
+	tracker, err := optionTracker(shareCtx, eventData, "tracked_role")
+	if err == nil {
+		fileID, err = trackerFileID(tracker)
+	}
+	switch {
+	case err != nil:
+		// reported below
+	case *eventData.SubCommandName == "add":
+		var p *drive.Permission
+		p, err = shareFile(shareCtx, fileID, email, eventData.String("role"))
+		if err == nil {
+			content = fmt.Sprintf("The spreadsheet is shared with %s as a %s", email, p.Role)
 		}
-		if !alreadyExists {
-			permsToAdd = append(permsToAdd, permsOnDisk[i])
-			log.Debugf(
-				"file permission queued to be created (email:%s,type:%s,role:%s)",
-				permsOnDisk[i].EmailAddress,
-				permsOnDisk[i].Type,
-				permsOnDisk[i].Role,
-			)
+	case *eventData.SubCommandName == "remove":
+		err = unshareFile(shareCtx, fileID, email)
+		if err == nil {
+			content = fmt.Sprintf("The spreadsheet is no longer shared with %s", email)
 		}
-	}
-	// determine perms that need to be updated
-	permsToUpdate := map[string]*drive.Permission{}
-	for i := 0; i < len(permsOnDisk); i++ {
-		shouldBeUpdated := false
-		var id string
-		for dbPermID, dbPerm := range dbPerms {
-			if permsOnDisk[i].Type == dbPerm.Type && permsOnDisk[i].Type == "anyone" {
-				// the anyone permission
-				if permsOnDisk[i].Role != dbPerm.Role {
-					shouldBeUpdated = true
-					id = dbPermID
-					break
-				}
-			} else if strings.EqualFold(permsOnDisk[i].EmailAddress, dbPerm.EmailAddress) {
-				// all other permissions
-				if permsOnDisk[i].Role != dbPerm.Role {
-					shouldBeUpdated = true
-					id = dbPermID
-					break
-				}
+	case *eventData.SubCommandName == "list":
+		var shares []Share
+		shares, err = listShares(shareCtx, fileID)
+		if err == nil {
+			lines := make([]string, len(shares))
+			for i := 0; i < len(shares); i++ {
+				lines[i] = shares[i].String()
 			}
+			content = fmt.Sprintf("```\n%s\n```", strings.Join(lines, "\n"))
 		}
-		if shouldBeUpdated {
-			permsToUpdate[id] = &drive.Permission{
-				Role: permsOnDisk[i].Role,
-			}
-			log.Debugf(
-				"file permission queued to be updated (email:%s,type:%s,role:%s)",
-				permsOnDisk[i].EmailAddress,
-				permsOnDisk[i].Type,
-				permsOnDisk[i].Role,
-			)
+	case *eventData.SubCommandName == "transfer_ownership":
+		var pending bool
+		pending, err = transferFileOwnership(shareCtx, fileID, email)
+		if err == nil && pending {
+			content = fmt.Sprintf("%s was asked to accept the ownership of the spreadsheet in google drive", email)
+		} else if err == nil {
+			content = fmt.Sprintf("%s now owns the spreadsheet", email)
 		}
 	}
-	// determine perms that need to be deleted
-	permIDsToDelete := []string{}
-	for dbPermID, dbPerm := range dbPerms {
-		isNotInPermsOnDisk := true
-		for i := 0; i < len(permsOnDisk); i++ {
-			if permsOnDisk[i].Type == dbPerm.Type && permsOnDisk[i].Type == "anyone" {
-				// the anyone permission
-				isNotInPermsOnDisk = false
-				break
-			} else if permsOnDisk[i].EmailAddress == dbPerm.EmailAddress {
-				// all other permissions
-				isNotInPermsOnDisk = false
-				break
-			}
-		}
-		if isNotInPermsOnDisk {
-			permIDsToDelete = append(permIDsToDelete, dbPermID)
-			log.Debugf(
-				"file permission queued to be deleted (email:%s,type:%s,role:%s)",
-				dbPerm.EmailAddress,
-				dbPerm.Type,
-				dbPerm.Role,
-			)
-		}
-	}
-	// delete perms
-	for i := 0; i < len(permIDsToDelete); i++ {
-		err = gdriveSvc.Permissions.Delete(*fileID, permIDsToDelete[i]).SupportsAllDrives(true).Do()
-		if err != nil {
-			log.Error(err)
-			return
-		}
+	if err != nil {
+		logger.Error(err)
+		content = fmt.Sprintf("Sharing could not be changed: %s", err)
 	}
-	log.Debug("perms deleted")
-	// update perms
-	for permID, perm := range permsToUpdate {
-		_, err = gdriveSvc.Permissions.Update(*fileID, permID, perm).SupportsAllDrives(true).Do()
-		if err != nil {
-			log.Error(err)
-			return
-		}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
+		return
 	}
-	log.Debug("perms updated")
-	// create new perms
-	newPermMap := map[string]*drive.Permission{}
-	for i := 0; i < len(permsToAdd); i++ {
-		p, err := gdriveSvc.Permissions.Create(*fileID, permsToAdd[i]).SupportsAllDrives(true).Do()
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		newPermMap[p.Id] = &drive.Permission{
-			EmailAddress: permsToAdd[i].EmailAddress,
-			Type:         p.Type,
-			Role:         p.Role,
-		}
+}
+
+func linkEmailHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "link_email" {
+		return
 	}
-	log.Debug("perms added")
+	logger := interactionLogger(event)
 
-	tx, err := dbcon.Begin(ctx)
+	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	// delete perms from db
-	for i := 0; i < len(permIDsToDelete); i++ {
-		_, err = tx.Exec(ctx, `delete from bot.permissions where perm_gcp_id=$1`, permIDsToDelete[i])
-		if err != nil {
-			log.Error(err)
-			return
-		}
+	content, err := linkEmail(withLogger(ctx, logger), event, eventData)
+	if err != nil {
+		logger.Error(err)
+		content = "Your email address could not be linked, please try again later"
 	}
-	log.Debug("perms queued to be deleted from db")
-	// add perms to db
-	for id, perm := range newPermMap {
-		_, err = tx.Exec(
-			ctx,
-			`insert into bot.permissions(file_gcp_id,perm_gcp_id,email,role,role_type) values($1,$2,$3,$4,$5)`,
-			*fileID,
-			id,
-			perm.EmailAddress,
-			perm.Role,
-			perm.Type,
-		)
-		if err != nil {
-			log.Error(err)
-			return
-		}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
+		return
 	}
-	log.Debug("perms queued to be added to db")
-	// update perms in db
-	for permID, perm := range permsToUpdate {
-		_, err = tx.Exec(
-			ctx,
-			`update bot.permissions set
-				role=$1
-			where perm_gcp_id=$2`,
-			perm.Role,
-			permID,
-		)
-		if err != nil {
-			log.Error(err)
-			return
-		}
+}
+
+// linkEmail gets the reply to /link_email. the returned error is for failures that are
+// not the member's to fix.
+func linkEmail(ctx context.Context, event *events.ApplicationCommandInteractionCreate, eventData discord.SlashCommandInteractionData) (string, error) {
+	if !eventData.Bool("consent") {
+		return "Your email address was not linked, it is only stored when you consent to it", nil
+	}
+	member := event.Member()
+	if member == nil {
+		return "Use this command in the server", nil
+	}
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	if !hasTrackedRole(trackers, member.RoleIDs) {
+		return "Only members with a tracked role can get access to the spreadsheets", nil
+	}
+	email, err := validateLinkEmail(ctx, eventData.String("email"))
+	if err != nil {
+		return err.Error(), nil
 	}
-	log.Debug("perms queued to be updated in db")
-	err = tx.Commit(ctx)
+	granted, err := linkMemberEmail(ctx, member.GuildID, MemberID(member.User.ID.String()), email, member.RoleIDs)
 	if err != nil {
-		log.Error(err)
+		return "", fmt.Errorf("linkMemberEmail() error: [%w]", err)
+	}
+	if granted == 0 {
+		return fmt.Sprintf("%s is linked, it already had access to the spreadsheets of your roles", email), nil
+	}
+	return fmt.Sprintf("%s is linked and can now open %d spreadsheet(s)", email, granted), nil
+}
+
+func unlinkEmailHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "unlink_email" {
 		return
 	}
-	dbcon.Release()
-	log.Debug("file permissions successfully synced")
+	logger := interactionLogger(event)
 
-	content := "File permissions successfully synced"
+	err := event.DeferCreateMessage(true)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	content := "You have no linked email address"
+	unlinked, err := unlinkMemberEmail(withLogger(ctx, logger), MemberID(event.User().ID.String()))
+	if err != nil {
+		logger.Error(err)
+		content = "Your email address could not be unlinked, please try again later"
+	} else if unlinked {
+		content = "Your email address was unlinked and no longer has access to the spreadsheets"
+	}
 	_, err = event.Client().Rest().UpdateInteractionResponse(
 		event.ApplicationID(),
 		event.Token(),
@@ -568,7 +621,7 @@ func syncFilePermsHandler(event *events.ApplicationCommandInteractionCreate) {
 		},
 	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
 }
@@ -578,23 +631,27 @@ func anyXivCharacterSearchHandler(event *events.ApplicationCommandInteractionCre
 	if eventData.CommandName() != "any_xiv_char_search" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
 	xivCharName := eventData.String("xiv_character_name")
 	xivDiscUser := eventData.User("discord_user")
 	err = xivCharacterSearch(
+		withLogger(ctx, logger),
 		xivDiscUser,
+		false,
 		xivCharName,
+		0,
 		event.Client(),
 		event.ApplicationID(),
 		event.Token(),
 	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 	}
 }
 
@@ -603,23 +660,27 @@ func xivCharacterSearchHandler(event *events.ApplicationCommandInteractionCreate
 	if eventData.CommandName() != "xiv_char_search" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
 	xivCharName := eventData.String("xiv_character_name")
 	xivDiscUser := event.Member().User
 	err = xivCharacterSearch(
+		withLogger(ctx, logger),
 		xivDiscUser,
+		true,
 		xivCharName,
+		0,
 		event.Client(),
 		event.ApplicationID(),
 		event.Token(),
 	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 	}
 }
 
@@ -628,15 +689,17 @@ func mapAnyXivCharacterIDHandler(event *events.ApplicationCommandInteractionCrea
 	if eventData.CommandName() != "map_any_xiv_char_id" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
 	xivCharID := eventData.String("xiv_character_id")
 	xivDiscUser := eventData.User("discord_user")
 	err = mapXivCharacterID(
+		withLogger(ctx, logger),
 		xivDiscUser,
 		xivCharID,
 		event.Client(),
@@ -644,7 +707,7 @@ func mapAnyXivCharacterIDHandler(event *events.ApplicationCommandInteractionCrea
 		event.Token(),
 	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 	}
 }
 
@@ -653,23 +716,300 @@ func mapXivCharacterIDHandler(event *events.ApplicationCommandInteractionCreate)
 	if eventData.CommandName() != "map_xiv_char_id" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
 	xivCharID := eventData.String("xiv_character_id")
-	xivDiscUser := event.Member().User
-	err = mapXivCharacterID(
-		xivDiscUser,
-		xivCharID,
-		event.Client(),
+	content, err := startXivCharacterVerification(withLogger(ctx, logger), event.Member().User, xivCharID, false)
+	if err != nil {
+		logger.Error(err)
+		content = "Failed to start the character verification"
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
 		event.ApplicationID(),
 		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
 	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
+	}
+}
+
+func verifyXivCharacterHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "verify_xiv_char" {
+		return
+	}
+	logger := interactionLogger(event)
+
+	err := event.DeferCreateMessage(true)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	content, err := verifyXivCharacter(withLogger(ctx, logger), event.Member().User)
+	if err != nil {
+		logger.Error(err)
+		content = "Failed to verify the character"
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func addXivAltHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "add_xiv_alt" {
+		return
+	}
+	logger := interactionLogger(event)
+
+	err := event.DeferCreateMessage(true)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	xivCharID := eventData.String("xiv_character_id")
+	content, err := startXivCharacterVerification(withLogger(ctx, logger), event.Member().User, xivCharID, true)
+	if err != nil {
+		logger.Error(err)
+		content = "Failed to start the character verification"
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func removeXivAltHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "remove_xiv_alt" {
+		return
+	}
+	logger := interactionLogger(event)
+
+	err := event.DeferCreateMessage(true)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	xivCharID := eventData.String("xiv_character_id")
+	removed, err := removeXivAlt(withLogger(ctx, logger), MemberID(event.Member().User.ID.String()), xivCharID)
+	var content string
+	switch {
+	case err != nil:
+		logger.Error(err)
+		content = "Failed to remove the alt"
+	case !removed:
+		content = fmt.Sprintf("Character ID %s is not one of your alts", xivCharID)
+	default:
+		content = fmt.Sprintf("Character ID %s is no longer your alt", xivCharID)
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func setPrimaryXivCharacterHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "set_primary_xiv_char" {
+		return
+	}
+	logger := interactionLogger(event)
+
+	err := event.DeferCreateMessage(true)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	xivCharID := eventData.String("xiv_character_id")
+	changed, err := setPrimaryXivCharacter(withLogger(ctx, logger), MemberID(event.Member().User.ID.String()), xivCharID)
+	var content string
+	switch {
+	case err != nil:
+		logger.Error(err)
+		content = "Failed to change the primary character"
+	case !changed:
+		content = fmt.Sprintf("Character ID %s is not one of your alts, add it with /add_xiv_alt first", xivCharID)
+	default:
+		content = fmt.Sprintf("Character ID %s is now your primary character", xivCharID)
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func xivCharactersHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "xiv_chars" {
+		return
+	}
+	logger := interactionLogger(event)
+
+	err := event.DeferCreateMessage(true)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	content, err := xivCharacters(withLogger(ctx, logger), event)
+	if err != nil {
+		logger.Error(err)
+		content = "Failed to get your characters"
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// xivCharacters gets the reply to /xiv_chars, in the ownership mode of the guild
+func xivCharacters(ctx context.Context, event *events.ApplicationCommandInteractionCreate) (string, error) {
+	memberID := MemberID(event.Member().User.ID.String())
+	mode, err := getGuildOwnershipMode(ctx, *event.GuildID())
+	if err != nil {
+		return "", fmt.Errorf("getGuildOwnershipMode() error: [%w]", err)
+	}
+	characters, err := getMemberCharacters(ctx, memberID)
+	if err != nil {
+		return "", fmt.Errorf("getMemberCharacters() error: [%w]", err)
+	}
+	characterCollectibles, err := getCharacterCollectibles(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getCharacterCollectibles() error: [%w]", err)
+	}
+	owned, err := getOwnedCollectibles(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getOwnedCollectibles() error: [%w]", err)
+	}
+	collectibles, err := getCollectibles(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getCollectibles() error: [%w]", err)
+	}
+	collectibleMap := map[CollectibleID]*Collectible{}
+	for i := 0; i < len(collectibles); i++ {
+		collectibleMap[collectibles[i].ID] = collectibles[i]
+	}
+	lang := localeLanguage(event.Locale())
+	return renderMemberCharacters(characters[memberID], characterCollectibles[memberID], owned[memberID], collectibleMap, mode, lang), nil
+}
+
+func setOwnershipModeHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "set_ownership_mode" {
+		return
+	}
+	logger := interactionLogger(event)
+
+	err := event.DeferCreateMessage(true)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	var content string
+	mode, err := parseOwnershipMode(eventData.String("mode"))
+	if err != nil {
+		content = fmt.Sprintf("mode %s", err)
+	} else {
+		err = setGuildOwnershipMode(withLogger(ctx, logger), *event.GuildID(), mode)
+		if err == nil {
+			err = syncOwnershipNotes(withLogger(ctx, logger), *event.GuildID())
+		}
+		if err != nil {
+			logger.Error(err)
+			content = "Failed to set the ownership mode"
+		} else {
+			content = fmt.Sprintf("Collectible ownership is now shown as %s", mode)
+		}
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func setSpreadsheetLanguageHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "set_spreadsheet_language" {
+		return
+	}
+	logger := interactionLogger(event)
+
+	err := event.DeferCreateMessage(true)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	var content string
+	lang, err := parseLanguage(eventData.String("language"))
+	if err != nil {
+		content = fmt.Sprintf("language %s", err)
+	} else {
+		err = setGuildSpreadsheetLanguage(withLogger(ctx, logger), *event.GuildID(), lang)
+		if err == nil {
+			// the headers and sheet titles are renamed with the styling
+			err = syncGuildStyling(withLogger(ctx, logger), *event.GuildID())
+		}
+		if err != nil {
+			logger.Error(err)
+			content = "Failed to set the spreadsheet language"
+		} else {
+			content = fmt.Sprintf("The spreadsheets now name bosses, collectibles and expansions in %s", lang)
+		}
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
 	}
 }
 
@@ -678,15 +1018,29 @@ func scanXivMountsHandler(event *events.ApplicationCommandInteractionCreate) {
 	if eventData.CommandName() != "scan_xiv_mounts" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	err = xivMountScan()
+	var plan *SyncPlan
+	if eventData.Bool("dry_run") {
+		plan = &SyncPlan{}
+	}
+	start := time.Now()
+	err = xivCollectibleScan(withLogger(ctx, logger.WithField("job_id", uuid.New().String())), nullSnowflake, plan)
+	observeScan("mount", start, err)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
+		return
+	}
+	if plan != nil {
+		err = respondWithSyncPlan(event, "Mount scan", plan)
+		if err != nil {
+			logger.Error(err)
+		}
 		return
 	}
 	content := "Force mount scan completed"
@@ -698,7 +1052,7 @@ func scanXivMountsHandler(event *events.ApplicationCommandInteractionCreate) {
 		},
 	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 	}
 }
 
@@ -707,21 +1061,22 @@ func updateMemberNamesHandler(event *events.ApplicationCommandInteractionCreate)
 	if eventData.CommandName() != "update_member_names" {
 		return
 	}
+	logger := interactionLogger(event)
 
 	err := event.DeferCreateMessage(true)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
 	// get all members from discord
 	discMembers, err := event.Client().Rest().GetMembers(*event.GuildID(), guildMemberCountRequestLimit, nullSnowflake)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	err = discordNicknameScan(discMembers)
+	err = discordNicknameScan(withLogger(ctx, logger), *event.GuildID(), discMembers)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
 	content := "Names updated in spreadsheet"
@@ -733,6 +1088,75 @@ func updateMemberNamesHandler(event *events.ApplicationCommandInteractionCreate)
 		},
 	)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 	}
 }
+
+func workerStatusHandler(event *events.ApplicationCommandInteractionCreate) {
+	eventData := event.SlashCommandInteractionData()
+	if eventData.CommandName() != "worker_status" {
+		return
+	}
+	logger := interactionLogger(event)
+
+	err := event.DeferCreateMessage(true)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	states := workers.States()
+	var content string
+	if len(states) == 0 {
+		content = "No workers have been started"
+	} else {
+		lines := make([]string, len(states))
+		for i := 0; i < len(states); i++ {
+			line := fmt.Sprintf(
+				"%s: %s since <t:%d:R> (restarts: %d)",
+				states[i].Name,
+				states[i].Status,
+				states[i].StartedAt.Unix(),
+				states[i].Restarts,
+			)
+			if states[i].LastError != "" {
+				line = fmt.Sprintf("%s, last error: %s", line, strings.SplitN(states[i].LastError, "\n", 2)[0])
+			}
+			lines[i] = line
+		}
+		content = strings.Join(lines, "\n")
+	}
+	_, err = event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		discord.MessageUpdate{
+			Content: &content,
+		},
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+const discordMessageMaxLength = 2000
+
+// respondWithSyncPlan shows the diff of a dry run in the response, or attaches it when
+// it is too long for a message
+func respondWithSyncPlan(event *events.ApplicationCommandInteractionCreate, title string, plan *SyncPlan) error {
+	diff := plan.Render()
+	content := fmt.Sprintf("%s dry run, nothing was changed:\n```diff\n%s```", title, diff)
+	update := discord.MessageUpdate{
+		Content: &content,
+	}
+	if len(content) > discordMessageMaxLength {
+		content = fmt.Sprintf("%s dry run, nothing was changed: %d changes, see the attached diff", title, len(plan.Changes))
+		update.Files = []*discord.File{
+			discord.NewFile("dry-run.diff", "", strings.NewReader(diff)),
+		}
+	}
+	_, err := event.Client().Rest().UpdateInteractionResponse(
+		event.ApplicationID(),
+		event.Token(),
+		update,
+	)
+	return err
+}
@@ -18,17 +18,81 @@ func createSlashCommands() []discord.ApplicationCommandCreate {
 					Required:    true,
 					Description: "the role to set",
 				},
+				discord.ApplicationCommandOptionString{
+					Name:        "title",
+					Description: "The title of the role's spreadsheet",
+				},
+				discord.ApplicationCommandOptionString{
+					Name:         "expansions",
+					Description:  "Comma separated expansions that get a sheet, every expansion when empty",
+					Autocomplete: true,
+				},
 			},
 		},
 		discord.SlashCommandCreate{
 			Name:                     "unset_role",
-			Description:              "Unset the mount farm role to watch for discord member updates",
+			Description:              "Unset a mount farm role to stop watching it for discord member updates",
+			DefaultMemberPermissions: &adminPerm,
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionRole{
+					Name:        "role",
+					Required:    true,
+					Description: "the role to unset",
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:                     "set_role_styling",
+			Description:              "Sets the colors of a boss in the spreadsheet of a role",
 			DefaultMemberPermissions: &adminPerm,
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionRole{
+					Name:        "role",
+					Required:    true,
+					Description: "The watched role",
+				},
+				discord.ApplicationCommandOptionString{
+					Name:         "boss",
+					Required:     true,
+					Description:  "The name of the boss",
+					Autocomplete: true,
+				},
+				discord.ApplicationCommandOptionString{
+					Name:        "header_background",
+					Description: "The header background color, as a hex color like #1f2a44",
+				},
+				discord.ApplicationCommandOptionString{
+					Name:        "header_foreground",
+					Description: "The header text color, as a hex color",
+				},
+				discord.ApplicationCommandOptionString{
+					Name:        "checkbox_background",
+					Description: "The checkbox background color, as a hex color",
+				},
+				discord.ApplicationCommandOptionString{
+					Name:        "checkbox_foreground",
+					Description: "The checkbox color, as a hex color",
+				},
+				discord.ApplicationCommandOptionBool{
+					Name:        "reset",
+					Description: "Go back to the default colors of the boss",
+				},
+			},
 		},
 		discord.SlashCommandCreate{
 			Name:                     "spreadsheet_discord_member_sync",
-			Description:              "Syncs the spreadsheet with discord member data",
+			Description:              "Syncs the spreadsheets with discord member data",
 			DefaultMemberPermissions: &adminPerm,
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionBool{
+					Name:        "dry_run",
+					Description: "Only show what would change without changing anything",
+				},
+				discord.ApplicationCommandOptionRole{
+					Name:        "role",
+					Description: "Only sync the spreadsheet of this role",
+				},
+			},
 		},
 		discord.SlashCommandCreate{
 			Name:                     "sync_spreadsheet_styling",
@@ -39,10 +103,139 @@ func createSlashCommands() []discord.ApplicationCommandCreate {
 			Name:                     "sync_file_perms",
 			Description:              "Syncs the spreadsheet file permissions with the stored file permissions data",
 			DefaultMemberPermissions: &adminPerm,
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionBool{
+					Name:        "dry_run",
+					Description: "Only show what would change without changing anything",
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:                     "rebuild_spreadsheet",
+			Description:              "Builds a new spreadsheet from the stored member and mount data",
+			DefaultMemberPermissions: &adminPerm,
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionBool{
+					Name:        "trash_old",
+					Description: "Move the previous spreadsheet to the Google Drive trash",
+				},
+				discord.ApplicationCommandOptionRole{
+					Name:        "role",
+					Description: "The role whose spreadsheet is rebuilt, when several roles are watched",
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:                     "adopt_spreadsheet",
+			Description:              "Takes over an existing mount spreadsheet and imports its checkboxes",
+			DefaultMemberPermissions: &adminPerm,
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionString{
+					Name:        "spreadsheet",
+					Description: "The ID or URL of the spreadsheet, shared with the bot's service account as an editor",
+					Required:    true,
+				},
+				discord.ApplicationCommandOptionRole{
+					Name:        "role",
+					Description: "The role that adopts the spreadsheet, when several roles are watched",
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:                     "share",
+			Description:              "Manages who the spreadsheet is shared with",
+			DefaultMemberPermissions: &adminPerm,
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "add",
+					Description: "Shares the spreadsheet with an email address, or changes its role",
+					Options: []discord.ApplicationCommandOption{
+						discord.ApplicationCommandOptionString{
+							Name:        "email",
+							Description: "The email address of the google account",
+							Required:    true,
+						},
+						discord.ApplicationCommandOptionString{
+							Name:        "role",
+							Description: "What the account can do with the spreadsheet",
+							Required:    true,
+							Choices: []discord.ApplicationCommandOptionChoiceString{
+								{Name: "reader", Value: "reader"},
+								{Name: "commenter", Value: "commenter"},
+								{Name: "writer", Value: "writer"},
+							},
+						},
+						discord.ApplicationCommandOptionRole{
+							Name:        "tracked_role",
+							Description: "The role whose spreadsheet is shared, when several roles are watched",
+						},
+					},
+				},
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "remove",
+					Description: "Stops sharing the spreadsheet with an email address",
+					Options: []discord.ApplicationCommandOption{
+						discord.ApplicationCommandOptionString{
+							Name:        "email",
+							Description: "The email address of the google account",
+							Required:    true,
+						},
+						discord.ApplicationCommandOptionRole{
+							Name:        "tracked_role",
+							Description: "The role whose spreadsheet is shared, when several roles are watched",
+						},
+					},
+				},
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "list",
+					Description: "Lists who the spreadsheet is shared with",
+					Options: []discord.ApplicationCommandOption{
+						discord.ApplicationCommandOptionRole{
+							Name:        "tracked_role",
+							Description: "The role whose spreadsheet is shared, when several roles are watched",
+						},
+					},
+				},
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "transfer_ownership",
+					Description: "Makes an email address the owner of the spreadsheet",
+					Options: []discord.ApplicationCommandOption{
+						discord.ApplicationCommandOptionString{
+							Name:        "email",
+							Description: "The email address of the google account",
+							Required:    true,
+						},
+						discord.ApplicationCommandOptionRole{
+							Name:        "tracked_role",
+							Description: "The role whose spreadsheet is shared, when several roles are watched",
+						},
+					},
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:        "link_email",
+			Description: "Gives your google account access to the spreadsheets of the tracked roles you have",
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionString{
+					Name:        "email",
+					Description: "The gmail or google workspace address of your google account",
+					Required:    true,
+				},
+				discord.ApplicationCommandOptionBool{
+					Name:        "consent",
+					Description: "I agree that the bot stores this email address and shares the spreadsheets with it",
+					Required:    true,
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:        "unlink_email",
+			Description: "Removes the access of your linked email address and forgets it",
 		},
 		discord.SlashCommandCreate{
 			Name:                     "any_xiv_char_search",
-			Description:              "Attempts to search for a FF14 character's ID by the given character name and save it",
+			Description:              "Searches for a FF14 character by name to pick and save for the given discord user",
 			DefaultMemberPermissions: &adminPerm,
 			Options: []discord.ApplicationCommandOption{
 				discord.ApplicationCommandOptionUser{
@@ -51,20 +244,22 @@ func createSlashCommands() []discord.ApplicationCommandCreate {
 					Required:    true,
 				},
 				discord.ApplicationCommandOptionString{
-					Name:        "xiv_character_name",
-					Description: "The entire name of a FF14 character",
-					Required:    true,
+					Name:         "xiv_character_name",
+					Description:  "The entire name of a FF14 character",
+					Required:     true,
+					Autocomplete: true,
 				},
 			},
 		},
 		discord.SlashCommandCreate{
 			Name:        "xiv_char_search",
-			Description: "Attempts to search for the user's FF14 character's ID by the given character name and save it",
+			Description: "Searches for the user's FF14 character by name to pick and verify it",
 			Options: []discord.ApplicationCommandOption{
 				discord.ApplicationCommandOptionString{
-					Name:        "xiv_character_name",
-					Description: "The entire name of a FF14 character",
-					Required:    true,
+					Name:         "xiv_character_name",
+					Description:  "The entire name of a FF14 character",
+					Required:     true,
+					Autocomplete: true,
 				},
 			},
 		},
@@ -79,32 +274,123 @@ func createSlashCommands() []discord.ApplicationCommandCreate {
 					Required:    true,
 				},
 				discord.ApplicationCommandOptionString{
-					Name:        "xiv_character_id",
-					Description: "The FF14 character's ID",
-					Required:    true,
+					Name:         "xiv_character_id",
+					Description:  "The FF14 character's ID",
+					Required:     true,
+					Autocomplete: true,
 				},
 			},
 		},
 		discord.SlashCommandCreate{
 			Name:        "map_xiv_char_id",
-			Description: "Maps a FF14 character's ID to the discord user that used the command",
+			Description: "Starts verifying the FF14 character of the discord user that used the command",
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionString{
+					Name:         "xiv_character_id",
+					Description:  "The FF14 character's ID",
+					Required:     true,
+					Autocomplete: true,
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:        "verify_xiv_char",
+			Description: "Checks the lodestone bio for the verification code and saves the FF14 character",
+		},
+		discord.SlashCommandCreate{
+			Name:        "add_xiv_alt",
+			Description: "Starts verifying an alt FF14 character of the discord user that used the command",
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionString{
+					Name:         "xiv_character_id",
+					Description:  "The FF14 character's ID",
+					Required:     true,
+					Autocomplete: true,
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:        "remove_xiv_alt",
+			Description: "Unlinks an alt FF14 character from the discord user that used the command",
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionString{
+					Name:         "xiv_character_id",
+					Description:  "The FF14 character's ID",
+					Required:     true,
+					Autocomplete: true,
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:        "set_primary_xiv_char",
+			Description: "Makes an alt the primary FF14 character of the discord user that used the command",
 			Options: []discord.ApplicationCommandOption{
 				discord.ApplicationCommandOptionString{
-					Name:        "xiv_character_id",
-					Description: "The FF14 character's ID",
+					Name:         "xiv_character_id",
+					Description:  "The FF14 character's ID",
+					Required:     true,
+					Autocomplete: true,
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:        "xiv_chars",
+			Description: "Lists the FF14 characters of the discord user that used the command and what they own",
+		},
+		discord.SlashCommandCreate{
+			Name:                     "set_ownership_mode",
+			Description:              "Sets whether collectibles owned by alts are shown per character or for any character",
+			DefaultMemberPermissions: &adminPerm,
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionString{
+					Name:        "mode",
+					Description: "How collectible ownership is shown in the spreadsheets and commands",
 					Required:    true,
+					Choices: []discord.ApplicationCommandOptionChoiceString{
+						{Name: "any character", Value: string(OwnershipAny)},
+						{Name: "per character", Value: string(OwnershipPerCharacter)},
+					},
+				},
+			},
+		},
+		discord.SlashCommandCreate{
+			Name:                     "set_spreadsheet_language",
+			Description:              "Sets the language of the boss, collectible and expansion names in the spreadsheets",
+			DefaultMemberPermissions: &adminPerm,
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionString{
+					Name:        "language",
+					Description: "Language of the names in the spreadsheets of the server",
+					Required:    true,
+					Choices: []discord.ApplicationCommandOptionChoiceString{
+						{Name: "English", Value: string(LanguageEnglish)},
+						{Name: "Français", Value: string(LanguageFrench)},
+						{Name: "Deutsch", Value: string(LanguageGerman)},
+						{Name: "日本語", Value: string(LanguageJapanese)},
+					},
 				},
 			},
 		},
 		discord.SlashCommandCreate{
 			Name:                     "scan_xiv_mounts",
-			Description:              "Scans XIVAPI for mounts",
+			Description:              "Scans XIVAPI for mounts, minions and achievements",
 			DefaultMemberPermissions: &adminPerm,
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionBool{
+					Name:        "dry_run",
+					Description: "Only show what would change without changing anything",
+				},
+			},
 		},
 		discord.SlashCommandCreate{
 			Name:                     "update_member_names",
 			Description:              "Updates member names",
 			DefaultMemberPermissions: &adminPerm,
 		},
+		discord.SlashCommandCreate{
+			Name:                     "worker_status",
+			Description:              "Lists the background workers and their state",
+			DefaultMemberPermissions: &adminPerm,
+		},
 	}
 }
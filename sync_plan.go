@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type PlanTarget string
+
+const (
+	PlanTargetSheets PlanTarget = "Google Sheets"
+	PlanTargetDrive  PlanTarget = "Google Drive permissions"
+	PlanTargetDB     PlanTarget = "Database"
+)
+
+func getPlanTargets() []PlanTarget {
+	return []PlanTarget{
+		PlanTargetSheets,
+		PlanTargetDrive,
+		PlanTargetDB,
+	}
+}
+
+type PlanOp string
+
+const (
+	PlanOpCreate PlanOp = "+"
+	PlanOpUpdate PlanOp = "~"
+	PlanOpDelete PlanOp = "-"
+)
+
+type PlannedChange struct {
+	Target      PlanTarget
+	Op          PlanOp
+	Description string
+}
+
+// SyncPlan collects what a sync would change when it runs as a dry run. The syncs
+// apply their changes when they are given a nil plan, and the methods of a nil plan
+// record nothing.
+type SyncPlan struct {
+	SheetUpdates []*SheetBatchUpdate
+	Changes      []PlannedChange
+}
+
+func (p *SyncPlan) add(target PlanTarget, op PlanOp, format string, args ...interface{}) {
+	if p == nil {
+		return
+	}
+	p.Changes = append(p.Changes, PlannedChange{
+		Target:      target,
+		Op:          op,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// planOrQueueSheetBatchUpdate queues the batch for the sheet writer, or only records
+// it when planning a dry run
+func planOrQueueSheetBatchUpdate(plan *SyncPlan, req *SheetBatchUpdate) {
+	if plan == nil {
+		queueSheetBatchUpdate(req)
+		return
+	}
+	plan.SheetUpdates = append(plan.SheetUpdates, req)
+}
+
+// Render formats the planned changes as a diff grouped by what they change
+func (p *SyncPlan) Render() string {
+	if len(p.Changes) == 0 && len(p.SheetUpdates) == 0 {
+		return "no changes\n"
+	}
+	b := strings.Builder{}
+	targets := getPlanTargets()
+	for i := 0; i < len(targets); i++ {
+		lines := []string{}
+		for j := 0; j < len(p.Changes); j++ {
+			if p.Changes[j].Target == targets[i] {
+				lines = append(lines, fmt.Sprintf("%s %s", p.Changes[j].Op, p.Changes[j].Description))
+			}
+		}
+		header := string(targets[i])
+		if targets[i] == PlanTargetSheets && len(p.SheetUpdates) > 0 {
+			numRequests := 0
+			for j := 0; j < len(p.SheetUpdates); j++ {
+				numRequests += len(p.SheetUpdates[j].Batch.Requests)
+			}
+			header = fmt.Sprintf("%s: %d batch updates, %d requests", header, len(p.SheetUpdates), numRequests)
+		} else if len(lines) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(header + "\n")
+		for j := 0; j < len(lines); j++ {
+			b.WriteString(lines[j] + "\n")
+		}
+	}
+	return b.String()
+}
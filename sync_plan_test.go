@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+func TestSyncPlan_Render(t *testing.T) {
+	withChanges := &SyncPlan{}
+	withChanges.add(PlanTargetDB, PlanOpDelete, "bot.member_metadata %s (%s)", "Tataru", "1")
+	withChanges.add(PlanTargetSheets, PlanOpCreate, "add row of %s (%s) to %d sheets", "Krile", "2", 3)
+	planOrQueueSheetBatchUpdate(withChanges, &SheetBatchUpdate{
+		ID: "file",
+		Batch: &sheets.BatchUpdateSpreadsheetRequest{
+			Requests: []*sheets.Request{{}, {}, {}},
+		},
+	})
+	tests := []struct {
+		name string
+		plan *SyncPlan
+		want string
+	}{
+		{
+			name: "no changes",
+			plan: &SyncPlan{},
+			want: "no changes\n",
+		},
+		{
+			name: "changes are grouped by target",
+			plan: withChanges,
+			want: "Google Sheets: 1 batch updates, 3 requests\n" +
+				"+ add row of Krile (2) to 3 sheets\n" +
+				"\n" +
+				"Database\n" +
+				"- bot.member_metadata Tataru (1)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.plan.Render(); got != tt.want {
+				t.Errorf("SyncPlan.Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type RoleID string
+
+// Tracker is a watched role together with the spreadsheet its members are tracked in
+type Tracker struct {
+	RoleID RoleID
+	// the title of the spreadsheet, the configured title when empty
+	Title string
+	// empty until the spreadsheet is built
+	FileID FileID
+	// the expansions that get a sheet, every expansion when empty
+	ExpansionIDs []ExpansionID
+	// empty until the role is seen in its guild
+	GuildID string
+	// the ownership mode of the guild of the role
+	Ownership OwnershipMode
+	// the language of the spreadsheet names, the language of the guild of the role
+	Language Language
+}
+
+func (t *Tracker) spreadsheetTitle() string {
+	if t.Title != "" {
+		return t.Title
+	}
+	return getBotConfig().MountSpreadsheetTitle
+}
+
+// owners gets the names of the characters owning each collectible for the checkbox
+// notes, or nil when the guild of the role does not show ownership per character
+func (t *Tracker) owners(characterOwners map[CollectibleID][]string) func(id CollectibleID) []string {
+	if t.Ownership != OwnershipPerCharacter {
+		return nil
+	}
+	return func(id CollectibleID) []string {
+		return characterOwners[id]
+	}
+}
+
+func (t *Tracker) fileName() string {
+	if t.Title != "" {
+		return t.Title
+	}
+	return getBotConfig().MountSpreadsheetFileName
+}
+
+// getTrackers gets every watched role with its spreadsheet and expansions
+func getTrackers(ctx context.Context) ([]*Tracker, error) {
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select
+			r.role_id,
+			coalesce(r.title, ''),
+			coalesce(f.file_gcp_id, ''),
+			coalesce(array_agg(e.expansion_id) filter (where e.expansion_id is not null), '{}'),
+			coalesce(r.guild_id, ''),
+			coalesce(g.ownership_mode, $1),
+			coalesce(g.spreadsheet_language, $2)
+		from bot.role_ref r
+		left join bot.file_ref f
+		on f.role_id = r.role_id
+		left join bot.role_expansion_map e
+		on e.role_id = r.role_id
+		left join bot.guild_settings g
+		on g.guild_id = r.guild_id
+		group by r.role_id, r.title, f.file_gcp_id, r.guild_id, g.ownership_mode, g.spreadsheet_language
+		order by r.role_id
+		`,
+		string(OwnershipAny),
+		string(getBotConfig().SpreadsheetLanguage),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get trackers error: [%w]", err)
+	}
+	defer rows.Close()
+	trackers := []*Tracker{}
+	for rows.Next() {
+		var roleID string
+		var title string
+		var fileID string
+		var expansionIDs []string
+		var guildID string
+		var ownership string
+		var lang string
+		err = rows.Scan(&roleID, &title, &fileID, &expansionIDs, &guildID, &ownership, &lang)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		t := &Tracker{
+			RoleID:       RoleID(roleID),
+			Title:        title,
+			FileID:       FileID(fileID),
+			ExpansionIDs: make([]ExpansionID, len(expansionIDs)),
+			GuildID:      guildID,
+			Ownership:    OwnershipMode(ownership),
+			Language:     Language(lang),
+		}
+		for i := 0; i < len(expansionIDs); i++ {
+			t.ExpansionIDs[i] = ExpansionID(expansionIDs[i])
+		}
+		trackers = append(trackers, t)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows.Err() error: [%w]", rows.Err())
+	}
+	return trackers, nil
+}
+
+// getTracker gets the tracker of the role, or nil when the role is not watched
+func getTracker(ctx context.Context, roleID RoleID) (*Tracker, error) {
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	for i := 0; i < len(trackers); i++ {
+		if trackers[i].RoleID == roleID {
+			return trackers[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// resolveTracker gets the tracker of the role, or the only tracker when no role is given
+func resolveTracker(ctx context.Context, roleID RoleID) (*Tracker, error) {
+	if roleID != "" {
+		t, err := getTracker(ctx, roleID)
+		if err != nil {
+			return nil, fmt.Errorf("getTracker() error: [%w]", err)
+		}
+		if t == nil {
+			return nil, fmt.Errorf("the role is not watched, set it with /set_role")
+		}
+		return t, nil
+	}
+	trackers, err := getTrackers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getTrackers() error: [%w]", err)
+	}
+	switch len(trackers) {
+	case 0:
+		return nil, fmt.Errorf("no role is watched, set one with /set_role")
+	case 1:
+		return trackers[0], nil
+	}
+	return nil, fmt.Errorf("%d roles are watched, choose one with the role option", len(trackers))
+}
+
+// trackerFileID gets the spreadsheet of the tracker, which has to be built already
+func trackerFileID(t *Tracker) (FileID, error) {
+	if t.FileID == "" {
+		return "", fmt.Errorf("the spreadsheet of role %s is not built yet", t.RoleID)
+	}
+	return t.FileID, nil
+}
+
+// guildTrackers gets the trackers of the roles of the guild. the members and roles of a
+// guild say nothing about the roles of the other guilds.
+func guildTrackers(trackers []*Tracker, guildID string) []*Tracker {
+	selected := []*Tracker{}
+	for i := 0; i < len(trackers); i++ {
+		if trackers[i].GuildID == guildID {
+			selected = append(selected, trackers[i])
+		}
+	}
+	return selected
+}
+
+// selectExpansions gets the expansions with the given IDs, or every expansion when no
+// IDs are given, ordered by their index
+func selectExpansions(expansions []*Expansion, ids []ExpansionID) []*Expansion {
+	selected := []*Expansion{}
+	for i := 0; i < len(expansions); i++ {
+		if len(ids) == 0 {
+			selected = append(selected, expansions[i])
+			continue
+		}
+		for j := 0; j < len(ids); j++ {
+			if expansions[i].ID == ids[j] {
+				selected = append(selected, expansions[i])
+				break
+			}
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Index < selected[j].Index
+	})
+	return selected
+}
+
+// getTrackerExpansions gets the expansions that have a sheet in the spreadsheet of the
+// tracker, ordered by their index
+func getTrackerExpansions(ctx context.Context, t *Tracker) ([]*Expansion, error) {
+	expansions, err := getExpansions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getExpansions() error: [%w]", err)
+	}
+	return selectExpansions(expansions, t.ExpansionIDs), nil
+}
+
+// parseExpansionList reads a comma separated list of expansion names, in any language
+// they are translated to, or IDs. the error lists the names in lang.
+func parseExpansionList(s string, expansions []*Expansion, t Translations, lang Language) ([]ExpansionID, error) {
+	ids := []ExpansionID{}
+	parts := strings.Split(s, ",")
+	for i := 0; i < len(parts); i++ {
+		part := strings.TrimSpace(parts[i])
+		if part == "" {
+			continue
+		}
+		found := false
+		for j := 0; j < len(expansions); j++ {
+			if t.matches(string(expansions[j].ID), string(expansions[j].Name), part) || string(expansions[j].ID) == part {
+				ids = append(ids, expansions[j].ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			names := make([]string, len(expansions))
+			for j := 0; j < len(expansions); j++ {
+				names[j] = t.name(string(expansions[j].ID), lang, string(expansions[j].Name))
+			}
+			return nil, fmt.Errorf("%q is not one of the expansions %s", part, strings.Join(names, ", "))
+		}
+	}
+	return ids, nil
+}
+
+// addTracker starts watching the role. a spreadsheet without a role, left from before
+// several roles could be watched, is given to it.
+func addTracker(ctx context.Context, roleID RoleID, guildID string, title string, expansionIDs []ExpansionID) (*Tracker, error) {
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dbpool.Begin() error: [%w]", err)
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(
+		ctx,
+		`insert into bot.role_ref(role_id,title,guild_id) values($1,$2,$3)`,
+		string(roleID),
+		nullIfEmpty(title),
+		nullIfEmpty(guildID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert into bot.role_ref error: [%w]", err)
+	}
+	for i := 0; i < len(expansionIDs); i++ {
+		_, err = tx.Exec(
+			ctx,
+			`insert into bot.role_expansion_map(role_id,expansion_id) values($1,$2) on conflict do nothing`,
+			string(roleID),
+			string(expansionIDs[i]),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("insert into bot.role_expansion_map error: [%w]", err)
+		}
+	}
+	_, err = tx.Exec(
+		ctx,
+		`
+		update bot.file_ref set role_id = $1
+		where file_gcp_id = (select max(file_gcp_id) from bot.file_ref where role_id is null)
+		`,
+		string(roleID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update bot.file_ref error: [%w]", err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	t, err := getTracker(ctx, roleID)
+	if err != nil {
+		return nil, fmt.Errorf("getTracker() error: [%w]", err)
+	}
+	return t, nil
+}
+
+// linkGuildRoles records the guild of the watched roles among roleIDs that were set
+// before roles were linked to their guild
+func linkGuildRoles(ctx context.Context, guildID string, roleIDs []string) error {
+	_, err := dbpool.Exec(
+		ctx,
+		`update bot.role_ref set guild_id = $1 where guild_id is null and role_id = any($2)`,
+		guildID,
+		roleIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("update bot.role_ref error: [%w]", err)
+	}
+	return nil
+}
+
+// removeTracker stops watching the role. the spreadsheet is kept in google drive, but
+// the bot forgets it together with the members of the role.
+func removeTracker(ctx context.Context, roleID RoleID) (bool, error) {
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("dbpool.Begin() error: [%w]", err)
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `delete from bot.role_ref where role_id = $1`, string(roleID))
+	if err != nil {
+		return false, fmt.Errorf("delete from bot.role_ref error: [%w]", err)
+	}
+	// members of no other role are no longer tracked
+	_, err = tx.Exec(
+		ctx,
+		`
+		delete from bot.member_metadata m
+		where not exists (select 1 from bot.role_member r where r.member_discord_id = m.member_discord_id)
+		`,
+	)
+	if err != nil {
+		return false, fmt.Errorf("delete from bot.member_metadata error: [%w]", err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// getRoleMembersFromDB gets the members tracked in the spreadsheet of the role
+func getRoleMembersFromDB(ctx context.Context, roleID RoleID) ([]*Member, error) {
+	rows, err := dbpool.Query(
+		ctx,
+		`
+		select
+			m.member_discord_id,
+			m.member_name,
+			m.member_xiv_id
+		from bot.member_metadata m
+		inner join bot.role_member r
+		on r.member_discord_id = m.member_discord_id
+		where r.role_id = $1
+		order by m.member_name
+		`,
+		string(roleID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get bot.member_metadata error: [%w]", err)
+	}
+	defer rows.Close()
+	members := []*Member{}
+	for rows.Next() {
+		var memberID string
+		var membername string
+		var xivid *string
+		err = rows.Scan(&memberID, &membername, &xivid)
+		if err != nil {
+			return nil, fmt.Errorf("row scan error: [%w]", err)
+		}
+		members = append(members, &Member{
+			id:    MemberID(memberID),
+			name:  membername,
+			xivid: xivid,
+		})
+	}
+	return members, rows.Err()
+}
+
+// addRoleMember tracks the member in the spreadsheet of the role
+func addRoleMember(ctx context.Context, tx pgx.Tx, roleID RoleID, memberID MemberID, name string) error {
+	_, err := tx.Exec(
+		ctx,
+		`
+		insert into bot.member_metadata(member_discord_id,member_name) values($1,$2)
+		on conflict (member_discord_id) do nothing
+		`,
+		string(memberID),
+		name,
+	)
+	if err != nil {
+		return fmt.Errorf("insert into bot.member_metadata error: [%w]", err)
+	}
+	_, err = tx.Exec(
+		ctx,
+		`insert into bot.role_member(role_id,member_discord_id) values($1,$2) on conflict do nothing`,
+		string(roleID),
+		string(memberID),
+	)
+	if err != nil {
+		return fmt.Errorf("insert into bot.role_member error: [%w]", err)
+	}
+	return nil
+}
+
+// removeRoleMember stops tracking the member in the spreadsheet of the role. a member
+// who is in no other spreadsheet is forgotten together with their mounts.
+func removeRoleMember(ctx context.Context, tx pgx.Tx, roleID RoleID, memberID MemberID) error {
+	_, err := tx.Exec(
+		ctx,
+		`delete from bot.role_member where role_id = $1 and member_discord_id = $2`,
+		string(roleID),
+		string(memberID),
+	)
+	if err != nil {
+		return fmt.Errorf("delete from bot.role_member error: [%w]", err)
+	}
+	_, err = tx.Exec(
+		ctx,
+		`
+		delete from bot.member_metadata
+		where member_discord_id = $1
+		and not exists (select 1 from bot.role_member where member_discord_id = $1)
+		`,
+		string(memberID),
+	)
+	if err != nil {
+		return fmt.Errorf("delete from bot.member_metadata error: [%w]", err)
+	}
+	return nil
+}
+
+// BossStyling overrides the colors of a boss in the spreadsheet of one role. empty colors
+// keep the colors of bot.boss_styling_data.
+type BossStyling struct {
+	HeaderBackground   string
+	HeaderForeground   string
+	CheckboxBackground string
+	CheckboxForeground string
+}
+
+// setRoleBossStyling saves the colors of the boss for the spreadsheet of the role
+func setRoleBossStyling(ctx context.Context, roleID RoleID, bossName string, styling BossStyling) error {
+	colors := []string{styling.HeaderBackground, styling.HeaderForeground, styling.CheckboxBackground, styling.CheckboxForeground}
+	for i := 0; i < len(colors); i++ {
+		if colors[i] != "" && !isHex(colors[i]) {
+			return fmt.Errorf("%s is not a hex color like #d9d9d9", colors[i])
+		}
+	}
+	tag, err := dbpool.Exec(
+		ctx,
+		`
+		insert into bot.role_boss_styling_data(
+			role_id,
+			boss_id,
+			header_background_hex_color,
+			header_foreground_hex_color,
+			checkbox_background_hex_color,
+			checkbox_foreground_hex_color
+		)
+		select
+			$1,
+			b.boss_id,
+			coalesce($3, rs.header_background_hex_color, bs.header_background_hex_color),
+			coalesce($4, rs.header_foreground_hex_color, bs.header_foreground_hex_color),
+			coalesce($5, rs.checkbox_background_hex_color, bs.checkbox_background_hex_color),
+			coalesce($6, rs.checkbox_foreground_hex_color, bs.checkbox_foreground_hex_color)
+		from bot.boss_metadata b
+		inner join bot.boss_styling_data bs
+		on bs.boss_id = b.boss_id
+		left join bot.role_boss_styling_data rs
+		on rs.boss_id = b.boss_id and rs.role_id = $1
+		where lower(b.boss_name) = lower($2)
+		on conflict (role_id, boss_id) do update
+		set
+			header_background_hex_color = excluded.header_background_hex_color,
+			header_foreground_hex_color = excluded.header_foreground_hex_color,
+			checkbox_background_hex_color = excluded.checkbox_background_hex_color,
+			checkbox_foreground_hex_color = excluded.checkbox_foreground_hex_color
+		`,
+		string(roleID),
+		bossName,
+		nullIfEmpty(styling.HeaderBackground),
+		nullIfEmpty(styling.HeaderForeground),
+		nullIfEmpty(styling.CheckboxBackground),
+		nullIfEmpty(styling.CheckboxForeground),
+	)
+	if err != nil {
+		return fmt.Errorf("insert into bot.role_boss_styling_data error: [%w]", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("there is no boss named %s", bossName)
+	}
+	return nil
+}
+
+// resetRoleBossStyling makes the boss use the colors of bot.boss_styling_data again in
+// the spreadsheet of the role
+func resetRoleBossStyling(ctx context.Context, roleID RoleID, bossName string) error {
+	_, err := dbpool.Exec(
+		ctx,
+		`
+		delete from bot.role_boss_styling_data rs
+		using bot.boss_metadata b
+		where rs.boss_id = b.boss_id
+		and rs.role_id = $1
+		and lower(b.boss_name) = lower($2)
+		`,
+		string(roleID),
+		bossName,
+	)
+	if err != nil {
+		return fmt.Errorf("delete from bot.role_boss_styling_data error: [%w]", err)
+	}
+	return nil
+}
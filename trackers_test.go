@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testExpansions() []*Expansion {
+	return []*Expansion{
+		{ID: "3", Name: "Heavensward", Index: 1},
+		{ID: "2", Name: "A Realm Reborn", Index: 0},
+		{ID: "4", Name: "Stormblood", Index: 2},
+	}
+}
+
+func Test_parseExpansionList(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []ExpansionID
+		wantErr bool
+	}{
+		{
+			name: "translated names",
+			s:    "紅蓮のリベレーター,heavensward",
+			want: []ExpansionID{"4", "3"},
+		},
+		{
+			name: "empty",
+			s:    "",
+			want: []ExpansionID{},
+		},
+		{
+			name: "names in any case",
+			s:    "stormblood, Heavensward",
+			want: []ExpansionID{"4", "3"},
+		},
+		{
+			name: "ids",
+			s:    "2,4",
+			want: []ExpansionID{"2", "4"},
+		},
+		{
+			name: "blank entries",
+			s:    " ,Stormblood,",
+			want: []ExpansionID{"4"},
+		},
+		{
+			name:    "unknown expansion",
+			s:       "Heavensward,Endwalker",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			translations := Translations{"4": {LanguageJapanese: "紅蓮のリベレーター"}}
+			got, err := parseExpansionList(tt.s, testExpansions(), translations, LanguageFrench)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseExpansionList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseExpansionList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectExpansions(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []ExpansionID
+		want []ExpansionID
+	}{
+		{
+			name: "every expansion",
+			ids:  nil,
+			want: []ExpansionID{"2", "3", "4"},
+		},
+		{
+			name: "subset ordered by index",
+			ids:  []ExpansionID{"4", "2"},
+			want: []ExpansionID{"2", "4"},
+		},
+		{
+			name: "unknown id",
+			ids:  []ExpansionID{"9"},
+			want: []ExpansionID{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := selectExpansions(testExpansions(), tt.ids)
+			got := make([]ExpansionID, len(selected))
+			for i := 0; i < len(selected); i++ {
+				got[i] = selected[i].ID
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectExpansions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_guildTrackers(t *testing.T) {
+	trackers := []*Tracker{
+		{RoleID: "1", GuildID: "10"},
+		{RoleID: "2", GuildID: "20"},
+		{RoleID: "3", GuildID: "10"},
+		{RoleID: "4"},
+	}
+	tests := []struct {
+		name    string
+		guildID string
+		want    []RoleID
+	}{
+		{name: "roles of the guild", guildID: "10", want: []RoleID{"1", "3"}},
+		{name: "guild without roles", guildID: "30", want: []RoleID{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []RoleID{}
+			for _, tracker := range guildTrackers(trackers, tt.guildID) {
+				got = append(got, tracker.RoleID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("guildTrackers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
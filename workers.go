@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	workerMinRestartDelay = time.Duration(1) * time.Second
+	workerMaxRestartDelay = time.Duration(60) * time.Second
+)
+
+// WorkerFunc is a long running routine that is expected to return once its context is cancelled
+type WorkerFunc func(ctx context.Context) error
+
+type WorkerStatus string
+
+const (
+	WorkerStatusRunning    WorkerStatus = "running"
+	WorkerStatusRestarting WorkerStatus = "restarting"
+	WorkerStatusStopped    WorkerStatus = "stopped"
+)
+
+type WorkerState struct {
+	Name      string
+	Status    WorkerStatus
+	Restarts  int
+	StartedAt time.Time
+	LastError string
+}
+
+// WorkerSupervisor starts each named worker at most once for the lifetime of the
+// process and keeps track of its state. Workers that should run once per guild
+// include the guild ID in their name.
+type WorkerSupervisor struct {
+	ctx    context.Context
+	group  *errgroup.Group
+	mu     sync.Mutex
+	states map[string]*WorkerState
+}
+
+func NewWorkerSupervisor(ctx context.Context) *WorkerSupervisor {
+	return &WorkerSupervisor{
+		ctx:    ctx,
+		group:  &errgroup.Group{},
+		states: map[string]*WorkerState{},
+	}
+}
+
+// Go runs the worker in its own routine and restarts it with a backoff if it
+// returns or panics before the supervisor's context is cancelled. It returns
+// false without doing anything if a worker with the same name was already started.
+func (s *WorkerSupervisor) Go(name string, fn WorkerFunc) bool {
+	logger := log.WithField("worker", name)
+	s.mu.Lock()
+	if _, ok := s.states[name]; ok {
+		s.mu.Unlock()
+		logger.Debug("worker is already started")
+		return false
+	}
+	s.states[name] = &WorkerState{
+		Name:      name,
+		Status:    WorkerStatusRunning,
+		StartedAt: time.Now(),
+	}
+	s.mu.Unlock()
+	logger.Debug("worker started")
+
+	s.group.Go(func() error {
+		restartDelay := workerMinRestartDelay
+		for {
+			startedAt := time.Now()
+			err := runWorker(s.ctx, name, fn)
+			if s.ctx.Err() != nil {
+				if err != nil {
+					logger.WithError(err).Error("worker stopped with error")
+				} else {
+					logger.Debug("worker stopped")
+				}
+				s.update(name, func(state *WorkerState) {
+					state.Status = WorkerStatusStopped
+					if err != nil {
+						state.LastError = err.Error()
+					}
+				})
+				return nil
+			}
+			// a worker that ran for a while before failing starts its backoff over
+			if time.Since(startedAt) > workerMaxRestartDelay {
+				restartDelay = workerMinRestartDelay
+			}
+			logger.WithError(err).Errorf("worker exited unexpectedly, restarting in %s", restartDelay)
+			s.update(name, func(state *WorkerState) {
+				state.Status = WorkerStatusRestarting
+				if err != nil {
+					state.LastError = err.Error()
+				} else {
+					state.LastError = "returned without error"
+				}
+			})
+			if sleepContext(s.ctx, restartDelay) != nil {
+				s.update(name, func(state *WorkerState) {
+					state.Status = WorkerStatusStopped
+				})
+				return nil
+			}
+			restartDelay *= 2
+			if restartDelay > workerMaxRestartDelay {
+				restartDelay = workerMaxRestartDelay
+			}
+			s.update(name, func(state *WorkerState) {
+				state.Status = WorkerStatusRunning
+				state.Restarts++
+				state.StartedAt = time.Now()
+			})
+		}
+	})
+	return true
+}
+
+func (s *WorkerSupervisor) update(name string, fn func(state *WorkerState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.states[name])
+}
+
+// States returns a snapshot of every started worker's state ordered by name
+func (s *WorkerSupervisor) States() []WorkerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]WorkerState, 0, len(s.states))
+	for _, state := range s.states {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+	return states
+}
+
+// Wait blocks until every worker has stopped
+func (s *WorkerSupervisor) Wait() error {
+	return s.group.Wait()
+}
+
+func runWorker(ctx context.Context, name string, fn WorkerFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("worker %s panic: %v\n%s", name, r, debug.Stack())
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerSupervisor_Go(t *testing.T) {
+	tests := []struct {
+		name         string
+		fn           func(runs *int64) WorkerFunc
+		wantMinRuns  int64
+		wantRestarts bool
+	}{
+		{
+			name: "worker blocks until cancelled",
+			fn: func(runs *int64) WorkerFunc {
+				return func(ctx context.Context) error {
+					atomic.AddInt64(runs, 1)
+					<-ctx.Done()
+					return nil
+				}
+			},
+			wantMinRuns:  1,
+			wantRestarts: false,
+		},
+		{
+			name: "worker panics and is restarted",
+			fn: func(runs *int64) WorkerFunc {
+				return func(ctx context.Context) error {
+					if atomic.AddInt64(runs, 1) == 1 {
+						panic("boom")
+					}
+					<-ctx.Done()
+					return nil
+				}
+			},
+			wantMinRuns:  2,
+			wantRestarts: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			s := NewWorkerSupervisor(ctx)
+			var runs int64
+			if !s.Go("worker", tt.fn(&runs)) {
+				t.Fatalf("Go() = false on first start")
+			}
+			if s.Go("worker", tt.fn(&runs)) {
+				t.Errorf("Go() = true for an already started worker")
+			}
+			deadline := time.Now().Add(workerMinRestartDelay * 3)
+			for atomic.LoadInt64(&runs) < tt.wantMinRuns && time.Now().Before(deadline) {
+				time.Sleep(time.Duration(10) * time.Millisecond)
+			}
+			cancel()
+			s.Wait()
+
+			if got := atomic.LoadInt64(&runs); got < tt.wantMinRuns {
+				t.Errorf("worker ran %d times, want at least %d", got, tt.wantMinRuns)
+			}
+			states := s.States()
+			if len(states) != 1 {
+				t.Fatalf("States() returned %d states, want 1", len(states))
+			}
+			if states[0].Status != WorkerStatusStopped {
+				t.Errorf("state status = %s, want %s", states[0].Status, WorkerStatusStopped)
+			}
+			if (states[0].Restarts > 0) != tt.wantRestarts {
+				t.Errorf("state restarts = %d, wantRestarts %v", states[0].Restarts, tt.wantRestarts)
+			}
+		})
+	}
+}
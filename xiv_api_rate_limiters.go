@@ -1,13 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"strconv"
 	"time"
 
-	"github.com/disgoorg/log"
 	"github.com/google/uuid"
 )
 
@@ -16,22 +16,29 @@ type XivApiTokenMap struct {
 	ResponseToken string
 }
 
-func RetryXivApiLodestoneRequest(req interface{}, prevLimit, maxWaitSeconds float64, hasSuggestedRetryDur bool) (interface{}, error) {
+func RetryXivApiLodestoneRequest(ctx context.Context, req interface{}, prevLimit, maxWaitSeconds float64, hasSuggestedRetryDur bool) (interface{}, error) {
 	var waitDur float64
 	if hasSuggestedRetryDur {
 		waitDur = prevLimit
 	} else {
 		waitDur = CalcThrottledWaitDuration(prevLimit, maxWaitSeconds)
 	}
-	<-time.After(time.Duration(waitDur) * time.Second)
+	err := sleepContext(ctx, time.Duration(waitDur)*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("retry wait error: [%w]", err)
+	}
 	var out interface{}
 	switch r := req.(type) {
 	case XivCharacterSearchRequest:
-		resp, err := r.Do(r.Name, r.Params...)
+		reqLogger := log.WithField("request_token", r.Token)
+		start := time.Now()
+		resp, err := r.Do(ctx, r.Name, r.Params...)
+		observeXivapiRequest("character_search", start, resp, err)
 		if err != nil {
 			return nil, fmt.Errorf("XivCharacterSearchRequest send request error: [%w]", err)
 		}
-		log.Debugf("retry xivapi lodestone character search request api reponse status code: %d", resp.StatusCode)
+		defer resp.Body.Close()
+		reqLogger.Debugf("retry xivapi lodestone character search request api reponse status code: %d", resp.StatusCode)
 		if resp.StatusCode == 429 {
 			durStr := resp.Header.Get("Retry-After")
 			var initWait float64
@@ -45,7 +52,7 @@ func RetryXivApiLodestoneRequest(req interface{}, prevLimit, maxWaitSeconds floa
 				}
 				hasSuggestedRetryDur = true
 			}
-			return RetryXivApiLodestoneRequest(r, initWait, 3600, hasSuggestedRetryDur)
+			return RetryXivApiLodestoneRequest(ctx, r, initWait, maxWaitSeconds, hasSuggestedRetryDur)
 		}
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
@@ -58,11 +65,15 @@ func RetryXivApiLodestoneRequest(req interface{}, prevLimit, maxWaitSeconds floa
 		}
 		out = characterSearch
 	case XivCharacterRequest:
-		resp, err := r.Do(r.XivID, r.Data...)
+		reqLogger := log.WithField("request_token", r.Token)
+		start := time.Now()
+		resp, err := r.Do(ctx, r.XivID, r.Data...)
+		observeXivapiRequest("character", start, resp, err)
 		if err != nil {
 			return nil, fmt.Errorf("XivCharacterRequest send request error: [%w]", err)
 		}
-		log.Debugf("retry xivapi lodestone character request api reponse status code: %d", resp.StatusCode)
+		defer resp.Body.Close()
+		reqLogger.Debugf("retry xivapi lodestone character request api reponse status code: %d", resp.StatusCode)
 		if resp.StatusCode == 429 {
 			durStr := resp.Header.Get("Retry-After")
 			var initWait float64
@@ -76,7 +87,7 @@ func RetryXivApiLodestoneRequest(req interface{}, prevLimit, maxWaitSeconds floa
 				}
 				hasSuggestedRetryDur = true
 			}
-			return RetryXivApiLodestoneRequest(r, initWait, 3600, hasSuggestedRetryDur)
+			return RetryXivApiLodestoneRequest(ctx, r, initWait, maxWaitSeconds, hasSuggestedRetryDur)
 		}
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
@@ -88,20 +99,66 @@ func RetryXivApiLodestoneRequest(req interface{}, prevLimit, maxWaitSeconds floa
 			return nil, fmt.Errorf("json.Unmarshal() 2 error: [%w]", err)
 		}
 		out = character
+	case XivGameDataRequest:
+		reqLogger := log.WithField("request_token", r.Token)
+		start := time.Now()
+		resp, err := r.send(ctx)
+		observeXivapiRequest("game_data", start, resp, err)
+		if err != nil {
+			return nil, fmt.Errorf("XivGameDataRequest send request error: [%w]", err)
+		}
+		defer resp.Body.Close()
+		reqLogger.Debugf("retry xivapi game data request api reponse status code: %d", resp.StatusCode)
+		if resp.StatusCode == 429 {
+			durStr := resp.Header.Get("Retry-After")
+			var initWait float64
+			hasSuggestedRetryDur := false
+			if durStr == "" {
+				initWait = waitDur
+			} else {
+				initWait, err = strconv.ParseFloat(durStr, 64)
+				if err != nil {
+					return nil, fmt.Errorf("strconv.ParseFloat() 3 error: [%w]", err)
+				}
+				hasSuggestedRetryDur = true
+			}
+			return RetryXivApiLodestoneRequest(ctx, r, initWait, maxWaitSeconds, hasSuggestedRetryDur)
+		}
+		if resp.StatusCode == 404 {
+			return XivGameData{}, nil
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("io.ReadAll() 3 error: [%w]", err)
+		}
+		out, err = r.decode(respBody)
+		if err != nil {
+			return nil, fmt.Errorf("r.decode() error: [%w]", err)
+		}
 	default:
 		return nil, fmt.Errorf("unknown lodestone request type %v", r)
 	}
 	return out, nil
 }
 
-func xivApiLodestoneRequestRateLimiter(rateLimit, maxRetryDuration float64, reqs chan interface{}, resps chan map[XivApiTokenMap]interface{}, tokenMaps chan XivApiTokenMap) {
+// xivApiLodestoneRequestRateLimiter sends the queued requests one at a time. the rate
+// limits are read from the config for every request so reloads apply without a restart.
+func xivApiLodestoneRequestRateLimiter(ctx context.Context, reqs chan interface{}, resps chan map[XivApiTokenMap]interface{}, tokenMaps chan XivApiTokenMap) error {
 	for {
-		waitDur := CalcWaitDuration(rateLimit)
 		log.Debug("xivApiLodestoneRequestRateLimiter is waiting for requests")
-		req := <-reqs
+		var req interface{}
+		select {
+		case <-ctx.Done():
+			return nil
+		case req = <-reqs:
+		}
+		config := getBotConfig()
+		waitDur := CalcWaitDuration(config.XivapiRateLimit)
+		maxRetryDuration := config.MaxRetryDuration.Seconds()
 		respToken := uuid.New().String()
 		switch r := req.(type) {
 		case XivCharacterSearchRequest:
+			reqLogger := log.WithField("request_token", r.Token)
 			tokenMap := XivApiTokenMap{
 				RequestToken:  r.Token,
 				ResponseToken: respToken,
@@ -109,15 +166,18 @@ func xivApiLodestoneRequestRateLimiter(rateLimit, maxRetryDuration float64, reqs
 			go func() {
 				tokenMaps <- tokenMap
 			}()
-			log.Debugf("token map sent for %s", r.Name)
-			resp, err := r.Do(r.Name, r.Params...)
+			reqLogger.WithField("character_name", r.Name).Debug("token map sent")
+			start := time.Now()
+			resp, err := r.Do(ctx, r.Name, r.Params...)
+			observeXivapiRequest("character_search", start, resp, err)
 			if err != nil {
-				log.Error(err)
+				reqLogger.Error(err)
 				continue
 			}
-			log.Debugf("xivapi lodestone character search request api reponse status code: %d", resp.StatusCode)
+			reqLogger.Debugf("xivapi lodestone character search request api reponse status code: %d", resp.StatusCode)
 			var outResp interface{}
 			if resp.StatusCode == 429 {
+				resp.Body.Close()
 				durStr := resp.Header.Get("Retry-After")
 				var initWait float64
 				hasSuggestedRetryDur := false
@@ -126,36 +186,38 @@ func xivApiLodestoneRequestRateLimiter(rateLimit, maxRetryDuration float64, reqs
 				} else {
 					initWait, err = strconv.ParseFloat(durStr, 64)
 					if err != nil {
-						log.Error(err)
+						reqLogger.Error(err)
 						continue
 					}
 					hasSuggestedRetryDur = true
 				}
-				outResp, err = RetryXivApiLodestoneRequest(r, initWait, 3600, hasSuggestedRetryDur)
+				outResp, err = RetryXivApiLodestoneRequest(ctx, r, initWait, maxRetryDuration, hasSuggestedRetryDur)
 				if err != nil {
-					log.Error(err)
+					reqLogger.Error(err)
 					continue
 				}
 			} else {
 				respBody, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
 				if err != nil {
-					log.Error(err)
+					reqLogger.Error(err)
 					continue
 				}
 				var characterSearch XivCharacterSearch
 				err = json.Unmarshal(respBody, &characterSearch)
 				if err != nil {
-					log.Error(err)
+					reqLogger.Error(err)
 					continue
 				}
 				outResp = characterSearch
 			}
-			log.Debugf("got response for request token %s", tokenMap.RequestToken)
+			reqLogger.Debug("got response")
 			go func() {
 				resps <- map[XivApiTokenMap]interface{}{tokenMap: outResp}
 			}()
-			<-time.After(time.Duration(waitDur) * time.Second)
+			sleepContext(ctx, time.Duration(waitDur)*time.Second)
 		case XivCharacterRequest:
+			reqLogger := log.WithField("request_token", r.Token)
 			tokenMap := XivApiTokenMap{
 				RequestToken:  r.Token,
 				ResponseToken: respToken,
@@ -163,14 +225,17 @@ func xivApiLodestoneRequestRateLimiter(rateLimit, maxRetryDuration float64, reqs
 			go func() {
 				tokenMaps <- tokenMap
 			}()
-			resp, err := r.Do(r.XivID, r.Data...)
+			start := time.Now()
+			resp, err := r.Do(ctx, r.XivID, r.Data...)
+			observeXivapiRequest("character", start, resp, err)
 			if err != nil {
-				log.Error(err)
+				reqLogger.Error(err)
 				continue
 			}
-			log.Debugf("xivapi lodestone character search request api reponse status code: %d", resp.StatusCode)
+			reqLogger.Debugf("xivapi lodestone character request api reponse status code: %d", resp.StatusCode)
 			var outResp interface{}
 			if resp.StatusCode == 429 {
+				resp.Body.Close()
 				durStr := resp.Header.Get("Retry-After")
 				var initWait float64
 				hasSuggestedRetryDur := false
@@ -179,42 +244,106 @@ func xivApiLodestoneRequestRateLimiter(rateLimit, maxRetryDuration float64, reqs
 				} else {
 					initWait, err = strconv.ParseFloat(durStr, 64)
 					if err != nil {
-						log.Error(err)
+						reqLogger.Error(err)
 						continue
 					}
 					hasSuggestedRetryDur = true
 				}
-				outResp, err = RetryXivApiLodestoneRequest(r, initWait, 3600, hasSuggestedRetryDur)
+				outResp, err = RetryXivApiLodestoneRequest(ctx, r, initWait, maxRetryDuration, hasSuggestedRetryDur)
 				if err != nil {
-					log.Error(err)
+					reqLogger.Error(err)
 					continue
 				}
 			} else if resp.StatusCode == 404 {
 				respBody, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
 				if err != nil {
-					log.Error(err)
+					reqLogger.Error(err)
 					continue
 				}
-				log.Error(string(respBody))
+				reqLogger.Error(string(respBody))
+				// the character does not exist, the empty profile tells the waiting caller
+				outResp = XivCharacter{}
 			} else {
 				respBody, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
 				if err != nil {
-					log.Error(err)
+					reqLogger.Error(err)
 					continue
 				}
 				var character XivCharacter
 				err = json.Unmarshal(respBody, &character)
 				if err != nil {
-					log.Error(err)
+					reqLogger.Error(err)
 					continue
 				}
 				outResp = character
 			}
-			log.Debugf("got response for request token %s", tokenMap.RequestToken)
+			reqLogger.Debug("got response")
+			go func() {
+				resps <- map[XivApiTokenMap]interface{}{tokenMap: outResp}
+			}()
+			sleepContext(ctx, time.Duration(waitDur)*time.Second)
+		case XivGameDataRequest:
+			reqLogger := log.WithField("request_token", r.Token)
+			tokenMap := XivApiTokenMap{
+				RequestToken:  r.Token,
+				ResponseToken: respToken,
+			}
+			go func() {
+				tokenMaps <- tokenMap
+			}()
+			start := time.Now()
+			resp, err := r.send(ctx)
+			observeXivapiRequest("game_data", start, resp, err)
+			if err != nil {
+				reqLogger.Error(err)
+				continue
+			}
+			reqLogger.Debugf("xivapi game data request api reponse status code: %d", resp.StatusCode)
+			var outResp interface{}
+			if resp.StatusCode == 429 {
+				resp.Body.Close()
+				durStr := resp.Header.Get("Retry-After")
+				var initWait float64
+				hasSuggestedRetryDur := false
+				if durStr == "" {
+					initWait = waitDur
+				} else {
+					initWait, err = strconv.ParseFloat(durStr, 64)
+					if err != nil {
+						reqLogger.Error(err)
+						continue
+					}
+					hasSuggestedRetryDur = true
+				}
+				outResp, err = RetryXivApiLodestoneRequest(ctx, r, initWait, maxRetryDuration, hasSuggestedRetryDur)
+				if err != nil {
+					reqLogger.Error(err)
+					continue
+				}
+			} else if resp.StatusCode == 404 {
+				resp.Body.Close()
+				// the game ID does not exist
+				outResp = XivGameData{}
+			} else {
+				respBody, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					reqLogger.Error(err)
+					continue
+				}
+				outResp, err = r.decode(respBody)
+				if err != nil {
+					reqLogger.Error(err)
+					continue
+				}
+			}
+			reqLogger.Debug("got response")
 			go func() {
 				resps <- map[XivApiTokenMap]interface{}{tokenMap: outResp}
 			}()
-			<-time.After(time.Duration(waitDur) * time.Second)
+			sleepContext(ctx, time.Duration(waitDur)*time.Second)
 		}
 	}
 }
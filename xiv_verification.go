@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	xivVerificationCodePrefix = "tataru-"
+	// how long a member has to put the code in their lodestone bio
+	xivVerificationTTL = time.Duration(24) * time.Hour
+)
+
+func newXivVerificationCode() (string, error) {
+	b := make([]byte, 5)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("rand.Read() error: [%w]", err)
+	}
+	return xivVerificationCodePrefix + hex.EncodeToString(b), nil
+}
+
+// bioHasCode checks if the lodestone bio contains the verification code
+func bioHasCode(bio string, code string) bool {
+	return code != "" && strings.Contains(strings.ToLower(bio), strings.ToLower(code))
+}
+
+// getXivCharacter gets the profile of the character, nil when it does not exist
+func getXivCharacter(ctx context.Context, xivCharID string) (*XivCharacter, error) {
+	resps, err := xivapiCollectCharacterResponses(ctx, []XivCharacterRequest{
+		{
+			Token: uuid.New().String(),
+			XivID: xivCharID,
+			Data:  nil,
+			Do:    xivapiClient.GetCharacter,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("xivapiCollectCharacterResponses() error: [%w]", err)
+	}
+	if len(resps) == 0 || resps[0].Character.ID == 0 {
+		return nil, nil
+	}
+	return &resps[0], nil
+}
+
+// xivCharacterVerifiedByOther gets the name of the member other than memberID who
+// proved owning the character, empty when there is none
+func xivCharacterVerifiedByOther(ctx context.Context, xivCharID string, memberID MemberID) (string, error) {
+	var name string
+	err := dbpool.QueryRow(
+		ctx,
+		`
+		select m.member_name
+		from (`+memberCharactersQuery+`) c
+		inner join bot.member_metadata m
+		on m.member_discord_id = c.member_discord_id
+		where c.member_xiv_id = $1 and c.verified and c.member_discord_id <> $2
+		limit 1
+		`,
+		xivCharID,
+		string(memberID),
+	).Scan(&name)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get verified character error: [%w]", err)
+	}
+	return name, nil
+}
+
+// startXivCharacterVerification gets the reply to a member claiming a character, as
+// their primary character or as an alt. the member gets a code to put in the lodestone
+// bio of the character, the character ID is only saved once /verify_xiv_char finds it
+// there.
+func startXivCharacterVerification(ctx context.Context, user discord.User, xivCharID string, asAlt bool) (string, error) {
+	if !regexp.MustCompile(XivCharacterIDRegexPattern).MatchString(xivCharID) {
+		return fmt.Sprintf("%s is not a character ID, it is the number at the end of the lodestone profile URL", xivCharID), nil
+	}
+	memberID := MemberID(user.ID.String())
+	other, err := xivCharacterVerifiedByOther(ctx, xivCharID, memberID)
+	if err != nil {
+		return "", fmt.Errorf("xivCharacterVerifiedByOther() error: [%w]", err)
+	}
+	if other != "" {
+		return fmt.Sprintf("Character ID %s is already verified for %s", xivCharID, other), nil
+	}
+	if asAlt {
+		characters, err := getMemberCharacters(ctx, memberID)
+		if err != nil {
+			return "", fmt.Errorf("getMemberCharacters() error: [%w]", err)
+		}
+		for _, c := range characters[memberID] {
+			if c.XivID == xivCharID && c.Primary {
+				return fmt.Sprintf("Character ID %s is already your primary character", xivCharID), nil
+			}
+		}
+	}
+	character, err := getXivCharacter(ctx, xivCharID)
+	if err != nil {
+		return "", fmt.Errorf("getXivCharacter() error: [%w]", err)
+	}
+	if character == nil {
+		return fmt.Sprintf("No matching character was found for character ID %s", xivCharID), nil
+	}
+	code, err := newXivVerificationCode()
+	if err != nil {
+		return "", fmt.Errorf("newXivVerificationCode() error: [%w]", err)
+	}
+	tag, err := dbpool.Exec(
+		ctx,
+		`
+		insert into bot.member_xiv_verification(
+			member_discord_id,
+			member_xiv_id,
+			code,
+			expires_at,
+			as_alt
+		)
+		select $1, $2, $3, $4, $5
+		where exists(select 1 from bot.member_metadata where member_discord_id = $1)
+		on conflict (member_discord_id)
+		do update set
+			member_xiv_id = excluded.member_xiv_id,
+			code = excluded.code,
+			expires_at = excluded.expires_at,
+			as_alt = excluded.as_alt
+		`,
+		string(memberID),
+		xivCharID,
+		code,
+		time.Now().Add(xivVerificationTTL).UTC(),
+		asAlt,
+	)
+	if err != nil {
+		return "", fmt.Errorf("upsert bot.member_xiv_verification error: [%w]", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return "Only members with a tracked role can map a character", nil
+	}
+	return fmt.Sprintf(
+		"To prove %s (%s) is your character, put `%s` in its lodestone profile bio and use /verify_xiv_char within %s. The bio can be changed back once the character is verified.",
+		character.Character.Name,
+		xivCharID,
+		code,
+		xivVerificationTTL,
+	), nil
+}
+
+// verifyXivCharacter gets the reply to /verify_xiv_char. the character ID the member
+// claimed is saved as verified when its lodestone bio has the code.
+func verifyXivCharacter(ctx context.Context, user discord.User) (string, error) {
+	memberID := MemberID(user.ID.String())
+	var xivCharID string
+	var code string
+	var expiresAt time.Time
+	var asAlt bool
+	err := dbpool.QueryRow(
+		ctx,
+		`select member_xiv_id, code, expires_at, as_alt from bot.member_xiv_verification where member_discord_id = $1`,
+		string(memberID),
+	).Scan(&xivCharID, &code, &expiresAt, &asAlt)
+	if err == pgx.ErrNoRows {
+		return "No character is waiting to be verified, use /map_xiv_char_id or /add_xiv_alt first", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get bot.member_xiv_verification error: [%w]", err)
+	}
+	if time.Now().After(expiresAt) {
+		_, err = dbpool.Exec(ctx, `delete from bot.member_xiv_verification where member_discord_id = $1`, string(memberID))
+		if err != nil {
+			return "", fmt.Errorf("delete bot.member_xiv_verification error: [%w]", err)
+		}
+		return "The verification code expired, use /map_xiv_char_id or /add_xiv_alt to get a new one", nil
+	}
+	other, err := xivCharacterVerifiedByOther(ctx, xivCharID, memberID)
+	if err != nil {
+		return "", fmt.Errorf("xivCharacterVerifiedByOther() error: [%w]", err)
+	}
+	if other != "" {
+		return fmt.Sprintf("Character ID %s is already verified for %s", xivCharID, other), nil
+	}
+	character, err := getXivCharacter(ctx, xivCharID)
+	if err != nil {
+		return "", fmt.Errorf("getXivCharacter() error: [%w]", err)
+	}
+	if character == nil {
+		return fmt.Sprintf("No matching character was found for character ID %s", xivCharID), nil
+	}
+	if !bioHasCode(character.Character.Bio, code) {
+		return fmt.Sprintf(
+			"`%s` is not in the lodestone bio of %s yet. Lodestone profiles can take a few minutes to update, try again later.",
+			code,
+			character.Character.Name,
+		), nil
+	}
+
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("dbpool.Begin() error: [%w]", err)
+	}
+	defer tx.Rollback(ctx)
+	if asAlt {
+		_, err = tx.Exec(
+			ctx,
+			`
+			insert into bot.member_character(member_discord_id,member_xiv_id,verified) values($1,$2,true)
+			on conflict (member_discord_id, member_xiv_id) do update set verified = true
+			`,
+			string(memberID),
+			xivCharID,
+		)
+		if err != nil {
+			return "", fmt.Errorf("insert into bot.member_character error: [%w]", err)
+		}
+	} else {
+		_, err = tx.Exec(
+			ctx,
+			`update bot.member_metadata set member_xiv_id=$1, member_xiv_id_verified=true where member_discord_id=$2`,
+			xivCharID,
+			string(memberID),
+		)
+		if err != nil {
+			return "", fmt.Errorf("update bot.member_metadata error: [%w]", err)
+		}
+		// an alt that becomes the primary character is no longer an alt
+		_, err = tx.Exec(
+			ctx,
+			`delete from bot.member_character where member_discord_id = $1 and member_xiv_id = $2`,
+			string(memberID),
+			xivCharID,
+		)
+		if err != nil {
+			return "", fmt.Errorf("delete from bot.member_character error: [%w]", err)
+		}
+	}
+	_, err = tx.Exec(
+		ctx,
+		`
+		insert into bot.xiv_character(member_xiv_id,character_name) values($1,$2)
+		on conflict (member_xiv_id) do update set character_name = excluded.character_name
+		`,
+		xivCharID,
+		character.Character.Name,
+	)
+	if err != nil {
+		return "", fmt.Errorf("upsert bot.xiv_character error: [%w]", err)
+	}
+	_, err = tx.Exec(ctx, `delete from bot.member_xiv_verification where member_discord_id = $1`, string(memberID))
+	if err != nil {
+		return "", fmt.Errorf("delete bot.member_xiv_verification error: [%w]", err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return "", fmt.Errorf("tx.Commit() error: [%w]", err)
+	}
+	if asAlt {
+		return fmt.Sprintf("%s (%s) is verified as your alt", character.Character.Name, xivCharID), nil
+	}
+	return fmt.Sprintf("%s (%s) is verified as your character", character.Character.Name, xivCharID), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func Test_bioHasCode(t *testing.T) {
+	type args struct {
+		bio  string
+		code string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "code in bio",
+			args: args{bio: "Raiding on Behemoth. tataru-0a1b2c3d4e", code: "tataru-0a1b2c3d4e"},
+			want: true,
+		},
+		{
+			name: "code with other casing",
+			args: args{bio: "TATARU-0A1B2C3D4E", code: "tataru-0a1b2c3d4e"},
+			want: true,
+		},
+		{
+			name: "code missing",
+			args: args{bio: "Raiding on Behemoth.", code: "tataru-0a1b2c3d4e"},
+			want: false,
+		},
+		{
+			name: "other code",
+			args: args{bio: "tataru-ffffffffff", code: "tataru-0a1b2c3d4e"},
+			want: false,
+		},
+		{
+			name: "empty code",
+			args: args{bio: "anything", code: ""},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bioHasCode(tt.args.bio, tt.args.code); got != tt.want {
+				t.Errorf("bioHasCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newXivVerificationCode(t *testing.T) {
+	pattern := regexp.MustCompile(`^tataru-[0-9a-f]{10}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		code, err := newXivVerificationCode()
+		if err != nil {
+			t.Fatalf("newXivVerificationCode() error = %v", err)
+		}
+		if !pattern.MatchString(code) {
+			t.Errorf("newXivVerificationCode() = %v, want match of %v", code, pattern)
+		}
+		if seen[code] {
+			t.Errorf("newXivVerificationCode() = %v, repeated", code)
+		}
+		seen[code] = true
+	}
+}
@@ -3,11 +3,19 @@ package main
 // everything is not implemented here because this bot doesn't need most of it
 
 type XivMount struct {
+	ID   uint   `json:"id,omitempty"`
 	Name string `json:"name,omitempty"`
 	Icon string `json:"icon,omitempty"`
 }
 
 type XivMinion struct {
+	ID   uint   `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Icon string `json:"icon,omitempty"`
+}
+
+type XivAchievement struct {
+	ID   uint   `json:"id,omitempty"`
 	Name string `json:"name,omitempty"`
 	Icon string `json:"icon,omitempty"`
 }
@@ -26,6 +34,7 @@ type XivReducedCharacterProfile struct {
 type XivCharacterProfile struct {
 	Name string `json:"name,omitempty"`
 	ID   uint   `json:"id,omitempty"`
+	Bio  string `json:"bio,omitempty"`
 }
 
 type XivPagination struct {
@@ -45,7 +54,40 @@ type XivCharacterSearch struct {
 
 type XivCharacter struct {
 	Character          XivCharacterProfile          `json:"character,omitempty"`
+	Achievements       []XivAchievement             `json:"achievements,omitempty"`
 	FreeCompanyMembers []XivReducedCharacterProfile `json:"free_company_members,omitempty"`
 	Minions            []XivMinion                  `json:"minions,omitempty"`
 	Mounts             []XivMount                   `json:"mounts,omitempty"`
 }
+
+// XivGameData is a row of a game data content like Mount or Companion
+type XivGameData struct {
+	ID     uint   `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	NameEn string `json:"name_en,omitempty"`
+	NameFr string `json:"name_fr,omitempty"`
+	NameDe string `json:"name_de,omitempty"`
+	NameJa string `json:"name_ja,omitempty"`
+	Icon   string `json:"icon,omitempty"`
+}
+
+// localizedNames gets the names of the row in each language it has a name in
+func (d XivGameData) localizedNames() map[Language]string {
+	names := map[Language]string{}
+	for lang, name := range map[Language]string{
+		LanguageEnglish:  d.NameEn,
+		LanguageFrench:   d.NameFr,
+		LanguageGerman:   d.NameDe,
+		LanguageJapanese: d.NameJa,
+	} {
+		if name != "" {
+			names[lang] = name
+		}
+	}
+	return names
+}
+
+type XivGameDataSearch struct {
+	Pagination XivPagination `json:"pagination,omitempty"`
+	Results    []XivGameData `json:"results,omitempty"`
+}
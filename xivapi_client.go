@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/disgoorg/log"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -27,66 +32,193 @@ const (
 	XivCharacterDataPvpTeam            XivCharacterData = "PVP"
 )
 
+// XivGameDataContent is a game data content of XIVAPI
+type XivGameDataContent string
+
+const (
+	XivGameDataAchievement XivGameDataContent = "Achievement"
+	XivGameDataCompanion   XivGameDataContent = "Companion"
+	XivGameDataMount       XivGameDataContent = "Mount"
+	XivGameDataOrchestrion XivGameDataContent = "Orchestrion"
+)
+
+// xivGameDataColumns are the columns requested from game data contents, with the name
+// in every language names are translated to
+const xivGameDataColumns = "ID,Name,Name_en,Name_fr,Name_de,Name_ja,Icon"
+
 type XivApiQueryParam struct {
 	Name  string
 	Value string
 }
 type XivApiClient struct {
-	c   *http.Client
-	key string
+	c       *http.Client
+	rootUrl string
 }
 
 func NewXivApiClient(apiKey string, client *http.Client) *XivApiClient {
-	c := client
-	if c == nil {
-		c = &http.Client{Timeout: time.Duration(60) * time.Second}
-	} else if c == http.DefaultClient {
+	var c http.Client
+	if client != nil {
+		// copy the client so the caller's client never sends the key
+		c = *client
+	}
+	if client == nil || client == http.DefaultClient {
 		c.Timeout = time.Duration(60) * time.Second
 	}
+	c.Transport = &xivApiKeyTransport{
+		base: c.Transport,
+		key:  apiKey,
+	}
 	return &XivApiClient{
-		c:   c,
-		key: apiKey,
+		c:       &c,
+		rootUrl: XivApiRootUrl,
 	}
 }
 
+// xivApiKeyTransport adds the private key to requests as they are sent so that
+// it is never part of a request URL seen by the rest of the bot
+type xivApiKeyTransport struct {
+	base http.RoundTripper
+	key  string
+}
+
+func (t *xivApiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	keyedReq := req.Clone(req.Context())
+	if t.key != "" {
+		query := keyedReq.URL.Query()
+		query.Set("private_key", t.key)
+		keyedReq.URL.RawQuery = query.Encode()
+	}
+	resp, err := base.RoundTrip(keyedReq)
+	if err != nil {
+		return nil, t.redactError(err)
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+func (t *xivApiKeyTransport) redactError(err error) error {
+	if t.key == "" {
+		return err
+	}
+	msg := err.Error()
+	msg = strings.ReplaceAll(msg, t.key, redactedLogValue)
+	msg = strings.ReplaceAll(msg, url.QueryEscape(t.key), redactedLogValue)
+	return &xivApiRedactedError{
+		msg: msg,
+		err: err,
+	}
+}
+
+// xivApiRedactedError keeps the wrapped error for errors.Is checks but only prints the redacted message
+type xivApiRedactedError struct {
+	msg string
+	err error
+}
+
+func (e *xivApiRedactedError) Error() string {
+	return e.msg
+}
+
+func (e *xivApiRedactedError) Unwrap() error {
+	return e.err
+}
+
 type XivCharacterSearchRequest struct {
 	Token  string
 	Name   string
 	Params []XivApiQueryParam
-	Do     func(string, ...XivApiQueryParam) (*http.Response, error)
+	Do     func(context.Context, string, ...XivApiQueryParam) (*http.Response, error)
 }
 
 type XivCharacterRequest struct {
 	Token string
 	XivID string
 	Data  []XivCharacterData
-	Do    func(string, ...XivCharacterData) (*http.Response, error)
+	Do    func(context.Context, string, ...XivCharacterData) (*http.Response, error)
+}
+
+// XivGameDataRequest gets a game data row by its ID, or searches for the row named Name
+// when GameID is 0
+type XivGameDataRequest struct {
+	Token   string
+	Content XivGameDataContent
+	GameID  uint
+	Name    string
+	Get     func(context.Context, XivGameDataContent, uint) (*http.Response, error)
+	Search  func(context.Context, XivGameDataContent, string) (*http.Response, error)
+}
+
+func (r XivGameDataRequest) send(ctx context.Context) (*http.Response, error) {
+	if r.GameID != 0 {
+		return r.Get(ctx, r.Content, r.GameID)
+	}
+	return r.Search(ctx, r.Content, r.Name)
+}
+
+// decode reads the row from the body of the response to the request. the row is empty
+// when a search finds no row with exactly the name.
+func (r XivGameDataRequest) decode(body []byte) (XivGameData, error) {
+	if r.GameID != 0 {
+		var row XivGameData
+		err := json.Unmarshal(body, &row)
+		if err != nil {
+			return XivGameData{}, fmt.Errorf("json.Unmarshal() error: [%w]", err)
+		}
+		return row, nil
+	}
+	var search XivGameDataSearch
+	err := json.Unmarshal(body, &search)
+	if err != nil {
+		return XivGameData{}, fmt.Errorf("json.Unmarshal() error: [%w]", err)
+	}
+	for i := 0; i < len(search.Results); i++ {
+		if strings.EqualFold(search.Results[i].Name, r.Name) {
+			return search.Results[i], nil
+		}
+	}
+	return XivGameData{}, nil
+}
+
+func (xiv *XivApiClient) newRequest(ctx context.Context, urlPath string, query url.Values) (*http.Request, error) {
+	u, err := url.Parse(xiv.rootUrl)
+	if err != nil {
+		return nil, fmt.Errorf("url.Parse() error: [%w]", err)
+	}
+	u.Path = path.Join(u.Path, urlPath)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequestWithContext() error: [%w]", err)
+	}
+	return req, nil
 }
 
 /*
 required params:
 
-	name: Must replace spaces with '+'
+	name
 
 optional params:
 
 	server
 	page
 */
-func (xiv *XivApiClient) SearchForCharacter(name string, params ...XivApiQueryParam) (*http.Response, error) {
-	queryName := strings.ReplaceAll(name, " ", "+")
-	url := fmt.Sprintf("%s?private_key=%s", XivApiCharacterSearchUrl, xiv.key)
-	url = fmt.Sprintf("%s&name=%s", url, queryName)
+func (xiv *XivApiClient) SearchForCharacter(ctx context.Context, name string, params ...XivApiQueryParam) (*http.Response, error) {
+	query := url.Values{}
+	query.Set("name", name)
 	for i := 0; i < len(params); i++ {
-		url = fmt.Sprintf("%s&%s=%s", url, params[i].Name, params[i].Value)
+		query.Set(params[i].Name, params[i].Value)
 	}
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := xiv.newRequest(ctx, "/character/search", query)
 	if err != nil {
-		return nil, fmt.Errorf("http.NewRequest() error: [%w]", err)
+		return nil, fmt.Errorf("xiv.newRequest() error: [%w]", err)
 	}
-	log.Debug("sending character search request for %s", name)
+	log.WithField("character_name", name).Debug("sending character search request")
 	return xiv.c.Do(req)
-
 }
 
 /*
@@ -101,20 +233,46 @@ optional params:
 			XivCharacterDataFreeCompanyMembers
 			XivCharacterDataMountsMinions
 */
-func (xiv *XivApiClient) GetCharacter(xivid string, data ...XivCharacterData) (*http.Response, error) {
-	url := fmt.Sprintf("%s/%s?private_key=%s", XivApiCharacterUrl, xivid, xiv.key)
-	for i := 0; i < len(data); i++ {
-		if i == 0 {
-			url = fmt.Sprintf("%s&data=%s", url, data[i])
-		} else {
-			url = fmt.Sprintf("%s,%s", url, data[i])
+func (xiv *XivApiClient) GetCharacter(ctx context.Context, xivid string, data ...XivCharacterData) (*http.Response, error) {
+	query := url.Values{}
+	if len(data) > 0 {
+		dataStrs := make([]string, len(data))
+		for i := 0; i < len(data); i++ {
+			dataStrs[i] = string(data[i])
 		}
+		query.Set("data", strings.Join(dataStrs, ","))
 	}
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := xiv.newRequest(ctx, path.Join("/character", xivid), query)
 	if err != nil {
-		return nil, fmt.Errorf("http.NewRequest() error: [%w]", err)
+		return nil, fmt.Errorf("xiv.newRequest() error: [%w]", err)
 	}
-	log.Debug("sending character request for %s", xivid)
+	log.WithField("xiv_character_id", xivid).Debug("sending character request")
 	return xiv.c.Do(req)
+}
 
+// GetGameData gets the row of the content with the game ID
+func (xiv *XivApiClient) GetGameData(ctx context.Context, content XivGameDataContent, gameID uint) (*http.Response, error) {
+	query := url.Values{}
+	query.Set("columns", xivGameDataColumns)
+	req, err := xiv.newRequest(ctx, path.Join("/", string(content), strconv.FormatUint(uint64(gameID), 10)), query)
+	if err != nil {
+		return nil, fmt.Errorf("xiv.newRequest() error: [%w]", err)
+	}
+	log.WithFields(logrus.Fields{"content": content, "game_id": gameID}).Debug("sending game data request")
+	return xiv.c.Do(req)
+}
+
+// SearchGameData searches the content for rows named name
+func (xiv *XivApiClient) SearchGameData(ctx context.Context, content XivGameDataContent, name string) (*http.Response, error) {
+	query := url.Values{}
+	query.Set("indexes", string(content))
+	query.Set("string", name)
+	query.Set("string_algo", "match")
+	query.Set("columns", xivGameDataColumns)
+	req, err := xiv.newRequest(ctx, "/search", query)
+	if err != nil {
+		return nil, fmt.Errorf("xiv.newRequest() error: [%w]", err)
+	}
+	log.WithFields(logrus.Fields{"content": content, "name": name}).Debug("sending game data search request")
+	return xiv.c.Do(req)
 }
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+const testXivApiKey = "test-private-key-0123"
+
+// captureLogs sends debug logs to a buffer for the duration of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	out := log.Out
+	level := log.GetLevel()
+	log.SetOutput(&buf)
+	log.SetLevel(logrus.TraceLevel)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetLevel(level)
+	})
+	return &buf
+}
+
+func TestXivApiClient_SearchForCharacter(t *testing.T) {
+	tests := []struct {
+		name      string
+		character string
+		params    []XivApiQueryParam
+	}{
+		{
+			name:      "name with a space",
+			character: "Tataru Taru",
+			params:    []XivApiQueryParam{{Name: "server", Value: "Behemoth"}},
+		},
+		{
+			name:      "name with an apostrophe",
+			character: "Y'shtola Rhul",
+		},
+		{
+			name:      "name with accents",
+			character: "Lyse Hexté Bélanger",
+			params:    []XivApiQueryParam{{Name: "page", Value: "2"}},
+		},
+		{
+			name:      "name with reserved query characters",
+			character: "A&B=C+D",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			var gotQuery url.Values
+			var gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotQuery = r.URL.Query()
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+			xiv := NewXivApiClient(testXivApiKey, srv.Client())
+			xiv.rootUrl = srv.URL
+
+			resp, err := xiv.SearchForCharacter(context.Background(), tt.character, tt.params...)
+			if err != nil {
+				t.Fatalf("SearchForCharacter() error = %v", err)
+			}
+			resp.Body.Close()
+			if gotPath != "/character/search" {
+				t.Errorf("path = %s, want /character/search", gotPath)
+			}
+			if got := gotQuery.Get("name"); got != tt.character {
+				t.Errorf("name = %q, want %q", got, tt.character)
+			}
+			for i := 0; i < len(tt.params); i++ {
+				if got := gotQuery.Get(tt.params[i].Name); got != tt.params[i].Value {
+					t.Errorf("%s = %q, want %q", tt.params[i].Name, got, tt.params[i].Value)
+				}
+			}
+			if got := gotQuery.Get("private_key"); got != testXivApiKey {
+				t.Errorf("private_key = %q, want %q", got, testXivApiKey)
+			}
+			if strings.Contains(resp.Request.URL.String(), testXivApiKey) {
+				t.Errorf("response request URL contains the private key: %s", resp.Request.URL)
+			}
+			if strings.Contains(logs.String(), testXivApiKey) {
+				t.Errorf("logs contain the private key: %s", logs.String())
+			}
+		})
+	}
+}
+
+func TestXivApiClient_GetCharacter(t *testing.T) {
+	tests := []struct {
+		name     string
+		xivid    string
+		data     []XivCharacterData
+		wantPath string
+		wantData string
+	}{
+		{
+			name:     "no data",
+			xivid:    "12345",
+			wantPath: "/character/12345",
+		},
+		{
+			name:     "multiple data",
+			xivid:    "12345",
+			data:     []XivCharacterData{XivCharacterDataMountsMinions, XivCharacterDataAchievements},
+			wantPath: "/character/12345",
+			wantData: "MIMO,AC",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery url.Values
+			var gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotQuery = r.URL.Query()
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+			xiv := NewXivApiClient(testXivApiKey, srv.Client())
+			xiv.rootUrl = srv.URL
+
+			resp, err := xiv.GetCharacter(context.Background(), tt.xivid, tt.data...)
+			if err != nil {
+				t.Fatalf("GetCharacter() error = %v", err)
+			}
+			resp.Body.Close()
+			if gotPath != tt.wantPath {
+				t.Errorf("path = %s, want %s", gotPath, tt.wantPath)
+			}
+			if got := gotQuery.Get("data"); got != tt.wantData {
+				t.Errorf("data = %q, want %q", got, tt.wantData)
+			}
+			if got := gotQuery.Get("private_key"); got != testXivApiKey {
+				t.Errorf("private_key = %q, want %q", got, testXivApiKey)
+			}
+		})
+	}
+}
+
+func TestXivGameDataRequest_send(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       XivGameDataRequest
+		body      string
+		wantPath  string
+		wantQuery url.Values
+		want      XivGameData
+	}{
+		{
+			name:      "by game id",
+			req:       XivGameDataRequest{Content: XivGameDataMount, GameID: 42},
+			body:      `{"ID": 42, "Name": "Xanthos", "Icon": "/i/004000/004042.png"}`,
+			wantPath:  "/Mount/42",
+			wantQuery: url.Values{"columns": {xivGameDataColumns}},
+			want:      XivGameData{ID: 42, Name: "Xanthos", Icon: "/i/004000/004042.png"},
+		},
+		{
+			name:      "search picks the exact name",
+			req:       XivGameDataRequest{Content: XivGameDataCompanion, Name: "Wind-up Ixion"},
+			body:      `{"Results": [{"ID": 1, "Name": "Wind-up Ixion Mk II"}, {"ID": 2, "Name": "Wind-up Ixion"}]}`,
+			wantPath:  "/search",
+			wantQuery: url.Values{"indexes": {"Companion"}, "string": {"Wind-up Ixion"}, "string_algo": {"match"}, "columns": {xivGameDataColumns}},
+			want:      XivGameData{ID: 2, Name: "Wind-up Ixion"},
+		},
+		{
+			name:      "search without an exact name",
+			req:       XivGameDataRequest{Content: XivGameDataMount, Name: "Xanthos"},
+			body:      `{"Results": [{"ID": 1, "Name": "Xanthos Barding"}]}`,
+			wantPath:  "/search",
+			wantQuery: url.Values{"indexes": {"Mount"}, "string": {"Xanthos"}, "string_algo": {"match"}, "columns": {xivGameDataColumns}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery url.Values
+			var gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotQuery = r.URL.Query()
+				gotQuery.Del("private_key")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			xiv := NewXivApiClient(testXivApiKey, srv.Client())
+			xiv.rootUrl = srv.URL
+			tt.req.Get = xiv.GetGameData
+			tt.req.Search = xiv.SearchGameData
+
+			resp, err := tt.req.send(context.Background())
+			if err != nil {
+				t.Fatalf("send() error = %v", err)
+			}
+			defer resp.Body.Close()
+			if gotPath != tt.wantPath {
+				t.Errorf("path = %s, want %s", gotPath, tt.wantPath)
+			}
+			if !reflect.DeepEqual(gotQuery, tt.wantQuery) {
+				t.Errorf("query = %v, want %v", gotQuery, tt.wantQuery)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("io.ReadAll() error = %v", err)
+			}
+			got, err := tt.req.decode(body)
+			if err != nil {
+				t.Fatalf("decode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestXivApiClient_errorsDoNotContainKey(t *testing.T) {
+	errTransport := errors.New("transport failure")
+	tests := []struct {
+		name   string
+		client func(srv *httptest.Server) *http.Client
+	}{
+		{
+			name: "transport error that echoes the request URL",
+			client: func(srv *httptest.Server) *http.Client {
+				return &http.Client{
+					Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+						return nil, fmt.Errorf("dial %s: %w", req.URL, errTransport)
+					}),
+				}
+			},
+		},
+		{
+			name: "server closed",
+			client: func(srv *httptest.Server) *http.Client {
+				c := srv.Client()
+				srv.Close()
+				return c
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+			xiv := NewXivApiClient(testXivApiKey, tt.client(srv))
+			xiv.rootUrl = srv.URL
+
+			_, err := xiv.SearchForCharacter(context.Background(), "Tataru Taru")
+			if err == nil {
+				t.Fatal("SearchForCharacter() error = nil, want an error")
+			}
+			log.Error(err)
+			if strings.Contains(err.Error(), testXivApiKey) {
+				t.Errorf("SearchForCharacter() error contains the private key: %s", err)
+			}
+			_, err = xiv.GetCharacter(context.Background(), "12345", XivCharacterDataMountsMinions)
+			if err == nil {
+				t.Fatal("GetCharacter() error = nil, want an error")
+			}
+			log.Error(err)
+			if strings.Contains(err.Error(), testXivApiKey) {
+				t.Errorf("GetCharacter() error contains the private key: %s", err)
+			}
+			if strings.Contains(logs.String(), testXivApiKey) {
+				t.Errorf("logs contain the private key: %s", logs.String())
+			}
+		})
+	}
+}
+
+func TestXivApiClient_doesNotModifyCallerClient(t *testing.T) {
+	client := &http.Client{}
+	NewXivApiClient(testXivApiKey, client)
+	if client.Transport != nil {
+		t.Errorf("caller's client transport was replaced")
+	}
+}
@@ -1,31 +1,45 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"time"
 
-	"github.com/disgoorg/log"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 )
 
-func xivapiCollectCharacterSearchResponses(requests []XivCharacterSearchRequest) ([]XivCharacterSearch, error) {
+// the catalog only changes with new game content, which makes a daily check plenty
+const collectibleCatalogValidationInterval = time.Duration(24) * time.Hour
+
+func xivapiCollectCharacterSearchResponses(ctx context.Context, requests []XivCharacterSearchRequest) ([]XivCharacterSearch, error) {
+	logger := loggerFromContext(ctx)
 	responses := make([]XivCharacterSearch, len(requests))
 	for i := 0; i < len(requests); i++ {
 		var tokenMap XivApiTokenMap
+		req := requests[i]
 		go func() {
-			xivapiLodestoneReqs <- requests[i]
+			select {
+			case xivapiLodestoneReqs <- req:
+			case <-ctx.Done():
+			}
 		}()
 		// collect the token map
 		maxIters := 1000
 		iters := 0
-		log.Debugf("waiting for token map for character %s", requests[i].Name)
+		logger.WithField("request_token", requests[i].Token).Debug("waiting for token map")
 		for {
 			if iters == maxIters {
 				return nil, fmt.Errorf("max iterations hit while waiting for xivapi token map")
 			}
 			// wait for token
-			tMap := <-xivapiLodestoneReqTokens
+			var tMap XivApiTokenMap
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("waiting for xivapi token map error: [%w]", ctx.Err())
+			case tMap = <-xivapiLodestoneReqTokens:
+			}
 			// check if this is the corresponding token map to the request that was sent
 			if tMap.RequestToken != requests[i].Token {
 				// send it back through the channel
@@ -40,13 +54,18 @@ func xivapiCollectCharacterSearchResponses(requests []XivCharacterSearchRequest)
 		}
 		iters = 0
 		// collect the response
-		log.Debugf("waiting for search response for character %s", requests[i].Name)
+		logger.WithField("request_token", requests[i].Token).Debug("waiting for search response")
 		for {
 			if iters == maxIters {
 				return nil, fmt.Errorf("max iterations hit while waiting for xivapi token map")
 			}
 			// wait for the response
-			r := <-xivapiLodestoneResps
+			var r map[XivApiTokenMap]interface{}
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("waiting for xivapi response error: [%w]", ctx.Err())
+			case r = <-xivapiLodestoneResps:
+			}
 			// check if this is the corresponding response
 			if respVal, ok := r[tokenMap]; ok {
 				responses[i] = respVal.(XivCharacterSearch)
@@ -63,12 +82,16 @@ func xivapiCollectCharacterSearchResponses(requests []XivCharacterSearchRequest)
 	return responses, nil
 }
 
-func xivapiCollectCharacterResponses(requests []XivCharacterRequest) ([]XivCharacter, error) {
+func xivapiCollectCharacterResponses(ctx context.Context, requests []XivCharacterRequest) ([]XivCharacter, error) {
 	responses := make([]XivCharacter, len(requests))
 	for i := 0; i < len(requests); i++ {
 		var tokenMap XivApiTokenMap
+		req := requests[i]
 		go func() {
-			xivapiLodestoneReqs <- requests[i]
+			select {
+			case xivapiLodestoneReqs <- req:
+			case <-ctx.Done():
+			}
 		}()
 		// collect the token map
 		maxIters := 1000
@@ -78,7 +101,12 @@ func xivapiCollectCharacterResponses(requests []XivCharacterRequest) ([]XivChara
 				return nil, fmt.Errorf("max iterations hit while waiting for xivapi token map")
 			}
 			// wait for token
-			tMap := <-xivapiLodestoneReqTokens
+			var tMap XivApiTokenMap
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("waiting for xivapi token map error: [%w]", ctx.Err())
+			case tMap = <-xivapiLodestoneReqTokens:
+			}
 			// check if this is the corresponding token map to the request that was sent
 			if tMap.RequestToken != requests[i].Token {
 				// send it back through the channel
@@ -98,7 +126,12 @@ func xivapiCollectCharacterResponses(requests []XivCharacterRequest) ([]XivChara
 				return nil, fmt.Errorf("max iterations hit while waiting for xivapi token map")
 			}
 			// wait for the response
-			r := <-xivapiLodestoneResps
+			var r map[XivApiTokenMap]interface{}
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("waiting for xivapi response error: [%w]", ctx.Err())
+			case r = <-xivapiLodestoneResps:
+			}
 			// check if this is the corresponding response
 			if respVal, ok := r[tokenMap]; ok {
 				responses[i] = respVal.(XivCharacter)
@@ -115,133 +148,281 @@ func xivapiCollectCharacterResponses(requests []XivCharacterRequest) ([]XivChara
 	return responses, nil
 }
 
-func xivapiScanForCharacterIDs() {
+func xivapiCollectGameDataResponses(ctx context.Context, requests []XivGameDataRequest) ([]XivGameData, error) {
+	responses := make([]XivGameData, len(requests))
+	for i := 0; i < len(requests); i++ {
+		var tokenMap XivApiTokenMap
+		req := requests[i]
+		go func() {
+			select {
+			case xivapiLodestoneReqs <- req:
+			case <-ctx.Done():
+			}
+		}()
+		// collect the token map
+		maxIters := 1000
+		iters := 0
+		for {
+			if iters == maxIters {
+				return nil, fmt.Errorf("max iterations hit while waiting for xivapi token map")
+			}
+			// wait for token
+			var tMap XivApiTokenMap
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("waiting for xivapi token map error: [%w]", ctx.Err())
+			case tMap = <-xivapiLodestoneReqTokens:
+			}
+			// check if this is the corresponding token map to the request that was sent
+			if tMap.RequestToken != requests[i].Token {
+				// send it back through the channel
+				go func() {
+					xivapiLodestoneReqTokens <- tMap
+				}()
+			} else {
+				tokenMap = tMap
+				break
+			}
+			iters++
+		}
+		iters = 0
+		// collect the response
+		for {
+			if iters == maxIters {
+				return nil, fmt.Errorf("max iterations hit while waiting for xivapi token map")
+			}
+			// wait for the response
+			var r map[XivApiTokenMap]interface{}
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("waiting for xivapi response error: [%w]", ctx.Err())
+			case r = <-xivapiLodestoneResps:
+			}
+			// check if this is the corresponding response
+			if respVal, ok := r[tokenMap]; ok {
+				responses[i] = respVal.(XivGameData)
+				break
+			} else {
+				// send it back through the channel
+				go func() {
+					xivapiLodestoneResps <- r
+				}()
+			}
+			iters++
+		}
+	}
+	return responses, nil
+}
+
+// xivapiValidateCollectibleCatalog validates the collectible catalog once a day, so
+// collectibles added to the catalog get their game data without a restart
+func xivapiValidateCollectibleCatalog(ctx context.Context) error {
 	for {
-		dbcon, err := dbpool.Acquire(ctx)
+		start := time.Now()
+		logger := jobLogger("collectible_catalog_validation")
+		err := validateCollectibleCatalog(withLogger(ctx, logger))
+		observeScan("collectible_catalog", start, err)
 		if err != nil {
-			log.Error(err)
-			dbcon.Release()
-			<-time.After(xivapiCharacterScanSleepDuration)
+			logger.Error(err)
+		}
+		if sleepContext(ctx, collectibleCatalogValidationInterval) != nil {
+			return nil
+		}
+	}
+}
+
+// validateCollectibleCatalog looks up every collectible in the XIVAPI game data. the game
+// IDs, icons and names in other languages that are found are saved, and the collectibles
+// that do not resolve to a real row are reported.
+func validateCollectibleCatalog(ctx context.Context) error {
+	logger := loggerFromContext(ctx)
+	collectibles, err := getCollectibles(ctx)
+	if err != nil {
+		return fmt.Errorf("getCollectibles() error: [%w]", err)
+	}
+	requests := make([]XivGameDataRequest, len(collectibles))
+	for i := 0; i < len(collectibles); i++ {
+		requests[i] = XivGameDataRequest{
+			Token:   uuid.New().String(),
+			Content: collectibles[i].Type.gameDataContent(),
+			GameID:  collectibles[i].GameID,
+			Name:    string(collectibles[i].Name),
+			Get:     xivapiClient.GetGameData,
+			Search:  xivapiClient.SearchGameData,
+		}
+	}
+	rows, err := xivapiCollectGameDataResponses(ctx, requests)
+	if err != nil {
+		return fmt.Errorf("xivapiCollectGameDataResponses() error: [%w]", err)
+	}
+	unresolved := 0
+	for i := 0; i < len(collectibles); i++ {
+		c := collectibles[i]
+		problem := catalogProblem(c, rows[i])
+		if problem != "" {
+			unresolved++
+			logger.WithFields(logrus.Fields{
+				"collectible_id":   c.ID,
+				"collectible_type": c.Type,
+				"collectible_name": c.Name,
+			}).Warnf("collectible does not resolve to the game data: %s", problem)
 			continue
 		}
-		// get all members that have null xiv character IDs and create requests
-		query := `
+		for lang, name := range rows[i].localizedNames() {
+			if lang == LanguageEnglish {
+				continue
+			}
+			_, err = dbpool.Exec(
+				ctx,
+				`
+				insert into bot.collectible_localized_name(collectible_id, language, collectible_name)
+				values($1, $2, $3)
+				on conflict (collectible_id, language) do update set collectible_name = excluded.collectible_name
+				`,
+				string(c.ID),
+				string(lang),
+				name,
+			)
+			if err != nil {
+				return fmt.Errorf("upsert bot.collectible_localized_name error; collectible_id=%s: [%w]", c.ID, err)
+			}
+		}
+		if c.GameID == rows[i].ID && c.Icon != "" {
+			continue
+		}
+		icon := ""
+		if rows[i].Icon != "" {
+			icon = XivApiRootUrl + rows[i].Icon
+		}
+		_, err = dbpool.Exec(
+			ctx,
+			`update bot.collectible_metadata set game_id=$1, icon_url=coalesce(icon_url, nullif($2, '')) where collectible_id=$3`,
+			int32(rows[i].ID),
+			icon,
+			string(c.ID),
+		)
+		if err != nil {
+			return fmt.Errorf("update bot.collectible_metadata error; collectible_id=%s: [%w]", c.ID, err)
+		}
+	}
+	logger.Infof("collectible catalog validated, %d of %d collectibles do not resolve", unresolved, len(collectibles))
+	return nil
+}
+
+func xivapiCharacterIDScan(ctx context.Context) error {
+	logger := loggerFromContext(ctx)
+	dbcon, err := dbpool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("database connection acquire error: [%w]", err)
+	}
+	defer dbcon.Release()
+	// get all members that have null xiv character IDs and create requests
+	query := `
 		select
 			member_discord_id,
 			member_name
 		from bot.member_metadata
 		where member_xiv_id is null
 		order by member_name
-		`
-		rows, err := dbcon.Query(
-			ctx,
-			query,
-		)
+	`
+	rows, err := dbcon.Query(
+		ctx,
+		query,
+	)
+	if err != nil {
+		return fmt.Errorf("get members without character ids error: [%w]", err)
+	}
+	reqMap := map[string]XivCharacterSearchRequest{}
+	requests := []XivCharacterSearchRequest{}
+	for rows.Next() {
+		var memberID string
+		var membername string
+		err = rows.Scan(&memberID, &membername)
 		if err != nil {
-			log.Error(err)
-			dbcon.Release()
-			<-time.After(xivapiCharacterScanSleepDuration)
-			continue
+			rows.Close()
+			return fmt.Errorf("row scan error: [%w]", err)
 		}
-		reqMap := map[string]XivCharacterSearchRequest{}
-		requests := []XivCharacterSearchRequest{}
-		hasErr := false
-		for rows.Next() {
-			var memberID string
-			var membername string
-			err = rows.Scan(&memberID, &membername)
-			if err != nil {
-				hasErr = true
-				break
-			}
-			req := XivCharacterSearchRequest{
-				Token: uuid.New().String(),
-				Name:  membername,
-				Params: []XivApiQueryParam{
-					{
-						Name:  "server",
-						Value: "Behemoth",
-					},
+		req := XivCharacterSearchRequest{
+			Token: uuid.New().String(),
+			Name:  membername,
+			Params: []XivApiQueryParam{
+				{
+					Name:  "server",
+					Value: "Behemoth",
 				},
-				Do: xivapiClient.SearchForCharacter,
+			},
+			Do: xivapiClient.SearchForCharacter,
+		}
+		reqMap[memberID] = req
+		requests = append(requests, req)
+	}
+	logger.Debug("created character name search requests")
+	logger.Debugf("# of character name search requests: %d", len(requests))
+	if len(requests) == 0 {
+		return nil
+	}
+	// send requests and collect responses
+	logger.Debug("sending requests")
+	responses, err := xivapiCollectCharacterSearchResponses(ctx, requests)
+	if err != nil {
+		return fmt.Errorf("xivapiCollectCharacterSearchResponses() error: [%w]", err)
+	}
+	logger.Debug("responses collected")
+	// discord ID -> xiv character ID
+	xivCharIDMap := map[string]string{}
+	// determine if the character was found
+	for i := 0; i < len(responses); i++ {
+		characterProfiles := responses[i].Results
+		for discordUserID, charSearchReq := range reqMap {
+			for j := 0; j < len(characterProfiles); j++ {
+				if characterProfiles[j].Name == charSearchReq.Name {
+					xivCharIDMap[discordUserID] = strconv.FormatUint(uint64(characterProfiles[j].ID), 10)
+					break
+				}
 			}
-			reqMap[memberID] = req
-			requests = append(requests, req)
 		}
-		log.Debug("created character name search requests")
-		log.Debugf("# of character name search requests: %d", len(requests))
-		if hasErr {
-			log.Error(err)
-			dbcon.Release()
-			<-time.After(xivapiCharacterScanSleepDuration)
-			continue
+	}
+	logger.Debugf("unpacked %d responses", len(xivCharIDMap))
+	if len(xivCharIDMap) > 0 {
+		// update the members where their xiv character ID was found
+		tx, err := dbcon.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("dbcon.Begin() error: [%w]", err)
 		}
-		if len(requests) == 0 {
-			dbcon.Release()
-			<-time.After(xivapiCharacterScanSleepDuration)
-			continue
+		defer tx.Rollback(ctx)
+		for discordUserID, xivCharacterID := range xivCharIDMap {
+			_, err = tx.Exec(
+				ctx,
+				`update bot.member_metadata set member_xiv_id=$1, member_xiv_id_verified=false where member_discord_id=$2`,
+				xivCharacterID,
+				discordUserID,
+			)
+			if err != nil {
+				return fmt.Errorf("update bot.member_metadata error; member_discord_id=%s: [%w]", discordUserID, err)
+			}
 		}
-		// send requests and collect responses
-		log.Debug("sending requests")
-		responses, err := xivapiCollectCharacterSearchResponses(requests)
-		log.Debug("responses collected")
+		err = tx.Commit(ctx)
 		if err != nil {
-			log.Error(err)
-			dbcon.Release()
-			<-time.After(xivapiCharacterScanSleepDuration)
-			continue
+			return fmt.Errorf("tx.Commit() error: [%w]", err)
 		}
-		// discord ID -> xiv character ID
-		xivCharIDMap := map[string]string{}
-		// determine if the character was found
-		for i := 0; i < len(responses); i++ {
-			characterProfiles := responses[i].Results
-			for discordUserID, charSearchReq := range reqMap {
-				for j := 0; j < len(characterProfiles); j++ {
-					if characterProfiles[j].Name == charSearchReq.Name {
-						xivCharIDMap[discordUserID] = strconv.FormatUint(uint64(characterProfiles[j].ID), 10)
-						break
-					}
-				}
-			}
+		characterIDScanFoundTotal.Add(float64(len(xivCharIDMap)))
+		logger.Debugf("%d member character ids updated from auto-character ID search", len(xivCharIDMap))
+	}
+	logger.Debug("auto-character ID seach successfully completed")
+	return nil
+}
+
+func xivapiScanForCharacterIDs(ctx context.Context) error {
+	for {
+		start := time.Now()
+		logger := jobLogger("character_id_scan")
+		err := xivapiCharacterIDScan(withLogger(ctx, logger))
+		observeScan("character_id", start, err)
+		if err != nil {
+			logger.Error(err)
 		}
-		log.Debugf("unpacked %d responses", len(xivCharIDMap))
-		if len(xivCharIDMap) > 0 {
-			// update the members where their xiv character ID was found
-			tx, err := dbcon.Begin(ctx)
-			if err != nil {
-				log.Error(err)
-				dbcon.Release()
-				<-time.After(xivapiCharacterScanSleepDuration)
-				continue
-			}
-			hasErr = false
-			for discordUserID, xivCharacterID := range xivCharIDMap {
-				_, err = tx.Exec(
-					ctx,
-					`update bot.member_metadata set member_xiv_id=$1 where member_discord_id=$2`,
-					xivCharacterID,
-					discordUserID,
-				)
-				if err != nil {
-					hasErr = true
-					break
-				}
-			}
-			if hasErr {
-				log.Error(err)
-				dbcon.Release()
-				<-time.After(xivapiCharacterScanSleepDuration)
-				continue
-			}
-			err = tx.Commit(ctx)
-			if err != nil {
-				log.Error(err)
-			}
-			log.Debugf("%d member character ids updated from auto-character ID search", len(xivCharIDMap))
+		if sleepContext(ctx, getBotConfig().CharacterScanInterval) != nil {
+			return nil
 		}
-		log.Debug("auto-character ID seach successfully completed")
-		dbcon.Release()
-		<-time.After(xivapiCharacterScanSleepDuration)
 	}
 }